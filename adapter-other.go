@@ -0,0 +1,196 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// The rule Dolphin's documentation gives for the adapter, installed by adapter check -fix
+const (
+	gcAdapterRulePath = "/etc/udev/rules.d/51-gcadapter.rules"
+	gcAdapterRule     = `SUBSYSTEM=="usb", ENV{DEVTYPE}=="usb_device", ATTRS{idVendor}=="057e", ATTRS{idProduct}=="0337", MODE="0666"` + "\n"
+)
+
+var udevRuleDirs = []string{"/etc/udev/rules.d", "/run/udev/rules.d", "/lib/udev/rules.d", "/usr/lib/udev/rules.d"}
+
+// findAdapterRule returns the udev rules file that matches the adapter, if any
+func findAdapterRule() string {
+	for _, dir := range udevRuleDirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+
+			for _, line := range strings.Split(strings.ToLower(string(contents)), "\n") {
+				if !strings.HasPrefix(strings.TrimSpace(line), "#") && strings.Contains(line, gcAdapterVendorID) && strings.Contains(line, gcAdapterProductID) {
+					return path
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// findAdapterDevices returns the usbfs nodes of the connected adapters
+func findAdapterDevices() []string {
+	devices := []string{}
+
+	dirs, _ := filepath.Glob("/sys/bus/usb/devices/*")
+	for _, dir := range dirs {
+		vendor, _ := ioutil.ReadFile(filepath.Join(dir, "idVendor"))
+		product, _ := ioutil.ReadFile(filepath.Join(dir, "idProduct"))
+		if strings.TrimSpace(string(vendor)) != gcAdapterVendorID || strings.TrimSpace(string(product)) != gcAdapterProductID {
+			continue
+		}
+
+		bus, _ := ioutil.ReadFile(filepath.Join(dir, "busnum"))
+		device, _ := ioutil.ReadFile(filepath.Join(dir, "devnum"))
+		var busNumber, deviceNumber int
+		fmt.Sscan(string(bus), &busNumber)
+		fmt.Sscan(string(device), &deviceNumber)
+		devices = append(devices, fmt.Sprintf("/dev/bus/usb/%03d/%03d", busNumber, deviceNumber))
+	}
+
+	return devices
+}
+
+// findMacAdapter looks through the USB tree system_profiler reports for the adapter
+func findMacAdapter() (bool, error) {
+	output, err := exec.Command("system_profiler", "SPUSBDataType", "-json").Output()
+	if err != nil {
+		return false, err
+	}
+
+	var tree interface{}
+	err = json.Unmarshal(output, &tree)
+	if err != nil {
+		return false, err
+	}
+
+	var walk func(node interface{}) bool
+	walk = func(node interface{}) bool {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			vendor, _ := node["vendor_id"].(string)
+			product, _ := node["product_id"].(string)
+			if strings.HasPrefix(strings.ToLower(vendor), "0x"+gcAdapterVendorID) && strings.HasPrefix(strings.ToLower(product), "0x"+gcAdapterProductID) {
+				return true
+			}
+			for _, child := range node {
+				if walk(child) {
+					return true
+				}
+			}
+		case []interface{}:
+			for _, child := range node {
+				if walk(child) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return walk(tree), nil
+}
+
+const gcAdapterNotConnected = "The adapter isn't connected. Plug in both of its USB plugs, the black one powers rumble, and set its switch to Wii U"
+
+// detectGCAdapter finds the adapter. macOS needs no driver, Linux needs Dolphin to be allowed to
+// open the device, which is what the udev rule does
+func detectGCAdapter() (gcAdapterStatus, error) {
+	status := gcAdapterStatus{Problems: []string{}}
+
+	if runtime.GOOS == "darwin" {
+		connected, err := findMacAdapter()
+		if err != nil {
+			return status, err
+		}
+
+		status.Connected = connected
+		status.DriverOK = true
+		if !connected {
+			status.Problems = append(status.Problems, gcAdapterNotConnected)
+		}
+		return status, nil
+	}
+
+	status.Rule = findAdapterRule()
+	devices := findAdapterDevices()
+	status.Connected = len(devices) > 0
+
+	switch {
+	case !status.Connected:
+		status.DriverOK = status.Rule != ""
+		status.Problems = append(status.Problems, gcAdapterNotConnected)
+	default:
+		status.DriverOK = true
+		for _, device := range devices {
+			// R_OK | W_OK, libusb opens the device for both
+			if syscall.Access(device, 0x6) != nil {
+				status.DriverOK = false
+			}
+		}
+	}
+
+	switch {
+	case status.DriverOK:
+	case status.Rule == "":
+		status.Problems = append(status.Problems, "Dolphin isn't allowed to open the adapter. Run sudo dolphin-slippi-tools adapter check -fix to install the udev rule")
+	default:
+		status.Problems = append(status.Problems, fmt.Sprintf("Dolphin isn't allowed to open the adapter even though %s exists. Unplug the adapter and plug it back in", status.Rule))
+	}
+
+	return status, nil
+}
+
+// fixGCAdapterDriver installs the udev rule and has udev apply it to adapters already plugged in
+func fixGCAdapterDriver(status gcAdapterStatus) ([]string, error) {
+	if runtime.GOOS == "darwin" {
+		return []string{}, nil
+	}
+
+	fixed := []string{}
+	if status.Rule == "" {
+		err := ioutil.WriteFile(gcAdapterRulePath, []byte(gcAdapterRule), 0644)
+		if os.IsPermission(err) {
+			return fixed, errors.New("installing the udev rule needs root, run the command with sudo")
+		}
+		if os.IsNotExist(err) {
+			return fixed, fmt.Errorf("%s doesn't exist, is udev installed?", filepath.Dir(gcAdapterRulePath))
+		}
+		if err != nil {
+			return fixed, err
+		}
+		fixed = append(fixed, "Installed "+gcAdapterRulePath)
+	}
+
+	for _, args := range [][]string{{"control", "--reload-rules"}, {"trigger", "--subsystem-match=usb"}} {
+		output, err := exec.Command("udevadm", args...).CombinedOutput()
+		if err != nil {
+			return fixed, fmt.Errorf("udevadm %s failed. %s %s", args[0], err.Error(), strings.TrimSpace(string(output)))
+		}
+	}
+	fixed = append(fixed, "Reloaded the udev rules")
+
+	return fixed, nil
+}
@@ -0,0 +1,83 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Lists the adapter's device with the driver service bound to it
+const adapterListScript = `
+$devices = @(Get-CimInstance Win32_PnPEntity | Where-Object { $_.DeviceID -like 'USB\VID_057E&PID_0337*' } | ForEach-Object {
+	[pscustomobject]@{
+		deviceId = $_.DeviceID
+		service = [string]$_.Service
+		errorCode = [int]$_.ConfigManagerErrorCode
+	}
+})
+ConvertTo-Json -Compress -InputObject $devices
+`
+
+// Drivers libusb, and so Dolphin, can open the adapter through
+var gcAdapterDrivers = []string{"WinUSB", "libusbK", "libusb0"}
+
+const gcAdapterZadigGuide = "Install the WinUSB driver with Zadig (https://zadig.akeo.ie): pick Options > List All Devices, select WUP-028, choose WinUSB and click Replace Driver"
+
+// detectGCAdapter finds the adapter and the driver Windows bound to it. Out of the box that is the
+// HID driver, which Dolphin can't use
+func detectGCAdapter() (gcAdapterStatus, error) {
+	status := gcAdapterStatus{Problems: []string{}}
+
+	output, err := runPowerShell(adapterListScript)
+	if err != nil {
+		return status, err
+	}
+
+	var devices []struct {
+		DeviceID  string `json:"deviceId"`
+		Service   string `json:"service"`
+		ErrorCode int    `json:"errorCode"`
+	}
+	output = bytes.TrimSpace(output)
+	if len(output) > 0 {
+		err = json.Unmarshal(output, &devices)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	if len(devices) == 0 {
+		status.Problems = append(status.Problems, "The adapter isn't connected. Plug in both of its USB plugs, the black one powers rumble, and set its switch to Wii U")
+		return status, nil
+	}
+
+	device := devices[0]
+	status.Connected = true
+	status.Driver = device.Service
+	status.DriverOK = containsFold(gcAdapterDrivers, device.Service) && device.ErrorCode == 0
+
+	switch {
+	case status.DriverOK:
+	case strings.EqualFold(device.Service, "HidUsb"):
+		status.Problems = append(status.Problems, "Windows uses its HID driver for the adapter, which Dolphin can't open. Make sure the switch is set to Wii U, then "+gcAdapterZadigGuide)
+	case device.ErrorCode != 0:
+		status.Problems = append(status.Problems, "Windows reports a problem with the adapter's driver. "+gcAdapterZadigGuide)
+	default:
+		status.Problems = append(status.Problems, "The adapter has no driver Dolphin can use. "+gcAdapterZadigGuide)
+	}
+
+	return status, nil
+}
+
+// fixGCAdapterDriver can't replace drivers, that needs Zadig's signed driver package
+func fixGCAdapterDriver(status gcAdapterStatus) ([]string, error) {
+	if !status.Connected {
+		return []string{}, nil
+	}
+
+	return nil, errors.New(gcAdapterZadigGuide)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// The official GameCube controller adapter for Wii U (WUP-028) and the clones of it
+const (
+	gcAdapterVendorID  = "057e"
+	gcAdapterProductID = "0337"
+
+	// SIDevice value of a port that reads its controller from the adapter
+	siDeviceAdapter = "12"
+)
+
+// gcAdapterStatus is what adapter check found. Problems tell the user what to do about each issue
+type gcAdapterStatus struct {
+	Connected bool   `json:"connected"`
+	Driver    string `json:"driver,omitempty"`
+	DriverOK  bool   `json:"driverOk"`
+	// Rule is the udev rule giving access to the adapter on Linux
+	Rule     string   `json:"rule,omitempty"`
+	Ports    []int    `json:"ports"`
+	Problems []string `json:"problems"`
+	Fixed    []string `json:"fixed"`
+}
+
+type gcAdapterEvent struct {
+	Type string `json:"type"`
+	gcAdapterStatus
+}
+
+// adapterPorts returns the controller ports, counted from 1, that Dolphin reads from the adapter
+func adapterPorts(userDir string) ([]int, error) {
+	config, err := readDolphinConfig(userDir, "Dolphin")
+	if err != nil {
+		return nil, err
+	}
+
+	ports := []int{}
+	for i := 0; i < 4; i++ {
+		if value, _ := config.section("[Core]").value("SIDevice" + strconv.Itoa(i)); value == siDeviceAdapter {
+			ports = append(ports, i+1)
+		}
+	}
+
+	return ports, nil
+}
+
+// execAdapter checks that the adapter is connected, that Dolphin can open it and that a port uses
+// it. With fix the Linux udev rule is installed and port 1 is set to the adapter when none is
+func execAdapter(cfg toolsConfig, userDir string, fix bool) (status gcAdapterStatus, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered checking the GameCube adapter")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	status, err := detectGCAdapter()
+	if err != nil {
+		log.Panicf("Failed to look for the adapter. %s", err.Error())
+	}
+
+	fixed := []string{}
+	if fix && !status.DriverOK {
+		fixed, err = fixGCAdapterDriver(status)
+		if err != nil {
+			failf(exitNotWritable, "Failed to set up the adapter. %s", err.Error())
+		}
+
+		status, err = detectGCAdapter()
+		if err != nil {
+			log.Panicf("Failed to look for the adapter. %s", err.Error())
+		}
+	}
+	status.Fixed = fixed
+
+	status.Ports, err = adapterPorts(userDir)
+	if err != nil {
+		log.Panicf("Failed to read the Dolphin config. %s", err.Error())
+	}
+	// Under sudo the user folder would be root's, the rule is all that should be fixed as root
+	if len(status.Ports) == 0 && fix && os.Geteuid() != 0 {
+		err = setDolphinSetting(userDir, dolphinSetting{File: "Dolphin", Section: "Core", Key: "SIDevice0", Value: siDeviceAdapter})
+		if err != nil {
+			failf(exitNotWritable, "Failed to set port 1 to the adapter. %s", err.Error())
+		}
+		status.Ports = []int{1}
+		status.Fixed = append(status.Fixed, "Set port 1 to the GameCube adapter")
+	}
+	if len(status.Ports) == 0 {
+		status.Problems = append(status.Problems, "No port uses the adapter, run adapter check -fix or set a port to GameCube Adapter for Wii U in Dolphin's controller settings")
+	}
+
+	switch {
+	case !status.Connected:
+		fmt.Println("Adapter:  not connected")
+	case status.Driver != "":
+		fmt.Printf("Adapter:  connected, driver %s\n", status.Driver)
+	default:
+		fmt.Println("Adapter:  connected")
+	}
+	if status.Rule != "" {
+		fmt.Printf("udev:     %s\n", status.Rule)
+	}
+	fmt.Printf("Ports:    %v\n", status.Ports)
+	for _, fixed := range status.Fixed {
+		fmt.Printf("Fixed: %s\n", fixed)
+	}
+
+	if len(status.Problems) == 0 {
+		fmt.Println("The adapter is ready")
+		return status, nil
+	}
+	for _, problem := range status.Problems {
+		fmt.Printf("- %s\n", problem)
+	}
+
+	// The status is what a failure is about, it goes out as an event before the error
+	if jsonOutput {
+		emitEvent(gcAdapterEvent{Type: "adapter", gcAdapterStatus: status})
+	}
+	failf(exitVerification, "The adapter isn't ready, %d problems found", len(status.Problems))
+	return status, nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// listAntivirusProducts finds nothing, antivirus products rarely get in the way of updates here
+func listAntivirusProducts() ([]string, error) {
+	return []string{}, nil
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Security Center knows the antivirus products registered with Windows, it only exists on
+// desktop editions
+const antivirusListScript = `
+$products = @(Get-CimInstance -Namespace root/SecurityCenter2 -ClassName AntiVirusProduct | ForEach-Object { $_.displayName })
+ConvertTo-Json -Compress -InputObject $products
+`
+
+func listAntivirusProducts() ([]string, error) {
+	output, err := runPowerShell(antivirusListScript)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []string{}
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return products, nil
+	}
+
+	err = json.Unmarshal(output, &products)
+	return products, err
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// Windows error for a file another process, usually an antivirus scanning it, has open
+const errorSharingViolation = syscall.Errno(32)
+
+// antivirusReport is what went wrong with which file and what the user can do about it
+type antivirusReport struct {
+	Path string `json:"path"`
+	// Reason is blocked when Windows said an antivirus refused the file, quarantined when the
+	// file disappeared and locked when we weren't allowed to write it
+	Reason   string   `json:"reason"`
+	Products []string `json:"products"`
+	Steps    []string `json:"steps"`
+}
+
+type antivirusEvent struct {
+	Type string `json:"type"`
+	antivirusReport
+}
+
+// antivirusGuides are the steps for the products Dolphin is most often flagged by, matched on
+// the name Windows Security Center reports. %s is the install
+var antivirusGuides = []struct {
+	match string
+	steps []string
+}{
+	{"defender", []string{
+		"Open Windows Security > Virus & threat protection > Protection history and restore the Dolphin file if it's listed",
+		"Under Virus & threat protection settings > Manage settings > Exclusions, add the folder %s",
+	}},
+	{"avast", []string{
+		"Open Avast > Protection > Virus Chest and restore the Dolphin file if it's listed",
+		"Under Menu > Settings > General > Exceptions, add the folder %s",
+	}},
+	{"avg", []string{
+		"Open AVG > Menu > Quarantine and restore the Dolphin file if it's listed",
+		"Under Menu > Settings > General > Exceptions, add the folder %s",
+	}},
+	{"norton", []string{
+		"Open Norton > Security > History, show Quarantine and restore the Dolphin file if it's listed",
+		"Under Settings > Antivirus > Scans and Risks > Items to Exclude from Scans, add the folder %s",
+	}},
+	{"mcafee", []string{
+		"Open McAfee > Quarantined Items and restore the Dolphin file if it's listed",
+		"Under Real-Time Scanning > Excluded Files, add the folder %s",
+	}},
+	{"bitdefender", []string{
+		"Open Bitdefender > Protection > Antivirus > Quarantine and restore the Dolphin file if it's listed",
+		"Under Protection > Antivirus > Settings > Manage exceptions, add the folder %s",
+	}},
+	{"kaspersky", []string{
+		"Open Kaspersky > Quarantine and restore the Dolphin file if it's listed",
+		"Under Settings > Security settings > Exclusions, add the folder %s",
+	}},
+	{"malwarebytes", []string{
+		"Open Malwarebytes > Detection History > Quarantine and restore the Dolphin file if it's listed",
+		"Under Settings > Allow List, add the folder %s",
+	}},
+	{"eset", []string{
+		"Open ESET > Tools > Quarantine and restore the Dolphin file if it's listed",
+		"Under Setup > Computer protection > Exclusions, add the folder %s",
+	}},
+}
+
+var genericAntivirusSteps = []string{
+	"Restore the Dolphin file from your antivirus' quarantine if it's listed there",
+	"Add an exception for the folder %s to your antivirus",
+}
+
+// isFileLocked tells whether we weren't allowed to write a file, which during an update mostly
+// means an antivirus is holding or scanning it
+func isFileLocked(err error) bool {
+	var errno syscall.Errno
+	if runtime.GOOS == "windows" && errors.As(err, &errno) && errno == errorSharingViolation {
+		return true
+	}
+
+	// errors.Is rather than os.IsPermission, the error may come wrapped from retries
+	return errors.Is(err, os.ErrPermission)
+}
+
+// antivirusSteps picks the steps for the installed antivirus products, the generic ones when
+// none of them is known
+func antivirusSteps(products []string, exPath string) []string {
+	steps := []string{}
+	for _, product := range products {
+		for _, guide := range antivirusGuides {
+			if !strings.Contains(strings.ToLower(product), guide.match) {
+				continue
+			}
+			for _, step := range guide.steps {
+				steps = append(steps, fmt.Sprintf("%s: %s", product, fmt.Sprintf(step, exPath)))
+			}
+			break
+		}
+	}
+
+	if len(steps) == 0 {
+		for _, step := range genericAntivirusSteps {
+			steps = append(steps, fmt.Sprintf(step, exPath))
+		}
+	}
+
+	return append(steps, "Run the update again")
+}
+
+// failAntivirus stops the update with the steps to get the antivirus out of the way
+func failAntivirus(exPath, path, reason string) {
+	products, err := listAntivirusProducts()
+	if err != nil {
+		logDebugf("Could not list the antivirus products. %s", err.Error())
+	}
+
+	report := antivirusReport{Path: path, Reason: reason, Products: products, Steps: antivirusSteps(products, exPath)}
+	if report.Products == nil {
+		report.Products = []string{}
+	}
+
+	switch reason {
+	case "blocked":
+		fmt.Printf("Your antivirus blocked %s.\n", path)
+	case "quarantined":
+		fmt.Printf("%s disappeared right after it was written, most likely your antivirus quarantined it.\n", path)
+	default:
+		fmt.Printf("%s couldn't be written, most likely your antivirus is holding it.\n", path)
+	}
+	if len(products) > 0 {
+		fmt.Printf("Antivirus found: %s\n", strings.Join(products, ", "))
+	}
+	for i, step := range report.Steps {
+		fmt.Printf("%d. %s\n", i+1, step)
+	}
+
+	// The report is what the failure is about, it goes out as an event before the error
+	if jsonOutput {
+		emitEvent(antivirusEvent{Type: "antivirus", antivirusReport: report})
+	}
+	failf(exitAntivirus, "The update was stopped by antivirus (%s), nothing was changed", reason)
+}
+
+// failIfAntivirus turns an extraction error an antivirus is behind into the steps to fix it
+func failIfAntivirus(exPath string, err error) {
+	if runtime.GOOS != "windows" {
+		return
+	}
+
+	var pathErr *os.PathError
+	path := exPath
+	if errors.As(err, &pathErr) {
+		path = strings.TrimPrefix(pathErr.Path, `\\?\`)
+	}
+
+	switch {
+	case updater.IsBlockedByAntivirus(err):
+		failAntivirus(exPath, path, "blocked")
+	case isFileLocked(err):
+		failAntivirus(exPath, path, "locked")
+	}
+}
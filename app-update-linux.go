@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// execLinuxAppUpdate updates a Linux install, which is either a single AppImage or an extracted
+// directory build. Each is updated with its matching artifact
+func execLinuxAppUpdate(ctx context.Context, cfg toolsConfig, opts appUpdateOptions) {
+	exPath := cfg.InstallDir
+	appImagePath := findAppImage(exPath)
+	if appImagePath != "" {
+		exPath = filepath.Dir(appImagePath)
+	}
+
+	ensureWritable(exPath)
+
+	// AppImages run from a temporary mount so we can't match them by install path
+	if appImagePath != "" {
+		waitForDolphinClose("")
+	} else {
+		waitForDolphinClose(exPath)
+	}
+	repairBeforeUpdate(exPath)
+
+	latest := getTargetVersion(ctx, cfg, opts)
+	updateTargetVersion = latest.Version
+	if !shouldApplyUpdate(ctx, cfg, opts, exPath, latest) {
+		return
+	}
+	if opts.KeepOldPlayback && appImagePath != "" {
+		keepOldPlayback(exPath, appImagePath, opts.PrevVersion)
+	} else if opts.KeepOldPlayback {
+		keepOldPlayback(exPath, exPath, opts.PrevVersion)
+	}
+
+	// Stage inside the install such that the final rename stays on the same volume
+	dir, err := createStagingDir(cfg.TempDir, exPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	launchPath := ""
+	if appImagePath != "" {
+		if latest.AppImageURL == "" && opts.FromFile == "" {
+			failf(exitNetwork, "No AppImage is available for this version")
+		}
+
+		newAppImagePath := filepath.Join(dir, filepath.Base(appImagePath))
+		if opts.KeepArchive {
+			defer keepArchive(newAppImagePath, opts.ArchivePath, exPath, latest.Version)
+		}
+
+		fetchArtifact(ctx, cfg, opts, newAppImagePath, updater.WithMirrors(latest.AppImageURL, latest.AppImageMirrors), "", latest.AppImageSig, validateAppImage)
+
+		err = os.Chmod(newAppImagePath, 0755)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// Last chance to stop, renaming over the old AppImage is atomic on the same volume
+		failIfCancelled(ctx)
+		err = os.Rename(newAppImagePath, appImagePath)
+		if err != nil {
+			failf(exitInstall, "Failed to replace AppImage. %s", err.Error())
+		}
+
+		files := []updater.UpdatedFile{}
+		if info, err := os.Stat(appImagePath); err == nil {
+			files = append(files, updater.UpdatedFile{Path: filepath.Base(appImagePath), Size: info.Size()})
+		}
+
+		err = writeUpdateManifest(exPath, updateManifest{
+			PrevVersion: opts.PrevVersion,
+			Version:     latest.Version,
+			UpdatedAt:   time.Now(),
+			Files:       files,
+		})
+		if err != nil {
+			log.Printf("Failed to write update manifest. %s\n", err.Error())
+		}
+
+		launchPath = appImagePath
+	} else {
+		if latest.LinuxZipURL == "" && opts.FromFile == "" {
+			failf(exitNetwork, "No Linux archive is available for this version")
+		}
+
+		zipFilePath := filepath.Join(dir, "dolphin.zip")
+		if opts.KeepArchive {
+			defer keepArchive(zipFilePath, opts.ArchivePath, exPath, latest.Version)
+		}
+
+		preflightDiskSpace(ctx, cfg, opts, dir, exPath, updater.WithMirrors(latest.LinuxZipURL, latest.LinuxZipMirrors))
+		fetchArtifact(ctx, cfg, opts, zipFilePath, updater.WithMirrors(latest.LinuxZipURL, latest.LinuxZipMirrors), "", latest.LinuxZipSig, updater.ValidateArchive)
+
+		installArchive(ctx, cfg, exPath, zipFilePath, opts.PrevVersion, latest)
+
+		// Zips don't always carry unix permissions, make sure the binary can run
+		launchPath = findDolphinExe(exPath)
+		err = os.Chmod(launchPath, 0755)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	if cfg.PostUpdateCommand != "" {
+		err = runPostUpdateHook(cfg.PostUpdateCommand, latest.Version)
+		if err != nil && opts.StrictHook {
+			log.Panic(err)
+		} else if err != nil {
+			log.Printf("Warning: %s\n", err.Error())
+		}
+	}
+
+	if opts.ShouldLaunch {
+		cmd := exec.Command(launchPath, "-e", opts.IsoPath)
+		cmd.Dir = exPath
+		if opts.LaunchDir != "" {
+			cmd.Dir = opts.LaunchDir
+		}
+
+		err = startDetached(cmd)
+		if err != nil {
+			log.Panicf("Failed to start Dolphin. %s", err.Error())
+		}
+	}
+}
+
+// findAppImage returns the AppImage being updated, if the install is one. When the tools run from
+// inside an AppImage its runtime tells us the path, otherwise we look next to the tools
+func findAppImage(exPath string) string {
+	if path := os.Getenv("APPIMAGE"); path != "" {
+		return path
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(exPath, "*.AppImage"))
+	if len(matches) > 0 {
+		return matches[0]
+	}
+
+	return ""
+}
+
+func validateAppImage(path string) error {
+	return updater.ValidateFileMagic(path, []byte("\x7fELF"), "download did not return a valid AppImage")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const macBundleName = "Slippi Dolphin.app"
+
+// execMacAppUpdate updates a macOS install. The tools live inside the app bundle so unlike Windows
+// there is no need to update the updater first, the whole bundle is swapped at once
+func execMacAppUpdate(ctx context.Context, cfg toolsConfig, opts appUpdateOptions) {
+	bundlePath := findAppBundle(cfg.InstallDir)
+	installDir := filepath.Dir(bundlePath)
+
+	ensureWritable(installDir)
+
+	waitForDolphinClose(installDir)
+
+	latest := getTargetVersion(ctx, cfg, opts)
+	updateTargetVersion = latest.Version
+	if !shouldApplyUpdate(ctx, cfg, opts, installDir, latest) {
+		return
+	}
+	if latest.MacURL == "" && opts.FromFile == "" {
+		failf(exitNetwork, "No macOS build is available for this version")
+	}
+	if opts.KeepOldPlayback {
+		keepOldPlayback(installDir, bundlePath, opts.PrevVersion)
+	}
+
+	// Stage next to the bundle such that the final rename stays on the same volume
+	dir, err := createStagingDir(cfg.TempDir, installDir)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zipFilePath := filepath.Join(dir, "dolphin.zip")
+	if opts.KeepArchive {
+		defer keepArchive(zipFilePath, opts.ArchivePath, installDir, latest.Version)
+	}
+
+	fetchArtifact(ctx, cfg, opts, zipFilePath, updater.WithMirrors(latest.MacURL, latest.MacMirrors), latest.MacSHA256, latest.MacSignature, updater.ValidateArchive)
+
+	newBundlePath, files, err := extractBundle(ctx, zipFilePath, dir, cfg.extractOptions())
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitInstall, "Failed to extract update. %s", err.Error())
+	}
+
+	// Last chance to stop, replacing the bundle is a single rename
+	failIfCancelled(ctx)
+
+	err = replaceBundle(bundlePath, newBundlePath)
+	if err != nil {
+		failf(exitInstall, "Failed to replace app bundle. %s", err.Error())
+	}
+
+	err = writeUpdateManifest(installDir, updateManifest{
+		PrevVersion: opts.PrevVersion,
+		Version:     latest.Version,
+		UpdatedAt:   time.Now(),
+		Files:       files,
+	})
+	if err != nil {
+		log.Printf("Failed to write update manifest. %s\n", err.Error())
+	}
+
+	if cfg.PostUpdateCommand != "" {
+		err = runPostUpdateHook(cfg.PostUpdateCommand, latest.Version)
+		if err != nil && opts.StrictHook {
+			log.Panic(err)
+		} else if err != nil {
+			log.Printf("Warning: %s\n", err.Error())
+		}
+	}
+
+	if opts.ShouldLaunch {
+		args := []string{"-a", bundlePath}
+		if opts.IsoPath != "" {
+			args = append(args, "--args", "-e", opts.IsoPath)
+		}
+
+		err = exec.Command("open", args...).Run()
+		if err != nil {
+			log.Panicf("Failed to start Dolphin. %s", err.Error())
+		}
+	}
+}
+
+// findAppBundle walks up from the executable to find the .app bundle it lives in. If the tools
+// aren't inside a bundle, the bundle is expected next to them
+func findAppBundle(exPath string) string {
+	for dir := exPath; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if strings.HasSuffix(dir, ".app") {
+			return dir
+		}
+	}
+
+	return filepath.Join(exPath, macBundleName)
+}
+
+// extractBundle extracts the .app bundle in the archive into the target directory. It goes through
+// updater.Extract, which keeps the permissions and links bundles rely on without letting an entry
+// or a link lead out of target
+func extractBundle(ctx context.Context, source, target string, opts updater.ExtractOptions) (string, []updater.UpdatedFile, error) {
+	archive, err := updater.OpenArchiveWithLimits(source, opts.Limits)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Find the bundle root inside the archive
+	bundlePrefix := ""
+	for _, entry := range archive.Entries() {
+		idx := strings.Index(entry.Name, ".app/")
+		if idx != -1 && !strings.HasPrefix(entry.Name, "__MACOSX") {
+			bundlePrefix = entry.Name[:idx+len(".app/")]
+			break
+		}
+	}
+	archive.Close()
+	if bundlePrefix == "" {
+		return "", nil, fmt.Errorf("archive does not contain an app bundle")
+	}
+
+	bundleName := path.Base(strings.TrimSuffix(bundlePrefix, "/"))
+	opts.Root = path.Dir(strings.TrimSuffix(bundlePrefix, "/"))
+	files, err := updater.Extract(ctx, target, source, func(relPath string) string {
+		// Only the bundle, not the __MACOSX metadata or anything else next to it
+		if relPath != bundleName && !strings.HasPrefix(filepath.ToSlash(relPath), bundleName+"/") {
+			return ""
+		}
+		return relPath
+	}, opts)
+	if err != nil {
+		return "", files, err
+	}
+
+	return filepath.Join(target, bundleName), files, nil
+}
+
+// replaceBundle swaps the new bundle into place, restoring the previous one if the swap fails
+func replaceBundle(bundlePath, newBundlePath string) error {
+	oldBundlePath := bundlePath + ".old"
+	os.RemoveAll(oldBundlePath)
+
+	hadBundle := true
+	err := os.Rename(bundlePath, oldBundlePath)
+	if os.IsNotExist(err) {
+		hadBundle = false
+	} else if err != nil {
+		return err
+	}
+
+	err = os.Rename(newBundlePath, bundlePath)
+	if err != nil {
+		if hadBundle {
+			os.Rename(oldBundlePath, bundlePath)
+		}
+		return err
+	}
+
+	return os.RemoveAll(oldBundlePath)
+}
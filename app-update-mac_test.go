@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+func TestExtractBundle(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "dolphin.zip")
+	err := writeZipFiles(source, map[string][]byte{
+		"Slippi Dolphin.app/Contents/MacOS/Slippi Dolphin":         []byte("exe"),
+		"Slippi Dolphin.app/Contents/Resources/Sys/GameSettings/x": []byte("ini"),
+		"__MACOSX/Slippi Dolphin.app/._Contents":                   []byte("resource fork"),
+		"../escape.txt":                                            []byte("evil"),
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "staging")
+	_, _, err = extractBundle(context.Background(), source, target, updater.ExtractOptions{IsDolphinExe: isDolphinExe})
+	if err == nil {
+		t.Fatal("extracting an archive with an escaping entry succeeded")
+	}
+
+	err = writeZipFiles(source, map[string][]byte{
+		"Slippi Dolphin.app/Contents/MacOS/Slippi Dolphin":         []byte("exe"),
+		"Slippi Dolphin.app/Contents/Resources/Sys/GameSettings/x": []byte("ini"),
+		"__MACOSX/Slippi Dolphin.app/._Contents":                   []byte("resource fork"),
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundlePath, files, err := extractBundle(context.Background(), source, target, updater.ExtractOptions{IsDolphinExe: isDolphinExe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundlePath != filepath.Join(target, "Slippi Dolphin.app") {
+		t.Errorf("the bundle is at %s", bundlePath)
+	}
+	if len(files) != 2 {
+		t.Errorf("got files %v, want only the bundle's", files)
+	}
+	if got := readTestFile(t, filepath.Join(bundlePath, "Contents", "MacOS", "Slippi Dolphin")); got != "exe" {
+		t.Errorf("the exe is %q", got)
+	}
+}
@@ -1,69 +1,156 @@
 package main
 
 import (
-	"archive/zip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/machinebox/graphql"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
 )
 
-type gqlResponse struct {
-	DolphinVersion dolphinVersion `json:"getLatestDolphin"`
+// dolphinExeNames lists the executable names a Dolphin build may use, the first one is preferred
+// when launching. Can be overridden with the -dolphin-exe flag
+var dolphinExeNames = defaultDolphinExeNames()
+
+func defaultDolphinExeNames() []string {
+	if runtime.GOOS == "linux" {
+		return []string{"dolphin-emu", "Slippi Dolphin"}
+	}
+
+	return []string{"Slippi Dolphin.exe", "Dolphin.exe"}
 }
 
-type dolphinVersion struct {
-	URL     string `json:"windowsDownloadUrl"`
-	Version string `json:"version"`
+type appUpdateOptions struct {
+	IsFull            bool
+	SkipUpdaterUpdate bool
+	ShouldLaunch      bool
+	IsoPath           string
+	PrevVersion       string
+	KeepArchive       bool
+	ArchivePath       string
+	StrictHook        bool
+	LaunchDir         string
+	Delta             bool
+	JSONProgress      bool
+	NonInteractive    bool
+	TargetVersion     string
+	ConfirmChanges    bool
+	Backup            bool
+	FromFile          string
+	Repair            bool
+	ReplayDir         string
+	KeepOldPlayback   bool
+	Force             bool
 }
 
-func execAppUpdate(isFull, skipUpdaterUpdate, shouldLaunch bool, isoPath, prevVersion string) (returnErr error) {
+type updateManifest struct {
+	PrevVersion string                `json:"prevVersion"`
+	Version     string                `json:"version"`
+	UpdatedAt   time.Time             `json:"updatedAt"`
+	Files       []updater.UpdatedFile `json:"files"`
+}
+
+func execAppUpdate(ctx context.Context, cfg toolsConfig, opts appUpdateOptions) (returnErr error) {
 	defer func() {
 		if r := recover(); r != nil {
-			returnErr = errors.New("Error encountered updating app")
+			returnErr = recoveredError(r, "Error encountered updating app")
 		}
 	}()
 
-	// Get executable path
-	ex, err := os.Executable()
-	if err != nil {
-		log.Panic(err)
+	switch runtime.GOOS {
+	case "darwin":
+		execMacAppUpdate(ctx, cfg, opts)
+		return nil
+	case "linux":
+		execLinuxAppUpdate(ctx, cfg, opts)
+		return nil
 	}
-	exPath := filepath.Dir(ex)
+
+	exPath := cfg.InstallDir
+
+	// Make sure we can write to the install before doing anything destructive
+	ensureWritable(exPath)
 
 	oldSlippiToolsPath := filepath.Join(exPath, "old-dolphin-slippi-tools.exe")
+	heartbeatPath := filepath.Join(exPath, "updater-heartbeat")
+
+	// Let the previous updater know we have started successfully
+	if opts.SkipUpdaterUpdate {
+		ioutil.WriteFile(heartbeatPath, []byte(time.Now().Format(time.RFC3339)), 0644)
+	}
 
 	// If we are doing a full update or if we are done updating the updater, wait for Dolphin to close
-	if isFull || skipUpdaterUpdate {
-		waitForDolphinClose()
+	if opts.IsFull || opts.SkipUpdaterUpdate {
+		waitForDolphinClose(exPath)
+		repairBeforeUpdate(exPath)
 	}
 
-	isBeta := strings.Contains(prevVersion, "-beta")
-	latest := getLatestVersion(isBeta)
-	dir, err := ioutil.TempDir("", "dolphin-update")
+	latest := getTargetVersion(ctx, cfg, opts)
+	updateTargetVersion = latest.Version
+
+	if !shouldApplyUpdate(ctx, cfg, opts, exPath, latest) {
+		return nil
+	}
+
+	dir, err := createStagingDir(cfg.TempDir, exPath)
 	if err != nil {
 		log.Panic(err)
 	}
 	defer os.RemoveAll(dir)
 
 	zipFilePath := filepath.Join(dir, "dolphin.zip")
-	err = downloadFile(zipFilePath, latest.URL)
-	if err != nil {
-		log.Panic(err)
+	if opts.KeepArchive {
+		// Deferred after the staging dir cleanup such that it runs first, also on failure
+		defer keepArchive(zipFilePath, opts.ArchivePath, exPath, latest.Version)
 	}
 
-	if !isFull && !skipUpdaterUpdate {
-		prevVersionDisplay := prevVersion
+	// The kept playback build and the backup have to be of the previous version, a delta update
+	// patches the install right away
+	if opts.IsFull || opts.SkipUpdaterUpdate {
+		if opts.KeepOldPlayback {
+			keepOldPlayback(exPath, exPath, opts.PrevVersion)
+		}
+
+		if opts.Backup {
+			_, err = execBackup(cfg, "")
+			if err != nil {
+				failf(exitInstall, "Failed to back up the install, nothing was changed. %s", err.Error())
+			}
+		}
+	}
+
+	// A delta update only applies to Dolphin itself, the first phase still needs the full archive
+	// to get the new updater
+	usedDelta := false
+	if opts.Delta && opts.FromFile == "" && (opts.IsFull || opts.SkipUpdaterUpdate) {
+		err = applyDeltaUpdate(ctx, cfg, exPath, dir, opts.PrevVersion, latest)
+		if err == nil {
+			usedDelta = true
+		} else {
+			failIfCancelled(ctx)
+			log.Printf("Delta update not possible, falling back to a full download. %s\n", err.Error())
+		}
+	}
+
+	if !usedDelta {
+		preflightDiskSpace(ctx, cfg, opts, dir, exPath, updater.WithMirrors(latest.URL, latest.Mirrors))
+		fetchArtifact(ctx, cfg, opts, zipFilePath, updater.WithMirrors(latest.URL, latest.Mirrors), latest.ArchiveSHA256, latest.Signature, updater.ValidateArchive)
+	}
+
+	if !opts.IsFull && !opts.SkipUpdaterUpdate {
+		prevVersionDisplay := opts.PrevVersion
 		if prevVersionDisplay == "" {
 			prevVersionDisplay = "unknown"
 		}
@@ -77,20 +164,53 @@ func execAppUpdate(isFull, skipUpdaterUpdate, shouldLaunch bool, isoPath, prevVe
 		}
 
 		// Now extract the updater
-		err = extractFiles(exPath, zipFilePath, updaterUpdateGen)
+		_, err = updater.Extract(ctx, exPath, zipFilePath, updaterUpdateGen, cfg.extractOptions())
 		if err != nil {
+			restoreUpdater(slippiToolsPath, oldSlippiToolsPath)
+			failIfCancelled(ctx)
 			log.Panic(err)
 		}
 
 		// Launch the new updater
-		launchArg := fmt.Sprintf("-launch=%t", shouldLaunch)
-		cmd := exec.Command(slippiToolsPath, "app-update", "-skip-updater", launchArg, "-iso", isoPath, "-version", prevVersion)
+		os.RemoveAll(heartbeatPath)
+		launchArg := fmt.Sprintf("-launch=%t", opts.ShouldLaunch)
+		args := []string{
+			"app-update", "-skip-updater", launchArg, "-iso", opts.IsoPath, "-version", opts.PrevVersion,
+			"-dolphin-exe", strings.Join(dolphinExeNames, ","),
+			fmt.Sprintf("-keep-archive=%t", opts.KeepArchive), "-archive-path", opts.ArchivePath,
+			fmt.Sprintf("-strict-hook=%t", opts.StrictHook), "-launch-dir", opts.LaunchDir,
+			fmt.Sprintf("-delta=%t", opts.Delta), fmt.Sprintf("-json-progress=%t", opts.JSONProgress),
+			fmt.Sprintf("-force-close=%t", forceClose), "-close-grace", strconv.Itoa(int(forceCloseGrace.Seconds())),
+			fmt.Sprintf("-non-interactive=%t", opts.NonInteractive), "-target-version", opts.TargetVersion,
+			fmt.Sprintf("-backup=%t", opts.Backup), "-from-file", opts.FromFile,
+			"-replay-dir", opts.ReplayDir, fmt.Sprintf("-keep-old-playback=%t", opts.KeepOldPlayback),
+		}
+		if jsonOutput {
+			args = append([]string{"--json"}, args...)
+		}
+		if allowUnsigned {
+			args = append([]string{"--allow-unsigned"}, args...)
+		}
+		cmd := exec.Command(slippiToolsPath, append(args, cfg.args()...)...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stdout
+		if jsonOutput {
+			// The relaunched updater continues the same event stream
+			cmd.Stdout = jsonStdout
+			cmd.Stderr = os.Stderr
+		}
 		err = cmd.Start()
 		if err != nil {
+			restoreUpdater(slippiToolsPath, oldSlippiToolsPath)
 			log.Panicf("Failed to start app-update with new updater. %s", err.Error())
 		}
+
+		// Make sure the new updater actually came up before we exit
+		err = waitForUpdaterHeartbeat(cmd, heartbeatPath, 10*time.Second)
+		if err != nil {
+			restoreUpdater(slippiToolsPath, oldSlippiToolsPath)
+			log.Panicf("New updater failed to start. %s", err.Error())
+		}
 	} else {
 		fmt.Printf("\n\nIMPORTANT:\nThis updater will soon no longer work. Future updates will be through the Slippi Launcher. We recommend switching at your earliest convenience. You can download it from slippi.gg\n\n")
 		fmt.Printf("Your update will resume shortly, please read warning above...")
@@ -100,31 +220,40 @@ func execAppUpdate(isFull, skipUpdaterUpdate, shouldLaunch bool, isoPath, prevVe
 		// for Dolphin to close which means the previous updater should no longer be running
 		os.RemoveAll(oldSlippiToolsPath)
 
-		// After 2.2.0 we stopped supporting non-melee games by default, this will delete all old inis
-		applyMeleeOnlyChanges(prevVersion, exPath)
-
-		// Delete previous install
-		err := deletePrevious(exPath)
+		// Clean up what older versions left behind that the new one doesn't expect
+		_, err = runMigrations(exPath, opts.PrevVersion, false)
 		if err != nil {
-			log.Panicf("Failed to delete old install. %s\n", err.Error())
+			failf(exitInstall, "Failed to migrate the install. %s", err.Error())
 		}
 
-		// Extract all non-exe files used for update
-		err = extractFiles(exPath, zipFilePath, fullUpdateGen)
-		if err != nil {
-			log.Panic(err)
+		// Runtimes Dolphin needs but doesn't ship, such that the new version starts
+		ensurePrerequisites(ctx, cfg, exPath, cfg.Prerequisites, !opts.NonInteractive && !jsonOutput)
+
+		// Swap the new version into the install, rolling back if anything goes wrong
+		if !usedDelta {
+			installArchive(ctx, cfg, exPath, zipFilePath, opts.PrevVersion, latest)
 		}
 
-		// Now extract the exe (do this last such that we can avoid a partial update)
-		err = extractFiles(exPath, zipFilePath, exeUpdateGen)
-		if err != nil {
-			log.Panic(err)
+		if cfg.PostUpdateCommand != "" {
+			err = runPostUpdateHook(cfg.PostUpdateCommand, latest.Version)
+			if err != nil && opts.StrictHook {
+				log.Panic(err)
+			} else if err != nil {
+				log.Printf("Warning: %s\n", err.Error())
+			}
 		}
 
-		if shouldLaunch {
+		if opts.ShouldLaunch {
 			// Launch Dolphin
-			cmd := exec.Command(filepath.Join(exPath, "Slippi Dolphin.exe"), "-e", isoPath)
-			cmd.Start()
+			cmd := exec.Command(findDolphinExe(exPath), "-e", opts.IsoPath)
+
+			// Run from the install such that Dolphin resolves its relative Sys/User paths correctly
+			cmd.Dir = exPath
+			if opts.LaunchDir != "" {
+				cmd.Dir = opts.LaunchDir
+			}
+
+			err = startDetached(cmd)
 			if err != nil {
 				log.Panicf("Failed to start Dolphin. %s", err.Error())
 			}
@@ -134,125 +263,213 @@ func execAppUpdate(isFull, skipUpdaterUpdate, shouldLaunch bool, isoPath, prevVe
 	return nil
 }
 
-func waitForDolphinClose() {
-	// TODO: Look for specific dolphin process?
+// checkWritable probes a directory by creating and deleting a temporary file in it
+func checkWritable(path string) error {
+	f, err := ioutil.TempFile(path, "write-check")
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("\nYou can find release notes at: https://github.com/project-slippi/Ishiiruka/releases \n\n")
-	fmt.Println("Waiting for Dolphin to close. Ensure ALL Dolphin instances are closed. Can take a few moments after they are all closed...")
-	for {
-		cmd, _ := exec.Command("TASKLIST", "/FI", "IMAGENAME eq Dolphin.exe").Output()
-		output := string(cmd[:])
-		splitOutp := strings.Split(output, "\n")
-		if len(splitOutp) > 3 {
-			time.Sleep(500 * time.Millisecond)
-			//fmt.Println("Process is running...")
-			continue
-		}
+	f.Close()
+	return os.Remove(f.Name())
+}
 
-		cmd, _ = exec.Command("TASKLIST", "/FI", "IMAGENAME eq Slippi Dolphin.exe").Output()
-		output = string(cmd[:])
-		splitOutp = strings.Split(output, "\n")
-		if len(splitOutp) > 3 {
-			time.Sleep(500 * time.Millisecond)
-			//fmt.Println("Process is running...")
-			continue
+// createStagingDir creates the directory the download is staged in. If no directory was provided
+// we prefer the install directory such that we stay on the same volume, falling back to the system
+// temp directory if the install directory can't be used
+func createStagingDir(tempDir, exPath string) (string, error) {
+	if tempDir != "" {
+		err := os.MkdirAll(tempDir, 0755)
+		if err != nil {
+			return "", err
 		}
 
-		// If we get here, process is gone
-		break
+		return ioutil.TempDir(tempDir, "dolphin-update")
 	}
+
+	dir, err := ioutil.TempDir(exPath, "dolphin-update")
+	if err == nil {
+		return dir, nil
+	}
+
+	log.Printf("Failed to create staging directory in install, using system temp. %s\n", err.Error())
+	return ioutil.TempDir("", "dolphin-update")
+}
+
+// keepArchive copies the downloaded zip out of the staging directory such that users can share
+// the exact archive that failed for them
+func keepArchive(zipFilePath, archivePath, exPath, version string) {
+	if _, err := os.Stat(zipFilePath); err != nil {
+		return
+	}
+
+	if archivePath == "" {
+		archivePath = filepath.Join(filepath.Dir(exPath), fmt.Sprintf("dolphin-%s.zip", version))
+	}
+
+	err := copyFile(zipFilePath, archivePath)
+	if err != nil {
+		log.Printf("Failed to keep downloaded archive. %s\n", err.Error())
+		return
+	}
+
+	log.Printf("Downloaded archive saved to: %s\n", archivePath)
 }
 
-func extractFiles(target, source string, genTargetFile func(string) string) error {
-	reader, err := zip.OpenReader(source)
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
+	defer in.Close()
 
-	// First find Dolphin.exe
-	dolphinPath := ""
-	for _, file := range reader.File {
-		filePathName := file.Name
-		baseFile := filepath.Base(filePathName)
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
 
-		if baseFile == "Dolphin.exe" || baseFile == "Slippi Dolphin.exe" {
-			dolphinPath = filepath.Dir(filePathName)
-			break
-		}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// startDetached starts a process that keeps running after the updater exits
+func startDetached(cmd *exec.Cmd) error {
+	// Don't hand our std streams to the child, otherwise it stays tied to our console
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	configureDetached(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
 	}
 
-	// Path pattern
-	dolphinPathPattern := filepath.ToSlash(filepath.Join(dolphinPath, "*"))
+	return cmd.Process.Release()
+}
 
-	// Iterate through all files, deciding whether to extract
-	for _, file := range reader.File {
-		isMatch, err := filepath.Match(dolphinPathPattern, file.Name)
-		if err != nil || !isMatch {
-			continue
-		}
+// waitForUpdaterHeartbeat waits for the relaunched updater to write its heartbeat file. Only
+// returns an error if the process exited without ever writing it, if it is still running after
+// the timeout we assume it is an older updater that doesn't write heartbeats
+func waitForUpdaterHeartbeat(cmd *exec.Cmd, heartbeatPath string, timeout time.Duration) error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
 
-		relPath, err := filepath.Rel(dolphinPath, file.Name)
-		if err != nil {
-			continue
+	start := time.Now()
+	for time.Now().Sub(start) < timeout {
+		if _, err := os.Stat(heartbeatPath); err == nil {
+			os.RemoveAll(heartbeatPath)
+			return nil
 		}
 
-		targetRelPath := genTargetFile(relPath)
-		if targetRelPath == "" {
-			continue
+		select {
+		case err := <-exited:
+			if _, statErr := os.Stat(heartbeatPath); statErr == nil {
+				os.RemoveAll(heartbeatPath)
+				return nil
+			}
+			if err == nil {
+				err = errors.New("process exited")
+			}
+			return fmt.Errorf("updater exited before starting: %s", err.Error())
+		case <-time.After(100 * time.Millisecond):
 		}
+	}
+
+	log.Printf("Did not receive heartbeat from new updater, assuming it is running\n")
+	return nil
+}
 
-		// Generate target path
-		path := filepath.Join(target, targetRelPath)
+func restoreUpdater(slippiToolsPath, oldSlippiToolsPath string) {
+	log.Printf("Restoring previous updater...\n")
+	os.RemoveAll(slippiToolsPath)
+	err := os.Rename(oldSlippiToolsPath, slippiToolsPath)
+	if err != nil {
+		log.Printf("Failed to restore previous updater. %s\n", err.Error())
+	}
+}
 
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.Mode())
+// waitForDolphinClose blocks until no Dolphin from the install is running. An empty installDir
+// matches Dolphin running from anywhere
+func waitForDolphinClose(installDir string) {
+	fmt.Printf("\nYou can find release notes at: https://github.com/project-slippi/Ishiiruka/releases \n\n")
+	fmt.Println("Waiting for Dolphin to close. Ensure ALL Dolphin instances are closed. Can take a few moments after they are all closed...")
+	start := time.Now()
+	closeRequested := false
+	killed := false
+	for {
+		processes := findDolphinProcesses(installDir)
+		if len(processes) > 0 {
+			if forceClose && !closeRequested && time.Since(start) > forceCloseGrace {
+				closeProcesses(processes, false)
+				closeRequested = true
+			} else if forceClose && !killed && time.Since(start) > 2*forceCloseGrace {
+				closeProcesses(processes, true)
+				killed = true
+			}
+
+			time.Sleep(500 * time.Millisecond)
+			//fmt.Println("Process is running...")
 			continue
 		}
 
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
+		// If we get here, process is gone
+		break
+	}
+}
+
+func isDolphinExe(name string) bool {
+	for _, exeName := range dolphinExeNames {
+		if name == exeName {
+			return true
 		}
-		defer fileReader.Close()
+	}
 
-		start := time.Now()
+	return false
+}
 
-		for time.Now().Sub(start) < (time.Second * 20) {
-			targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-			if err != nil {
-				log.Printf("Failed to open file for write, will try again: %s\n", path)
-				time.Sleep(time.Second)
-				continue
-			}
-			defer targetFile.Close()
+// findDolphinExe returns the path of the first Dolphin executable found in the install. Falls
+// back to the preferred name if none exist
+func findDolphinExe(exPath string) string {
+	for _, name := range dolphinExeNames {
+		path := filepath.Join(exPath, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
 
-			if _, err := io.Copy(targetFile, fileReader); err != nil {
-				log.Printf("Failed to copy file, will try again: %s\n", path)
-				time.Sleep(time.Second)
-				continue
-			}
+	return filepath.Join(exPath, dolphinExeNames[0])
+}
 
-			// If everything succeeded, break immediately
-			break
-		}
+func readUpdateManifest(exPath string) (updateManifest, error) {
+	var manifest updateManifest
 
-		// Return error if there was one above and we timed out
-		if err != nil {
-			return err
-		}
+	contents, err := ioutil.ReadFile(filepath.Join(exPath, "last-update-files.json"))
+	if err != nil {
+		return manifest, err
+	}
 
-		log.Printf("Finished copying file: %s\n", path)
+	err = json.Unmarshal(contents, &manifest)
+	return manifest, err
+}
+
+func writeUpdateManifest(exPath string, manifest updateManifest) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return ioutil.WriteFile(filepath.Join(exPath, "last-update-files.json"), contents, 0644)
 }
 
 func fullUpdateGen(path string) string {
 	slashPath := filepath.ToSlash(path)
 
 	// Check if Dolphin.exe
-	if slashPath == "Dolphin.exe" || slashPath == "Slippi Dolphin.exe" {
+	if isDolphinExe(slashPath) {
 		return ""
 	}
 
@@ -275,99 +492,68 @@ func exeUpdateGen(path string) string {
 	slashPath := filepath.ToSlash(path)
 
 	// Check if Dolphin.exe
-	if slashPath == "Dolphin.exe" || slashPath == "Slippi Dolphin.exe" {
+	if isDolphinExe(slashPath) {
 		return path
 	}
 
 	return ""
 }
 
-func deletePrevious(path string) error {
-	err := os.RemoveAll(filepath.Join(path, "Dolphin.exe"))
-	if err != nil {
-		return err
-	}
+// managedEntries lists the top level entries of the install owned by Dolphin, these are replaced
+// as a whole on update
+func managedEntries() []string {
+	return append([]string{"Sys"}, dolphinExeNames...)
+}
 
-	err = os.RemoveAll(filepath.Join(path, "Slippi Dolphin.exe"))
-	if err != nil {
-		return err
+func getLatestVersion(ctx context.Context, cfg toolsConfig, channel string) slippiapi.DolphinVersion {
+	var latest slippiapi.DolphinVersion
+	cacheKey := cfg.versionCacheKey("latest:" + channel)
+	if freshCachedResponse(cfg, cacheKey, &latest) && latest.Version != "" {
+		return latest
 	}
 
-	err = os.RemoveAll(filepath.Join(path, "Sys"))
-	if err != nil {
+	err := queryProviders(ctx, cfg, cacheKey, &latest, func(provider slippiapi.Provider) (err error) {
+		latest, err = provider.LatestVersion(ctx, channel)
 		return err
-	}
-
-	return nil
-}
-
-func getLatestVersion(isBeta bool) dolphinVersion {
-	// TODO: Cache response?
-
-	client := graphql.NewClient("https://gql-gateway-dot-slippi.uc.r.appspot.com/graphql")
-	req := graphql.NewRequest(`
-		query GetLatestDolphin($includeBeta: Boolean) {
-			getLatestDolphin(includeBeta: $includeBeta) {
-				windowsDownloadUrl
-				version
-			}
-		}
-	`)
-
-	req.Var("includeBeta", isBeta)
-	ctx := context.Background()
-
-	var resp gqlResponse
-	err := client.Run(ctx, req, &resp)
+	})
 	if err != nil {
-		log.Printf("Failed to fetch version info from graphql server, got %s", err.Error())
+		log.Printf("Failed to fetch version info from the server, got %s", err.Error())
 	}
 
-	return resp.DolphinVersion
+	return latest
 }
 
-// DownloadFile will download a url to a local file. It's efficient because it will
-// write as it downloads and not load the whole file into memory.
-// Taken from: https://golangcode.com/download-a-file-from-a-url/
-func downloadFile(filepath string, url string) error {
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
+// getVersion looks up a specific published version, used to install something other than the
+// latest such as when rolling back a bad release
+func getVersion(ctx context.Context, cfg toolsConfig, version string) slippiapi.DolphinVersion {
+	var target slippiapi.DolphinVersion
+	err := queryProviders(ctx, cfg, cfg.versionCacheKey("version:"+version), &target, func(provider slippiapi.Provider) (err error) {
+		target, err = provider.Version(ctx, version)
+		if err == nil && target.Version == "" {
+			err = fmt.Errorf("%s does not know version %s", provider.Name(), version)
+		}
 		return err
+	})
+	if err != nil {
+		log.Printf("Failed to fetch version info from the server, got %s", err.Error())
 	}
-	defer resp.Body.Close()
 
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
+	if target.Version == "" {
+		failf(exitNetwork, "Version %s could not be found", version)
 	}
-	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	return target
 }
 
-func applyMeleeOnlyChanges(prevVersion, exPath string) {
-	if prevVersion != "" {
-		// Before version 2.2.1, we didn't include previous version, so if this isn't empty,
-		// we shouldn't be deleting these files
-		return
+// getTargetVersion returns the version app-update should install
+func getTargetVersion(ctx context.Context, cfg toolsConfig, opts appUpdateOptions) slippiapi.DolphinVersion {
+	if opts.FromFile != "" {
+		return localVersion(opts)
 	}
 
-	gameSettingsPath := filepath.Join(exPath, "Sys", "GameSettings")
-
-	log.Printf("Cleaning up old files...")
-
-	// Attempt to delete all files inside the Sys/GameSettings folder
-	dir, err := ioutil.ReadDir(gameSettingsPath)
-	for _, d := range dir {
-		err = os.RemoveAll(filepath.Join(gameSettingsPath, d.Name()))
-		if err != nil {
-			log.Panic(err)
-		}
+	if opts.TargetVersion != "" {
+		return getVersion(ctx, cfg, opts.TargetVersion)
 	}
 
-	log.Printf("Cleanup complete")
+	return getLatestVersion(ctx, cfg, cfg.channel(opts.PrevVersion))
 }
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const backupsDirName = "dolphin-backups"
+
+// Entries of the install that are never backed up, either because they belong to the running
+// tools or because they are leftovers of an update
+var backupExcluded = []string{
+	"dolphin-slippi-tools.exe",
+	"old-dolphin-slippi-tools.exe",
+	"updater-heartbeat",
+	"last-failure.json",
+	journalFileName,
+	backupDirName,
+	apiCacheDirName,
+}
+
+// Written into every backup such that restore knows where the user folder came from
+type backupInfo struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserDir   string    `json:"userDir,omitempty"`
+}
+
+func (cfg toolsConfig) backupDir() string {
+	if cfg.BackupDir != "" {
+		return cfg.BackupDir
+	}
+
+	return filepath.Join(filepath.Dir(cfg.InstallDir), backupsDirName)
+}
+
+// isBackupExcluded skips the excluded entries as well as staging directories created next to the
+// install, which all start with a known prefix followed by a random suffix
+func isBackupExcluded(name string) bool {
+	if containsFold(backupExcluded, name) {
+		return true
+	}
+
+	for _, prefix := range []string{"dolphin-new", "dolphin-update", configDefaultsDirName} {
+		if strings.HasPrefix(name, prefix) && name != configDefaultsDirName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func execBackup(cfg toolsConfig, userDir string) (string, error) {
+	exPath := cfg.InstallDir
+	version := readInstalledVersion(exPath)
+
+	info := backupInfo{Version: version, CreatedAt: time.Now()}
+
+	// A user folder inside the install is already part of the install backup
+	if userDir != "" {
+		if rel, err := filepath.Rel(exPath, userDir); err == nil && !strings.HasPrefix(rel, "..") {
+			userDir = ""
+		} else {
+			info.UserDir = userDir
+		}
+	}
+
+	err := os.MkdirAll(cfg.backupDir(), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	if version == "" {
+		version = "unknown"
+	}
+	name := fmt.Sprintf("dolphin-%s-%s.zip", version, info.CreatedAt.Format("20060102-150405"))
+	backupPath := filepath.Join(cfg.backupDir(), name)
+
+	log.Printf("Backing up %s to %s...\n", exPath, backupPath)
+
+	out, err := os.Create(backupPath + ".part")
+	if err != nil {
+		return "", err
+	}
+
+	writer := zip.NewWriter(out)
+	err = writeBackupInfo(writer, info)
+	if err == nil {
+		err = addDirToZip(writer, exPath, "install", func(name string) bool {
+			// The backup directory may have been configured to live inside the install
+			return isBackupExcluded(name) || filepath.Join(exPath, name) == filepath.Clean(cfg.backupDir())
+		})
+	}
+	if err == nil && userDir != "" {
+		err = addDirToZip(writer, userDir, "user", func(string) bool { return false })
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	out.Close()
+	if err != nil {
+		os.Remove(backupPath + ".part")
+		return "", err
+	}
+
+	// Only give the backup its final name once it is complete
+	err = os.Rename(backupPath+".part", backupPath)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Backup saved to: %s\n", backupPath)
+	return backupPath, nil
+}
+
+func writeBackupInfo(writer *zip.Writer, info backupInfo) error {
+	contents, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	w, err := writer.Create("backup.json")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(contents)
+	return err
+}
+
+// addDirToZip adds everything in dir under prefix. Top level entries for which exclude returns
+// true are skipped
+func addDirToZip(writer *zip.Writer, dir, prefix string, exclude func(string) bool) error {
+	return filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if !strings.Contains(filepath.ToSlash(rel), "/") && exclude(rel) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(fileInfo)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + "/" + filepath.ToSlash(rel)
+
+		if fileInfo.IsDir() {
+			header.Name += "/"
+			_, err = writer.CreateHeader(header)
+			return err
+		}
+
+		// Skip symlinks and other special files
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+
+		header.Method = zip.Deflate
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		_, err = io.Copy(w, in)
+		return err
+	})
+}
+
+// listBackups returns the backups in the backup directory, newest first
+func listBackups(cfg toolsConfig) ([]string, error) {
+	entries, err := ioutil.ReadDir(cfg.backupDir())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().After(entries[j].ModTime())
+	})
+
+	backups := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".zip") {
+			backups = append(backups, entry.Name())
+		}
+	}
+
+	return backups, nil
+}
+
+func execRestore(cfg toolsConfig, name string, skipConfirm bool) (returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered restoring backup")
+		}
+	}()
+
+	if name == "" {
+		backups, err := listBackups(cfg)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if len(backups) == 0 {
+			fmt.Printf("No backups found in %s\n", cfg.backupDir())
+			return nil
+		}
+
+		fmt.Printf("Backups in %s, pass one to restore it:\n", cfg.backupDir())
+		for _, backup := range backups {
+			fmt.Println(backup)
+		}
+		return nil
+	}
+
+	backupPath := name
+	if !strings.ContainsAny(name, `/\`) {
+		backupPath = filepath.Join(cfg.backupDir(), name)
+	}
+
+	exPath := cfg.InstallDir
+	ensureWritable(exPath)
+
+	reader, err := zip.OpenReader(backupPath)
+	if err != nil {
+		failf(exitInstall, "Failed to open backup. %s", err.Error())
+	}
+	defer reader.Close()
+
+	info, err := readBackupInfo(&reader.Reader)
+	if err != nil {
+		failf(exitInstall, "Not a valid backup. %s", err.Error())
+	}
+	if info.Version == "" {
+		info.Version = "unknown"
+	}
+
+	prompt := fmt.Sprintf("This will replace Dolphin in %s with the backup of %s taken %s", exPath, info.Version, info.CreatedAt.Format(time.RFC1123))
+	if info.UserDir != "" {
+		prompt += fmt.Sprintf(" and overwrite the user folder %s", info.UserDir)
+	}
+	if !skipConfirm && !confirm(prompt+". Continue?") {
+		fmt.Println("Restore cancelled")
+		return nil
+	}
+
+	waitForDolphinClose(exPath)
+	repairBeforeUpdate(exPath)
+
+	// Extract next to the install such that the swap is just renames on the same volume
+	newDir, err := ioutil.TempDir(exPath, "dolphin-new")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(newDir)
+
+	err = extractZipPrefix(&reader.Reader, "install", newDir)
+	if err != nil {
+		failf(exitInstall, "Failed to extract backup. %s", err.Error())
+	}
+
+	journal, err := beginJournal(exPath, "restore", readInstalledVersion(exPath), info.Version, newDir)
+	if err != nil {
+		failf(exitInstall, "Failed to start the update journal, nothing was changed. %s", err.Error())
+	}
+
+	_, err = swapIntoInstall(journal, exPath, newDir)
+	if err != nil {
+		journal.finish()
+		failf(exitInstall, "Failed to restore backup, previous install was restored. %s", err.Error())
+	}
+	journal.finish()
+
+	if info.UserDir != "" {
+		err = extractZipPrefix(&reader.Reader, "user", info.UserDir)
+		if err != nil {
+			failf(exitInstall, "Failed to restore user folder. %s", err.Error())
+		}
+	}
+
+	fmt.Printf("Restored Dolphin %s\n", info.Version)
+	return nil
+}
+
+func readBackupInfo(reader *zip.Reader) (backupInfo, error) {
+	var info backupInfo
+
+	for _, file := range reader.File {
+		if file.Name != "backup.json" {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return info, err
+		}
+		defer r.Close()
+
+		err = json.NewDecoder(r).Decode(&info)
+		return info, err
+	}
+
+	return info, fmt.Errorf("backup.json is missing")
+}
+
+// extractZipPrefix extracts the entries under prefix into target
+func extractZipPrefix(reader *zip.Reader, prefix, target string) error {
+	for _, file := range reader.File {
+		if !strings.HasPrefix(file.Name, prefix+"/") {
+			continue
+		}
+
+		rel := strings.TrimPrefix(file.Name, prefix+"/")
+		if rel == "" {
+			continue
+		}
+		if !updater.IsSafeRelPath(rel) {
+			return fmt.Errorf("backup contains an unsafe path: %s", file.Name)
+		}
+
+		path := filepath.Join(target, filepath.FromSlash(rel))
+		if file.FileInfo().IsDir() {
+			err := os.MkdirAll(path, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = extractZipFile(file, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZipFile(file *zip.File, path string) error {
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
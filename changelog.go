@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/semver"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// getChangelog fetches the release notes of every version after fromVersion up to toVersion
+func getChangelog(ctx context.Context, cfg toolsConfig, fromVersion, toVersion string) ([]slippiapi.ReleaseNotes, error) {
+	var changelog []slippiapi.ReleaseNotes
+	err := queryProviders(ctx, cfg, "", &changelog, func(provider slippiapi.Provider) (err error) {
+		changelog, err = provider.Changelog(ctx, fromVersion, toVersion)
+		return err
+	})
+
+	return changelog, err
+}
+
+func printChangelog(changelog []slippiapi.ReleaseNotes) {
+	fmt.Println("\nChanges in this update:")
+	for _, release := range changelog {
+		fmt.Printf("\n%s\n", release.Version)
+		for _, line := range strings.Split(strings.TrimSpace(release.Notes), "\n") {
+			fmt.Printf("  %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+	fmt.Println("")
+}
+
+// updateSkipped is set when shouldApplyUpdate, or the user at the reinstall prompt, decided not to
+// update, such that an update that never ran isn't reported or recorded
+var updateSkipped bool
+
+// shouldApplyUpdate is run before an update starts. Skips versions that are already installed or
+// snoozed, shows what changed and, if requested, asks the user to confirm
+func shouldApplyUpdate(ctx context.Context, cfg toolsConfig, opts appUpdateOptions, stateDir string, latest slippiapi.DolphinVersion) bool {
+	// Only the first phase talks to the user, the relaunched updater just continues
+	if opts.SkipUpdaterUpdate {
+		return true
+	}
+
+	installed := opts.PrevVersion
+	if installed == "" {
+		installed = readInstalledVersion(cfg.InstallDir)
+	}
+	if !opts.Force && latest.Version != "" && sameVersion(installed, latest.Version) {
+		fmt.Printf("Dolphin %s is already up to date, pass -force to install it again\n", installed)
+		updateSkipped = true
+		return false
+	}
+
+	// Local archives have no release notes to show
+	if opts.FromFile != "" {
+		return true
+	}
+
+	// Respect the user's choice to stay on their current version
+	if opts.TargetVersion == "" && loadState(stateDir).isSnoozed(latest.Version) {
+		fmt.Printf("Version %s is snoozed, run check -clear-snooze to allow updating to it\n", latest.Version)
+		updateSkipped = true
+		return false
+	}
+
+	if opts.PrevVersion != "" && semver.Compare(latest.Version, opts.PrevVersion) < 0 {
+		log.Printf("Warning: %s is older than the installed %s, this is a downgrade\n", latest.Version, opts.PrevVersion)
+	}
+
+	changelog, err := getChangelog(ctx, cfg, opts.PrevVersion, latest.Version)
+	if err != nil {
+		log.Printf("Failed to fetch release notes. %s\n", err.Error())
+	} else if len(changelog) > 0 {
+		printChangelog(changelog)
+	}
+
+	if cfg.dolphinType() == slippiapi.TypePlayback {
+		checkReplayCompatibility(ctx, cfg, opts, latest)
+	}
+
+	if opts.ConfirmChanges && !confirm(fmt.Sprintf("Update to %s?", latest.Version)) {
+		fmt.Println("Update cancelled")
+		updateSkipped = true
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// execChannel prints the effective release channel, or saves a new preference when one is given
+func execChannel(cfg toolsConfig, channel string) {
+	if channel == "" {
+		fmt.Println(cfg.channel(readInstalledVersion(cfg.InstallDir)))
+		return
+	}
+
+	if !isValidChannel(channel) {
+		log.Panicf("Unknown channel %s, must be one of: %s", channel, strings.Join(validChannels, ", "))
+	}
+
+	state := loadState(cfg.InstallDir)
+	state.Channel = channel
+	err := saveState(cfg.InstallDir, state)
+	if err != nil {
+		log.Panicf("Failed to save channel. %s", err.Error())
+	}
+
+	fmt.Printf("Updates will now come from the %s channel\n", channel)
+}
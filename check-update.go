@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+type checkResult struct {
+	InstalledVersion string `json:"installedVersion"`
+	LatestVersion    string `json:"latestVersion"`
+	UpdateAvailable  bool   `json:"updateAvailable"`
+	Snoozed          bool   `json:"snoozed"`
+}
+
+func execCheckUpdate(ctx context.Context, cfg toolsConfig, installedVersion string, snooze, clearSnooze, asJSON, notify bool) {
+	exPath := cfg.InstallDir
+	state := loadState(exPath)
+
+	// Without an explicit version, use what we know is installed
+	if installedVersion == "" {
+		installedVersion = readInstalledVersion(exPath)
+	}
+
+	if clearSnooze {
+		state.SnoozedVersion = ""
+		err := saveState(exPath, state)
+		if err != nil {
+			log.Panicf("Failed to clear snooze. %s", err.Error())
+		}
+		if !asJSON {
+			fmt.Println("Snooze cleared")
+		}
+	}
+
+	latest := getLatestVersion(ctx, cfg, cfg.channel(installedVersion))
+	if latest.Version == "" {
+		log.Panic("Failed to determine the latest version")
+	}
+
+	if snooze {
+		state.SnoozedVersion = latest.Version
+		err := saveState(exPath, state)
+		if err != nil {
+			log.Panicf("Failed to snooze version. %s", err.Error())
+		}
+		if !asJSON {
+			fmt.Printf("Snoozed version %s, you won't be notified until a newer version is released\n", latest.Version)
+		}
+	}
+
+	result := checkResult{
+		InstalledVersion: installedVersion,
+		LatestVersion:    latest.Version,
+		Snoozed:          state.isSnoozed(latest.Version),
+	}
+	result.UpdateAvailable = updateAvailable(installedVersion, latest.Version) && !result.Snoozed
+
+	if notify && result.UpdateAvailable {
+		notifyUpdate(cfg, installedVersion, latest.Version)
+	}
+
+	if asJSON && jsonOutput {
+		emitResult("check", result)
+		return
+	} else if asJSON {
+		contents, err := json.Marshal(result)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+		return
+	}
+
+	if !result.UpdateAvailable {
+		fmt.Println("Up to date")
+		return
+	}
+
+	fmt.Printf("Update available: %s\n", latest.Version)
+}
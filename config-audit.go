@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// meleeGameID is the game ID of NTSC Melee, its user game ini overrides Dolphin.ini
+const meleeGameID = "GALE01"
+
+// auditRule is a setting netplay needs. The first of Allowed is what -fix sets. Default is the value
+// Dolphin uses when the setting isn't in the file, empty if any value Dolphin picks is fine
+type auditRule struct {
+	Setting string
+	Allowed []string
+	Default string
+	Reason  string
+}
+
+// auditRules are checked in order by config audit
+var auditRules = []auditRule{
+	{
+		Setting: "Dolphin.Core.CPUThread",
+		Allowed: []string{"False"},
+		Default: "True",
+		Reason:  "dual core can desync netplay",
+	},
+	{
+		Setting: "Dolphin.Core.OverclockEnable",
+		Allowed: []string{"False"},
+		Default: "False",
+		Reason:  "overclocking the emulated CPU desyncs with opponents that don't",
+	},
+	{
+		Setting: "Dolphin.Core.EmulationSpeed",
+		Allowed: []string{"1.00000000", "1", "1.0"},
+		Default: "1.00000000",
+		Reason:  "netplay only works at full speed",
+	},
+	{
+		Setting: "Dolphin.Core.GFXBackend",
+		Allowed: recommendedBackends(),
+		Reason:  "the software renderer and null backend can't keep up with netplay",
+	},
+}
+
+// recommendedBackends are the video backends that run Melee at full speed on this OS
+func recommendedBackends() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"D3D", "D3D12", "Vulkan", "OGL"}
+	}
+
+	return []string{"OGL", "Vulkan"}
+}
+
+// auditFinding is a setting that doesn't match its rule. File is the ini it was read from
+type auditFinding struct {
+	Setting  string   `json:"setting"`
+	File     string   `json:"file"`
+	Value    string   `json:"value"`
+	Expected []string `json:"expected"`
+	Reason   string   `json:"reason"`
+	Fixed    bool     `json:"fixed"`
+}
+
+// auditResult is reported at the end of config audit
+type auditResult struct {
+	UserDir  string         `json:"userDir"`
+	Checked  int            `json:"checked"`
+	Findings []auditFinding `json:"findings"`
+}
+
+// auditIssueEvent is emitted in json mode for every finding, before the result
+type auditIssueEvent struct {
+	Type     string   `json:"type"`
+	Setting  string   `json:"setting"`
+	Value    string   `json:"value"`
+	Expected []string `json:"expected"`
+	Fixed    bool     `json:"fixed"`
+}
+
+// meleeGameConfigPath is the user game ini of Melee. Its [Core] section takes precedence over the
+// one in Dolphin.ini, so a value there hides what Dolphin.ini says
+func meleeGameConfigPath(userDir string) string {
+	return filepath.Join(userDir, "GameSettings", meleeGameID+".ini")
+}
+
+// checkAuditRule returns the finding for rule, or false if the setting is fine. Core settings are
+// read from the Melee game ini first
+func checkAuditRule(userDir string, rule auditRule, gameConfig *iniFile) (auditFinding, bool) {
+	setting := parseDolphinSetting(rule.Setting)
+	finding := auditFinding{
+		Setting:  rule.Setting,
+		File:     filepath.Base(dolphinConfigPath(userDir, setting.File)),
+		Expected: rule.Allowed,
+		Reason:   rule.Reason,
+	}
+
+	value, ok := "", false
+	if setting.File == "Dolphin" && gameConfig != nil {
+		value, ok = gameConfig.section("[" + setting.Section + "]").value(setting.Key)
+		if ok {
+			finding.File = meleeGameID + ".ini"
+		}
+	}
+	if !ok {
+		current, err := getDolphinSetting(userDir, setting)
+		if err != nil {
+			log.Panicf("Failed to read %s. %s", setting.File, err.Error())
+		}
+		value, ok = current.Value, current.Set
+	}
+
+	if !ok {
+		if rule.Default == "" {
+			return finding, false
+		}
+		value = rule.Default
+	}
+
+	finding.Value = value
+	for _, allowed := range rule.Allowed {
+		if strings.EqualFold(value, allowed) {
+			return finding, false
+		}
+	}
+
+	return finding, true
+}
+
+// fixAuditFinding sets the first allowed value in Dolphin.ini and removes the override from the
+// Melee game ini, such that the fix isn't hidden by it
+func fixAuditFinding(userDir string, finding auditFinding, gameConfig *iniFile) error {
+	setting := parseDolphinSetting(finding.Setting)
+	if finding.File == meleeGameID+".ini" {
+		gameConfig.unset("["+setting.Section+"]", setting.Key)
+	}
+
+	setting.Value = finding.Expected[0]
+	return setDolphinSetting(userDir, setting)
+}
+
+// execConfigAudit checks the Dolphin config of the install against the settings netplay needs and
+// sets the recommended values with fix. Fails with exitVerification if anything is left to fix
+func execConfigAudit(cfg toolsConfig, userDir string, fix bool) (result auditResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered auditing the Dolphin config")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+	result.UserDir = userDir
+	result.Checked = len(auditRules)
+	result.Findings = []auditFinding{}
+
+	// Dolphin writes its config when it closes, which would undo the fixes
+	if fix && len(findDolphinProcesses(cfg.InstallDir)) > 0 {
+		failf(exitGeneric, "Close Dolphin before fixing its config, it overwrites the changes when it closes")
+	}
+
+	gamePath := meleeGameConfigPath(userDir)
+	gameConfig, err := readIniFile(gamePath)
+	if err != nil {
+		log.Panicf("Failed to read %s. %s", gamePath, err.Error())
+	}
+	gameOriginal := gameConfig.String()
+
+	for _, rule := range auditRules {
+		finding, bad := checkAuditRule(userDir, rule, gameConfig)
+		if !bad {
+			continue
+		}
+
+		if fix {
+			err := fixAuditFinding(userDir, finding, gameConfig)
+			if err != nil {
+				log.Panicf("Failed to fix %s. %s", finding.Setting, err.Error())
+			}
+			finding.Fixed = true
+		}
+
+		result.Findings = append(result.Findings, finding)
+		if jsonOutput {
+			emitEvent(auditIssueEvent{
+				Type:     "audit-issue",
+				Setting:  finding.Setting,
+				Value:    finding.Value,
+				Expected: finding.Expected,
+				Fixed:    finding.Fixed,
+			})
+		}
+	}
+
+	if gameConfig.String() != gameOriginal {
+		err := writeIniFile(gamePath, gameConfig)
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", gamePath, err.Error())
+		}
+	}
+
+	remaining := 0
+	for _, finding := range result.Findings {
+		status := "fixed"
+		if !finding.Fixed {
+			status = "should be " + strings.Join(finding.Expected, " or ")
+			remaining++
+		}
+		fmt.Printf("%s is %s in %s, %s: %s\n", finding.Setting, finding.Value, finding.File, status, finding.Reason)
+	}
+
+	if remaining > 0 {
+		failf(exitVerification, "%d of %d settings aren't netplay safe, run config audit -fix to fix them", remaining, result.Checked)
+	}
+
+	if len(result.Findings) > 0 {
+		fmt.Printf("Fixed %d of %d settings\n", len(result.Findings), result.Checked)
+	} else {
+		fmt.Printf("All %d settings are netplay safe\n", result.Checked)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// configDefaultsDirName holds a copy of the config files shipped with the installed version, they
+// are the base when merging user changes with the defaults of a new version
+const configDefaultsDirName = "config-defaults"
+
+// isPreservableConfig reports whether an install relative path is a config file users may edit,
+// in Sys or in the User folder of a portable install
+func isPreservableConfig(relPath string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	return (strings.HasPrefix(slashPath, "Sys/") || strings.HasPrefix(slashPath, "User/")) && strings.EqualFold(path.Ext(slashPath), ".ini")
+}
+
+// findModifiedConfig compares the config files in the install against the hashes recorded when
+// they were installed and returns the ones the user changed
+func findModifiedConfig(exPath string, manifest updateManifest) []updater.UpdatedFile {
+	modified := []updater.UpdatedFile{}
+	for _, file := range manifest.Files {
+		if file.SHA256 == "" || !isPreservableConfig(file.Path) {
+			continue
+		}
+
+		err := updater.VerifyFileHash(filepath.Join(exPath, filepath.FromSlash(file.Path)), file.SHA256)
+		if err != nil && !os.IsNotExist(err) {
+			modified = append(modified, file)
+		}
+	}
+
+	return modified
+}
+
+// stageConfigDefaults copies the shipped config files out of the extracted version before they
+// are swapped in, such that they can become the merge base for the next update
+func stageConfigDefaults(exPath, newDir string, files []updater.UpdatedFile) (string, error) {
+	stagingDir, err := ioutil.TempDir(exPath, configDefaultsDirName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range files {
+		if !isPreservableConfig(file.Path) {
+			continue
+		}
+
+		target := filepath.Join(stagingDir, filepath.FromSlash(file.Path))
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err == nil {
+			err = copyFile(filepath.Join(newDir, filepath.FromSlash(file.Path)), target)
+		}
+		if err != nil {
+			os.RemoveAll(stagingDir)
+			return "", err
+		}
+	}
+
+	return stagingDir, nil
+}
+
+// restoreUserConfig brings the user's changes back after the new version was swapped in. Files
+// the new version didn't change are restored as is, files changed on both sides are merged
+func restoreUserConfig(exPath, backupDir string, modified []updater.UpdatedFile, files []updater.UpdatedFile) {
+	newHashes := map[string]string{}
+	for _, file := range files {
+		newHashes[file.Path] = file.SHA256
+	}
+
+	for _, file := range modified {
+		relPath := filepath.FromSlash(file.Path)
+		userPath := filepath.Join(backupDir, relPath)
+		installPath := filepath.Join(exPath, relPath)
+
+		newHash, shipped := newHashes[file.Path]
+		if !shipped || strings.EqualFold(newHash, file.SHA256) {
+			err := os.MkdirAll(filepath.Dir(installPath), 0755)
+			if err == nil {
+				err = copyFile(userPath, installPath)
+			}
+			if err != nil {
+				log.Printf("Failed to restore your changes to %s. %s\n", file.Path, err.Error())
+			}
+			continue
+		}
+
+		err := mergeUserConfig(filepath.Join(exPath, configDefaultsDirName, relPath), userPath, installPath)
+		if err != nil {
+			log.Printf("Failed to merge your changes to %s, the new default is used. %s\n", file.Path, err.Error())
+			continue
+		}
+
+		log.Printf("Merged your changes to %s with the new version\n", file.Path)
+	}
+}
+
+// mergeUserConfig does a three-way merge of an ini file, writing the result over the new default.
+// Without a base every setting the user has wins
+func mergeUserConfig(basePath, userPath, newPath string) error {
+	base, err := ioutil.ReadFile(basePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	user, err := ioutil.ReadFile(userPath)
+	if err != nil {
+		return err
+	}
+
+	latest, err := ioutil.ReadFile(newPath)
+	if err != nil {
+		return err
+	}
+
+	merged := mergeIni(parseIni(string(base)), parseIni(string(user)), parseIni(string(latest)))
+	return ioutil.WriteFile(newPath, []byte(merged.String()), 0644)
+}
+
+// replaceConfigDefaults makes the staged defaults of the new version the base for the next update
+func replaceConfigDefaults(exPath, stagingDir string) error {
+	defaultsDir := filepath.Join(exPath, configDefaultsDirName)
+
+	err := os.RemoveAll(defaultsDir)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(stagingDir, defaultsDir)
+}
+
+// mergeIni merges section by section. A section only one side changed takes that side, a section
+// both sides changed is merged key by key when it only holds settings. Code sections such as
+// [Gecko] can't be merged line by line so the user's version wins
+func mergeIni(base, user, latest *iniFile) *iniFile {
+	merged := &iniFile{}
+
+	for _, latestSection := range latest.sections {
+		baseSection := base.section(latestSection.name)
+		userSection := user.section(latestSection.name)
+
+		switch {
+		case userSection.equal(baseSection):
+			merged.sections = append(merged.sections, latestSection)
+		case latestSection.equal(baseSection) && userSection == nil:
+			// Removed by the user and not changed by the new version
+		case latestSection.equal(baseSection):
+			merged.sections = append(merged.sections, userSection)
+		case userSection == nil:
+			merged.sections = append(merged.sections, latestSection)
+		default:
+			merged.sections = append(merged.sections, mergeIniSection(baseSection, userSection, latestSection))
+		}
+	}
+
+	// Keep sections the user added
+	for _, userSection := range user.sections {
+		if latest.section(userSection.name) == nil && base.section(userSection.name) == nil {
+			merged.sections = append(merged.sections, userSection)
+		}
+	}
+
+	return merged
+}
+
+func mergeIniSection(base, user, latest *iniSection) *iniSection {
+	baseValues := map[string]string{}
+	if base != nil {
+		for _, line := range base.lines {
+			if key, ok := iniKey(line); ok {
+				baseValues[key] = line
+			}
+		}
+	}
+
+	// Collect the settings the user changed, bailing out if the section holds anything else
+	userChanges := map[string]string{}
+	userKeys := []string{}
+	for _, line := range user.lines {
+		key, ok := iniKey(line)
+		if !ok {
+			trimmed := strings.TrimSpace(line)
+			if trimmed != "" && !strings.HasPrefix(trimmed, ";") && !strings.HasPrefix(trimmed, "#") {
+				return user
+			}
+			continue
+		}
+
+		userKeys = append(userKeys, key)
+		if baseValues[key] != line {
+			userChanges[key] = line
+		}
+	}
+
+	merged := &iniSection{name: latest.name}
+	seen := map[string]bool{}
+	for _, line := range latest.lines {
+		key, ok := iniKey(line)
+		if !ok {
+			merged.lines = append(merged.lines, line)
+			continue
+		}
+
+		seen[key] = true
+		if changed, ok := userChanges[key]; ok {
+			merged.lines = append(merged.lines, changed)
+		} else if _, inBase := baseValues[key]; inBase && !containsString(userKeys, key) && baseValues[key] == line {
+			// Removed by the user and not changed by the new version
+		} else {
+			merged.lines = append(merged.lines, line)
+		}
+	}
+
+	// Keep settings the user added
+	for _, key := range userKeys {
+		if changed, ok := userChanges[key]; ok && !seen[key] {
+			merged.lines = append(merged.lines, changed)
+		}
+	}
+
+	return merged
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/semver"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const defaultEndpoint = "https://gql-gateway-dot-slippi.uc.r.appspot.com/graphql"
+
+// toolsConfig holds settings that can come from config.json, environment variables, or flags.
+// Later sources take precedence over earlier ones
+type toolsConfig struct {
+	Endpoint       string `json:"endpoint"`
+	Channel        string `json:"channel"`
+	Target         string `json:"target"`
+	InstallDir     string `json:"installDir"`
+	TempDir        string `json:"tempDir"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	Retries        int    `json:"retries"`
+	MaxFileMB      int    `json:"maxFileMB"`
+	MaxExtractMB   int    `json:"maxExtractMB"`
+	BackupDir      string `json:"backupDir"`
+	ControllerDir  string `json:"controllerDir"`
+	GeckoSource    string `json:"geckoSource"`
+	Connections    int    `json:"connections"`
+	ExtractWorkers int    `json:"extractWorkers"`
+	MinSpeedKB     int    `json:"minSpeedKB"`
+	LimitRate      string `json:"limitRate"`
+	Proxy          string `json:"proxy"`
+	LANCache       string `json:"lanCache"`
+
+	PostUpdateCommand string `json:"postUpdateCommand"`
+	HealthCheck       bool   `json:"healthCheck"`
+	CleanupOrphans    bool   `json:"cleanupOrphans"`
+	Prerequisites     string `json:"prerequisites"`
+	UpdateWebhook     string `json:"updateWebhook"`
+	WebhookFormat     string `json:"webhookFormat"`
+	FallbackEndpoints string `json:"fallbackEndpoints"`
+	UserEndpoint      string `json:"userEndpoint"`
+	Provider          string `json:"provider"`
+	RESTEndpoint      string `json:"restEndpoint"`
+	CacheTTLMinutes   int    `json:"cacheTTLMinutes"`
+	NoCache           bool   `json:"noCache"`
+}
+
+func getExecutableDir() string {
+	ex, err := os.Executable()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return filepath.Dir(ex)
+}
+
+// loadConfig resolves the configuration from defaults, config.json next to the executable, the
+// config.json of the install when it lives elsewhere, and environment variables. Flags are applied
+// afterwards by registerConfigFlags
+func loadConfig(installDir string) toolsConfig {
+	exPath := getExecutableDir()
+
+	cfg := toolsConfig{
+		Endpoint:       defaultEndpoint,
+		RESTEndpoint:   slippiapi.DefaultRESTEndpoint,
+		InstallDir:     exPath,
+		TimeoutSeconds: 30,
+		Retries:        3,
+		MaxFileMB:      1024,
+		MaxExtractMB:   4096,
+		Connections:    4,
+		ExtractWorkers: 4,
+		MinSpeedKB:     50,
+
+		CacheTTLMinutes: 5,
+		Prerequisites:   "ask",
+	}
+
+	readConfigFile(filepath.Join(exPath, "config.json"), &cfg)
+
+	// Every install can have its own settings when one copy of the tools manages several
+	applyEnvString(&cfg.InstallDir, "SLIPPI_INSTALL_DIR")
+	if installDir != "" {
+		cfg.InstallDir = installDir
+	}
+	if installDir = cfg.InstallDir; !samePath(installDir, exPath) {
+		readConfigFile(filepath.Join(installDir, "config.json"), &cfg)
+		cfg.InstallDir = installDir
+	}
+
+	applyEnvString(&cfg.Endpoint, "SLIPPI_ENDPOINT")
+	applyEnvString(&cfg.FallbackEndpoints, "SLIPPI_FALLBACK_ENDPOINTS")
+	applyEnvString(&cfg.UserEndpoint, "SLIPPI_USER_ENDPOINT")
+	applyEnvString(&cfg.Provider, "SLIPPI_PROVIDER")
+	applyEnvString(&cfg.RESTEndpoint, "SLIPPI_REST_ENDPOINT")
+	applyEnvInt(&cfg.CacheTTLMinutes, "SLIPPI_CACHE_TTL_MINUTES")
+	applyEnvBool(&cfg.NoCache, "SLIPPI_NO_CACHE")
+	applyEnvString(&cfg.Channel, "SLIPPI_CHANNEL")
+	applyEnvString(&cfg.Target, "SLIPPI_TARGET")
+	applyEnvString(&cfg.TempDir, "SLIPPI_TEMP_DIR")
+	applyEnvInt(&cfg.TimeoutSeconds, "SLIPPI_TIMEOUT_SECONDS")
+	applyEnvInt(&cfg.Retries, "SLIPPI_RETRIES")
+	applyEnvInt(&cfg.MaxFileMB, "SLIPPI_MAX_FILE_MB")
+	applyEnvInt(&cfg.MaxExtractMB, "SLIPPI_MAX_EXTRACT_MB")
+	applyEnvString(&cfg.BackupDir, "SLIPPI_BACKUP_DIR")
+	applyEnvString(&cfg.ControllerDir, "SLIPPI_CONTROLLER_DIR")
+	applyEnvString(&cfg.GeckoSource, "SLIPPI_GECKO_SOURCE")
+	applyEnvInt(&cfg.Connections, "SLIPPI_CONNECTIONS")
+	applyEnvInt(&cfg.ExtractWorkers, "SLIPPI_EXTRACT_WORKERS")
+	applyEnvInt(&cfg.MinSpeedKB, "SLIPPI_MIN_SPEED_KB")
+	applyEnvString(&cfg.LimitRate, "SLIPPI_LIMIT_RATE")
+	applyEnvString(&cfg.Proxy, "SLIPPI_PROXY")
+	applyEnvString(&cfg.LANCache, "SLIPPI_LAN_CACHE")
+
+	// Go only reads HTTP_PROXY and HTTPS_PROXY, map ALL_PROXY onto them such that NO_PROXY still
+	// applies to it
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		if value := os.Getenv(name); value != "" {
+			setEnvDefault("HTTP_PROXY", "http_proxy", value)
+			setEnvDefault("HTTPS_PROXY", "https_proxy", value)
+		}
+	}
+	applyEnvString(&cfg.PostUpdateCommand, "SLIPPI_POST_UPDATE_COMMAND")
+	applyEnvBool(&cfg.HealthCheck, "SLIPPI_HEALTH_CHECK")
+	applyEnvBool(&cfg.CleanupOrphans, "SLIPPI_CLEANUP_ORPHANS")
+	applyEnvString(&cfg.Prerequisites, "SLIPPI_PREREQUISITES")
+	applyEnvString(&cfg.UpdateWebhook, "SLIPPI_UPDATE_WEBHOOK")
+	applyEnvString(&cfg.WebhookFormat, "SLIPPI_WEBHOOK_FORMAT")
+
+	return cfg
+}
+
+func readConfigFile(path string, cfg *toolsConfig) {
+	contents, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(contents, cfg)
+		if err != nil {
+			log.Printf("Failed to parse %s, ignoring it. %s\n", path, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Failed to read %s, ignoring it. %s\n", path, err.Error())
+	}
+}
+
+func applyEnvString(target *string, name string) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		*target = value
+	}
+}
+
+// setEnvDefault sets an environment variable unless it is already set in either casing
+func setEnvDefault(upper, lower, value string) {
+	if os.Getenv(upper) == "" && os.Getenv(lower) == "" {
+		os.Setenv(upper, value)
+	}
+}
+
+func applyEnvBool(target *bool, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring invalid value for %s: %s\n", name, value)
+		return
+	}
+
+	*target = parsed
+}
+
+func applyEnvInt(target *int, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring invalid value for %s: %s\n", name, value)
+		return
+	}
+
+	*target = parsed
+}
+
+// registerConfigFlags adds flags for every config value, using the already resolved values as
+// defaults such that flags only override when passed
+func registerConfigFlags(fs *flag.FlagSet, cfg *toolsConfig) {
+	fs.StringVar(&cfg.Endpoint, "endpoint", cfg.Endpoint, "GraphQL endpoint used to look up versions.")
+	fs.StringVar(&cfg.FallbackEndpoints, "fallback-endpoints", cfg.FallbackEndpoints, "Comma separated GraphQL endpoints tried when the endpoint can't be reached.")
+	fs.StringVar(&cfg.Provider, "provider", cfg.Provider, "API used to look up versions: rest, graphql, or auto to try REST first.")
+	fs.StringVar(&cfg.RESTEndpoint, "rest-endpoint", cfg.RESTEndpoint, "Base URL of the REST API.")
+	fs.IntVar(&cfg.CacheTTLMinutes, "cache-ttl-minutes", cfg.CacheTTLMinutes, "Minutes the latest version is reused from the cache before asking the server again, 0 to always ask.")
+	fs.BoolVar(&cfg.NoCache, "no-cache", cfg.NoCache, "Always ask the server for the latest version instead of using the cache.")
+	fs.StringVar(&cfg.UserEndpoint, "user-endpoint", cfg.UserEndpoint, "GraphQL endpoint used to look up user info, tried before the built in one.")
+	fs.StringVar(&cfg.Channel, "channel", cfg.Channel, "Release channel to update from. Detected from the installed version if empty.")
+	fs.StringVar(&cfg.Target, "target", cfg.Target, "Dolphin build to manage, netplay or playback. Uses the registered install of that type.")
+	fs.StringVar(&cfg.InstallDir, "install-dir", cfg.InstallDir, "Dolphin install directory.")
+	fs.StringVar(&cfg.TempDir, "temp-dir", cfg.TempDir, "Directory to stage the download in. Defaults to the install directory.")
+	fs.IntVar(&cfg.TimeoutSeconds, "timeout", cfg.TimeoutSeconds, "Network timeout in seconds.")
+	fs.IntVar(&cfg.Retries, "retries", cfg.Retries, "Number of attempts made for each request and download.")
+	fs.IntVar(&cfg.MaxFileMB, "max-file-mb", cfg.MaxFileMB, "Largest single file in MB allowed to be extracted, 0 for no limit.")
+	fs.IntVar(&cfg.MaxExtractMB, "max-extract-mb", cfg.MaxExtractMB, "Largest total size in MB allowed to be extracted, 0 for no limit.")
+	fs.StringVar(&cfg.BackupDir, "backup-dir", cfg.BackupDir, "Directory backups are saved to. Defaults to next to the install.")
+	fs.StringVar(&cfg.ControllerDir, "controller-dir", cfg.ControllerDir, "Folder controller profiles are exported to and restored from after updates.")
+	fs.StringVar(&cfg.GeckoSource, "gecko-source", cfg.GeckoSource, "File or url of the Gecko code list gecko add uses when none is passed.")
+	fs.IntVar(&cfg.Connections, "connections", cfg.Connections, "Number of connections a download is split over, 1 to disable.")
+	fs.IntVar(&cfg.ExtractWorkers, "extract-workers", cfg.ExtractWorkers, "Number of files extracted at once, 1 to extract one at a time.")
+	fs.IntVar(&cfg.MinSpeedKB, "min-speed-kb", cfg.MinSpeedKB, "Download speed in KB/s below which we switch to a mirror, 0 to disable.")
+	fs.StringVar(&cfg.LimitRate, "limit-rate", cfg.LimitRate, "Maximum download speed such as 500K or 2M, empty for no limit.")
+	fs.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "Proxy for all requests such as http://host:port or socks5://host:port. Defaults to the proxy environment variables.")
+	fs.StringVar(&cfg.LANCache, "lan-cache", cfg.LANCache, "Address of a serve-cache on the LAN such as http://host:8484, downloads are tried from it first.")
+	fs.StringVar(&cfg.PostUpdateCommand, "post-update-command", cfg.PostUpdateCommand, "Command to run after a successful update.")
+	fs.BoolVar(&cfg.HealthCheck, "health-check", cfg.HealthCheck, "Start the new Dolphin with --version after an update and restore the previous version if it fails.")
+	fs.BoolVar(&cfg.CleanupOrphans, "cleanup-orphans", cfg.CleanupOrphans, "Remove the files of the previous version the new one no longer has after an update.")
+	fs.StringVar(&cfg.Prerequisites, "prerequisites", cfg.Prerequisites, "What app-update does about missing runtimes such as the Visual C++ Redistributable: ask, install or skip.")
+	fs.StringVar(&cfg.UpdateWebhook, "update-webhook", cfg.UpdateWebhook, "URL told when an update succeeds or fails, such as a Discord webhook.")
+	fs.StringVar(&cfg.WebhookFormat, "webhook-format", cfg.WebhookFormat, "Format of the webhook posts: generic json or discord. Detected from the url if empty.")
+}
+
+// args converts the config back into flags such that it can be forwarded to a relaunched updater
+func (cfg toolsConfig) args() []string {
+	return []string{
+		"-endpoint", cfg.Endpoint,
+		"-fallback-endpoints", cfg.FallbackEndpoints,
+		"-user-endpoint", cfg.UserEndpoint,
+		"-provider", cfg.Provider,
+		"-rest-endpoint", cfg.RESTEndpoint,
+		"-cache-ttl-minutes", strconv.Itoa(cfg.CacheTTLMinutes),
+		fmt.Sprintf("-no-cache=%t", cfg.NoCache),
+		"-channel", cfg.Channel,
+		"-target", cfg.Target,
+		"-install-dir", cfg.InstallDir,
+		"-temp-dir", cfg.TempDir,
+		"-timeout", strconv.Itoa(cfg.TimeoutSeconds),
+		"-retries", strconv.Itoa(cfg.Retries),
+		"-max-file-mb", strconv.Itoa(cfg.MaxFileMB),
+		"-max-extract-mb", strconv.Itoa(cfg.MaxExtractMB),
+		"-backup-dir", cfg.BackupDir,
+		"-controller-dir", cfg.ControllerDir,
+		"-gecko-source", cfg.GeckoSource,
+		"-connections", strconv.Itoa(cfg.Connections),
+		"-extract-workers", strconv.Itoa(cfg.ExtractWorkers),
+		"-min-speed-kb", strconv.Itoa(cfg.MinSpeedKB),
+		"-limit-rate", cfg.LimitRate,
+		"-proxy", cfg.Proxy,
+		"-lan-cache", cfg.LANCache,
+		"-post-update-command", cfg.PostUpdateCommand,
+		fmt.Sprintf("-health-check=%t", cfg.HealthCheck),
+		fmt.Sprintf("-cleanup-orphans=%t", cfg.CleanupOrphans),
+		"-prerequisites", cfg.Prerequisites,
+		"-update-webhook", cfg.UpdateWebhook,
+		"-webhook-format", cfg.WebhookFormat,
+	}
+}
+
+// dolphinType is the Dolphin build the install is, picked by -target or detected from the install
+func (cfg toolsConfig) dolphinType() string {
+	if cfg.Target != "" {
+		return cfg.Target
+	}
+
+	return installType(cfg.InstallDir)
+}
+
+var validChannels = []string{"stable", "beta", "nightly"}
+
+// channel decides which release channel to update from. An explicit channel from config, env or
+// flags wins, then the preference saved with the channel command. Otherwise we stay on the channel
+// of the installed version
+func (cfg toolsConfig) channel(installedVersion string) string {
+	if cfg.Channel != "" && isValidChannel(cfg.Channel) {
+		return cfg.Channel
+	} else if cfg.Channel != "" {
+		log.Printf("Ignoring unknown channel %s\n", cfg.Channel)
+	}
+
+	if saved := loadState(cfg.InstallDir).Channel; saved != "" {
+		return saved
+	}
+
+	if tag := semver.PrereleaseTag(installedVersion); isValidChannel(tag) {
+		return tag
+	}
+
+	return "stable"
+}
+
+func isValidChannel(channel string) bool {
+	for _, valid := range validChannels {
+		if channel == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cfg toolsConfig) timeout() time.Duration {
+	return time.Duration(cfg.TimeoutSeconds) * time.Second
+}
+
+func (cfg toolsConfig) cacheTTL() time.Duration {
+	return time.Duration(cfg.CacheTTLMinutes) * time.Minute
+}
+
+func (cfg toolsConfig) minSpeed() float64 {
+	return float64(cfg.MinSpeedKB) * 1024
+}
+
+// limitRate returns the download limit in bytes per second, 0 if there is none
+func (cfg toolsConfig) limitRate() int64 {
+	if cfg.LimitRate == "" {
+		return 0
+	}
+
+	rate, err := updater.ParseRate(cfg.LimitRate)
+	if err != nil {
+		log.Printf("Ignoring download limit. %s\n", err.Error())
+		return 0
+	}
+
+	return rate
+}
+
+func (cfg toolsConfig) extractLimits() updater.ExtractLimits {
+	return updater.ExtractLimits{
+		MaxFileBytes:  uint64(cfg.MaxFileMB) * 1024 * 1024,
+		MaxTotalBytes: uint64(cfg.MaxExtractMB) * 1024 * 1024,
+	}
+}
+
+func (cfg toolsConfig) extractOptions() updater.ExtractOptions {
+	return updater.ExtractOptions{Limits: cfg.extractLimits(), IsDolphinExe: isDolphinExe, Progress: progress, Workers: cfg.ExtractWorkers}
+}
+
+// transport is the base of every client such that the proxy applies to all network calls
+func (cfg toolsConfig) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.timeout()
+
+	if cfg.Proxy == "" {
+		return transport
+	}
+
+	proxyURL, err := url.Parse(cfg.Proxy)
+	if err != nil || proxyURL.Host == "" || !containsFold([]string{"http", "https", "socks5", "socks5h"}, proxyURL.Scheme) {
+		log.Printf("Ignoring invalid proxy %s, expected something like http://host:port or socks5://host:port\n", cfg.Proxy)
+		return transport
+	}
+
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport
+}
+
+// httpClient returns a client for API requests which should always complete quickly. Each
+// attempt is bounded by the timeout, temporary failures are retried with backoff
+func (cfg toolsConfig) httpClient() *http.Client {
+	transport := cfg.transport()
+
+	return &http.Client{
+		Transport: &slippiapi.RetryTransport{Base: transport, Retries: cfg.Retries},
+		// Bounds the whole request including retries and reading the response
+		Timeout: time.Duration(cfg.Retries+1)*cfg.timeout() + time.Duration(cfg.Retries)*slippiapi.RetryMaxDelay,
+	}
+}
+
+// downloadClient returns a client for large downloads. Only the wait for the response is bounded
+// since the download itself can legitimately take a long time on slow connections
+func (cfg toolsConfig) downloadClient() *http.Client {
+	return &http.Client{Transport: cfg.transport()}
+}
+
+func (cfg toolsConfig) downloader() updater.Downloader {
+	return updater.Downloader{
+		Client:              cfg.downloadClient(),
+		Connections:         cfg.Connections,
+		Retries:             cfg.Retries,
+		MinBytesPerSecond:   cfg.minSpeed(),
+		LimitBytesPerSecond: cfg.limitRate(),
+		Progress:            progress,
+		Cache:               cfg.LANCache,
+	}
+}
+
+func execConfig(cfg toolsConfig, asJSON bool) {
+	if asJSON && jsonOutput {
+		emitResult("config", cfg)
+		return
+	} else if asJSON {
+		contents, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(string(contents))
+		return
+	}
+
+	channel := cfg.Channel
+	if channel == "" {
+		channel = "auto"
+	}
+
+	cacheTTL := fmt.Sprintf("%d min", cfg.CacheTTLMinutes)
+	if cfg.NoCache {
+		cacheTTL = "disabled"
+	}
+
+	provider := cfg.Provider
+	if provider == "" {
+		provider = "auto"
+	}
+
+	tempDir := cfg.TempDir
+	if tempDir == "" {
+		tempDir = "(install directory)"
+	}
+
+	fmt.Printf("Provider:    %s\n", provider)
+	fmt.Printf("REST:        %s\n", cfg.RESTEndpoint)
+	fmt.Printf("Endpoints:   %s\n", strings.Join(cfg.endpoints(), ", "))
+	fmt.Printf("Cache TTL:   %s\n", cacheTTL)
+	fmt.Printf("Channel:     %s\n", channel)
+	fmt.Printf("Target:      %s\n", cfg.dolphinType())
+	fmt.Printf("Install dir: %s\n", cfg.InstallDir)
+	fmt.Printf("Portable:    %t\n", isPortableInstall(cfg.InstallDir))
+	fmt.Printf("Temp dir:    %s\n", tempDir)
+	fmt.Printf("Timeout:     %s\n", cfg.timeout())
+	fmt.Printf("Retries:     %d\n", cfg.Retries)
+	fmt.Printf("Max file:    %d MB\n", cfg.MaxFileMB)
+	fmt.Printf("Max extract: %d MB\n", cfg.MaxExtractMB)
+	fmt.Printf("Backup dir:  %s\n", cfg.backupDir())
+	fmt.Printf("Connections: %d\n", cfg.Connections)
+	fmt.Printf("Extractors:  %d\n", cfg.ExtractWorkers)
+	fmt.Printf("Min speed:   %d KB/s\n", cfg.MinSpeedKB)
+	fmt.Printf("Rate limit:  %s\n", cfg.LimitRate)
+	fmt.Printf("Proxy:       %s\n", cfg.Proxy)
+	fmt.Printf("LAN cache:   %s\n", cfg.LANCache)
+	fmt.Printf("Post-update: %s\n", cfg.PostUpdateCommand)
+	fmt.Printf("Start check: %t\n", cfg.HealthCheck)
+	fmt.Printf("Cleanup:     %t\n", cfg.CleanupOrphans)
+	fmt.Printf("Prereqs:     %s\n", cfg.Prerequisites)
+	fmt.Printf("Webhook:     %s\n", redactWebhook(cfg.UpdateWebhook))
+}
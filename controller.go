@@ -0,0 +1,400 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const (
+	controllerInfoName    = "controller.json"
+	controllerConfigName  = "GCPadNew.ini"
+	controllerProfilesDir = "Profiles/GCPad"
+)
+
+// adapterSettings are the [Core] keys of Dolphin.ini that pick what is plugged into each port and
+// how the GameCube adapter behaves, a digit from 0 to 3 is appended for the port
+var adapterSettings = []string{"SIDevice", "AdapterRumble", "SimulateKonga"}
+
+// controllerInfo is written into every bundle next to the controller files
+type controllerInfo struct {
+	Version   string            `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Adapter   map[string]string `json:"adapter"`
+}
+
+// controllerBundle is GCPadNew.ini, the GCPad profiles and the adapter settings of a user folder.
+// Files are keyed by their slash separated path inside the Config folder
+type controllerBundle struct {
+	Info  controllerInfo
+	Files map[string][]byte
+}
+
+// controllerResult is reported by controller export and import
+type controllerResult struct {
+	Path     string   `json:"path"`
+	Profiles []string `json:"profiles"`
+	Adapter  int      `json:"adapter"`
+}
+
+// isControllerFile limits bundles to the files controller import is allowed to write
+func isControllerFile(rel string) bool {
+	if rel == controllerConfigName {
+		return true
+	}
+
+	dir, name := filepath.ToSlash(filepath.Dir(rel)), filepath.Base(rel)
+	return dir == controllerProfilesDir && strings.EqualFold(filepath.Ext(name), ".ini") && updater.IsSafeRelPath(rel)
+}
+
+func (bundle controllerBundle) profiles() []string {
+	profiles := []string{}
+	for rel := range bundle.Files {
+		if rel != controllerConfigName {
+			profiles = append(profiles, strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel)))
+		}
+	}
+	sort.Strings(profiles)
+
+	return profiles
+}
+
+// collectControllers reads the controller files and adapter settings of the user folder
+func collectControllers(exPath, userDir string) (controllerBundle, error) {
+	bundle := controllerBundle{
+		Info:  controllerInfo{Version: readInstalledVersion(exPath), CreatedAt: time.Now(), Adapter: map[string]string{}},
+		Files: map[string][]byte{},
+	}
+	configDir := filepath.Join(userDir, "Config")
+
+	contents, err := ioutil.ReadFile(filepath.Join(configDir, controllerConfigName))
+	if err == nil {
+		bundle.Files[controllerConfigName] = contents
+	} else if !os.IsNotExist(err) {
+		return bundle, err
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(configDir, filepath.FromSlash(controllerProfilesDir)))
+	if err != nil && !os.IsNotExist(err) {
+		return bundle, err
+	}
+	for _, entry := range entries {
+		rel := controllerProfilesDir + "/" + entry.Name()
+		if entry.IsDir() || !isControllerFile(rel) {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(configDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return bundle, err
+		}
+		bundle.Files[rel] = contents
+	}
+
+	dolphinConfig, err := readDolphinConfig(userDir, "Dolphin")
+	if err != nil {
+		return bundle, err
+	}
+	core := dolphinConfig.section("[Core]")
+	for _, setting := range adapterSettings {
+		for port := 0; port < 4; port++ {
+			key := setting + strconv.Itoa(port)
+			if value, ok := core.value(key); ok {
+				bundle.Info.Adapter[key] = value
+			}
+		}
+	}
+
+	return bundle, nil
+}
+
+// writeControllerBundle saves the bundle as a zip, or as plain files when path is a folder such
+// as the sync folder
+func writeControllerBundle(path string, bundle controllerBundle) error {
+	info, err := json.MarshalIndent(bundle.Info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		for rel, contents := range bundle.Files {
+			err = os.MkdirAll(filepath.Dir(filepath.Join(path, filepath.FromSlash(rel))), 0755)
+			if err == nil {
+				err = fsutil.WriteFileAtomic(filepath.Join(path, filepath.FromSlash(rel)), contents, 0644)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return fsutil.WriteFileAtomic(filepath.Join(path, controllerInfoName), info, 0644)
+	}
+
+	files := map[string][]byte{controllerInfoName: info}
+	for rel, contents := range bundle.Files {
+		files[rel] = contents
+	}
+	return writeZipFiles(path, files, bundle.Info.CreatedAt)
+}
+
+// writeZipFiles writes the files into a new zip at path, which only appears once it is complete
+func writeZipFiles(path string, files map[string][]byte, modified time.Time) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(path + ".part")
+	if err != nil {
+		return err
+	}
+
+	writer := zip.NewWriter(out)
+	for name, contents := range files {
+		var w io.Writer
+		w, err = writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err == nil {
+			_, err = w.Write(contents)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	out.Close()
+	if err != nil {
+		os.Remove(path + ".part")
+		return err
+	}
+
+	return os.Rename(path+".part", path)
+}
+
+// readControllerBundle reads a bundle written by writeControllerBundle. Entries that aren't
+// controller files are ignored
+func readControllerBundle(path string) (controllerBundle, error) {
+	bundle := controllerBundle{Files: map[string][]byte{}}
+	files := map[string][]byte{}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return bundle, err
+	}
+
+	if stat.IsDir() {
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel != controllerInfoName && !isControllerFile(rel) {
+				return nil
+			}
+
+			files[rel], err = ioutil.ReadFile(file)
+			return err
+		})
+	} else {
+		files, err = readZipFiles(path, func(name string) bool {
+			return name == controllerInfoName || isControllerFile(name)
+		})
+	}
+	if err != nil {
+		return bundle, err
+	}
+
+	info, ok := files[controllerInfoName]
+	if !ok {
+		return bundle, fmt.Errorf("%s is missing", controllerInfoName)
+	}
+	err = json.Unmarshal(info, &bundle.Info)
+	if err != nil {
+		return bundle, err
+	}
+
+	delete(files, controllerInfoName)
+	bundle.Files = files
+	return bundle, nil
+}
+
+// readZipFiles reads the entries of the zip that keep accepts
+func readZipFiles(path string, keep func(name string) bool) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return files, err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if !keep(file.Name) {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return files, err
+		}
+		files[file.Name], err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
+}
+
+// applyControllerBundle writes the controller files into the user folder and sets the adapter
+// settings in Dolphin.ini. Profiles that aren't in the bundle are kept
+func applyControllerBundle(userDir string, bundle controllerBundle) error {
+	configDir := filepath.Join(userDir, "Config")
+	for rel, contents := range bundle.Files {
+		path := filepath.Join(configDir, filepath.FromSlash(rel))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(path, contents, 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(bundle.Info.Adapter) == 0 {
+		return nil
+	}
+
+	dolphinConfig, err := readDolphinConfig(userDir, "Dolphin")
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	for key := range bundle.Info.Adapter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dolphinConfig.set("[Core]", key, bundle.Info.Adapter[key])
+	}
+
+	return writeDolphinConfig(userDir, "Dolphin", dolphinConfig)
+}
+
+// defaultControllerPath is where export writes and import reads without a path, the sync folder
+// if one is configured
+func defaultControllerPath(cfg toolsConfig) string {
+	if cfg.ControllerDir != "" {
+		return cfg.ControllerDir
+	}
+
+	return filepath.Join(cfg.backupDir(), fmt.Sprintf("controllers-%s.zip", time.Now().Format("20060102-150405")))
+}
+
+// execController exports the controller setup of the install to a file or the sync folder, or
+// imports it back
+func execController(cfg toolsConfig, userDir, action, path string) (result controllerResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered copying controllers")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	switch action {
+	case "export":
+		if path == "" {
+			path = defaultControllerPath(cfg)
+		}
+
+		bundle, err := collectControllers(cfg.InstallDir, userDir)
+		if err != nil {
+			log.Panicf("Failed to read the controller config. %s", err.Error())
+		}
+		if len(bundle.Files) == 0 && len(bundle.Info.Adapter) == 0 {
+			failf(exitGeneric, "No controller config found in %s", userDir)
+		}
+
+		err = writeControllerBundle(path, bundle)
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", path, err.Error())
+		}
+
+		result = controllerResult{Path: path, Profiles: bundle.profiles(), Adapter: len(bundle.Info.Adapter)}
+		fmt.Printf("Exported %d controller profiles and %d adapter settings to %s\n", len(result.Profiles), result.Adapter, path)
+		return result, nil
+	case "import":
+		if path == "" && cfg.ControllerDir == "" {
+			failf(exitGeneric, "Must provide the file to import, or set controllerDir")
+		}
+		if path == "" {
+			path = cfg.ControllerDir
+		}
+
+		// Dolphin writes GCPadNew.ini when it closes, which would undo the import
+		if len(findDolphinProcesses(cfg.InstallDir)) > 0 {
+			failf(exitGeneric, "Close Dolphin before importing controllers, it overwrites them when it closes")
+		}
+
+		bundle, err := readControllerBundle(path)
+		if err != nil {
+			failf(exitInstall, "%s is not a controller export. %s", path, err.Error())
+		}
+
+		err = applyControllerBundle(userDir, bundle)
+		if err != nil {
+			log.Panicf("Failed to write the controller config. %s", err.Error())
+		}
+
+		result = controllerResult{Path: path, Profiles: bundle.profiles(), Adapter: len(bundle.Info.Adapter)}
+		fmt.Printf("Imported %d controller profiles and %d adapter settings from %s\n", len(result.Profiles), result.Adapter, path)
+		return result, nil
+	}
+
+	log.Panicf("Unknown controller action %s, must be export or import", action)
+	return result, nil
+}
+
+// syncControllers restores the controllers from the sync folder after the install was changed, a
+// failure only leaves the controllers as they were
+func syncControllers(cfg toolsConfig) {
+	if cfg.ControllerDir == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ControllerDir, controllerInfoName)); err != nil {
+		return
+	}
+
+	bundle, err := readControllerBundle(cfg.ControllerDir)
+	if err == nil {
+		err = applyControllerBundle(dolphinUserDir(cfg.InstallDir), bundle)
+	}
+	if err != nil {
+		log.Printf("Failed to restore controllers from %s. %s\n", cfg.ControllerDir, err.Error())
+		return
+	}
+
+	log.Printf("Restored controllers from %s\n", cfg.ControllerDir)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// deltaManifest describes the contents of a patch set archive. Patched files are stored at
+// patches/<path>.bsdiff and added files at files/<path>
+type deltaManifest struct {
+	BaseVersion string      `json:"baseVersion"`
+	Version     string      `json:"version"`
+	Files       []deltaFile `json:"files"`
+}
+
+type deltaFile struct {
+	Path       string `json:"path"`
+	Action     string `json:"action"`
+	BaseSHA256 string `json:"baseSha256"`
+	SHA256     string `json:"sha256"`
+}
+
+// applyDeltaUpdate tries to update the install by patching only the files that changed. Returns an
+// error without touching the install if the patch set can't be used, in which case the caller
+// should fall back to a full download
+func applyDeltaUpdate(ctx context.Context, cfg toolsConfig, exPath, stagingDir, prevVersion string, latest slippiapi.DolphinVersion) error {
+	if prevVersion == "" {
+		return errors.New("installed version is unknown")
+	}
+
+	delta, err := getDelta(ctx, cfg, prevVersion, latest.Version)
+	if err != nil {
+		return err
+	}
+	if delta.URL == "" {
+		return errors.New("no patch set available")
+	}
+	if delta.BaseVersion != prevVersion {
+		return fmt.Errorf("patch set is for %s but %s is installed", delta.BaseVersion, prevVersion)
+	}
+
+	patchPath := filepath.Join(stagingDir, "dolphin-patch.zip")
+	err = cfg.downloader().Download(ctx, patchPath, []string{delta.URL}, delta.SHA256, updater.ValidateArchive)
+	if err != nil {
+		return err
+	}
+
+	err = verifyReleaseSignature(patchPath, delta.Signature)
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.OpenReader(patchPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	manifest, err := readDeltaManifest(&reader.Reader)
+	if err != nil {
+		return err
+	}
+
+	// Build every changed file next to the install first, nothing in the install changes until all
+	// of them have been verified
+	newDir, err := ioutil.TempDir(exPath, "dolphin-delta")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(newDir)
+
+	files := []updater.UpdatedFile{}
+	for _, file := range manifest.Files {
+		if !updater.IsSafeRelPath(file.Path) {
+			return fmt.Errorf("patch set contains invalid path %s", file.Path)
+		}
+		if file.Action == "delete" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		contents, perm, err := buildDeltaFile(&reader.Reader, exPath, file)
+		if err != nil {
+			return fmt.Errorf("failed to build %s. %s", file.Path, err.Error())
+		}
+
+		target := filepath.Join(newDir, filepath.FromSlash(file.Path))
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(target, contents, perm)
+		if err != nil {
+			return err
+		}
+		// WriteFile is subject to the umask, the file must end up with the same mode as a full install
+		err = os.Chmod(target, perm)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, updater.UpdatedFile{Path: file.Path, Size: int64(len(contents))})
+	}
+
+	if latest.ExeSHA256 != "" && deltaChangesExe(manifest.Files) {
+		err = updater.VerifyFileHash(findDolphinExe(newDir), latest.ExeSHA256)
+		if err != nil {
+			return fmt.Errorf("patched Dolphin failed verification. %s", err.Error())
+		}
+	}
+
+	// Last chance to stop before the install changes
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	journal, err := beginJournal(exPath, "update", prevVersion, latest.Version, newDir)
+	if err != nil {
+		return err
+	}
+
+	err = swapDeltaFiles(journal, exPath, newDir, manifest.Files)
+	if err != nil {
+		journal.finish()
+		return fmt.Errorf("failed to apply patch set, previous version was restored. %s", err.Error())
+	}
+
+	// Same checks as a full install, the journal can still put the previous version back
+	err = checkDeltaInstall(ctx, cfg, exPath, latest)
+	if err != nil {
+		journal.rollback()
+		journal.finish()
+		return fmt.Errorf("%s, previous version was restored", err.Error())
+	}
+
+	journal.Files = files
+	journal.setPhase(journalFinishing)
+	journal.finishUpdate()
+	journal.finish()
+
+	return nil
+}
+
+func getDelta(ctx context.Context, cfg toolsConfig, fromVersion, toVersion string) (slippiapi.DolphinDelta, error) {
+	var delta slippiapi.DolphinDelta
+	err := queryProviders(ctx, cfg, "", &delta, func(provider slippiapi.Provider) (err error) {
+		delta, err = provider.Delta(ctx, fromVersion, toVersion)
+		return err
+	})
+
+	return delta, err
+}
+
+func readDeltaManifest(reader *zip.Reader) (deltaManifest, error) {
+	var manifest deltaManifest
+
+	contents, err := readZipEntry(reader, "manifest.json")
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(contents, &manifest)
+	return manifest, err
+}
+
+func readZipEntry(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return ioutil.ReadAll(f)
+	}
+
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+func zipEntryMode(reader *zip.Reader, name string) os.FileMode {
+	for _, file := range reader.File {
+		if file.Name == name {
+			return file.Mode().Perm()
+		}
+	}
+
+	return 0
+}
+
+// buildDeltaFile produces the new contents for a patched or added file and checks its hash. A
+// patched file keeps the mode of the installed one, an added file takes the mode stored in the
+// patch set
+func buildDeltaFile(reader *zip.Reader, exPath string, file deltaFile) ([]byte, os.FileMode, error) {
+	var contents []byte
+	var perm os.FileMode
+	switch file.Action {
+	case "add":
+		name := "files/" + file.Path
+		added, err := readZipEntry(reader, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		contents = added
+		perm = zipEntryMode(reader, name)
+	case "patch":
+		installPath := filepath.Join(exPath, filepath.FromSlash(file.Path))
+		info, err := os.Stat(installPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		perm = info.Mode().Perm()
+
+		old, err := ioutil.ReadFile(installPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		if file.BaseSHA256 != "" && !hashMatches(old, file.BaseSHA256) {
+			return nil, 0, errors.New("installed file doesn't match the patch base")
+		}
+
+		patch, err := readZipEntry(reader, "patches/"+file.Path+".bsdiff")
+		if err != nil {
+			return nil, 0, err
+		}
+		contents, err = updater.Bspatch(old, patch)
+		if err != nil {
+			return nil, 0, err
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown action %s", file.Action)
+	}
+
+	if !hashMatches(contents, file.SHA256) {
+		return nil, 0, errors.New("result doesn't match expected hash")
+	}
+
+	// Same as a full install, Dolphin has to be runnable even if the patch set carries no unix
+	// permissions
+	if isDolphinExe(file.Path) {
+		perm |= 0111
+	}
+
+	return contents, perm, nil
+}
+
+func deltaChangesExe(files []deltaFile) bool {
+	for _, file := range files {
+		if isDolphinExe(file.Path) && file.Action != "delete" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDeltaInstall runs the checks installArchive does on a freshly swapped install
+func checkDeltaInstall(ctx context.Context, cfg toolsConfig, exPath string, latest slippiapi.DolphinVersion) error {
+	if latest.ExeSHA256 != "" {
+		err := updater.VerifyFileHash(findDolphinExe(exPath), latest.ExeSHA256)
+		if err != nil {
+			return fmt.Errorf("patched Dolphin failed verification. %s", err.Error())
+		}
+	}
+
+	if cfg.HealthCheck {
+		version, err := checkDolphinStarts(ctx, exPath)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("patched Dolphin failed to start. %s", err.Error())
+		}
+		if version != "" {
+			log.Printf("Health check passed: %s\n", version)
+		}
+	}
+
+	return nil
+}
+
+func hashMatches(contents []byte, expected string) bool {
+	hash := sha256.Sum256(contents)
+	return strings.EqualFold(hex.EncodeToString(hash[:]), expected)
+}
+
+// swapDeltaFiles moves the built files into the install, backing up each file it replaces or
+// deletes. The exe is swapped last. On failure everything is put back
+func swapDeltaFiles(journal *updateJournal, exPath, newDir string, files []deltaFile) error {
+	backupDir := filepath.Join(exPath, backupDirName)
+	err := os.RemoveAll(backupDir)
+	if err != nil {
+		return err
+	}
+
+	ordered := []deltaFile{}
+	exeFiles := []deltaFile{}
+	for _, file := range files {
+		if isDolphinExe(file.Path) {
+			exeFiles = append(exeFiles, file)
+		} else {
+			ordered = append(ordered, file)
+		}
+	}
+	ordered = append(ordered, exeFiles...)
+
+	for _, file := range ordered {
+		relPath := filepath.FromSlash(file.Path)
+		installPath := filepath.Join(exPath, relPath)
+
+		if _, err := os.Stat(installPath); err == nil {
+			err = journal.move(installPath, filepath.Join(backupDir, relPath))
+			if err != nil {
+				journal.rollback()
+				return err
+			}
+		}
+
+		if file.Action == "delete" {
+			continue
+		}
+
+		err = journal.move(filepath.Join(newDir, relPath), installPath)
+		if err != nil {
+			journal.rollback()
+			return err
+		}
+	}
+
+	return nil
+}
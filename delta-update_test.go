@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+func TestBuildDeltaFileMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		zipPerm  os.FileMode
+		file     deltaFile
+		expected os.FileMode
+	}{
+		{"added file keeps its mode", 0644, deltaFile{Path: "Sys/GameSettings/GALE01.ini", Action: "add"}, 0644},
+		{"added script stays executable", 0755, deltaFile{Path: "run.sh", Action: "add"}, 0755},
+		{"added exe becomes executable", 0644, deltaFile{Path: dolphinExeNames[0], Action: "add"}, 0755},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := []byte(tt.name)
+			hash := sha256.Sum256(contents)
+			tt.file.SHA256 = hex.EncodeToString(hash[:])
+
+			buf := &bytes.Buffer{}
+			w := zip.NewWriter(buf)
+			header := &zip.FileHeader{Name: "files/" + tt.file.Path, Method: zip.Store}
+			header.SetMode(tt.zipPerm)
+			f, err := w.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(contents)
+			w.Close()
+
+			reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			built, perm, err := buildDeltaFile(reader, t.TempDir(), tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(built, contents) {
+				t.Errorf("contents = %q, want %q", built, contents)
+			}
+			if perm != tt.expected {
+				t.Errorf("mode = %v, want %v", perm, tt.expected)
+			}
+		})
+	}
+}
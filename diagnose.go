@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Only recent Dolphin logs are relevant and they can grow large, we keep the end of each
+const dolphinLogMaxAge = 7 * 24 * time.Hour
+const dolphinLogMaxBytes = 2 * 1024 * 1024
+
+// Hosts the tools talk to besides the API endpoints. Downloads come from GitHub releases
+var diagnoseHosts = []string{
+	"https://github.com",
+}
+
+// reachabilityResult is one row of network.json in the bundle
+type reachabilityResult struct {
+	URL       string   `json:"url"`
+	Addresses []string `json:"addresses,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	LatencyMS int64    `json:"latencyMs,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// execDiagnose collects everything support usually asks for into a single zip. Every part is best
+// effort, a missing piece is noted in the bundle instead of failing the command
+func execDiagnose(cfg toolsConfig, userDir, output string) (string, error) {
+	exPath := cfg.InstallDir
+	if userDir == "" {
+		userDir = dolphinUserDir(exPath)
+	}
+	if output == "" {
+		output = filepath.Join(exPath, fmt.Sprintf("slippi-diagnostics-%s.zip", time.Now().Format("20060102-150405")))
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	notes := []string{}
+	addNote := func(format string, args ...interface{}) {
+		note := fmt.Sprintf(format, args...)
+		log.Printf("Warning: %s\n", note)
+		notes = append(notes, note)
+	}
+
+	fmt.Println("Collecting system info...")
+	addZipBytes(writer, "system.txt", []byte(systemInfo(cfg)))
+
+	contents, err := redactedUserFile(cfg)
+	if err != nil {
+		addNote("Could not read user.json. %s", err.Error())
+	} else {
+		addZipBytes(writer, "user.json", contents)
+	}
+
+	for _, name := range []string{"last-failure.json", "last-update-files.json"} {
+		err = addZipFile(writer, filepath.Join(exPath, name), name, 0)
+		if err != nil && !os.IsNotExist(err) {
+			addNote("Could not add %s. %s", name, err.Error())
+		}
+	}
+
+	// Older rotated logs are included too since the failure may have happened a few runs back
+	logPaths, _ := filepath.Glob(filepath.Join(exPath, logDirName, logFileName+"*"))
+	for _, path := range logPaths {
+		err = addZipFile(writer, path, "tools-logs/"+filepath.Base(path), 0)
+		if err != nil {
+			addNote("Could not add %s. %s", path, err.Error())
+		}
+	}
+
+	dolphinLogs, err := ioutil.ReadDir(filepath.Join(userDir, "Logs"))
+	if err != nil {
+		addNote("Could not read Dolphin logs in %s. %s", userDir, err.Error())
+	}
+	for _, info := range dolphinLogs {
+		if info.IsDir() || time.Since(info.ModTime()) > dolphinLogMaxAge {
+			continue
+		}
+
+		path := filepath.Join(userDir, "Logs", info.Name())
+		err = addZipFile(writer, path, "dolphin-logs/"+info.Name(), dolphinLogMaxBytes)
+		if err != nil {
+			addNote("Could not add %s. %s", path, err.Error())
+		}
+	}
+
+	fmt.Println("Checking network reachability...")
+	contents, err = json.MarshalIndent(checkReachability(cfg), "", "  ")
+	if err == nil {
+		addZipBytes(writer, "network.json", contents)
+	}
+
+	if len(notes) > 0 {
+		addZipBytes(writer, "notes.txt", []byte(strings.Join(notes, "\n")+"\n"))
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Diagnostics saved to %s, post this file in the Slippi Discord when asking for help\n", output)
+	return output, nil
+}
+
+func systemInfo(cfg toolsConfig) string {
+	var b strings.Builder
+
+	dolphinVersion := readInstalledVersion(cfg.InstallDir)
+	if dolphinVersion == "" {
+		dolphinVersion = "unknown"
+	}
+
+	fmt.Fprintf(&b, "Created:              %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "dolphin-slippi-tools: %s\n", toolsVersion)
+	fmt.Fprintf(&b, "Dolphin:              %s\n", dolphinVersion)
+	fmt.Fprintf(&b, "Channel:              %s\n", cfg.channel(dolphinVersion))
+	fmt.Fprintf(&b, "Platform:             %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Install dir:          %s\n", cfg.InstallDir)
+	fmt.Fprintf(&b, "Portable:             %t\n", isPortableInstall(cfg.InstallDir))
+	fmt.Fprintf(&b, "Endpoints:            %s\n", strings.Join(cfg.endpoints(), ", "))
+	fmt.Fprintf(&b, "Proxy:                %s\n", redactURL(cfg.Proxy))
+
+	for _, section := range systemCommands() {
+		fmt.Fprintf(&b, "\n== %s ==\n", strings.Join(section, " "))
+
+		output, err := exec.Command(section[0], section[1:]...).CombinedOutput()
+		if err != nil {
+			fmt.Fprintf(&b, "failed: %s\n", err.Error())
+		}
+		b.Write(bytes.TrimSpace(output))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// systemCommands lists the commands whose output describes the OS and GPU on each platform
+func systemCommands() [][]string {
+	switch runtime.GOOS {
+	case "windows":
+		return [][]string{
+			{"cmd", "/c", "ver"},
+			{"wmic", "path", "win32_VideoController", "get", "Name,DriverVersion,VideoModeDescription"},
+		}
+	case "darwin":
+		return [][]string{
+			{"sw_vers"},
+			{"system_profiler", "SPDisplaysDataType"},
+		}
+	}
+
+	return [][]string{
+		{"uname", "-a"},
+		{"cat", "/etc/os-release"},
+		{"sh", "-c", "lspci | grep -iE 'vga|3d|display'"},
+		{"glxinfo", "-B"},
+	}
+}
+
+// redactedUserFile returns user.json with the playKey removed, it grants access to the account
+func redactedUserFile(cfg toolsConfig) ([]byte, error) {
+	path, err := userFilePath(cfg, "netplay", "")
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoded generically such that fields we don't know about are kept for support to see
+	user := map[string]interface{}{}
+	err = json.Unmarshal(contents, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := user["playKey"]; ok {
+		user["playKey"] = "REDACTED"
+	}
+
+	return json.MarshalIndent(user, "", "  ")
+}
+
+// redactURL hides the password of a proxy url
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), "REDACTED")
+	}
+
+	return parsed.String()
+}
+
+// checkReachability resolves and requests every host the tools use, through the configured proxy
+// but without retries such that the result reflects a single attempt
+func checkReachability(cfg toolsConfig) []reachabilityResult {
+	client := &http.Client{Transport: cfg.transport(), Timeout: cfg.timeout()}
+
+	results := []reachabilityResult{}
+	targets := append(joinEndpoints(cfg.RESTEndpoint), cfg.endpoints()...)
+	targets = append(append(targets, cfg.userEndpoints()...), diagnoseHosts...)
+	for _, target := range targets {
+		result := reachabilityResult{URL: target}
+
+		parsed, err := url.Parse(target)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.Addresses, err = net.LookupHost(parsed.Hostname())
+		if err != nil {
+			// With a proxy the lookup is done by the proxy so the request may still succeed
+			result.Error = fmt.Sprintf("dns: %s", err.Error())
+		}
+
+		start := time.Now()
+		resp, err := client.Get(target)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			resp.Body.Close()
+			result.Status = resp.Status
+			result.LatencyMS = time.Since(start).Milliseconds()
+		}
+
+		logDebugf("Reachability of %s: %+v", target, result)
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func addZipBytes(writer *zip.Writer, name string, contents []byte) error {
+	w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(contents)
+	return err
+}
+
+// addZipFile copies a file into the zip. With a limit only the last bytes are kept, the end of a
+// log is where the failure is
+func addZipFile(writer *zip.Writer, path, name string, limit int64) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if limit > 0 && info.Size() > limit {
+		_, err = in.Seek(-limit, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, in)
+	return err
+}
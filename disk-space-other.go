@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the file system of dir, the
+// blocks reserved for root don't count
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// volumeID tells file systems apart by their device
+func volumeID(dir string) (string, error) {
+	var stat syscall.Stat_t
+	err := syscall.Stat(dir, &stat)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(stat.Dev), nil
+}
@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// freeSpace returns the bytes available to us on the volume of dir, which respects quotas
+func freeSpace(dir string) (uint64, error) {
+	dirPtr, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	ret, _, callErr := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(dirPtr)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ret == 0 {
+		return 0, callErr
+	}
+
+	return available, nil
+}
+
+// volumeID tells volumes apart by drive letter or UNC share. Folders mounted into another
+// volume are counted with their drive, which only makes the check stricter
+func volumeID(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(filepath.VolumeName(abs)), nil
+}
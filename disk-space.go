@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// Dolphin builds compress to about a third of their size. Used until the archive is downloaded,
+// installArchive checks again with the exact size
+const extractRatioEstimate = 3
+
+// Room left on top of the estimate for logs, config and the file system's own overhead
+const diskSpaceMargin = 100 * 1024 * 1024
+
+// spaceNeed is space some step of the update will take up in a folder
+type spaceNeed struct {
+	Dir   string
+	Bytes uint64
+	What  string
+}
+
+// existingParent returns dir or its closest parent that exists, folders such as the backup folder
+// are only created once they are used
+func existingParent(dir string) string {
+	dir, _ = filepath.Abs(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// checkDiskSpace adds up what is needed on each volume and fails before anything is written when
+// one of them doesn't have room for it. A volume we can't query is skipped, the write errors
+// still catch it
+func checkDiskSpace(needs []spaceNeed) {
+	type volumeNeed struct {
+		dir   string
+		bytes uint64
+		what  []string
+	}
+
+	volumes := map[string]*volumeNeed{}
+	order := []string{}
+	for _, need := range needs {
+		if need.Bytes == 0 {
+			continue
+		}
+
+		dir := existingParent(need.Dir)
+		id, err := volumeID(dir)
+		if err != nil {
+			logDebugf("Could not find the volume of %s. %s", dir, err.Error())
+			continue
+		}
+
+		volume, ok := volumes[id]
+		if !ok {
+			volume = &volumeNeed{dir: dir}
+			volumes[id] = volume
+			order = append(order, id)
+		}
+		volume.bytes += need.Bytes
+		volume.what = append(volume.what, need.What)
+	}
+
+	for _, id := range order {
+		volume := volumes[id]
+		free, err := freeSpace(volume.dir)
+		if err != nil {
+			logDebugf("Could not get the free space of %s. %s", volume.dir, err.Error())
+			continue
+		}
+
+		logDebugf("%s needed on the volume of %s, %s free", updater.FormatBytes(int64(volume.bytes)), volume.dir, updater.FormatBytes(int64(free)))
+		if free < volume.bytes+diskSpaceMargin {
+			fmt.Printf("Free up %s on the drive of %s, or point -temp-dir or -backup-dir at another drive.\n", updater.FormatBytes(int64(volume.bytes+diskSpaceMargin-free)), volume.dir)
+			failf(exitNotWritable, "Not enough disk space for the %s, %s is needed on the drive of %s but only %s is free", strings.Join(volume.what, " and "), updater.FormatBytes(int64(volume.bytes)), volume.dir, updater.FormatBytes(int64(free)))
+		}
+	}
+}
+
+// installSize adds up what a backup of the install would hold, before compression
+func installSize(exPath string) uint64 {
+	entries, err := ioutil.ReadDir(exPath)
+	if err != nil {
+		return 0
+	}
+
+	var size uint64
+	for _, entry := range entries {
+		if isBackupExcluded(entry.Name()) {
+			continue
+		}
+
+		filepath.Walk(filepath.Join(exPath, entry.Name()), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				size += uint64(info.Size())
+			}
+			return nil
+		})
+	}
+
+	return size
+}
+
+// extractedSize adds up the sizes of the archive's entries. Only formats that list them without
+// unpacking are read, for the others 0 is returned
+func extractedSize(archivePath string) uint64 {
+	format, err := updater.DetectFormat(archivePath)
+	if err != nil || (format != updater.FormatZip && format != updater.FormatTarGz) {
+		return 0
+	}
+
+	archive, err := updater.OpenArchive(archivePath)
+	if err != nil {
+		return 0
+	}
+	defer archive.Close()
+
+	var size uint64
+	for _, entry := range archive.Entries() {
+		size += entry.Size
+	}
+
+	return size
+}
+
+// preflightDiskSpace checks that the download, the extracted files and the backup will fit before
+// anything is downloaded. Without a size from the server or the local archive there is nothing to
+// go on and the check is skipped
+func preflightDiskSpace(ctx context.Context, cfg toolsConfig, opts appUpdateOptions, stagingDir, exPath string, urls []string) {
+	var archiveSize int64
+	if opts.FromFile != "" {
+		if info, err := os.Stat(opts.FromFile); err == nil {
+			archiveSize = info.Size()
+		}
+	} else if len(urls) > 0 {
+		size, err := updater.RemoteSize(ctx, cfg.httpClient(), urls[0])
+		if err != nil {
+			failIfCancelled(ctx)
+			logDebugf("Could not get the size of the download. %s", err.Error())
+		}
+		archiveSize = size
+	}
+	if archiveSize <= 0 {
+		return
+	}
+
+	needs := []spaceNeed{
+		{Dir: stagingDir, Bytes: uint64(archiveSize), What: "download"},
+		{Dir: exPath, Bytes: uint64(archiveSize) * extractRatioEstimate, What: "new version"},
+	}
+	if opts.Backup {
+		needs = append(needs, spaceNeed{Dir: cfg.backupDir(), Bytes: installSize(exPath), What: "backup"})
+	}
+
+	checkDiskSpace(needs)
+}
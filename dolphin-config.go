@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+// dolphinSetting is a key in one of Dolphin's ini files, written as File.Section.Key such as
+// GFX.Settings.EFBScale for EFBScale in [Settings] of Config/GFX.ini
+type dolphinSetting struct {
+	File    string `json:"file"`
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Set     bool   `json:"set"`
+}
+
+func parseDolphinSetting(name string) dolphinSetting {
+	parts := strings.SplitN(name, ".", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		log.Panicf("Invalid setting %s, expected File.Section.Key such as GFX.Settings.EFBScale", name)
+	}
+
+	return dolphinSetting{File: parts[0], Section: parts[1], Key: parts[2]}
+}
+
+func (setting dolphinSetting) name() string {
+	return setting.File + "." + setting.Section + "." + setting.Key
+}
+
+func dolphinConfigPath(userDir, file string) string {
+	if !strings.EqualFold(filepath.Ext(file), ".ini") {
+		file += ".ini"
+	}
+
+	return filepath.Join(userDir, "Config", file)
+}
+
+// readDolphinConfig parses one of Dolphin's ini files, a missing file is empty
+func readDolphinConfig(userDir, file string) (*iniFile, error) {
+	return readIniFile(dolphinConfigPath(userDir, file))
+}
+
+func writeDolphinConfig(userDir, file string, config *iniFile) error {
+	return writeIniFile(dolphinConfigPath(userDir, file), config)
+}
+
+func readIniFile(path string) (*iniFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &iniFile{sections: []*iniSection{{}}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIni(string(contents)), nil
+}
+
+func writeIniFile(path string, config *iniFile) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(path, []byte(config.String()), 0644)
+}
+
+// getDolphinSetting reads a setting, Set is false when the file doesn't have it
+func getDolphinSetting(userDir string, setting dolphinSetting) (dolphinSetting, error) {
+	config, err := readDolphinConfig(userDir, setting.File)
+	if err != nil {
+		return setting, err
+	}
+
+	setting.Value, setting.Set = config.section("[" + setting.Section + "]").value(setting.Key)
+	return setting, nil
+}
+
+// setDolphinSetting writes a setting, leaving the rest of the file as it was
+func setDolphinSetting(userDir string, setting dolphinSetting) error {
+	config, err := readDolphinConfig(userDir, setting.File)
+	if err != nil {
+		return err
+	}
+
+	config.set("["+setting.Section+"]", setting.Key, setting.Value)
+	return writeDolphinConfig(userDir, setting.File, config)
+}
+
+// execDolphinConfig gets, sets or unsets a setting in the Dolphin config of the install
+func execDolphinConfig(cfg toolsConfig, userDir, action string, args []string) (setting dolphinSetting, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered editing the Dolphin config")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	if len(args) == 0 {
+		log.Panicf("Must provide the setting to %s, such as GFX.Settings.EFBScale", action)
+	}
+	setting = parseDolphinSetting(args[0])
+
+	switch action {
+	case "get":
+		var err error
+		setting, err = getDolphinSetting(userDir, setting)
+		if err != nil {
+			log.Panicf("Failed to read %s. %s", setting.File, err.Error())
+		}
+		if !setting.Set {
+			failf(exitGeneric, "%s is not set", setting.name())
+		}
+
+		fmt.Println(setting.Value)
+		return setting, nil
+	case "set":
+		if len(args) < 2 {
+			log.Panicf("Must provide the value to set %s to", setting.name())
+		}
+		setting.Value = strings.Join(args[1:], " ")
+		setting.Set = true
+
+		err := setDolphinSetting(userDir, setting)
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", setting.File, err.Error())
+		}
+
+		fmt.Printf("Set %s to %s\n", setting.name(), setting.Value)
+		return setting, nil
+	case "unset":
+		config, err := readDolphinConfig(userDir, setting.File)
+		if err != nil {
+			log.Panicf("Failed to read %s. %s", setting.File, err.Error())
+		}
+
+		if config.unset("["+setting.Section+"]", setting.Key) {
+			err = writeDolphinConfig(userDir, setting.File, config)
+			if err != nil {
+				log.Panicf("Failed to write %s. %s", setting.File, err.Error())
+			}
+		}
+
+		fmt.Printf("Unset %s, Dolphin uses its default\n", setting.name())
+		return setting, nil
+	}
+
+	log.Panicf("Unknown config action %s, must be get, set, unset or audit", action)
+	return setting, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+// runElevated isn't used, elevating here is up to the user running sudo
+func runElevated(exe string, args []string) (int, error) {
+	return 0, errors.New("elevating is only supported on Windows")
+}
@@ -0,0 +1,84 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procShellExecuteExW = syscall.NewLazyDLL("shell32.dll").NewProc("ShellExecuteExW")
+
+const (
+	seeMaskNoCloseProcess = 0x00000040
+	swShowNormal          = 1
+	errorCancelled        = 1223
+)
+
+// shellExecuteInfo is SHELLEXECUTEINFOW, Go lays it out with the same padding
+type shellExecuteInfo struct {
+	Size       uint32
+	Mask       uint32
+	Hwnd       uintptr
+	Verb       *uint16
+	File       *uint16
+	Parameters *uint16
+	Directory  *uint16
+	Show       int32
+	InstApp    uintptr
+	IDList     uintptr
+	Class      *uint16
+	KeyClass   uintptr
+	HotKey     uint32
+	Icon       uintptr
+	Process    syscall.Handle
+}
+
+// runElevated starts the exe through the UAC prompt and waits for it, returning its exit code.
+// The elevated process gets its own console window
+func runElevated(exe string, args []string) (int, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = syscall.EscapeArg(arg)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+
+	info := shellExecuteInfo{
+		Mask:       seeMaskNoCloseProcess,
+		Verb:       syscall.StringToUTF16Ptr("runas"),
+		File:       syscall.StringToUTF16Ptr(exe),
+		Parameters: syscall.StringToUTF16Ptr(strings.Join(quoted, " ")),
+		Directory:  syscall.StringToUTF16Ptr(wd),
+		Show:       swShowNormal,
+	}
+	info.Size = uint32(unsafe.Sizeof(info))
+
+	ret, _, callErr := procShellExecuteExW.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		if errno, ok := callErr.(syscall.Errno); ok && errno == errorCancelled {
+			return 0, errElevationDeclined
+		}
+		return 0, callErr
+	}
+	if info.Process == 0 {
+		return 0, errors.New("no process was started")
+	}
+	defer syscall.CloseHandle(info.Process)
+
+	_, err = syscall.WaitForSingleObject(info.Process, syscall.INFINITE)
+	if err != nil {
+		return 0, err
+	}
+
+	var code uint32
+	err = syscall.GetExitCodeProcess(info.Process, &code)
+	return int(code), err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// launchArgs are the arguments we were started with, global flags included, such that the
+// command can be run again elevated
+var launchArgs = append([]string{}, os.Args[1:]...)
+
+// noElevate is set by the global -no-elevate flag, which the elevated process also gets such that
+// it never asks again
+var noElevate = false
+
+var errElevationDeclined = errors.New("the administrator prompt was declined")
+
+type elevationEvent struct {
+	Type     string `json:"type"`
+	ExitCode int    `json:"exitCode"`
+}
+
+var shellSafeArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+func shellQuote(arg string) string {
+	if shellSafeArg.MatchString(arg) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// elevateIfNotWritable handles an install we aren't allowed to write to. On Windows the command
+// is run again through the UAC prompt and we exit with its code once it is done. Elsewhere the
+// sudo command to run is printed. Returns when the command should fail as before
+func elevateIfNotWritable(err error) {
+	if noElevate || !os.IsPermission(err) {
+		return
+	}
+
+	exe, exeErr := os.Executable()
+	if exeErr != nil {
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		command := []string{"sudo", shellQuote(exe)}
+		for _, arg := range launchArgs {
+			command = append(command, shellQuote(arg))
+		}
+		fmt.Printf("The install directory needs root to be changed. Run the command again with sudo:\n  %s\n", strings.Join(command, " "))
+		return
+	}
+
+	fmt.Println("The install directory needs administrator rights to be changed, continuing in an elevated window...")
+	code, err := runElevated(exe, append([]string{"-no-elevate"}, launchArgs...))
+	if err != nil {
+		log.Printf("Failed to relaunch as administrator. %s\n", err.Error())
+		return
+	}
+
+	// The elevated process writes its output and events to its own window, all we can pass on is
+	// how it ended
+	log.Printf("The elevated command exited with code %d\n", code)
+	if jsonOutput {
+		emitEvent(elevationEvent{Type: "elevation", ExitCode: code})
+	}
+	os.Exit(code)
+}
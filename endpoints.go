@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const apiCacheDirName = "api-cache"
+
+// embeddedEndpoints are tried after the configured ones. Comma separated such that the list can be
+// replaced at build time with -ldflags "-X main.embeddedEndpoints=..."
+var embeddedEndpoints = defaultEndpoint
+
+// embeddedUserEndpoints serve the user query of user-update, which has its own schema
+var embeddedUserEndpoints = "https://slippi-hasura.herokuapp.com/v1/graphql"
+
+// cachedResponse is the last successful response to a query, used when no endpoint is reachable
+type cachedResponse struct {
+	Source    string          `json:"source"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// endpoints lists the GraphQL endpoints in the order they are tried: the configured endpoint, the
+// configured fallbacks, then the embedded defaults
+func (cfg toolsConfig) endpoints() []string {
+	return joinEndpoints(cfg.Endpoint, cfg.FallbackEndpoints, embeddedEndpoints)
+}
+
+func (cfg toolsConfig) userEndpoints() []string {
+	return joinEndpoints(cfg.UserEndpoint, embeddedUserEndpoints)
+}
+
+// joinEndpoints splits comma separated lists and joins them, dropping duplicates
+func joinEndpoints(lists ...string) []string {
+	endpoints := []string{}
+	for _, list := range lists {
+		for _, endpoint := range strings.Split(list, ",") {
+			endpoint = strings.TrimSpace(endpoint)
+			if endpoint != "" && !containsFold(endpoints, endpoint) {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+
+	return endpoints
+}
+
+func cachePath(cfg toolsConfig, key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(cfg.InstallDir, apiCacheDirName, hex.EncodeToString(hash[:8])+".json")
+}
+
+// freshCachedResponse loads a cached response into resp if it is younger than the cache TTL, such
+// that repeated checks don't hit the server every time
+func freshCachedResponse(cfg toolsConfig, key string, resp interface{}) bool {
+	if cfg.NoCache || cfg.cacheTTL() <= 0 {
+		return false
+	}
+
+	cached, err := loadCachedResponse(cfg, key)
+	if err != nil || time.Since(cached.FetchedAt) > cfg.cacheTTL() {
+		return false
+	}
+
+	err = json.Unmarshal(cached.Response, resp)
+	if err != nil {
+		return false
+	}
+
+	logDebugf("Using the response from %s cached %s ago", cached.Source, time.Since(cached.FetchedAt).Round(time.Second))
+	return true
+}
+
+// useCachedResponse loads the last good response into resp after every source failed with err.
+// Returns err if there is nothing cached
+func useCachedResponse(cfg toolsConfig, key string, resp interface{}, err error) error {
+	cached, cacheErr := loadCachedResponse(cfg, key)
+	if cacheErr != nil {
+		return err
+	}
+
+	cacheErr = json.Unmarshal(cached.Response, resp)
+	if cacheErr != nil {
+		return err
+	}
+
+	log.Printf("Warning: the server could not be reached, using the response from %s cached %s ago. %s\n",
+		cached.Source, time.Since(cached.FetchedAt).Round(time.Minute), err.Error())
+	return nil
+}
+
+func saveCachedResponse(cfg toolsConfig, key, source string, resp interface{}) {
+	response, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	contents, err := json.MarshalIndent(cachedResponse{
+		Source:    source,
+		FetchedAt: time.Now(),
+		Response:  response,
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+
+	path := cachePath(cfg, key)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, contents, 0644)
+	}
+	if err != nil {
+		logDebugf("Failed to cache response. %s", err.Error())
+	}
+}
+
+func loadCachedResponse(cfg toolsConfig, key string) (cachedResponse, error) {
+	var cached cachedResponse
+
+	contents, err := ioutil.ReadFile(cachePath(cfg, key))
+	if err != nil {
+		return cached, err
+	}
+
+	err = json.Unmarshal(contents, &cached)
+	return cached, err
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+func readExeVersion(path string) (string, error) {
+	return "", errors.New("exe versions can only be read on Windows")
+}
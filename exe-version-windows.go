@@ -0,0 +1,99 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	versionDLL                  = syscall.NewLazyDLL("version.dll")
+	procGetFileVersionInfoSizeW = versionDLL.NewProc("GetFileVersionInfoSizeW")
+	procGetFileVersionInfoW     = versionDLL.NewProc("GetFileVersionInfoW")
+	procVerQueryValueW          = versionDLL.NewProc("VerQueryValueW")
+)
+
+// vsFixedFileInfo is VS_FIXEDFILEINFO, the numeric part of a version resource
+type vsFixedFileInfo struct {
+	Signature        uint32
+	StrucVersion     uint32
+	FileVersionMS    uint32
+	FileVersionLS    uint32
+	ProductVersionMS uint32
+	ProductVersionLS uint32
+	FileFlagsMask    uint32
+	FileFlags        uint32
+	FileOS           uint32
+	FileType         uint32
+	FileSubtype      uint32
+	FileDateMS       uint32
+	FileDateLS       uint32
+}
+
+// readExeVersion returns the product version of an exe. The string version is preferred since it
+// keeps prereleases such as -beta, the numeric one is used when there is none
+func readExeVersion(path string) (string, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+
+	size, _, callErr := procGetFileVersionInfoSizeW.Call(uintptr(unsafe.Pointer(pathPtr)), 0)
+	if size == 0 {
+		return "", fmt.Errorf("%s has no version info. %s", path, callErr.Error())
+	}
+
+	info := make([]byte, size)
+	ret, _, callErr := procGetFileVersionInfoW.Call(uintptr(unsafe.Pointer(pathPtr)), 0, size, uintptr(unsafe.Pointer(&info[0])))
+	if ret == 0 {
+		return "", fmt.Errorf("failed to read the version info of %s. %s", path, callErr.Error())
+	}
+
+	translation, length := queryVersionValue(info, `\VarFileInfo\Translation`)
+	if translation != nil && length >= 4 {
+		codes := unsafe.Slice((*uint16)(translation), 2)
+		key := fmt.Sprintf(`\StringFileInfo\%04x%04x\ProductVersion`, codes[0], codes[1])
+		value, length := queryVersionValue(info, key)
+		if value != nil && length > 0 {
+			version := strings.TrimSpace(syscall.UTF16ToString(unsafe.Slice((*uint16)(value), length)))
+			if version != "" {
+				return version, nil
+			}
+		}
+	}
+
+	value, length := queryVersionValue(info, `\`)
+	if value == nil || uintptr(length) < unsafe.Sizeof(vsFixedFileInfo{}) {
+		return "", errors.New(path + " has no product version")
+	}
+
+	fixed := (*vsFixedFileInfo)(value)
+	return fmt.Sprintf("%d.%d.%d", fixed.ProductVersionMS>>16, fixed.ProductVersionMS&0xffff, fixed.ProductVersionLS>>16), nil
+}
+
+// queryVersionValue looks up a value in a version resource. The pointer points into info
+func queryVersionValue(info []byte, key string) (unsafe.Pointer, uint32) {
+	keyPtr, err := syscall.UTF16PtrFromString(key)
+	if err != nil {
+		return nil, 0
+	}
+
+	var value unsafe.Pointer
+	var length uint32
+	ret, _, _ := procVerQueryValueW.Call(
+		uintptr(unsafe.Pointer(&info[0])),
+		uintptr(unsafe.Pointer(keyPtr)),
+		uintptr(unsafe.Pointer(&value)),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if ret == 0 {
+		return nil, 0
+	}
+
+	return value, length
+}
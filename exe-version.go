@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// readDolphinBinaryVersion reads the version Dolphin was built with from the installed binary, the
+// version resource of the exe on Windows and Info.plist of the bundle on macOS
+func readDolphinBinaryVersion(exPath string) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return readExeVersion(findDolphinExe(exPath))
+	case "darwin":
+		return readBundleVersion(findAppBundle(exPath))
+	}
+
+	return "", errors.New("the Dolphin binary has no readable version on " + runtime.GOOS)
+}
+
+// resolvePrevVersion returns the version app-update is updating from. The binary wins over the
+// passed version such that a wrong or missing -version doesn't skip migrations
+func resolvePrevVersion(exPath, passed string) string {
+	binary, err := readDolphinBinaryVersion(exPath)
+	if err != nil || binary == "" {
+		return passed
+	}
+
+	if passed != "" && !sameRelease(passed, binary) {
+		log.Printf("Warning: -version %s doesn't match the installed Dolphin %s, using %s\n", passed, binary, binary)
+		return binary
+	}
+	if passed == "" {
+		return readInstalledVersion(exPath)
+	}
+
+	return passed
+}
+
+// readBundleVersion returns CFBundleShortVersionString from the Info.plist of a macOS bundle
+func readBundleVersion(bundlePath string) (string, error) {
+	file, err := os.Open(filepath.Join(bundlePath, "Contents", "Info.plist"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// The plist is a flat list of keys, each followed by its value
+	decoder := xml.NewDecoder(file)
+	lastKey := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", errors.New("Info.plist has no CFBundleShortVersionString")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var value string
+		switch start.Name.Local {
+		case "key":
+			err = decoder.DecodeElement(&value, &start)
+			lastKey = value
+		case "string":
+			err = decoder.DecodeElement(&value, &start)
+			if lastKey == "CFBundleShortVersionString" {
+				return strings.TrimSpace(value), err
+			}
+			lastKey = ""
+		default:
+			lastKey = ""
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+var errFirewallUnsupported = errors.New("firewall rules can only be managed on Windows")
+
+func listFirewallRules(group, program string) ([]firewallRule, error) {
+	return nil, errFirewallUnsupported
+}
+
+func addFirewallRule(rule firewallRule) error {
+	return errFirewallUnsupported
+}
+
+func removeFirewallRule(name string) error {
+	return errFirewallUnsupported
+}
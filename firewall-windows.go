@@ -0,0 +1,88 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Values come in through environment variables such that they never need quoting. Rules are listed
+// by group and by program, which finds the rules Windows created when Dolphin first ran
+const (
+	firewallListScript = `
+$rules = @(Get-NetFirewallRule -Group $env:SLIPPI_FIREWALL_GROUP -ErrorAction SilentlyContinue)
+$rules += @(Get-NetFirewallApplicationFilter -Program $env:SLIPPI_FIREWALL_PROGRAM -ErrorAction SilentlyContinue | Get-NetFirewallRule)
+$list = @($rules | Sort-Object Name -Unique | ForEach-Object {
+	[pscustomobject]@{
+		name = $_.Name
+		displayName = $_.DisplayName
+		group = [string]$_.Group
+		direction = [string]$_.Direction
+		action = [string]$_.Action
+		enabled = [string]$_.Enabled
+		program = [string]($_ | Get-NetFirewallApplicationFilter).Program
+	}
+})
+ConvertTo-Json -Compress -InputObject $list
+`
+	firewallAddScript = `
+New-NetFirewallRule -DisplayName $env:SLIPPI_FIREWALL_NAME -Group $env:SLIPPI_FIREWALL_GROUP -Direction $env:SLIPPI_FIREWALL_DIRECTION -Action Allow -Program $env:SLIPPI_FIREWALL_PROGRAM -Profile Any -Enabled True -ErrorAction Stop | Out-Null
+`
+	firewallRemoveScript = `
+Remove-NetFirewallRule -Name $env:SLIPPI_FIREWALL_RULE -ErrorAction Stop
+`
+)
+
+func runPowerShell(script string, env ...string) ([]byte, error) {
+	// Output is in the console code page otherwise, which mangles paths with non-ASCII user names
+	script = "[Console]::OutputEncoding = [System.Text.Encoding]::UTF8\n" + script
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", script)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s. %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+func listFirewallRules(group, program string) ([]firewallRule, error) {
+	output, err := runPowerShell(firewallListScript, "SLIPPI_FIREWALL_GROUP="+group, "SLIPPI_FIREWALL_PROGRAM="+program)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []firewallRule{}
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return rules, nil
+	}
+
+	err = json.Unmarshal(output, &rules)
+	return rules, err
+}
+
+func addFirewallRule(rule firewallRule) error {
+	_, err := runPowerShell(
+		firewallAddScript,
+		"SLIPPI_FIREWALL_NAME="+rule.DisplayName,
+		"SLIPPI_FIREWALL_GROUP="+rule.Group,
+		"SLIPPI_FIREWALL_DIRECTION="+rule.Direction,
+		"SLIPPI_FIREWALL_PROGRAM="+rule.Program,
+	)
+	return err
+}
+
+func removeFirewallRule(name string) error {
+	_, err := runPowerShell(firewallRemoveScript, "SLIPPI_FIREWALL_RULE="+name)
+	return err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+)
+
+// Rules created by the tools are kept in their own group such that they can be found again
+const firewallGroup = "Slippi Dolphin"
+
+var firewallDirections = []string{"Inbound", "Outbound"}
+
+// firewallRule is a Windows Firewall rule that is either ours or applies to the Dolphin executable
+type firewallRule struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Group       string `json:"group"`
+	Direction   string `json:"direction"`
+	Action      string `json:"action"`
+	Enabled     string `json:"enabled"`
+	Program     string `json:"program"`
+}
+
+type firewallResult struct {
+	Program string         `json:"program"`
+	Rules   []firewallRule `json:"rules"`
+	Added   []firewallRule `json:"added"`
+	Removed []firewallRule `json:"removed"`
+}
+
+func describeFirewallRule(rule firewallRule) string {
+	return fmt.Sprintf("%-8s %-5s %s (%s)", rule.Direction, rule.Action, rule.DisplayName, rule.Program)
+}
+
+// planFirewallAllow picks the rules to remove and add such that the program is allowed both ways.
+// Our rules for other paths are left over from old installs. Block rules for the program are
+// usually created when the Windows prompt is dismissed, and they win over allow rules
+func planFirewallAllow(rules []firewallRule, program string) ([]firewallRule, []firewallRule) {
+	remove := []firewallRule{}
+	allowed := map[string]bool{}
+	for _, rule := range rules {
+		forProgram := samePath(rule.Program, program)
+		switch {
+		case rule.Group == firewallGroup && !forProgram:
+			remove = append(remove, rule)
+		case forProgram && rule.Action == "Block":
+			remove = append(remove, rule)
+		case forProgram && rule.Action == "Allow" && rule.Enabled == "True":
+			allowed[rule.Direction] = true
+		}
+	}
+
+	add := []firewallRule{}
+	for _, direction := range firewallDirections {
+		if !allowed[direction] {
+			add = append(add, firewallRule{
+				DisplayName: fmt.Sprintf("%s (%s)", firewallGroup, direction),
+				Group:       firewallGroup,
+				Direction:   direction,
+				Action:      "Allow",
+				Enabled:     "True",
+				Program:     program,
+			})
+		}
+	}
+
+	return remove, add
+}
+
+// execFirewall manages the Windows Firewall rules of the install's Dolphin. allow adds the missing
+// rules and removes the ones in the way, remove deletes the rules the tools added and list shows
+// what applies to Dolphin. Changing rules needs an elevated prompt
+func execFirewall(cfg toolsConfig, action string, dryRun bool) (result firewallResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered managing firewall rules")
+		}
+	}()
+
+	if runtime.GOOS != "windows" {
+		failf(exitGeneric, "firewall manages Windows Firewall, other platforms don't prompt for Dolphin")
+	}
+
+	result.Program = findDolphinExe(cfg.InstallDir)
+	if _, err := os.Stat(result.Program); err != nil {
+		failf(exitGeneric, "Dolphin not found at %s, pass -install-dir", result.Program)
+	}
+
+	rules, err := listFirewallRules(firewallGroup, result.Program)
+	if err != nil {
+		log.Panicf("Failed to read the firewall rules. %s", err.Error())
+	}
+	result.Rules = rules
+	result.Added = []firewallRule{}
+	result.Removed = []firewallRule{}
+
+	var remove, add []firewallRule
+	switch action {
+	case "list":
+		if len(rules) == 0 {
+			fmt.Printf("No firewall rules apply to %s\n", result.Program)
+		}
+		for _, rule := range rules {
+			fmt.Println(describeFirewallRule(rule))
+		}
+		return result, nil
+	case "allow":
+		remove, add = planFirewallAllow(rules, result.Program)
+	case "remove":
+		for _, rule := range rules {
+			if rule.Group == firewallGroup {
+				remove = append(remove, rule)
+			}
+		}
+	default:
+		log.Panicf("Unknown firewall action %s, must be allow, remove or list", action)
+	}
+
+	if len(remove) == 0 && len(add) == 0 && action == "remove" {
+		fmt.Println("No firewall rules were added by the tools")
+		return result, nil
+	}
+	if len(remove) == 0 && len(add) == 0 {
+		fmt.Println("The firewall rules are already in place")
+		return result, nil
+	}
+
+	for _, rule := range remove {
+		fmt.Printf("remove  %s\n", describeFirewallRule(rule))
+	}
+	for _, rule := range add {
+		fmt.Printf("add     %s\n", describeFirewallRule(rule))
+	}
+	if dryRun {
+		fmt.Println("Dry run, nothing was changed")
+		return result, nil
+	}
+
+	for _, rule := range remove {
+		err := removeFirewallRule(rule.Name)
+		if err != nil {
+			failf(exitNotWritable, "Failed to remove %s, run the tools as administrator. %s", rule.DisplayName, err.Error())
+		}
+		result.Removed = append(result.Removed, rule)
+	}
+	for _, rule := range add {
+		err := addFirewallRule(rule)
+		if err != nil {
+			failf(exitNotWritable, "Failed to add %s, run the tools as administrator. %s", rule.DisplayName, err.Error())
+		}
+		result.Added = append(result.Added, rule)
+	}
+
+	fmt.Printf("Added %d and removed %d firewall rules\n", len(result.Added), len(result.Removed))
+	return result, nil
+}
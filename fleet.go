@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fleetMachine is one install of the fleet, on this machine or on one reachable over ssh or WinRM
+type fleetMachine struct {
+	Name string `json:"name"`
+	// Host is user@host for ssh or the computer name for WinRM, empty for installs on this machine
+	Host string `json:"host"`
+	// Transport is local, ssh or winrm. Defaults to ssh when a host is set
+	Transport  string `json:"transport"`
+	InstallDir string `json:"installDir"`
+	// Tools is where dolphin-slippi-tools is on the machine, by default the one running for local
+	// installs and the one on the PATH for remote ones
+	Tools string `json:"tools"`
+	// Args are passed to app-update on top of the fleet's, remote machines otherwise use their own
+	// config.json
+	Args []string `json:"args"`
+}
+
+type fleetConfig struct {
+	Machines []fleetMachine `json:"machines"`
+	// Parallel is the number of machines updated at once
+	Parallel int `json:"parallel"`
+}
+
+// fleetResult is how the update of one machine went. Status is updated, up-to-date or failed
+type fleetResult struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Version  string  `json:"version"`
+	Duration float64 `json:"duration"`
+	ExitCode int     `json:"exitCode,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type fleetMachineEvent struct {
+	Type string `json:"type"`
+	fleetResult
+}
+
+// defaultFleetPath is kept next to the tools, like the list of installs
+func defaultFleetPath() string {
+	return filepath.Join(getExecutableDir(), "fleet.json")
+}
+
+func loadFleet(path string) fleetConfig {
+	fleet := fleetConfig{Parallel: 4}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		failf(exitGeneric, "Failed to read the fleet file. %s", err.Error())
+	}
+	err = json.Unmarshal(contents, &fleet)
+	if err != nil {
+		failf(exitGeneric, "Failed to parse the fleet file %s. %s", path, err.Error())
+	}
+
+	for i := range fleet.Machines {
+		machine := &fleet.Machines[i]
+		if machine.Transport == "" && machine.Host != "" {
+			machine.Transport = "ssh"
+		} else if machine.Transport == "" {
+			machine.Transport = "local"
+		}
+		if machine.Name == "" {
+			machine.Name = strings.TrimSpace(machine.Host + " " + machine.InstallDir)
+		}
+
+		switch {
+		case machine.Transport != "local" && machine.Transport != "ssh" && machine.Transport != "winrm":
+			failf(exitGeneric, "Unknown transport %s for %s, must be local, ssh or winrm", machine.Transport, machine.Name)
+		case machine.Transport != "local" && machine.Host == "":
+			failf(exitGeneric, "%s needs a host to be reached over %s", machine.Name, machine.Transport)
+		case machine.Transport == "local" && machine.InstallDir == "":
+			failf(exitGeneric, "%s needs an installDir", machine.Name)
+		}
+	}
+
+	return fleet
+}
+
+// sshQuote quotes an argument for the remote shell. Double quotes work the same for sh and for
+// cmd on Windows machines running OpenSSH, unless the argument needs escaping inside them
+func sshQuote(arg string) string {
+	if shellSafeArg.MatchString(arg) {
+		return arg
+	}
+	if !strings.ContainsAny(arg, "\"$`") && !strings.HasSuffix(arg, `\`) {
+		return `"` + arg + `"`
+	}
+
+	return shellQuote(arg)
+}
+
+func powerShellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
+
+// fleetCommand builds the app-update run for the machine. It always runs with --json such that the
+// outcome can be read from its result event, whatever the machine printed before
+func fleetCommand(ctx context.Context, cfg toolsConfig, machine fleetMachine) (*exec.Cmd, error) {
+	args := []string{"--json", "app-update", "-full", "-non-interactive"}
+	if machine.Transport == "local" {
+		args = append(args, cfg.args()...)
+	}
+	if machine.InstallDir != "" {
+		args = append(args, "-install-dir", machine.InstallDir)
+	}
+	args = append(args, machine.Args...)
+
+	tools := machine.Tools
+	switch machine.Transport {
+	case "local":
+		if tools == "" {
+			exe, err := os.Executable()
+			if err != nil {
+				return nil, err
+			}
+			tools = exe
+		}
+		return exec.CommandContext(ctx, tools, args...), nil
+	case "ssh":
+		if tools == "" {
+			tools = "dolphin-slippi-tools"
+		}
+		remote := []string{sshQuote(tools)}
+		for _, arg := range args {
+			remote = append(remote, sshQuote(arg))
+		}
+		// BatchMode fails instead of asking for a password nobody is there to type
+		return exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", machine.Host, strings.Join(remote, " ")), nil
+	}
+
+	if tools == "" {
+		tools = "dolphin-slippi-tools.exe"
+	}
+	quoted := []string{}
+	for _, arg := range args {
+		quoted = append(quoted, powerShellQuote(arg))
+	}
+	script := fmt.Sprintf("Invoke-Command -ComputerName %s -ScriptBlock { param($tools, $toolsArgs) & $tools @toolsArgs } -ArgumentList %s, @(%s)",
+		powerShellQuote(machine.Host), powerShellQuote(tools), strings.Join(quoted, ", "))
+
+	shell := "pwsh"
+	if runtime.GOOS == "windows" {
+		shell = "powershell"
+	}
+	return exec.CommandContext(ctx, shell, "-NoProfile", "-NonInteractive", "-Command", script), nil
+}
+
+// fleetOutcome finds the result event of app-update in its output
+func fleetOutcome(output io.Reader, result *fleetResult) bool {
+	found := false
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type    string       `json:"type"`
+			Command string       `json:"command"`
+			Success bool         `json:"success"`
+			Error   *updateError `json:"error"`
+			Data    struct {
+				Phase            string `json:"phase"`
+				InstalledVersion string `json:"installedVersion"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Type != "result" || event.Command != "app-update" {
+			continue
+		}
+
+		found = true
+		switch {
+		case !event.Success && event.Error != nil:
+			result.Status = "failed"
+			result.ExitCode = event.Error.Code
+			result.Error = event.Error.Message
+		case !event.Success:
+			result.Status = "failed"
+			result.ExitCode = exitGeneric
+		case event.Data.Phase == "skipped":
+			result.Status = "up-to-date"
+		default:
+			result.Status = "updated"
+		}
+		result.Version = event.Data.InstalledVersion
+	}
+
+	return found
+}
+
+// updateFleetMachine runs the update of one machine and reports how it went. Errors never stop
+// the fleet, they end up in the report
+func updateFleetMachine(ctx context.Context, cfg toolsConfig, machine fleetMachine) (result fleetResult) {
+	result = fleetResult{Name: machine.Name, Status: "failed"}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start).Round(time.Second).Seconds()
+	}()
+
+	cmd, err := fleetCommand(ctx, cfg, machine)
+	if err != nil {
+		result.ExitCode = exitGeneric
+		result.Error = err.Error()
+		return result
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	logDebugf("Running %s", strings.Join(cmd.Args, " "))
+	runErr := cmd.Run()
+
+	if fleetOutcome(&stdout, &result) {
+		return result
+	}
+
+	// No result means the tools never ran, such as ssh failing to connect
+	result.ExitCode = exitGeneric
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	result.Error = lines[len(lines)-1]
+	if result.Error == "" && runErr != nil {
+		result.Error = runErr.Error()
+	} else if result.Error == "" {
+		result.Error = "app-update didn't report a result"
+	}
+
+	return result
+}
+
+// execFleet updates every machine of the fleet file, a few at once, and prints a report of all of
+// them at the end. Fails when any machine failed
+func execFleet(ctx context.Context, cfg toolsConfig, path string, parallel int) (results []fleetResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered updating the fleet")
+		}
+	}()
+
+	fleet := loadFleet(path)
+	if parallel <= 0 {
+		parallel = fleet.Parallel
+	}
+	if parallel <= 0 {
+		parallel = 1
+	}
+	if len(fleet.Machines) == 0 {
+		failf(exitGeneric, "The fleet file %s lists no machines", path)
+	}
+	if parallel > len(fleet.Machines) {
+		parallel = len(fleet.Machines)
+	}
+
+	fmt.Printf("Updating %d setups, %d at a time...\n", len(fleet.Machines), parallel)
+	results = make([]fleetResult, len(fleet.Machines))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i, machine := range fleet.Machines {
+		wg.Add(1)
+		go func(i int, machine fleetMachine) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			result := updateFleetMachine(ctx, cfg, machine)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = result
+			fmt.Printf("%s: %s\n", result.Name, result.Status)
+			if jsonOutput {
+				emitEvent(fleetMachineEvent{Type: "fleet-machine", fleetResult: result})
+			}
+		}(i, machine)
+	}
+	wg.Wait()
+	failIfCancelled(ctx)
+
+	fmt.Println("")
+	failed := 0
+	for _, result := range results {
+		version := result.Version
+		if version == "" {
+			version = "unknown"
+		}
+		fmt.Printf("%-24s %-10s %-10s %s\n", result.Name, result.Status, version, time.Duration(result.Duration)*time.Second)
+		if result.Status == "failed" {
+			failed++
+			fmt.Printf("  exit code %d: %s\n", result.ExitCode, result.Error)
+		}
+	}
+
+	if failed > 0 {
+		failf(exitInstall, "%d of %d setups failed to update", failed, len(results))
+	}
+	fmt.Printf("All %d setups are up to date\n", len(results))
+
+	return results, nil
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Largest code list we download, community lists are a few hundred KB
+const maxGeckoListBytes = 4 * 1024 * 1024
+
+// geckoCode is a code from the [Gecko] section of a game ini. Lines are the code and note lines
+// after the $ header line as they are in the file
+type geckoCode struct {
+	Name    string   `json:"name"`
+	Header  string   `json:"-"`
+	Lines   []string `json:"-"`
+	Source  string   `json:"source"`
+	Enabled bool     `json:"enabled"`
+}
+
+// geckoCodeName is the name Dolphin enables a code by, the header without the $ and the creator
+// in brackets such as $Name [Creator]
+func geckoCodeName(header string) string {
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(header), "$"))
+	if i := strings.Index(name, " ["); i >= 0 && strings.HasSuffix(name, "]") {
+		name = strings.TrimSpace(name[:i])
+	}
+
+	return name
+}
+
+// parseGeckoCodes reads the codes in a list of lines in the format of the [Gecko] section. Lines
+// before the first $ header are ignored
+func parseGeckoCodes(lines []string, source string) []geckoCode {
+	codes := []geckoCode{}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "$") {
+			codes = append(codes, geckoCode{Name: geckoCodeName(trimmed), Header: trimmed, Lines: []string{}, Source: source})
+			continue
+		}
+		if trimmed == "" || len(codes) == 0 {
+			continue
+		}
+
+		current := &codes[len(codes)-1]
+		current.Lines = append(current.Lines, trimmed)
+	}
+
+	return codes
+}
+
+// geckoNames reads a [Gecko_Enabled] or [Gecko_Disabled] section
+func geckoNames(section *iniSection) map[string]bool {
+	names := map[string]bool{}
+	if section == nil {
+		return names
+	}
+
+	for _, line := range section.lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "$") {
+			names[geckoCodeName(trimmed)] = true
+		}
+	}
+
+	return names
+}
+
+// validateGeckoCode checks that every line is two 32 bit hex words and that codes which take the
+// following lines as data, such as C2 inserts, have all of them
+func validateGeckoCode(code geckoCode) error {
+	words := [][2]uint64{}
+	for _, line := range code.Lines {
+		if strings.HasPrefix(line, "*") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != 8 || len(fields[1]) != 8 {
+			return fmt.Errorf("%s: %q is not two groups of 8 hex digits", code.Name, line)
+		}
+
+		address, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not hex", code.Name, line)
+		}
+		value, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not hex", code.Name, line)
+		}
+		words = append(words, [2]uint64{address, value})
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("%s has no code lines", code.Name)
+	}
+
+	for i := 0; i < len(words); i++ {
+		// The 0x10 bit of the code type only selects the pointer instead of the base address
+		codeType := (words[i][0] >> 24) &^ 0x10
+		data := uint64(0)
+		switch {
+		case codeType == 0xC0 || codeType == 0xC2:
+			data = words[i][1]
+		case codeType == 0x06 || codeType == 0x07:
+			data = (words[i][1] + 7) / 8
+		case codeType == 0x08 || codeType == 0x09:
+			data = 1
+		}
+
+		if uint64(len(words)-i-1) < data {
+			return fmt.Errorf("%s: %08X %08X needs %d more lines but only %d follow", code.Name, words[i][0], words[i][1], data, len(words)-i-1)
+		}
+		i += int(data)
+	}
+
+	return nil
+}
+
+// geckoConfig is the Melee game ini of the user folder, which updates don't touch, and the default
+// one in Sys that comes with the build
+type geckoConfig struct {
+	userPath string
+	user     *iniFile
+	defaults *iniFile
+}
+
+func loadGeckoConfig(exPath, userDir string) (geckoConfig, error) {
+	config := geckoConfig{userPath: meleeGameConfigPath(userDir)}
+
+	var err error
+	config.user, err = readIniFile(config.userPath)
+	if err != nil {
+		return config, err
+	}
+
+	// Slippi ships its codes for revision 2 in GALE01r2.ini
+	config.defaults = &iniFile{sections: []*iniSection{{}}}
+	for _, name := range []string{meleeGameID + "r2.ini", meleeGameID + ".ini"} {
+		path := filepath.Join(exPath, "Sys", "GameSettings", name)
+		if _, statErr := os.Stat(path); statErr != nil {
+			continue
+		}
+
+		config.defaults, err = readIniFile(path)
+		if err != nil {
+			return config, err
+		}
+		break
+	}
+
+	return config, nil
+}
+
+// codes returns the default codes followed by the user's. A code is enabled when either ini enables
+// it, unless the user ini disables it
+func (config geckoConfig) codes() []geckoCode {
+	codes := []geckoCode{}
+	if section := config.defaults.section("[Gecko]"); section != nil {
+		codes = append(codes, parseGeckoCodes(section.lines, "default")...)
+	}
+	if section := config.user.section("[Gecko]"); section != nil {
+		codes = append(codes, parseGeckoCodes(section.lines, "user")...)
+	}
+
+	enabled := geckoNames(config.defaults.section("[Gecko_Enabled]"))
+	for name := range geckoNames(config.user.section("[Gecko_Enabled]")) {
+		enabled[name] = true
+	}
+	disabled := geckoNames(config.user.section("[Gecko_Disabled]"))
+
+	for i := range codes {
+		codes[i].Enabled = enabled[codes[i].Name] && !disabled[codes[i].Name]
+	}
+
+	return codes
+}
+
+func (config geckoConfig) find(name string) (geckoCode, bool) {
+	for _, code := range config.codes() {
+		if strings.EqualFold(code.Name, name) {
+			return code, true
+		}
+	}
+
+	return geckoCode{}, false
+}
+
+// setEnabled lists the code in [Gecko_Enabled] or [Gecko_Disabled] of the user ini and removes it
+// from the other one. Disabling needs the second section to turn off codes the defaults enable
+func (config geckoConfig) setEnabled(name string, enabled bool) {
+	add, remove := "[Gecko_Enabled]", "[Gecko_Disabled]"
+	if !enabled {
+		add, remove = remove, add
+	}
+
+	config.removeName(remove, name)
+	config.removeName(add, name)
+	config.user.addSection(add).appendLines("$" + name)
+}
+
+func (config geckoConfig) removeName(sectionName, name string) {
+	section := config.user.section(sectionName)
+	if section == nil {
+		return
+	}
+
+	lines := []string{}
+	for _, line := range section.lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "$") && strings.EqualFold(geckoCodeName(trimmed), name) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	section.lines = lines
+}
+
+// addCode puts the code into [Gecko] of the user ini, replacing a user code of the same name
+func (config geckoConfig) addCode(code geckoCode) {
+	section := config.user.addSection("[Gecko]")
+
+	lines := []string{}
+	skipping := false
+	for _, line := range section.lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "$") {
+			skipping = strings.EqualFold(geckoCodeName(trimmed), code.Name)
+		}
+		if !skipping {
+			lines = append(lines, line)
+		}
+	}
+	section.lines = lines
+
+	section.appendLines(append([]string{code.Header}, code.Lines...)...)
+}
+
+func (config geckoConfig) save() error {
+	return writeIniFile(config.userPath, config.user)
+}
+
+// fetchGeckoList reads a code list from a file or url in the format of the [Gecko] section
+func fetchGeckoList(ctx context.Context, cfg toolsConfig, source string) ([]string, error) {
+	if !isURL(source) {
+		contents, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n"), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cfg.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	contents, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxGeckoListBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n"), nil
+}
+
+// execGecko lists the Gecko codes of the install, enables or disables one, or adds codes from a
+// code list
+func execGecko(ctx context.Context, cfg toolsConfig, userDir, action string, args []string, enable bool) (codes []geckoCode, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered editing Gecko codes")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	config, err := loadGeckoConfig(cfg.InstallDir, userDir)
+	if err != nil {
+		log.Panicf("Failed to read the Melee game settings. %s", err.Error())
+	}
+
+	// Dolphin writes the game ini when its properties window is closed, which would undo the change
+	if action != "list" && len(findDolphinProcesses(cfg.InstallDir)) > 0 {
+		failf(exitGeneric, "Close Dolphin before changing Gecko codes")
+	}
+
+	switch action {
+	case "list":
+		codes = config.codes()
+		if len(codes) == 0 {
+			fmt.Println("No Gecko codes found")
+		}
+		for _, code := range codes {
+			state := " "
+			if code.Enabled {
+				state = "x"
+			}
+			fmt.Printf("[%s] %s (%s)\n", state, code.Name, code.Source)
+		}
+		return codes, nil
+	case "enable", "disable":
+		if len(args) == 0 {
+			log.Panicf("Must provide the name of the code to %s, as shown by gecko list", action)
+		}
+
+		name := strings.Join(args, " ")
+		code, ok := config.find(name)
+		if !ok {
+			failf(exitGeneric, "No Gecko code named %s, run gecko list to see them", name)
+		}
+
+		config.setEnabled(code.Name, action == "enable")
+		err = config.save()
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", config.userPath, err.Error())
+		}
+
+		code.Enabled = action == "enable"
+		if code.Enabled {
+			fmt.Printf("Enabled %s\n", code.Name)
+		} else {
+			fmt.Printf("Disabled %s\n", code.Name)
+		}
+		return []geckoCode{code}, nil
+	case "add":
+		source := cfg.GeckoSource
+		if len(args) > 0 {
+			source = args[0]
+			args = args[1:]
+		}
+		if source == "" {
+			log.Panic("Must provide the file or url of the codes to add, or set geckoSource")
+		}
+
+		lines, err := fetchGeckoList(ctx, cfg, source)
+		if err != nil {
+			failIfCancelled(ctx)
+			failf(exitNetwork, "Failed to read codes from %s. %s", source, err.Error())
+		}
+
+		// Without names every code of the list is added
+		available := parseGeckoCodes(lines, "user")
+		codes = []geckoCode{}
+		for _, code := range available {
+			if len(args) > 0 && !containsFold(args, code.Name) {
+				continue
+			}
+
+			err := validateGeckoCode(code)
+			if err != nil {
+				failf(exitVerification, "Invalid Gecko code, nothing was changed. %s", err.Error())
+			}
+			codes = append(codes, code)
+		}
+		if len(codes) == 0 {
+			failf(exitGeneric, "No matching Gecko codes in %s", source)
+		}
+
+		for i, code := range codes {
+			config.addCode(code)
+			if enable {
+				config.setEnabled(code.Name, true)
+				codes[i].Enabled = true
+			}
+		}
+
+		err = config.save()
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", config.userPath, err.Error())
+		}
+
+		for _, code := range codes {
+			fmt.Printf("Added %s\n", code.Name)
+		}
+		if !enable {
+			fmt.Println("Run gecko enable <name> to turn them on")
+		}
+		return codes, nil
+	}
+
+	log.Panicf("Unknown gecko action %s, must be list, enable, disable or add", action)
+	return nil, nil
+}
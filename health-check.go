@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Dolphin exits right after printing its version, this only guards against it hanging
+const healthCheckTimeout = 15 * time.Second
+
+// Windows exit codes of a process that couldn't be loaded
+const (
+	statusDLLNotFound     = 0xC0000135
+	statusInvalidImage    = 0xC000007B
+	statusEntryNotFound   = 0xC0000139
+	statusOrdinalNotFound = 0xC0000138
+)
+
+// vcRuntimeDLLs come with the Visual C++ redistributable rather than Windows
+var vcRuntimeDLLs = []string{"vcruntime140.dll", "vcruntime140_1.dll", "msvcp140.dll", "msvcp140_1.dll", "msvcp140_2.dll", "concrt140.dll"}
+
+// missingWindowsDLLs lists the DLLs the exe imports that Windows won't find. API sets are resolved
+// by the loader itself and never exist as files
+func missingWindowsDLLs(exe string) ([]string, error) {
+	file, err := pe.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	imports, err := file.ImportedLibraries()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, name := range imports {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "api-ms-") || strings.HasPrefix(lower, "ext-ms-") {
+			continue
+		}
+
+		if !findWindowsDLL(filepath.Dir(exe), name) {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// findWindowsDLL looks for a DLL where the loader would: next to the exe, in the system folders
+// and on the PATH
+func findWindowsDLL(exeDir, name string) bool {
+	dirs := []string{exeDir}
+	if root := os.Getenv("SystemRoot"); root != "" {
+		dirs = append(dirs, filepath.Join(root, "System32"), root)
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// missingLinuxLibraries asks the dynamic linker which libraries of the exe it can't find
+func missingLinuxLibraries(exe string) ([]string, error) {
+	output, err := exec.Command("ldd", exe).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "not found") {
+			missing = append(missing, strings.TrimSpace(strings.Split(line, "=>")[0]))
+		}
+	}
+
+	return missing, nil
+}
+
+// describeMissingLibraries explains missing libraries, most often the Visual C++ runtime
+func describeMissingLibraries(missing []string) string {
+	message := "missing " + strings.Join(missing, ", ")
+	for _, name := range missing {
+		if containsFold(vcRuntimeDLLs, name) {
+			return message + ". Install the latest Visual C++ Redistributable (x64) from Microsoft"
+		}
+	}
+
+	return message
+}
+
+// describeExitCode names the exit codes of an exe that didn't even start
+func describeExitCode(code int) string {
+	switch uint32(code) {
+	case statusDLLNotFound:
+		return "a DLL it needs is missing"
+	case statusInvalidImage:
+		return "the exe or one of its DLLs is corrupted or built for another architecture"
+	case statusEntryNotFound, statusOrdinalNotFound:
+		return "a DLL it needs is too old"
+	}
+
+	return fmt.Sprintf("exit code %d", code)
+}
+
+// checkDolphinStarts makes sure the Dolphin in exPath can run: the libraries it links against must
+// be there, then it is started with --version, which exits without opening a window
+func checkDolphinStarts(ctx context.Context, exPath string) (string, error) {
+	exe := findDolphinExe(exPath)
+
+	var missing []string
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		missing, err = missingWindowsDLLs(exe)
+	case "linux":
+		missing, err = missingLinuxLibraries(exe)
+	}
+	if err != nil {
+		logDebugf("Could not list the libraries of %s. %s", exe, err.Error())
+	}
+	if len(missing) > 0 {
+		return "", errors.New(describeMissingLibraries(missing))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, exe, "--version")
+	cmd.Dir = exPath
+	// Qt would otherwise need a display, which servers and ssh sessions don't have
+	cmd.Env = append(os.Environ(), "QT_QPA_PLATFORM=offscreen")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		// It is running, just not exiting, which is more than a broken install gets to
+		log.Printf("Warning: Dolphin didn't exit after %s, assuming it starts\n", healthCheckTimeout)
+		return "", nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("Dolphin failed to start, %s. %s", describeExitCode(exitErr.ExitCode()), strings.TrimSpace(output.String()))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output.String()), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+// Old entries are dropped such that the file doesn't grow forever with scheduled updates
+const maxHistoryEntries = 200
+
+// historyEntry is one update of the install, successful or not
+type historyEntry struct {
+	Command     string    `json:"command"`
+	FromVersion string    `json:"fromVersion"`
+	ToVersion   string    `json:"toVersion"`
+	Channel     string    `json:"channel"`
+	StartedAt   time.Time `json:"startedAt"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	// Outcome is success, failed or cancelled
+	Outcome  string `json:"outcome"`
+	ExitCode int    `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// updateTargetVersion is the version the running update installs, set once it is known such that
+// a failed update still records what it was updating to
+var updateTargetVersion string
+
+func historyPath(exPath string) string {
+	return filepath.Join(exPath, "update-history.json")
+}
+
+func loadHistory(exPath string) []historyEntry {
+	history := []historyEntry{}
+
+	contents, err := ioutil.ReadFile(historyPath(exPath))
+	if os.IsNotExist(err) {
+		return history
+	}
+	if err != nil {
+		log.Printf("Failed to read the update history, ignoring it. %s\n", err.Error())
+		return history
+	}
+
+	err = json.Unmarshal(contents, &history)
+	if err != nil {
+		log.Printf("Failed to parse the update history, ignoring it. %s\n", err.Error())
+	}
+
+	return history
+}
+
+// recordUpdate adds the update that just ended to the history and tells the update webhook.
+// Failing to write it only logs, the update itself already happened
+func recordUpdate(cfg toolsConfig, command, fromVersion string, startedAt time.Time, err error) {
+	entry := historyEntry{
+		Command:     command,
+		FromVersion: fromVersion,
+		ToVersion:   updateTargetVersion,
+		Channel:     cfg.channel(fromVersion),
+		StartedAt:   startedAt,
+		Duration:    math.Round(time.Since(startedAt).Seconds()*1000) / 1000,
+		Outcome:     "success",
+	}
+
+	switch uerr, ok := err.(*updateError); {
+	case err == nil:
+		entry.ToVersion = readInstalledVersion(cfg.InstallDir)
+	case isCancelled(err):
+		entry.Outcome = "cancelled"
+		entry.ExitCode = exitCancelled
+	case ok:
+		entry.Outcome = "failed"
+		entry.ExitCode = uerr.Code
+		entry.Error = uerr.Message
+	default:
+		entry.Outcome = "failed"
+		entry.ExitCode = exitGeneric
+		entry.Error = err.Error()
+	}
+
+	history := append(loadHistory(cfg.InstallDir), entry)
+	if len(history) > maxHistoryEntries {
+		history = history[len(history)-maxHistoryEntries:]
+	}
+
+	contents, marshalErr := json.MarshalIndent(history, "", "  ")
+	if marshalErr == nil {
+		marshalErr = fsutil.WriteFileAtomic(historyPath(cfg.InstallDir), contents, 0644)
+	}
+	if marshalErr != nil {
+		log.Printf("Failed to write the update history. %s\n", marshalErr.Error())
+	}
+
+	notifyUpdateWebhook(cfg, entry)
+}
+
+// execHistory lists the most recent updates, newest first. A limit of 0 lists all of them
+func execHistory(cfg toolsConfig, asJSON bool, limit int) []historyEntry {
+	history := loadHistory(cfg.InstallDir)
+
+	entries := []historyEntry{}
+	for i := len(history) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		entries = append(entries, history[i])
+	}
+
+	if jsonOutput {
+		return entries
+	} else if asJSON {
+		contents, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+		return entries
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No updates recorded yet")
+		return entries
+	}
+
+	for _, entry := range entries {
+		fromVersion := entry.FromVersion
+		if fromVersion == "" {
+			fromVersion = "unknown"
+		}
+		toVersion := entry.ToVersion
+		if toVersion == "" {
+			toVersion = "unknown"
+		}
+
+		duration := time.Duration(entry.Duration * float64(time.Second)).Round(time.Second)
+		fmt.Printf("%s  %-10s %-22s %-8s %-9s %s\n", entry.StartedAt.Local().Format("2006-01-02 15:04"), entry.Command,
+			fromVersion+" -> "+toVersion, entry.Channel, entry.Outcome, duration)
+		if entry.Error != "" {
+			fmt.Printf("  exit code %d: %s\n", entry.ExitCode, entry.Error)
+		}
+	}
+
+	return entries
+}
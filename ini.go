@@ -0,0 +1,164 @@
+package main
+
+import "strings"
+
+type iniSection struct {
+	name  string
+	lines []string
+}
+
+// iniFile keeps every line as it was read such that writing it back only changes what was edited
+type iniFile struct {
+	sections []*iniSection
+	crlf     bool
+}
+
+// parseIni splits an ini file into sections. Lines before the first header go in a section
+// without a name
+func parseIni(contents string) *iniFile {
+	file := &iniFile{sections: []*iniSection{{}}, crlf: strings.Contains(contents, "\r\n")}
+
+	contents = strings.ReplaceAll(contents, "\r\n", "\n")
+	for _, line := range strings.Split(strings.TrimRight(contents, "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			file.sections = append(file.sections, &iniSection{name: trimmed})
+			continue
+		}
+
+		current := file.sections[len(file.sections)-1]
+		current.lines = append(current.lines, line)
+	}
+
+	return file
+}
+
+func (file *iniFile) section(name string) *iniSection {
+	for _, section := range file.sections {
+		if section.name == name {
+			return section
+		}
+	}
+
+	return nil
+}
+
+// String formats the file with the line endings it was read with
+func (file *iniFile) String() string {
+	newline := "\n"
+	if file.crlf {
+		newline = "\r\n"
+	}
+
+	var builder strings.Builder
+	for _, section := range file.sections {
+		if section.name != "" {
+			builder.WriteString(section.name + newline)
+		}
+		for _, line := range section.lines {
+			builder.WriteString(line + newline)
+		}
+	}
+
+	return builder.String()
+}
+
+// set changes key in section, adding the section or key when they are missing
+func (file *iniFile) set(sectionName, key, value string) {
+	section := file.addSection(sectionName)
+
+	line := key + " = " + value
+	for i, existing := range section.lines {
+		if lineKey, ok := iniKey(existing); ok && strings.EqualFold(lineKey, key) {
+			section.lines[i] = line
+			return
+		}
+	}
+
+	section.appendLines(line)
+}
+
+// addSection returns the section, adding it at the end of the file if it is missing
+func (file *iniFile) addSection(sectionName string) *iniSection {
+	section := file.section(sectionName)
+	if section != nil {
+		return section
+	}
+
+	// Keep a blank line between sections like Dolphin does
+	last := file.sections[len(file.sections)-1]
+	if len(last.lines) > 0 && strings.TrimSpace(last.lines[len(last.lines)-1]) != "" {
+		last.lines = append(last.lines, "")
+	}
+
+	section = &iniSection{name: sectionName}
+	file.sections = append(file.sections, section)
+	return section
+}
+
+// appendLines adds lines after the last non blank line such that trailing blank lines stay between
+// the sections
+func (section *iniSection) appendLines(lines ...string) {
+	insert := len(section.lines)
+	for insert > 0 && strings.TrimSpace(section.lines[insert-1]) == "" {
+		insert--
+	}
+
+	rest := append([]string{}, section.lines[insert:]...)
+	section.lines = append(append(section.lines[:insert], lines...), rest...)
+}
+
+// unset removes key from section, returning false if it wasn't set
+func (file *iniFile) unset(sectionName, key string) bool {
+	section := file.section(sectionName)
+	if section == nil {
+		return false
+	}
+
+	for i, existing := range section.lines {
+		if lineKey, ok := iniKey(existing); ok && strings.EqualFold(lineKey, key) {
+			section.lines = append(section.lines[:i], section.lines[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (section *iniSection) equal(other *iniSection) bool {
+	if section == nil || other == nil {
+		return section == other
+	}
+
+	return strings.Join(section.lines, "\n") == strings.Join(other.lines, "\n")
+}
+
+// iniKey returns the key of a key = value line, or false for comments and code lines
+func iniKey(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+		return "", false
+	}
+
+	idx := strings.Index(trimmed, "=")
+	if idx <= 0 {
+		return "", false
+	}
+
+	return strings.TrimSpace(trimmed[:idx]), true
+}
+
+// value returns the value of key in the section
+func (section *iniSection) value(key string) (string, bool) {
+	if section == nil {
+		return "", false
+	}
+
+	for _, line := range section.lines {
+		if lineKey, ok := iniKey(line); ok && strings.EqualFold(lineKey, key) {
+			return strings.TrimSpace(line[strings.Index(line, "=")+1:]), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// portableMarker next to Dolphin makes it keep its User folder in the install instead of the
+// per user location
+const portableMarker = "portable.txt"
+
+// installMetadata is kept in every install the tools update, such that each install can be told
+// apart when several are managed from one copy of the tools
+type installMetadata struct {
+	Type      string    `json:"type,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	Portable  bool      `json:"portable"`
+}
+
+func installMetadataPath(exPath string) string {
+	return filepath.Join(exPath, "slippi-install.json")
+}
+
+func loadInstallMetadata(exPath string) (installMetadata, error) {
+	var metadata installMetadata
+
+	contents, err := ioutil.ReadFile(installMetadataPath(exPath))
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(contents, &metadata)
+	return metadata, err
+}
+
+// recordInstall updates the metadata of the install after it was changed
+func recordInstall(cfg toolsConfig) error {
+	exPath := cfg.InstallDir
+	version := readInstalledVersion(exPath)
+
+	metadata, _ := loadInstallMetadata(exPath)
+	metadata.Type = cfg.dolphinType()
+	metadata.Channel = cfg.channel(version)
+	metadata.Version = version
+	metadata.UpdatedAt = time.Now()
+	metadata.Portable = isPortableInstall(exPath)
+
+	contents, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(installMetadataPath(exPath), contents, 0644)
+}
+
+// noteInstall records the install after a command changed it, failing to do so only loses the metadata
+func noteInstall(cfg toolsConfig) {
+	err := recordInstall(cfg)
+	if err != nil {
+		log.Printf("Failed to record the install metadata. %s\n", err.Error())
+	}
+}
+
+// samePath reports whether both paths point at the same folder, falling back to comparing the
+// paths when either doesn't exist
+func samePath(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+func isPortableInstall(exPath string) bool {
+	_, err := os.Stat(filepath.Join(exPath, portableMarker))
+	return err == nil
+}
+
+// dolphinUserDir returns the User folder Dolphin uses for the install. Portable installs keep it
+// next to Dolphin, otherwise it's in the per user location of the OS
+func dolphinUserDir(exPath string) string {
+	portableDir := filepath.Join(exPath, "User")
+	if isPortableInstall(exPath) {
+		return portableDir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return portableDir
+	}
+
+	var userDir string
+	switch runtime.GOOS {
+	case "windows":
+		userDir = filepath.Join(home, "Documents", "Dolphin Emulator")
+	case "darwin":
+		userDir = filepath.Join(home, "Library", "Application Support", "Slippi Dolphin")
+	default:
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		userDir = filepath.Join(configHome, "SlippiOnline")
+	}
+
+	// Installs from before the marker was shipped still kept User next to Dolphin
+	if _, err := os.Stat(userDir); err != nil {
+		if _, err := os.Stat(portableDir); err == nil {
+			return portableDir
+		}
+	}
+
+	return userDir
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+var validDolphinTypes = []string{slippiapi.TypeNetplay, slippiapi.TypePlayback}
+
+// registeredInstall is a Dolphin install managed by this copy of the tools
+type registeredInstall struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	// Archived installs are old builds kept for their replays, they are never updated
+	Archived bool `json:"archived,omitempty"`
+}
+
+// installEntry is how an install is listed by the installs command
+type installEntry struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Version  string `json:"version"`
+	Portable bool   `json:"portable"`
+	Archived bool   `json:"archived"`
+}
+
+// installsPath is kept next to the tools rather than in an install since it lists all of them
+func installsPath() string {
+	return filepath.Join(getExecutableDir(), "slippi-installs.json")
+}
+
+func loadInstalls() []registeredInstall {
+	installs := []registeredInstall{}
+
+	contents, err := ioutil.ReadFile(installsPath())
+	if os.IsNotExist(err) {
+		return installs
+	}
+	if err != nil {
+		log.Printf("Failed to read the installs file, ignoring it. %s\n", err.Error())
+		return installs
+	}
+
+	err = json.Unmarshal(contents, &installs)
+	if err != nil {
+		log.Printf("Failed to parse the installs file, ignoring it. %s\n", err.Error())
+	}
+
+	return installs
+}
+
+func saveInstalls(installs []registeredInstall) error {
+	contents, err := json.MarshalIndent(installs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(installsPath(), contents, 0644)
+}
+
+func isValidDolphinType(dolphinType string) bool {
+	for _, valid := range validDolphinTypes {
+		if dolphinType == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// installType returns the Dolphin type of an install. The registered type wins, then the one
+// recorded by the last update. Unknown installs are netplay since that's what the tools ship with
+func installType(exPath string) string {
+	for _, install := range loadInstalls() {
+		if samePath(install.Path, exPath) {
+			return install.Type
+		}
+	}
+
+	metadata, err := loadInstallMetadata(exPath)
+	if err == nil && isValidDolphinType(metadata.Type) {
+		return metadata.Type
+	}
+
+	return slippiapi.TypeNetplay
+}
+
+// resolveTarget points the config at the registered install of the -target type, unless the
+// install dir already is one
+func resolveTarget(cfg *toolsConfig) {
+	if cfg.Target == "" {
+		return
+	}
+	if !isValidDolphinType(cfg.Target) {
+		log.Panicf("Unknown target %s, must be one of: %s", cfg.Target, strings.Join(validDolphinTypes, ", "))
+	}
+
+	if installType(cfg.InstallDir) == cfg.Target {
+		return
+	}
+
+	for _, install := range loadInstalls() {
+		if install.Type == cfg.Target && !install.Archived {
+			cfg.InstallDir = install.Path
+			return
+		}
+	}
+
+	failf(exitGeneric, "No %s install is registered, add one with installs add -type %s <path>", cfg.Target, cfg.Target)
+}
+
+// execInstalls lists, adds or removes the installs managed by the tools
+func execInstalls(action, path, dolphinType string) []installEntry {
+	installs := loadInstalls()
+
+	switch action {
+	case "", "list":
+	case "add":
+		if path == "" {
+			log.Panic("Must provide the path of the install to add")
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			log.Panic(err)
+		}
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+			log.Panicf("%s is not a folder", absPath)
+		}
+
+		if dolphinType == "" {
+			dolphinType = installType(absPath)
+		}
+		if !isValidDolphinType(dolphinType) {
+			log.Panicf("Unknown type %s, must be one of: %s", dolphinType, strings.Join(validDolphinTypes, ", "))
+		}
+
+		installs = withoutInstall(installs, absPath)
+		installs = append(installs, registeredInstall{Path: absPath, Type: dolphinType})
+		err = saveInstalls(installs)
+		if err != nil {
+			log.Panicf("Failed to save the installs file. %s", err.Error())
+		}
+		fmt.Printf("Registered %s install %s\n", dolphinType, absPath)
+	case "remove":
+		if path == "" {
+			log.Panic("Must provide the path of the install to remove")
+		}
+
+		remaining := withoutInstall(installs, path)
+		if len(remaining) == len(installs) {
+			log.Panicf("%s is not a registered install", path)
+		}
+		installs = remaining
+		err := saveInstalls(installs)
+		if err != nil {
+			log.Panicf("Failed to save the installs file. %s", err.Error())
+		}
+		fmt.Printf("Removed %s, its files were left alone\n", path)
+	default:
+		log.Panicf("Unknown installs action %s, must be list, add or remove", action)
+	}
+
+	entries := []installEntry{}
+	for _, install := range installs {
+		entries = append(entries, installEntry{
+			Path:     install.Path,
+			Type:     install.Type,
+			Version:  readInstalledVersion(install.Path),
+			Portable: isPortableInstall(install.Path),
+			Archived: install.Archived,
+		})
+	}
+
+	if action == "" || action == "list" {
+		if len(entries) == 0 {
+			fmt.Println("No installs registered, the install next to the tools is used")
+		}
+		for _, entry := range entries {
+			version := entry.Version
+			if version == "" {
+				version = "unknown"
+			}
+			archived := ""
+			if entry.Archived {
+				archived = " (archived)"
+			}
+			fmt.Printf("%-9s %-10s %s%s\n", entry.Type, version, entry.Path, archived)
+		}
+	}
+
+	return entries
+}
+
+func withoutInstall(installs []registeredInstall, path string) []registeredInstall {
+	remaining := []registeredInstall{}
+	for _, install := range installs {
+		if !samePath(install.Path, path) {
+			remaining = append(remaining, install)
+		}
+	}
+
+	return remaining
+}
@@ -0,0 +1,26 @@
+// Package fsutil has file helpers shared by the tools and its packages
+package fsutil
+
+import "os"
+
+// WriteFileAtomic writes to a temporary file next to path and renames it over path once it's
+// flushed to disk, readers see either the old or the new contents but never a partial file
+func WriteFileAtomic(path string, contents []byte, perm os.FileMode) error {
+	path = LongPath(path)
+	f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,36 @@
+package fsutil
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// LongPath returns path in the extended-length \\?\ form on Windows, which lifts the 260
+// character MAX_PATH limit. Go only adds the prefix itself for absolute paths, relative ones are
+// made absolute first since the prefix turns off all other normalization
+func LongPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+
+	return windowsLongPath(path, filepath.Abs)
+}
+
+// windowsLongPath does the work of LongPath with abs making paths absolute, such that it can be
+// tested on any platform
+func windowsLongPath(path string, abs func(string) (string, error)) string {
+	if path == "" || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+
+	absPath, err := abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(absPath, `\\`) {
+		return `\\?\UNC\` + absPath[2:]
+	}
+
+	return `\\?\` + absPath
+}
@@ -0,0 +1,61 @@
+package fsutil
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testAbs makes paths absolute like filepath.Abs on Windows with C:\Slippi as working directory
+func testAbs(path string) (string, error) {
+	if strings.HasPrefix(path, "bad") {
+		return "", errors.New("no working directory")
+	}
+	if strings.HasPrefix(path, `\\`) || (len(path) > 2 && path[1] == ':') {
+		return path, nil
+	}
+
+	return `C:\Slippi\` + path, nil
+}
+
+func TestWindowsLongPath(t *testing.T) {
+	long := `C:\Users\` + strings.Repeat(`ユーザー\フォルダ\`, 20) + `Slippi Dolphin.exe`
+	if len(long) <= 260 {
+		t.Fatalf("the long path is only %d characters", len(long))
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"empty", "", ""},
+		{"absolute", `C:\Slippi\Sys`, `\\?\C:\Slippi\Sys`},
+		{"relative", `Sys\GameSettings`, `\\?\C:\Slippi\Sys\GameSettings`},
+		{"unc", `\\venue-pc\share\Slippi`, `\\?\UNC\venue-pc\share\Slippi`},
+		{"already prefixed", `\\?\C:\Slippi`, `\\?\C:\Slippi`},
+		{"already prefixed unc", `\\?\UNC\venue-pc\share`, `\\?\UNC\venue-pc\share`},
+		{"device", `\\.\COM1`, `\\.\COM1`},
+		{"longer than MAX_PATH", long, `\\?\` + long},
+		{"abs fails", `bad\path`, `bad\path`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := windowsLongPath(test.path, testAbs); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLongPathOnlyChangesWindowsPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("covered by TestWindowsLongPath")
+	}
+
+	if got := LongPath("relative/path"); got != "relative/path" {
+		t.Errorf("got %q, want the path unchanged", got)
+	}
+}
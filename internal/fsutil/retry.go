@@ -0,0 +1,72 @@
+package fsutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy bounds how often a file operation is tried again when it fails with an error that
+// may go away, such as a file an antivirus or Explorer briefly holds open on Windows
+type RetryPolicy struct {
+	Attempts int
+	// Delay is the wait after the first failure, it doubles after every attempt up to MaxDelay
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Retryable decides whether an error is worth another attempt, all are when nil
+	Retryable func(error) bool
+}
+
+// FileRetryPolicy waits about 20 seconds in total, long enough for a scan of a large file
+var FileRetryPolicy = RetryPolicy{Attempts: 8, Delay: 250 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// RetryError holds the error of every attempt, it unwraps to the last one such that callers can
+// still tell what went wrong
+type RetryError struct {
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempts. %s", len(e.Errors), e.Unwrap().Error())
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Errors[len(e.Errors)-1]
+}
+
+// Do runs op until it succeeds, fails with an error that isn't retryable or runs out of attempts.
+// onRetry, if set, is told about each failure before the wait. Cancelling ctx stops the wait
+func (p RetryPolicy) Do(ctx context.Context, op func() error, onRetry func(err error, delay time.Duration)) error {
+	errs := []error{}
+	delay := p.Delay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+
+		if attempt >= p.Attempts || (p.Retryable != nil && !p.Retryable(err)) {
+			break
+		}
+
+		if onRetry != nil {
+			onRetry(err, delay)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		delay *= 2
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &RetryError{Errors: errs}
+}
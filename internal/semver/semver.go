@@ -0,0 +1,159 @@
+// Package semver parses and compares the version numbers of Dolphin and tools releases. Versions
+// follow semantic versioning, a leading v and missing minor or patch numbers are accepted since
+// older releases were published like that
+package semver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease []string
+	Build      string
+}
+
+// Parse parses a version such as 3.4.1, v3.4 or 3.5.0-beta.2+abc
+func Parse(version string) (Version, error) {
+	var v Version
+
+	rest := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.Index(rest, "+"); i >= 0 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "-"); i >= 0 {
+		if rest[i+1:] == "" {
+			return v, errors.New("empty prerelease in " + version)
+		}
+		v.Prerelease = strings.Split(rest[i+1:], ".")
+		rest = rest[:i]
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return v, errors.New("too many numbers in " + version)
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return v, errors.New("invalid version " + version)
+		}
+		*numbers[i] = number
+	}
+
+	return v, nil
+}
+
+// IsValid reports whether version can be parsed
+func IsValid(version string) bool {
+	_, err := Parse(version)
+	return err == nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is older, the same as or newer than w. A
+// prerelease is older than its release and build metadata is ignored. Invalid versions are older
+// than valid ones and equal to each other
+func Compare(v, w string) int {
+	pv, errV := Parse(v)
+	pw, errW := Parse(w)
+	switch {
+	case errV != nil && errW != nil:
+		return 0
+	case errV != nil:
+		return -1
+	case errW != nil:
+		return 1
+	}
+
+	return pv.Compare(pw)
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is older, the same as or newer than w
+func (v Version) Compare(w Version) int {
+	if cmp := compareInts(v.Major, w.Major); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareInts(v.Minor, w.Minor); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareInts(v.Patch, w.Patch); cmp != 0 {
+		return cmp
+	}
+
+	// A release is newer than its prereleases
+	switch {
+	case len(v.Prerelease) == 0 && len(w.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(w.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(w.Prerelease); i++ {
+		if cmp := compareIdentifiers(v.Prerelease[i], w.Prerelease[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	return compareInts(len(v.Prerelease), len(w.Prerelease))
+}
+
+// String formats the version with all three numbers
+func (v Version) String() string {
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+
+	return s
+}
+
+// PrereleaseTag returns the name the prerelease starts with in lower case, such as beta for
+// 3.5.0-beta.2 or 3.5.0-Beta2. Empty for releases and invalid versions
+func PrereleaseTag(version string) string {
+	v, err := Parse(version)
+	if err != nil || len(v.Prerelease) == 0 {
+		return ""
+	}
+
+	tag := strings.ToLower(v.Prerelease[0])
+	return strings.TrimRight(tag, "0123456789")
+}
+
+// Identifiers made of digits compare numerically and are older than ones with letters
+func compareIdentifiers(a, b string) int {
+	numA, errA := strconv.Atoi(a)
+	numB, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(numA, numB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
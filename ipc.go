@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipcProtocolVersion is bumped whenever a request or event changes in a way old launchers can't
+// handle, new fields alone don't need a bump
+const ipcProtocolVersion = 1
+
+// How long a cancelled command gets to roll back before it is killed
+const ipcCancelGrace = 30 * time.Second
+
+// ipcRequest is one line sent by the launcher. run starts command, which may be several words
+// such as "user login", cancel stops the run with the same id and shutdown cancels everything
+// and ends the session
+type ipcRequest struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+type ipcHelloEvent struct {
+	Type            string `json:"type"`
+	ProtocolVersion int    `json:"protocolVersion"`
+	ToolsVersion    string `json:"toolsVersion"`
+}
+
+// ipcExitEvent is the last event of every run, after the command's own result event
+type ipcExitEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Code      int    `json:"code"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ipcErrorEvent struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+type ipcRun struct {
+	cmd       *exec.Cmd
+	cancelled bool
+}
+
+// ipcSession serves one launcher connection. Every run is a separate process of the tools in json
+// mode, its events are forwarded with the run's id added
+type ipcSession struct {
+	cfg     toolsConfig
+	exePath string
+
+	mu   sync.Mutex
+	out  io.Writer
+	runs map[string]*ipcRun
+	wg   sync.WaitGroup
+}
+
+// execIPC serves launcher requests on stdin and stdout, or on a unix socket at listen
+func execIPC(ctx context.Context, cfg toolsConfig, listen string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if listen == "" {
+		// Stray prints would corrupt the event stream, they go to stderr like in json mode
+		out := jsonStdout
+		if !jsonOutput {
+			os.Stdout = os.Stderr
+		}
+
+		newIPCSession(cfg, exePath, out).serve(ctx, os.Stdin)
+		return nil
+	}
+
+	// A socket left behind by a crashed session would make listening fail
+	os.Remove(listen)
+	listener, err := net.Listen("unix", listen)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(listen)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Printf("Listening for the launcher on %s\n", listen)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			newIPCSession(cfg, exePath, conn).serve(ctx, conn)
+		}()
+	}
+}
+
+func newIPCSession(cfg toolsConfig, exePath string, out io.Writer) *ipcSession {
+	return &ipcSession{cfg: cfg, exePath: exePath, out: out, runs: map[string]*ipcRun{}}
+}
+
+// serve handles requests until shutdown, the end of in or ctx being cancelled. Runs still going
+// at that point are cancelled and waited for
+func (s *ipcSession) serve(ctx context.Context, in io.Reader) {
+	s.send(ipcHelloEvent{Type: "hello", ProtocolVersion: ipcProtocolVersion, ToolsVersion: toolsVersion})
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	defer s.wg.Wait()
+	defer s.cancelAll()
+
+	for {
+		var line string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case line, ok = <-lines:
+		}
+		if !ok {
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var req ipcRequest
+		err := json.Unmarshal([]byte(line), &req)
+		if err != nil {
+			s.send(ipcErrorEvent{Type: "error", Message: fmt.Sprintf("invalid request: %s", err.Error())})
+			continue
+		}
+
+		switch req.Type {
+		case "run":
+			err = s.start(req)
+		case "cancel":
+			err = s.cancel(req.ID)
+		case "shutdown":
+			return
+		default:
+			err = fmt.Errorf("unknown request type %s, expected run, cancel or shutdown", req.Type)
+		}
+		if err != nil {
+			s.send(ipcErrorEvent{Type: "error", ID: req.ID, Message: err.Error()})
+		}
+	}
+}
+
+// start runs the command as `<exe> -json <command> <config flags> <args>`, flags in args win
+// over the session's config since the last occurrence of a flag is used
+func (s *ipcSession) start(req ipcRequest) error {
+	words := strings.Fields(req.Command)
+	if req.ID == "" {
+		return errors.New("run needs an id")
+	}
+	if len(words) == 0 {
+		return errors.New("run needs a command")
+	}
+	if words[0] == "ipc" || words[0] == "watch" {
+		return fmt.Errorf("%s can't be run over ipc", words[0])
+	}
+
+	args := append([]string{"-json"}, words...)
+	args = append(args, s.cfg.args()...)
+	args = append(args, req.Args...)
+
+	cmd := exec.Command(s.exePath, args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.runs[req.ID]; ok {
+		return fmt.Errorf("%s is already running", req.ID)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	logDebugf("ipc run %s started %s", req.ID, strings.Join(args, " "))
+
+	run := &ipcRun{cmd: cmd}
+	s.runs[req.ID] = run
+	s.wg.Add(1)
+	go s.forward(req.ID, run, stdout)
+
+	return nil
+}
+
+// forward relays the events of a run until it exits, then reports how it ended
+func (s *ipcSession) forward(id string, run *ipcRun, stdout io.Reader) {
+	defer s.wg.Done()
+
+	idJSON, _ := json.Marshal(id)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		event := map[string]json.RawMessage{}
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			// Only events are written to stdout in json mode, anything else is passed on as a log
+			s.send(logEvent{Type: "log", Level: "info", Message: scanner.Text()})
+			continue
+		}
+
+		event["id"] = idJSON
+		s.send(event)
+	}
+
+	err := run.cmd.Wait()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		code = exitGeneric
+	}
+
+	s.mu.Lock()
+	delete(s.runs, id)
+	cancelled := run.cancelled
+	s.mu.Unlock()
+
+	s.send(ipcExitEvent{Type: "exit", ID: id, Code: code, Cancelled: cancelled})
+}
+
+func (s *ipcSession) cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return fmt.Errorf("%s is not running", id)
+	}
+
+	s.interrupt(run)
+	return nil
+}
+
+func (s *ipcSession) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, run := range s.runs {
+		s.interrupt(run)
+	}
+}
+
+// interrupt asks the run to stop such that it can roll back, and kills it if it doesn't within
+// the grace period. Windows can't deliver an interrupt to another process, the run is killed
+// and the journal repairs the install on the next start
+func (s *ipcSession) interrupt(run *ipcRun) {
+	if run.cancelled {
+		return
+	}
+	run.cancelled = true
+
+	process := run.cmd.Process
+	err := process.Signal(os.Interrupt)
+	if err != nil {
+		process.Kill()
+		return
+	}
+
+	time.AfterFunc(ipcCancelGrace, func() {
+		process.Kill()
+	})
+}
+
+func (s *ipcSession) send(event interface{}) {
+	contents, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	fmt.Fprintln(s.out, string(contents))
+}
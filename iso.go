@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knownIsos are clean dumps by MD5 of the whole image
+var knownIsos = map[string]string{
+	"0e63d4223b01d9aba596259dc155a174": "NTSC 1.02",
+}
+
+const (
+	isoMagicOffset = 0x1c
+	isoMagic       = 0xc2339f3d
+	apploaderStart = 0x2440
+	isoBlockSize   = 1024 * 1024
+)
+
+// Compressed images have to be converted back to an ISO before they can be hashed
+var compressedIsoMagics = map[string][]byte{
+	"RVZ":  []byte("RVZ\x01"),
+	"WIA":  []byte("WIA\x01"),
+	"GCZ":  {0x01, 0xc0, 0x0b, 0xb1},
+	"CISO": []byte("CISO"),
+}
+
+// isoResult is what iso verify found out about an image
+type isoResult struct {
+	Path     string `json:"path"`
+	GameID   string `json:"gameId"`
+	Revision string `json:"revision"`
+	MD5      string `json:"md5"`
+	// Status is vanilla, scrubbed, modified, wrong-revision, not-melee or compressed
+	Status string `json:"status"`
+	Known  string `json:"known,omitempty"`
+}
+
+// isoVerifyEvent is emitted in json mode for images that fail verification
+type isoVerifyEvent struct {
+	Type string `json:"type"`
+	isoResult
+}
+
+// isoExtent is a part of the image used by the game
+type isoExtent struct {
+	Start int64
+	End   int64
+}
+
+// execIsoVerify checks that an image is a clean NTSC 1.02 Melee ISO. Scrubbed images only had the
+// unused padding zeroed and play fine, anything else fails with exitVerification
+func execIsoVerify(ctx context.Context, path string) (result isoResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered verifying ISO")
+		}
+	}()
+
+	result.Path = path
+
+	file, err := os.Open(path)
+	if err != nil {
+		failf(exitGeneric, "Failed to open the ISO. %s", err.Error())
+	}
+	defer file.Close()
+
+	header := make([]byte, 0x440)
+	_, err = io.ReadFull(file, header)
+	if err != nil {
+		failf(exitVerification, "%s is too small to be a GameCube image", path)
+	}
+
+	for format, magic := range compressedIsoMagics {
+		if bytes.HasPrefix(header, magic) {
+			result.Status = "compressed"
+			fmt.Printf("%s is a %s image, convert it to an ISO with Dolphin to verify it\n", path, format)
+			return result, nil
+		}
+	}
+
+	if binary.BigEndian.Uint32(header[isoMagicOffset:]) != isoMagic {
+		failf(exitVerification, "%s is not a GameCube image", path)
+	}
+
+	result.GameID = string(header[:6])
+	result.Revision = fmt.Sprintf("1.%02d", header[7])
+
+	fmt.Printf("Hashing %s...\n", path)
+	result.MD5, err = hashIso(ctx, file)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitGeneric, "Failed to read the ISO. %s", err.Error())
+	}
+
+	if name, ok := knownIsos[result.MD5]; ok {
+		result.Status = "vanilla"
+		result.Known = name
+		fmt.Printf("%s is a clean %s ISO\n", path, name)
+		return result, nil
+	}
+
+	switch {
+	case result.GameID != "GALE01" && result.GameID != "GALJ01" && result.GameID != "GALP01":
+		result.Status = "not-melee"
+	case result.GameID != "GALE01" || header[7] != 2:
+		result.Status = "wrong-revision"
+	default:
+		scrubbed, err := isScrubbed(ctx, file, header)
+		if err != nil {
+			failIfCancelled(ctx)
+			failf(exitGeneric, "Failed to read the ISO. %s", err.Error())
+		}
+
+		result.Status = "modified"
+		if scrubbed {
+			result.Status = "scrubbed"
+		}
+	}
+
+	// The result isn't emitted on failure, the findings go out as an event first
+	emitResultOnFailure := func(format string, args ...interface{}) {
+		if jsonOutput {
+			emitEvent(isoVerifyEvent{Type: "iso-verify", isoResult: result})
+		}
+		failf(exitVerification, format, args...)
+	}
+
+	switch result.Status {
+	case "scrubbed":
+		fmt.Printf("%s is a scrubbed NTSC 1.02 ISO, only unused data was removed and it works for netplay\n", path)
+	case "modified":
+		emitResultOnFailure("%s is a modified NTSC 1.02 ISO (MD5 %s), use a clean ISO for netplay", path, result.MD5)
+	case "wrong-revision":
+		emitResultOnFailure("%s is Melee %s %s, netplay needs NTSC 1.02", path, result.GameID, result.Revision)
+	default:
+		emitResultOnFailure("%s is %s, not Melee", path, result.GameID)
+	}
+
+	return result, nil
+}
+
+func hashIso(ctx context.Context, file *os.File) (string, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	hash := md5.New()
+	buf := make([]byte, isoBlockSize)
+	for {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		n, err := file.Read(buf)
+		hash.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isScrubbed reports whether everything outside the parts the game uses is zero. Scrubbing tools
+// zero the padding between files such that the image compresses better
+func isScrubbed(ctx context.Context, file *os.File, header []byte) (bool, error) {
+	extents, err := isoExtents(file, header)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Check the gaps between the used extents
+	buf := make([]byte, isoBlockSize)
+	pos := int64(0)
+	for _, extent := range append(extents, isoExtent{Start: info.Size(), End: info.Size()}) {
+		for pos < extent.Start {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+
+			size := extent.Start - pos
+			if size > isoBlockSize {
+				size = isoBlockSize
+			}
+			_, err = file.ReadAt(buf[:size], pos)
+			if err != nil {
+				return false, err
+			}
+			if !isZero(buf[:size]) {
+				return false, nil
+			}
+			pos += size
+		}
+		if extent.End > pos {
+			pos = extent.End
+		}
+	}
+
+	return true, nil
+}
+
+// isoExtents lists the header, apploader, main executable, file system table and every file, sorted
+// by where they start
+func isoExtents(file *os.File, header []byte) ([]isoExtent, error) {
+	readUint32 := func(offset int64) (uint32, error) {
+		buf := make([]byte, 4)
+		_, err := file.ReadAt(buf, offset)
+		return binary.BigEndian.Uint32(buf), err
+	}
+
+	appSize, err := readUint32(apploaderStart + 0x14)
+	if err != nil {
+		return nil, err
+	}
+	appTrailer, err := readUint32(apploaderStart + 0x18)
+	if err != nil {
+		return nil, err
+	}
+	extents := []isoExtent{{Start: 0, End: apploaderStart + 0x20 + int64(appSize) + int64(appTrailer)}}
+
+	// The executable is as large as the furthest of its 7 text and 11 data sections
+	dolOffset := int64(binary.BigEndian.Uint32(header[0x420:]))
+	dolHeader := make([]byte, 0x100)
+	_, err = file.ReadAt(dolHeader, dolOffset)
+	if err != nil {
+		return nil, err
+	}
+	dolSize := int64(0x100)
+	for i := 0; i < 18; i++ {
+		offset := int64(binary.BigEndian.Uint32(dolHeader[i*4:]))
+		size := int64(binary.BigEndian.Uint32(dolHeader[0x90+i*4:]))
+		if offset+size > dolSize {
+			dolSize = offset + size
+		}
+	}
+	extents = append(extents, isoExtent{Start: dolOffset, End: dolOffset + dolSize})
+
+	fstOffset := int64(binary.BigEndian.Uint32(header[0x424:]))
+	fstSize := int64(binary.BigEndian.Uint32(header[0x428:]))
+	if fstSize < 12 || fstSize > 64*1024*1024 {
+		return nil, errors.New("invalid file system table")
+	}
+	fst := make([]byte, fstSize)
+	_, err = file.ReadAt(fst, fstOffset)
+	if err != nil {
+		return nil, err
+	}
+	extents = append(extents, isoExtent{Start: fstOffset, End: fstOffset + fstSize})
+
+	// Every entry is 12 bytes, the root entry holds the number of entries. Directories have their
+	// first byte set
+	entries := int64(binary.BigEndian.Uint32(fst[8:]))
+	if entries*12 > fstSize {
+		return nil, errors.New("invalid file system table")
+	}
+	for i := int64(1); i < entries; i++ {
+		entry := fst[i*12 : i*12+12]
+		if entry[0] != 0 {
+			continue
+		}
+
+		offset := int64(binary.BigEndian.Uint32(entry[4:]))
+		size := int64(binary.BigEndian.Uint32(entry[8:]))
+		extents = append(extents, isoExtent{Start: offset, End: offset + size})
+	}
+
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].Start < extents[j].Start
+	})
+
+	return extents, nil
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isoExtensions are the image formats Dolphin lists in its game folders
+var isoExtensions = []string{".iso", ".gcm", ".ciso", ".gcz", ".rvz", ".wia"}
+
+// wiaDiscHeaderOffset is where WIA and RVZ images keep a copy of the disc header
+const wiaDiscHeaderOffset = 0x58
+
+// findMeleeIsos lists the Melee images Dolphin knows about. The game Dolphin last ran or is set
+// to boot comes first, then the images in the game folders configured in Dolphin
+func findMeleeIsos(exPath string) []string {
+	contents, err := ioutil.ReadFile(filepath.Join(dolphinUserDir(exPath), "Config", "Dolphin.ini"))
+	if err != nil {
+		logDebugf("Could not read the Dolphin config. %s", err.Error())
+		return []string{}
+	}
+	config := parseIni(string(contents))
+
+	candidates := []string{}
+	for _, setting := range [][2]string{{"[Core]", "DefaultISO"}, {"[General]", "LastFilename"}} {
+		if path, ok := config.section(setting[0]).value(setting[1]); ok && path != "" {
+			candidates = append(candidates, path)
+		}
+	}
+
+	general := config.section("[General]")
+	count, _ := general.value("ISOPaths")
+	folders, _ := strconv.Atoi(count)
+	for i := 0; i < folders; i++ {
+		folder, ok := general.value(fmt.Sprintf("ISOPath%d", i))
+		if !ok || folder == "" {
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(folder)
+		if err != nil {
+			logDebugf("Could not read the game folder %s. %s", folder, err.Error())
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && containsFold(isoExtensions, filepath.Ext(entry.Name())) {
+				candidates = append(candidates, filepath.Join(folder, entry.Name()))
+			}
+		}
+	}
+
+	isos := []string{}
+	for _, path := range candidates {
+		if !containsPath(isos, path) && isMeleeImage(path) {
+			isos = append(isos, path)
+		}
+	}
+
+	return isos
+}
+
+// isMeleeImage checks the disc header for NTSC 1.02 Melee without hashing the image. GCZ and CISO
+// don't keep the header readable so they are trusted by name
+func isMeleeImage(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, wiaDiscHeaderOffset+8)
+	_, err = io.ReadFull(file, header)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case bytes.HasPrefix(header, compressedIsoMagics["RVZ"]), bytes.HasPrefix(header, compressedIsoMagics["WIA"]):
+		header = header[wiaDiscHeaderOffset:]
+	case bytes.HasPrefix(header, compressedIsoMagics["GCZ"]), bytes.HasPrefix(header, compressedIsoMagics["CISO"]):
+		return true
+	}
+
+	return string(header[:6]) == "GALE01" && header[7] == 2
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, existing := range paths {
+		if samePath(existing, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pickMeleeIso picks the ISO to launch with when -iso wasn't passed. With several candidates the
+// user picks one, unless nobody is there to answer
+func pickMeleeIso(exPath string, interactive bool) string {
+	isos := findMeleeIsos(exPath)
+	switch {
+	case len(isos) == 0:
+		log.Printf("Warning: no Melee ISO found, launching Dolphin without a game\n")
+		return ""
+	case len(isos) == 1 || !interactive:
+		fmt.Printf("Launching with %s\n", isos[0])
+		return isos[0]
+	}
+
+	fmt.Println("Found several Melee ISOs:")
+	for i, path := range isos {
+		fmt.Printf("  %d) %s\n", i+1, path)
+	}
+	fmt.Printf("Which one should Dolphin launch? [1] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(isos) {
+		choice = 1
+	}
+
+	return isos[choice-1]
+}
+
+// execIsoFind lists the Melee ISOs -launch can pick from
+func execIsoFind(cfg toolsConfig) []string {
+	isos := findMeleeIsos(cfg.InstallDir)
+	if len(isos) == 0 {
+		fmt.Println("No Melee ISO found in the Dolphin config or its game folders")
+	}
+	for _, path := range isos {
+		fmt.Println(path)
+	}
+
+	return isos
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const journalFileName = "update-journal.json"
+
+// Phases of an install recorded in the journal. While swapping the install is a mix of both
+// versions and can only be rolled back, once finishing the new version is complete and only the
+// steps after the swap are left
+const (
+	journalSwapping  = "swapping"
+	journalFinishing = "finishing"
+)
+
+// journalMove is a rename, with both paths relative to the install
+type journalMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// updateJournal records every change made to the install while swapping in a new version. It is
+// saved before each change such that a crash at any point can be repaired on the next run. Paths
+// are relative to the install, nothing the journal moves or removes may be outside of it
+type updateJournal struct {
+	exPath string
+
+	Operation   string        `json:"operation"`
+	PrevVersion string        `json:"prevVersion"`
+	Version     string        `json:"version"`
+	Phase       string        `json:"phase"`
+	StartedAt   time.Time     `json:"startedAt"`
+	Moves       []journalMove `json:"moves"`
+	TempDirs    []string      `json:"tempDirs,omitempty"`
+
+	// Needed to finish an update that crashed after the swap
+	BackupDir      string                `json:"backupDir,omitempty"`
+	DefaultsDir    string                `json:"defaultsDir,omitempty"`
+	ModifiedConfig []updater.UpdatedFile `json:"modifiedConfig,omitempty"`
+	Files          []updater.UpdatedFile `json:"files,omitempty"`
+}
+
+func journalPath(exPath string) string {
+	return filepath.Join(exPath, journalFileName)
+}
+
+// beginJournal starts recording an operation on the install. Staging directories passed are
+// removed when an interrupted operation is repaired
+func beginJournal(exPath, operation, prevVersion, version string, tempDirs ...string) (*updateJournal, error) {
+	journal := &updateJournal{
+		exPath:      exPath,
+		Operation:   operation,
+		PrevVersion: prevVersion,
+		Version:     version,
+		Phase:       journalSwapping,
+		StartedAt:   time.Now(),
+		Moves:       []journalMove{},
+		TempDirs:    []string{},
+	}
+
+	for _, dir := range tempDirs {
+		rel, err := journal.relPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		journal.TempDirs = append(journal.TempDirs, rel)
+	}
+
+	return journal, journal.save()
+}
+
+// isJournalPath tells whether a path of the journal is inside the install, and not the install
+// itself
+func isJournalPath(rel string) bool {
+	return updater.IsSafeRelPath(rel) && path.Clean(rel) != "."
+}
+
+// relPath turns a path in the install into the form the journal records
+func (journal *updateJournal) relPath(target string) (string, error) {
+	rel, err := filepath.Rel(fsutil.LongPath(journal.exPath), fsutil.LongPath(target))
+	if err != nil || !isJournalPath(filepath.ToSlash(rel)) {
+		return "", fmt.Errorf("%s is outside of the install", target)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// path returns where a path recorded in the journal is. A damaged or planted journal could lead
+// anywhere, so a path outside of the install is refused
+func (journal *updateJournal) path(rel string) (string, error) {
+	if !isJournalPath(rel) {
+		return "", fmt.Errorf("the update journal has a path outside of the install, %s", rel)
+	}
+
+	return fsutil.LongPath(filepath.Join(journal.exPath, filepath.FromSlash(rel))), nil
+}
+
+// validate checks every path of a loaded journal before anything is done with it
+func (journal *updateJournal) validate() error {
+	paths := append([]string{}, journal.TempDirs...)
+	for _, move := range journal.Moves {
+		paths = append(paths, move.From, move.To)
+	}
+	for _, dir := range []string{journal.BackupDir, journal.DefaultsDir} {
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+	}
+
+	for _, rel := range paths {
+		if _, err := journal.path(rel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadJournal(exPath string) (*updateJournal, error) {
+	contents, err := ioutil.ReadFile(journalPath(exPath))
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &updateJournal{exPath: exPath}
+	err = json.Unmarshal(contents, journal)
+	if err != nil {
+		return nil, err
+	}
+
+	return journal, journal.validate()
+}
+
+// save writes the journal to a temporary file first and renames it over the old one, such that a
+// crash while saving never leaves a truncated journal
+func (journal *updateJournal) save() error {
+	contents, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(journalPath(journal.exPath), contents, 0644)
+}
+
+// move renames from to to, recording it in the journal first. If the rename doesn't happen the
+// entry is dropped again
+func (journal *updateJournal) move(from, to string) error {
+	relFrom, err := journal.relPath(from)
+	if err != nil {
+		return err
+	}
+	relTo, err := journal.relPath(to)
+	if err != nil {
+		return err
+	}
+
+	from, to = fsutil.LongPath(from), fsutil.LongPath(to)
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+
+	journal.Moves = append(journal.Moves, journalMove{From: relFrom, To: relTo})
+	err = journal.save()
+	if err != nil {
+		journal.Moves = journal.Moves[:len(journal.Moves)-1]
+		return err
+	}
+
+	err = renameWithRetry(from, to)
+	if err != nil {
+		journal.Moves = journal.Moves[:len(journal.Moves)-1]
+		journal.save()
+		return err
+	}
+
+	return nil
+}
+
+// renameWithRetry renames from to to, trying again while Windows refuses because something such
+// as an antivirus scan or Explorer holds the file
+func renameWithRetry(from, to string) error {
+	policy := fsutil.FileRetryPolicy
+	policy.Retryable = func(err error) bool { return runtime.GOOS == "windows" && isFileLocked(err) }
+
+	return policy.Do(context.Background(), func() error {
+		return os.Rename(from, to)
+	}, func(err error, delay time.Duration) {
+		log.Printf("Failed to move %s, trying again in %s. %s\n", from, delay, err.Error())
+	})
+}
+
+// setPhase records that the install reached a new phase
+func (journal *updateJournal) setPhase(phase string) {
+	journal.Phase = phase
+	err := journal.save()
+	if err != nil {
+		log.Printf("Warning: failed to save update journal. %s\n", err.Error())
+	}
+}
+
+// rollback undoes the moves in reverse order, saving after each one such that an interrupted
+// rollback continues where it stopped. A move recorded right before a crash may not have
+// happened, its source not existing is expected
+func (journal *updateJournal) rollback() {
+	log.Printf("Restoring previous install...\n")
+
+	for len(journal.Moves) > 0 {
+		move := journal.Moves[len(journal.Moves)-1]
+
+		from, err := journal.path(move.From)
+		var to string
+		if err == nil {
+			to, err = journal.path(move.To)
+		}
+		if err == nil {
+			err = renameWithRetry(to, from)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to restore %s. %s\n", move.From, err.Error())
+		}
+
+		journal.Moves = journal.Moves[:len(journal.Moves)-1]
+		journal.save()
+	}
+}
+
+// finish removes the journal once the install is consistent again
+func (journal *updateJournal) finish() {
+	for _, rel := range journal.TempDirs {
+		dir, err := journal.path(rel)
+		if err != nil {
+			log.Printf("Warning: %s\n", err.Error())
+			continue
+		}
+		os.RemoveAll(dir)
+	}
+
+	err := os.Remove(journalPath(journal.exPath))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove update journal. %s\n", err.Error())
+	}
+}
+
+// repairInterruptedUpdate checks for an operation that didn't complete and brings the install
+// back to a consistent state. Returns false if there was nothing to repair
+func repairInterruptedUpdate(exPath string) (bool, error) {
+	journal, err := loadJournal(exPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		// Without a readable journal we don't know what happened, the user needs a reinstall
+		return true, fmt.Errorf("update journal is unreadable, run reinstall to fix the install. %s", err.Error())
+	}
+
+	log.Printf("Found an interrupted %s to %s started at %s\n", journal.Operation, journal.Version, journal.StartedAt.Format(time.RFC3339))
+
+	switch journal.Phase {
+	case journalFinishing:
+		journal.finishUpdate()
+		fmt.Printf("Finished installing %s\n", journal.Version)
+	default:
+		journal.rollback()
+		fmt.Printf("Rolled back to the previous install\n")
+	}
+
+	journal.finish()
+	return true, nil
+}
+
+// finishUpdate runs the steps after the swap, the new version is complete at this point
+func (journal *updateJournal) finishUpdate() {
+	exPath := journal.exPath
+
+	if backupDir, err := journal.path(journal.BackupDir); err == nil && len(journal.ModifiedConfig) > 0 {
+		log.Printf("Restoring %d config files you changed...\n", len(journal.ModifiedConfig))
+		restoreUserConfig(exPath, backupDir, journal.ModifiedConfig, journal.Files)
+	}
+
+	defaultsDir, err := journal.path(journal.DefaultsDir)
+	if _, statErr := os.Stat(defaultsDir); err == nil && statErr == nil {
+		err = replaceConfigDefaults(exPath, defaultsDir)
+		if err != nil {
+			log.Printf("Failed to save config defaults. %s\n", err.Error())
+		}
+	}
+
+	if journal.Files != nil {
+		err := writeUpdateManifest(exPath, updateManifest{
+			PrevVersion: journal.PrevVersion,
+			Version:     journal.Version,
+			UpdatedAt:   time.Now(),
+			Files:       journal.Files,
+		})
+		if err != nil {
+			log.Printf("Failed to write update manifest. %s\n", err.Error())
+		}
+	}
+}
+
+// repairBeforeUpdate finishes or rolls back an interrupted update before changing the install
+// again, otherwise we would build on a half installed Dolphin
+func repairBeforeUpdate(exPath string) {
+	_, err := repairInterruptedUpdate(exPath)
+	if err != nil {
+		failf(exitInstall, "Failed to repair the previous update. %s", err.Error())
+	}
+}
+
+// execRepair repairs an interrupted update on request, it also happens automatically before the
+// next update
+func execRepair(cfg toolsConfig) (returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered repairing install")
+		}
+	}()
+
+	exPath := cfg.InstallDir
+
+	ensureWritable(exPath)
+	waitForDolphinClose(exPath)
+
+	repaired, err := repairInterruptedUpdate(exPath)
+	if err != nil {
+		failf(exitInstall, "Failed to repair the install. %s", err.Error())
+	}
+
+	// Leftover staging directories are harmless but can be large
+	for _, pattern := range []string{"dolphin-new*", "dolphin-update*", "dolphin-delta*", configDefaultsDirName + "?*"} {
+		matches, _ := filepath.Glob(filepath.Join(exPath, pattern))
+		for _, match := range matches {
+			log.Printf("Removing leftover %s\n", filepath.Base(match))
+			os.RemoveAll(match)
+		}
+	}
+
+	if !repaired {
+		fmt.Println("No interrupted update found, nothing to repair")
+	}
+
+	return nil
+}
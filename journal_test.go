@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalRollback(t *testing.T) {
+	exPath := t.TempDir()
+	writeTestFiles(t, exPath, map[string]string{"Sys/a.ini": "old", "dolphin-new/Sys/a.ini": "new"})
+
+	journal, err := beginJournal(exPath, "update", "1.0.0", "2.0.0", filepath.Join(exPath, "dolphin-new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.move(filepath.Join(exPath, "Sys", "a.ini"), filepath.Join(exPath, backupDirName, "Sys", "a.ini"))
+	if err == nil {
+		err = journal.move(filepath.Join(exPath, "dolphin-new", "Sys", "a.ini"), filepath.Join(exPath, "Sys", "a.ini"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal.Moves[0].From != "Sys/a.ini" || journal.Moves[0].To != backupDirName+"/Sys/a.ini" {
+		t.Errorf("the journal recorded %+v, want paths relative to the install", journal.Moves[0])
+	}
+
+	repaired, err := repairInterruptedUpdate(exPath)
+	if !repaired || err != nil {
+		t.Fatalf("repaired %t. %v", repaired, err)
+	}
+	if got := readTestFile(t, filepath.Join(exPath, "Sys", "a.ini")); got != "old" {
+		t.Errorf("a.ini is %q after the rollback, want old", got)
+	}
+	if got := readTestFile(t, filepath.Join(exPath, "dolphin-new", "Sys", "a.ini")); got != "<missing>" {
+		t.Error("the staging folder wasn't removed")
+	}
+}
+
+func TestJournalStaysInTheInstall(t *testing.T) {
+	dir := t.TempDir()
+	exPath := filepath.Join(dir, "install")
+	outside := filepath.Join(dir, "outside")
+	writeTestFiles(t, dir, map[string]string{"install/Sys/a.ini": "ini", "outside/file.txt": "not ours"})
+
+	if _, err := beginJournal(exPath, "update", "1.0.0", "2.0.0", outside); err == nil {
+		t.Error("began a journal with a staging folder outside of the install")
+	}
+	journal, err := beginJournal(exPath, "update", "1.0.0", "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.move(filepath.Join(outside, "file.txt"), filepath.Join(exPath, "file.txt")); err == nil {
+		t.Error("moved a file from outside of the install")
+	}
+
+	planted := []string{
+		`{"phase": "swapping", "moves": [{"from": "../outside/file.txt", "to": "Sys/a.ini"}]}`,
+		`{"phase": "swapping", "moves": [{"from": "Sys/a.ini", "to": "` + filepath.ToSlash(outside) + `/file.txt"}]}`,
+		`{"phase": "swapping", "moves": [], "tempDirs": ["../outside"]}`,
+		`{"phase": "swapping", "moves": [], "tempDirs": ["."]}`,
+		`{"phase": "finishing", "moves": [], "backupDir": "../outside"}`,
+	}
+	for _, contents := range planted {
+		if err := ioutil.WriteFile(journalPath(exPath), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := repairInterruptedUpdate(exPath)
+		if err == nil {
+			t.Errorf("repaired with the journal %s", contents)
+		}
+		if got := readTestFile(t, filepath.Join(outside, "file.txt")); got != "not ours" {
+			t.Fatalf("the journal %s touched a file outside of the install", contents)
+		}
+		if got := readTestFile(t, filepath.Join(exPath, "Sys", "a.ini")); got != "ini" {
+			t.Fatalf("the journal %s changed the install", contents)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// commandKeychain keeps secrets through the platform's command line tool, security on macOS and
+// secret-tool (libsecret) on Linux
+type commandKeychain struct {
+	tool string
+}
+
+// newKeychain returns nil when no keychain is available, such as on Linux without libsecret
+func newKeychain() secretStore {
+	tool := "secret-tool"
+	if runtime.GOOS == "darwin" {
+		tool = "security"
+	}
+
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil
+	}
+
+	return commandKeychain{tool: tool}
+}
+
+func (k commandKeychain) name() string {
+	if k.tool == "security" {
+		return "macOS Keychain"
+	}
+
+	return "Secret Service"
+}
+
+func (k commandKeychain) run(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(k.tool, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s. %s", k.tool, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// securityQuote quotes an argument for a command read by security -i
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func (k commandKeychain) set(account, secret string) error {
+	if k.tool == "security" {
+		if strings.ContainsAny(secret, "\r\n") {
+			return errors.New("the secret can't be stored, it has a line break")
+		}
+
+		// -w takes the secret as an argument, which anyone can read in the process list. Running
+		// the command through security's interactive mode keeps it on stdin instead
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(keychainService), securityQuote(account), securityQuote(secret))
+		_, err := k.run(command, "-i")
+		if err != nil {
+			return err
+		}
+
+		// Interactive mode doesn't fail when the command does
+		stored, err := k.get(account)
+		if err != nil || stored != secret {
+			return errors.New("security did not store the secret")
+		}
+		return nil
+	}
+
+	// secret-tool reads the secret from stdin such that it doesn't show up in the process list
+	_, err := k.run(secret, "store", "--label", keychainService+" "+account, "service", keychainService, "account", account)
+	return err
+}
+
+func (k commandKeychain) get(account string) (string, error) {
+	var secret string
+	var err error
+	if k.tool == "security" {
+		secret, err = k.run("", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	} else {
+		secret, err = k.run("", "lookup", "service", keychainService, "account", account)
+	}
+
+	// Both tools fail without detail when nothing is stored
+	if err != nil || secret == "" {
+		return "", errSecretNotFound
+	}
+
+	return secret, nil
+}
+
+func (k commandKeychain) delete(account string) error {
+	if k.tool == "security" {
+		_, err := k.run("", "delete-generic-password", "-s", keychainService, "-a", account)
+		return err
+	}
+
+	_, err := k.run("", "clear", "service", keychainService, "account", account)
+	return err
+}
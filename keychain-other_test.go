@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "testing"
+
+func TestSecurityQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"abc123", `"abc123"`},
+		{"with space", `"with space"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"", `""`},
+	}
+
+	for _, test := range tests {
+		if got := securityQuote(test.arg); got != test.want {
+			t.Errorf("securityQuote(%q) = %s, want %s", test.arg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logDirName = "Logs"
+const logFileName = "slippi-tools.log"
+const maxLogBytes = 5 * 1024 * 1024
+const maxLogBackups = 3
+
+// verboseLogging is set by the global --verbose flag, debug logs are only shown on the console
+// with it. They always go to the log file
+var verboseLogging = false
+
+// setupLogging sends logs to the console and to Logs/slippi-tools.log in the install. Without a
+// writable install we keep logging to the console only
+func setupLogging(installDir string, console io.Writer) {
+	writer := &logWriter{console: console}
+
+	file, err := openRotatingFile(filepath.Join(installDir, logDirName, logFileName))
+	if err == nil {
+		writer.file = file
+	}
+
+	log.SetOutput(writer)
+	if err != nil {
+		log.Printf("Warning: failed to open log file, only logging to the console. %s\n", err.Error())
+	}
+
+	logDebugf("dolphin-slippi-tools %s started with %s", toolsVersion, strings.Join(os.Args[1:], " "))
+}
+
+// logDebugf logs a message that is only interesting when diagnosing an issue
+func logDebugf(format string, args ...interface{}) {
+	log.Output(2, "Debug: "+fmt.Sprintf(format, args...))
+}
+
+// logPanic records an unrecovered panic with its stack in the log file before crashing
+func logPanic() {
+	if r := recover(); r != nil {
+		log.Printf("Error: unexpected panic: %v\n%s", r, debug.Stack())
+		panic(r)
+	}
+}
+
+// stripLogPrefix drops the timestamp the log package prefixes to every line
+func stripLogPrefix(line string) string {
+	message := strings.TrimSpace(line)
+	if log.Flags() == log.LstdFlags && len(message) > len("2006/01/02 15:04:05 ") {
+		message = message[len("2006/01/02 15:04:05 "):]
+	}
+
+	return message
+}
+
+// logLevel derives the level from how the message starts, which is how the codebase has always
+// marked warnings
+func logLevel(message string) string {
+	switch {
+	case strings.HasPrefix(message, "Debug:"):
+		return "DEBUG"
+	case strings.HasPrefix(message, "Warning:"):
+		return "WARN"
+	case strings.HasPrefix(message, "Error:") || strings.HasPrefix(message, "Failed"):
+		return "ERROR"
+	}
+
+	return "INFO"
+}
+
+// logWriter passes each log line to the console and writes it with a level and full timestamp to
+// the log file
+type logWriter struct {
+	console io.Writer
+	file    *rotatingFile
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	message := stripLogPrefix(string(p))
+	level := logLevel(message)
+
+	if level != "DEBUG" || verboseLogging {
+		w.console.Write(p)
+	}
+
+	if w.file != nil {
+		fmt.Fprintf(w.file, "%s %-5s %s\n", time.Now().Format(time.RFC3339), level, strings.TrimPrefix(message, "Debug: "))
+	}
+
+	return len(p), nil
+}
+
+// rotatingFile appends to a file, moving it to .1 (and older ones up to .3) once it gets too large
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rotatingFile{path: path}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size+int64(len(p)) > maxLogBytes {
+		// Keep logging to the current file if rotating fails, a large log beats a lost one
+		f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+
+	for i := maxLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	os.Rename(f.path, f.path+".1")
+
+	return f.open()
+}
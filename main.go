@@ -1,22 +1,81 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
+	// Global flags come before the command, the command and its flags are shifted into place
+	globalFlags := flag.NewFlagSet("global", flag.ExitOnError)
+	globalJSONPtr := globalFlags.Bool(
+		"json",
+		false,
+		"Write newline delimited json events to stdout and human readable output to stderr.",
+	)
+	verbosePtr := globalFlags.Bool(
+		"verbose",
+		false,
+		"Also show debug logs on the console, they are always written to the log file.",
+	)
+	globalInstallDirPtr := globalFlags.String(
+		"install-dir",
+		"",
+		"Dolphin install to manage, its config.json is applied on top of the one next to the tools.",
+	)
+	noElevatePtr := globalFlags.Bool(
+		"no-elevate",
+		false,
+		"Fails instead of asking for administrator rights when the install isn't writable.",
+	)
+	allowUnsignedPtr := globalFlags.Bool(
+		"allow-unsigned",
+		false,
+		"Skips signature verification of downloads in development builds without a release key.",
+	)
+	globalFlags.Parse(os.Args[1:])
+	os.Args = append(os.Args[:1], globalFlags.Args()...)
+
+	var console io.Writer = os.Stderr
+	if *globalJSONPtr {
+		useJSONOutput()
+		console = jsonLogWriter{}
+	}
+	verboseLogging = *verbosePtr
+	noElevate = *noElevatePtr
+	allowUnsigned = *allowUnsignedPtr
+
 	if len(os.Args) < 2 {
 		log.Panic("Must provide a command'\n")
 	}
 
+	// Cancelled on Ctrl+C or SIGTERM such that downloads and extraction stop and what was staged is
+	// rolled back. A second Ctrl+C quits right away, the journal repairs the install on the next run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	cfg := loadConfig(*globalInstallDirPtr)
+	setupLogging(cfg.InstallDir, console)
+	defer logPanic()
+
 	command := os.Args[1]
 	switch command {
 	case "app-update":
 		buildFlags := flag.NewFlagSet("user", flag.ExitOnError)
+		registerConfigFlags(buildFlags, &cfg)
 		isFullUpdatePtr := buildFlags.Bool(
 			"full",
 			false,
@@ -41,23 +100,1108 @@ func main() {
 		versionPtr := buildFlags.String(
 			"version",
 			"",
-			"The current dolphin version we are updating.",
+			"The current dolphin version we are updating. Read from the Dolphin binary when it has one.",
+		)
+		dolphinExePtr := buildFlags.String(
+			"dolphin-exe",
+			strings.Join(dolphinExeNames, ","),
+			"Comma separated list of Dolphin executable names, the first is used to launch.",
+		)
+		keepArchivePtr := buildFlags.Bool(
+			"keep-archive",
+			false,
+			"If true, keeps a copy of the downloaded zip for debugging.",
+		)
+		archivePathPtr := buildFlags.String(
+			"archive-path",
+			"",
+			"Where to keep the downloaded zip when keep-archive is true. Defaults to next to the install.",
+		)
+		strictHookPtr := buildFlags.Bool(
+			"strict-hook",
+			false,
+			"If true, a failing post-update command fails the update.",
+		)
+		launchDirPtr := buildFlags.String(
+			"launch-dir",
+			"",
+			"Working directory to launch Dolphin in. Defaults to the install directory.",
+		)
+		deltaPtr := buildFlags.Bool(
+			"delta",
+			false,
+			"If true, tries to only download the changes since the installed version.",
+		)
+		jsonProgressPtr := buildFlags.Bool(
+			"json-progress",
+			false,
+			"If true, progress is printed as one json object per line instead of for humans.",
+		)
+		forceClosePtr := buildFlags.Bool(
+			"force-close",
+			false,
+			"If true, closes running Dolphin instances instead of waiting forever.",
+		)
+		closeGracePtr := buildFlags.Int(
+			"close-grace",
+			int(forceCloseGrace.Seconds()),
+			"Seconds to wait before asking Dolphin to close, and again before killing it, when force-close is true.",
+		)
+		targetVersionPtr := buildFlags.String(
+			"target-version",
+			"",
+			"Installs this version instead of the latest, can be used to downgrade.",
+		)
+		confirmChangesPtr := buildFlags.Bool(
+			"confirm-changes",
+			false,
+			"If true, asks for confirmation after showing the release notes.",
+		)
+		fromFilePtr := buildFlags.String(
+			"from-file",
+			"",
+			"Installs from this local archive instead of downloading, for machines without internet.",
+		)
+		backupPtr := buildFlags.Bool(
+			"backup",
+			false,
+			"If true, backs up the install before updating it.",
+		)
+		repairPtr := buildFlags.Bool(
+			"repair",
+			false,
+			"If true, replaces only the missing or damaged files of the installed version instead of updating.",
+		)
+		replayDirPtr := buildFlags.String(
+			"replay-dir",
+			"",
+			"Replay folder checked for replays a playback update can no longer play.",
+		)
+		keepOldPlaybackPtr := buildFlags.Bool(
+			"keep-old-playback",
+			false,
+			"If true, keeps a copy of the playback build being replaced next to the new one for older replays.",
+		)
+		forcePtr := buildFlags.Bool(
+			"force",
+			false,
+			"If true, installs the version even if it is already installed.",
+		)
+		nonInteractivePtr := buildFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := buildFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
 		)
 		buildFlags.Parse(os.Args[2:])
+		resolveTarget(&cfg)
+
+		dolphinExeNames = strings.Split(*dolphinExePtr, ",")
+		forceClose = *forceClosePtr
+		forceCloseGrace = time.Duration(*closeGracePtr) * time.Second
+		if *jsonProgressPtr {
+			useJSONProgress()
+		}
+
+		opts := appUpdateOptions{
+			IsFull:            *isFullUpdatePtr,
+			SkipUpdaterUpdate: *skipUpdaterUpdatePtr,
+			ShouldLaunch:      *shouldLaunchPtr,
+			IsoPath:           *isoPathPtr,
+			PrevVersion:       *versionPtr,
+			KeepArchive:       *keepArchivePtr,
+			ArchivePath:       *archivePathPtr,
+			StrictHook:        *strictHookPtr,
+			LaunchDir:         *launchDirPtr,
+			Delta:             *deltaPtr,
+			JSONProgress:      *jsonProgressPtr,
+			NonInteractive:    *nonInteractivePtr,
+			TargetVersion:     *targetVersionPtr,
+			ConfirmChanges:    *confirmChangesPtr,
+			Backup:            *backupPtr,
+			FromFile:          *fromFilePtr,
+			Repair:            *repairPtr,
+			ReplayDir:         *replayDirPtr,
+			KeepOldPlayback:   *keepOldPlaybackPtr,
+			Force:             *forcePtr,
+		}
+		opts.PrevVersion = resolvePrevVersion(cfg.InstallDir, opts.PrevVersion)
 
-		err := execAppUpdate(*isFullUpdatePtr, *skipUpdaterUpdatePtr, *shouldLaunchPtr, *isoPathPtr, *versionPtr)
+		// The relaunched updater gets the ISO picked by the first one
+		if opts.ShouldLaunch && opts.IsoPath == "" && !opts.SkipUpdaterUpdate && !opts.Repair {
+			opts.IsoPath = pickMeleeIso(cfg.InstallDir, !opts.NonInteractive && !jsonOutput)
+		}
+		startedAt := time.Now()
+		if opts.Repair {
+			result, err := execRepairInstall(ctx, cfg, opts)
+			recordUpdate(cfg, "repair", opts.PrevVersion, startedAt, err)
+			handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+			noteInstall(cfg)
+			emitResult(command, result)
+			break
+		}
+
+		err := execAppUpdate(ctx, cfg, opts)
+
+		// Without the full flag this run only updated the updater, the relaunched one reports again
+		phase := "complete"
+		if runtime.GOOS == "windows" && !*isFullUpdatePtr && !*skipUpdaterUpdatePtr {
+			phase = "updater"
+		}
+		if updateSkipped {
+			phase = "skipped"
+		}
+		if err != nil || phase == "complete" {
+			recordUpdate(cfg, command, opts.PrevVersion, startedAt, err)
+		}
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
 
+		if phase == "complete" {
+			noteInstall(cfg)
+			syncControllers(cfg)
+		}
+		emitResult(command, map[string]string{
+			"phase":            phase,
+			"installedVersion": readInstalledVersion(cfg.InstallDir),
+		})
+	case "reinstall":
+		reinstallFlags := flag.NewFlagSet("reinstall", flag.ExitOnError)
+		registerConfigFlags(reinstallFlags, &cfg)
+		versionPtr := reinstallFlags.String(
+			"version",
+			"",
+			"The current dolphin version, used to pick the release channel.",
+		)
+		preservePtr := reinstallFlags.String(
+			"preserve",
+			"",
+			"Comma separated list of additional files or folders in the install to keep.",
+		)
+		yesPtr := reinstallFlags.Bool(
+			"yes",
+			false,
+			"Skips the confirmation prompt.",
+		)
+		nonInteractivePtr := reinstallFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := reinstallFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		reinstallFlags.Parse(os.Args[2:])
+		resolveTarget(&cfg)
+
+		preserve := []string{}
+		if *preservePtr != "" {
+			preserve = strings.Split(*preservePtr, ",")
+		}
+
+		prevVersion := resolvePrevVersion(cfg.InstallDir, *versionPtr)
+		startedAt := time.Now()
+		err := execReinstall(ctx, cfg, prevVersion, preserve, *yesPtr)
+		if err != nil || !updateSkipped {
+			recordUpdate(cfg, command, prevVersion, startedAt, err)
+		}
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		noteInstall(cfg)
+		syncControllers(cfg)
+		emitResult(command, map[string]string{"installedVersion": readInstalledVersion(cfg.InstallDir)})
+	case "backup":
+		backupFlags := flag.NewFlagSet("backup", flag.ExitOnError)
+		registerConfigFlags(backupFlags, &cfg)
+		userDirPtr := backupFlags.String(
+			"user-dir",
+			"",
+			"Also back up this Dolphin user folder if it lives outside the install.",
+		)
+		backupFlags.Parse(os.Args[2:])
+
+		backupPath, err := execBackup(cfg, *userDirPtr)
 		if err != nil {
-			fmt.Println("")
-			fmt.Println("Something went wrong. Read above messages to see if there's additional help info. If Dolphin isn't working, screenshot this and head to the Slippi Discord")
-			for {
-				time.Sleep(1 * time.Second)
-			}
+			log.Printf("Failed to back up the install. %s\n", err.Error())
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
 		}
+		emitResult(command, map[string]string{"path": backupPath})
+	case "restore":
+		restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+		registerConfigFlags(restoreFlags, &cfg)
+		yesPtr := restoreFlags.Bool(
+			"yes",
+			false,
+			"Skips the confirmation prompt.",
+		)
+		nonInteractivePtr := restoreFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := restoreFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		restoreFlags.Parse(os.Args[2:])
+
+		err := execRestore(cfg, restoreFlags.Arg(0), *yesPtr)
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		noteInstall(cfg)
+		syncControllers(cfg)
+		emitResult(command, map[string]string{"installedVersion": readInstalledVersion(cfg.InstallDir)})
+	case "diagnose":
+		diagnoseFlags := flag.NewFlagSet("diagnose", flag.ExitOnError)
+		registerConfigFlags(diagnoseFlags, &cfg)
+		userDirPtr := diagnoseFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder to collect logs from. Defaults to the one the install uses.",
+		)
+		outputPtr := diagnoseFlags.String(
+			"output",
+			"",
+			"Where to save the zip. Defaults to next to the install.",
+		)
+		diagnoseFlags.Parse(os.Args[2:])
+
+		bundlePath, err := execDiagnose(cfg, *userDirPtr, *outputPtr)
+		if err != nil {
+			log.Printf("Failed to create the diagnostics bundle. %s\n", err.Error())
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, map[string]string{"path": bundlePath})
+	case "netcheck":
+		netcheckFlags := flag.NewFlagSet("netcheck", flag.ExitOnError)
+		registerConfigFlags(netcheckFlags, &cfg)
+		serverPtr := netcheckFlags.String(
+			"server",
+			netcheckServer,
+			"Matchmaking server to ping, as host:port.",
+		)
+		countPtr := netcheckFlags.Int(
+			"count",
+			20,
+			"Number of pings sent to every address of the server.",
+		)
+		outputPtr := netcheckFlags.String(
+			"output",
+			"",
+			"Also saves the report to this file.",
+		)
+		netcheckFlags.Parse(os.Args[2:])
+
+		report, err := execNetcheck(ctx, *serverPtr, *countPtr, *outputPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, report)
+	case "repair":
+		repairFlags := flag.NewFlagSet("repair", flag.ExitOnError)
+		registerConfigFlags(repairFlags, &cfg)
+		nonInteractivePtr := repairFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := repairFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		repairFlags.Parse(os.Args[2:])
+
+		err := execRepair(cfg)
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		emitResult(command, map[string]string{"installedVersion": readInstalledVersion(cfg.InstallDir)})
+	case "verify":
+		verifyFlags := flag.NewFlagSet("verify", flag.ExitOnError)
+		registerConfigFlags(verifyFlags, &cfg)
+		nonInteractivePtr := verifyFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := verifyFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		verifyFlags.Parse(os.Args[2:])
+		resolveTarget(&cfg)
+
+		result, err := execVerify(ctx, cfg)
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		emitResult(command, result)
+	case "self-update":
+		selfUpdateFlags := flag.NewFlagSet("self-update", flag.ExitOnError)
+		registerConfigFlags(selfUpdateFlags, &cfg)
+		checkPtr := selfUpdateFlags.Bool(
+			"check",
+			false,
+			"Only report whether a newer version is available.",
+		)
+		forcePtr := selfUpdateFlags.Bool(
+			"force",
+			false,
+			"Replaces the tools even if they are up to date or a development build.",
+		)
+		nonInteractivePtr := selfUpdateFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := selfUpdateFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		selfUpdateFlags.Parse(os.Args[2:])
+
+		result, err := execSelfUpdate(ctx, cfg, *checkPtr, *forcePtr)
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		emitResult(command, result)
 	case "user-update":
-		execUserUpdate()
+		userUpdateFlags := flag.NewFlagSet("user-update", flag.ExitOnError)
+		registerConfigFlags(userUpdateFlags, &cfg)
+		variantPtr := userUpdateFlags.String(
+			"variant",
+			"netplay",
+			"Which Dolphin's user.json to update on macOS, netplay or playback.",
+		)
+		pathPtr := userUpdateFlags.String(
+			"path",
+			"",
+			"Path to user.json or the folder containing it, for portable installs.",
+		)
+		nonInteractivePtr := userUpdateFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := userUpdateFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		userUpdateFlags.Parse(os.Args[2:])
+
+		result, err := execUserUpdate(ctx, cfg, *variantPtr, *pathPtr)
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		emitResult(command, result)
+	case "user":
+		if len(os.Args) >= 3 && os.Args[2] == "login" {
+			loginFlags := flag.NewFlagSet("user login", flag.ExitOnError)
+			registerConfigFlags(loginFlags, &cfg)
+			variantPtr := loginFlags.String(
+				"variant",
+				"netplay",
+				"Which Dolphin's user.json to create on macOS, netplay or playback.",
+			)
+			pathPtr := loginFlags.String(
+				"path",
+				"",
+				"Path to user.json or the folder containing it, for portable installs.",
+			)
+			tokenPtr := loginFlags.String(
+				"token",
+				"",
+				"Logs in with a token from slippi.gg instead of approving the login in the browser.",
+			)
+			pastePtr := loginFlags.Bool(
+				"paste",
+				false,
+				"Prompts for a token from slippi.gg instead of approving the login in the browser.",
+			)
+			nonInteractivePtr := loginFlags.Bool(
+				"non-interactive",
+				false,
+				"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+			)
+			countdownPtr := loginFlags.Int(
+				"countdown",
+				0,
+				"Seconds to wait before exiting on failure when non-interactive is true.",
+			)
+			loginFlags.Parse(os.Args[3:])
+
+			result, err := execUserLogin(ctx, cfg, *variantPtr, *pathPtr, *tokenPtr, *pastePtr)
+			handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+			noteInstall(cfg)
+			emitResult(command, result)
+			break
+		}
+
+		if len(os.Args) < 4 || os.Args[2] != "profiles" {
+			fmt.Println("Usage: user login or user profiles <list|add|use|remove> [name]")
+			break
+		}
+
+		action := os.Args[3]
+		profilesFlags := flag.NewFlagSet("user profiles "+action, flag.ExitOnError)
+		registerConfigFlags(profilesFlags, &cfg)
+		variantPtr := profilesFlags.String(
+			"variant",
+			"netplay",
+			"Which Dolphin's user.json to save from or switch on macOS, netplay or playback.",
+		)
+		pathPtr := profilesFlags.String(
+			"path",
+			"",
+			"Path to user.json or the folder containing it, for portable installs.",
+		)
+		nonInteractivePtr := profilesFlags.Bool(
+			"non-interactive",
+			false,
+			"If true, exits with a non-zero code on failure instead of waiting for the window to be closed.",
+		)
+		countdownPtr := profilesFlags.Int(
+			"countdown",
+			0,
+			"Seconds to wait before exiting on failure when non-interactive is true.",
+		)
+		profilesFlags.Parse(os.Args[4:])
+
+		var profiles userProfiles
+		userPath, err := userFilePath(cfg, *variantPtr, *pathPtr)
+		if err == nil {
+			profiles, err = execProfiles(cfg, action, profilesFlags.Arg(0), userPath)
+		}
+		handleFailure(cfg, command, err, *nonInteractivePtr, *countdownPtr)
+		emitResult(command, profiles.withoutSecrets())
+	case "check", "check-update":
+		checkFlags := flag.NewFlagSet("check", flag.ExitOnError)
+		registerConfigFlags(checkFlags, &cfg)
+		versionPtr := checkFlags.String(
+			"version",
+			"",
+			"The currently installed dolphin version. Read from the install if empty.",
+		)
+		snoozePtr := checkFlags.Bool(
+			"snooze",
+			false,
+			"Stop reporting the latest version as an update until a newer one is released.",
+		)
+		clearSnoozePtr := checkFlags.Bool(
+			"clear-snooze",
+			false,
+			"Clears a previously snoozed version.",
+		)
+		jsonPtr := checkFlags.Bool(
+			"json",
+			false,
+			"Print the result as json.",
+		)
+		notifyPtr := checkFlags.Bool(
+			"notify",
+			false,
+			"If true, shows a native notification when an update is available.",
+		)
+		checkFlags.Parse(os.Args[2:])
+		resolveTarget(&cfg)
+
+		execCheckUpdate(ctx, cfg, *versionPtr, *snoozePtr, *clearSnoozePtr, *jsonPtr || jsonOutput, *notifyPtr)
+	case "watch":
+		watchFlags := flag.NewFlagSet("watch", flag.ExitOnError)
+		registerConfigFlags(watchFlags, &cfg)
+		intervalPtr := watchFlags.Int(
+			"interval-minutes",
+			60,
+			"Minutes between update checks.",
+		)
+		autoApplyPtr := watchFlags.Bool(
+			"auto-apply",
+			false,
+			"If true, installs updates as soon as Dolphin isn't running.",
+		)
+		webhookPtr := watchFlags.String(
+			"webhook",
+			"",
+			"URL to post a json event to when an update is available.",
+		)
+		notifyPtr := watchFlags.Bool(
+			"notify",
+			false,
+			"If true, shows a native notification when an update is available.",
+		)
+		watchFlags.Parse(os.Args[2:])
+
+		err := execWatch(ctx, cfg, watchOptions{
+			Interval:  time.Duration(*intervalPtr) * time.Minute,
+			AutoApply: *autoApplyPtr,
+			Webhook:   *webhookPtr,
+			Notify:    *notifyPtr,
+		})
+		handleFailure(cfg, command, err, true, 0)
+		emitResult(command, nil)
+	case "schedule":
+		scheduleFlags := flag.NewFlagSet("schedule", flag.ExitOnError)
+		registerConfigFlags(scheduleFlags, &cfg)
+		scheduleCommandPtr := scheduleFlags.String(
+			"command",
+			"check",
+			"What to run on the schedule, check to notify about updates or app-update to install them.",
+		)
+		intervalHoursPtr := scheduleFlags.Int(
+			"interval-hours",
+			24,
+			"Hours between runs.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			scheduleFlags.Parse(os.Args[3:])
+		}
+
+		err := execSchedule(cfg, action, *scheduleCommandPtr, *intervalHoursPtr)
+		if err != nil {
+			log.Printf("Failed to %s scheduled updates. %s\n", action, err.Error())
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, map[string]string{"name": scheduleName(cfg)})
+	case "ipc":
+		ipcFlags := flag.NewFlagSet("ipc", flag.ExitOnError)
+		registerConfigFlags(ipcFlags, &cfg)
+		listenPtr := ipcFlags.String(
+			"listen",
+			"",
+			"Unix socket to accept launcher connections on instead of using stdin and stdout.",
+		)
+		ipcFlags.Parse(os.Args[2:])
+
+		err := execIPC(ctx, cfg, *listenPtr)
+		if err != nil {
+			log.Printf("Failed to serve ipc requests. %s\n", err.Error())
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+	case "iso":
+		isoFlags := flag.NewFlagSet("iso", flag.ExitOnError)
+		registerConfigFlags(isoFlags, &cfg)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			isoFlags.Parse(os.Args[3:])
+		}
+
+		switch action {
+		case "verify":
+			result, err := execIsoVerify(ctx, isoFlags.Arg(0))
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, result)
+		case "find":
+			isos := execIsoFind(cfg)
+			emitResult(command, isos)
+		default:
+			log.Panicf("Unknown iso action %s, must be verify or find", action)
+		}
+	case "firewall":
+		firewallFlags := flag.NewFlagSet("firewall", flag.ExitOnError)
+		registerConfigFlags(firewallFlags, &cfg)
+		dryRunPtr := firewallFlags.Bool(
+			"dry-run",
+			false,
+			"Only lists the rules that would be added or removed.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			firewallFlags.Parse(os.Args[3:])
+		}
+
+		result, err := execFirewall(cfg, action, *dryRunPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, result)
+	case "adapter":
+		adapterFlags := flag.NewFlagSet("adapter", flag.ExitOnError)
+		registerConfigFlags(adapterFlags, &cfg)
+		userDirPtr := adapterFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder whose ports are checked. Defaults to the one the install uses.",
+		)
+		fixPtr := adapterFlags.Bool(
+			"fix",
+			false,
+			"Installs the udev rule on Linux and sets port 1 to the adapter when no port uses it.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			adapterFlags.Parse(os.Args[3:])
+		}
+		if action != "check" {
+			log.Panicf("Unknown adapter action %s, must be check", action)
+		}
+
+		status, err := execAdapter(cfg, *userDirPtr, *fixPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, status)
+	case "prerequisites":
+		prerequisitesFlags := flag.NewFlagSet("prerequisites", flag.ExitOnError)
+		registerConfigFlags(prerequisitesFlags, &cfg)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			prerequisitesFlags.Parse(os.Args[3:])
+		}
+		resolveTarget(&cfg)
+		if action != "check" && action != "install" {
+			log.Panicf("Unknown prerequisites action %s, must be check or install", action)
+		}
+
+		result, err := execPrerequisites(ctx, cfg, action == "install")
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, result)
+	case "controller":
+		controllerFlags := flag.NewFlagSet("controller", flag.ExitOnError)
+		registerConfigFlags(controllerFlags, &cfg)
+		userDirPtr := controllerFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder the controllers are read from or written to. Defaults to the one the install uses.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			controllerFlags.Parse(os.Args[3:])
+		}
+
+		result, err := execController(cfg, *userDirPtr, action, controllerFlags.Arg(0))
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, result)
+	case "setup":
+		setupFlags := flag.NewFlagSet("setup", flag.ExitOnError)
+		registerConfigFlags(setupFlags, &cfg)
+		userDirPtr := setupFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder the settings are read from or written to. Defaults to the one the install uses.",
+		)
+		matchVersionPtr := setupFlags.Bool(
+			"match-version",
+			false,
+			"If true, import installs the Dolphin version the setup was exported from when another one is installed.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			setupFlags.Parse(os.Args[3:])
+		}
+
+		result, err := execSetup(ctx, cfg, *userDirPtr, action, setupFlags.Arg(0), *matchVersionPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, result)
+	case "textures":
+		texturesFlags := flag.NewFlagSet("textures", flag.ExitOnError)
+		registerConfigFlags(texturesFlags, &cfg)
+		userDirPtr := texturesFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder the texture packs are installed in. Defaults to the one the install uses.",
+		)
+		namePtr := texturesFlags.String(
+			"name",
+			"",
+			"Name of the folder the pack is installed in. Defaults to the name of the zip.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			texturesFlags.Parse(os.Args[3:])
+		}
+
+		packs, err := execTextures(ctx, cfg, *userDirPtr, action, texturesFlags.Arg(0), *namePtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, packs)
+	case "gecko":
+		geckoFlags := flag.NewFlagSet("gecko", flag.ExitOnError)
+		registerConfigFlags(geckoFlags, &cfg)
+		userDirPtr := geckoFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder whose Melee game settings are edited. Defaults to the one the install uses.",
+		)
+		enablePtr := geckoFlags.Bool(
+			"enable",
+			false,
+			"With add, also enables the added codes.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			geckoFlags.Parse(os.Args[3:])
+		}
+
+		codes, err := execGecko(ctx, cfg, *userDirPtr, action, geckoFlags.Args(), *enablePtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, codes)
+	case "replay":
+		replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+		registerConfigFlags(replayFlags, &cfg)
+		jsonPtr := replayFlags.Bool(
+			"json",
+			false,
+			"Print the replay info or search results as json.",
+		)
+		outputPtr := replayFlags.String(
+			"output",
+			"",
+			"File the index is written to, defaults to slippi-replay-index.json in the replay folder. With queue, the file the queue is written to instead of printing it. With archive, the folder archives are written to, defaults to archive in the replay folder. With extract, the folder replays are extracted to, defaults to the folder they were archived from.",
+		)
+		workersPtr := replayFlags.Int(
+			"workers",
+			0,
+			"Number of replays read at once while indexing. Defaults to the number of CPUs.",
+		)
+		codePtr := replayFlags.String(
+			"code",
+			"",
+			"With search, only replays with a player of this connect code.",
+		)
+		characterPtr := replayFlags.String(
+			"character",
+			"",
+			"With search, only replays with a player of this character.",
+		)
+		stagePtr := replayFlags.String(
+			"stage",
+			"",
+			"With search, only replays on this stage.",
+		)
+		sincePtr := replayFlags.String(
+			"since",
+			"",
+			"With search, only replays played on or after this day (2006-01-02) or time.",
+		)
+		untilPtr := replayFlags.String(
+			"until",
+			"",
+			"With search, only replays played before this day (2006-01-02) or time.",
+		)
+		shorterThanPtr := replayFlags.Duration(
+			"shorter-than",
+			0,
+			"With prune, deletes games shorter than this, such as 30s.",
+		)
+		olderThanDaysPtr := replayFlags.Int(
+			"older-than-days",
+			0,
+			"With prune, deletes games played more than this many days ago. With archive, archives them instead, defaults to 30.",
+		)
+		duplicatesPtr := replayFlags.Bool(
+			"duplicates",
+			false,
+			"With prune, deletes copies of the same replay, keeping the oldest.",
+		)
+		dryRunPtr := replayFlags.Bool(
+			"dry-run",
+			false,
+			"With prune or archive, only lists the replays that would be deleted or archived.",
+		)
+		keepPtr := replayFlags.Bool(
+			"keep",
+			false,
+			"With archive, keeps the replays after archiving them.",
+		)
+		replayIsoPtr := replayFlags.String(
+			"iso",
+			"",
+			"With play or queue -play, the Melee ISO to play with. Defaults to the one playback Dolphin launched last.",
+		)
+		fromPtr := replayFlags.String(
+			"from",
+			"",
+			"With queue, a file listing replays, folders or clips to queue, one per line.",
+		)
+		playPtr := replayFlags.Bool(
+			"play",
+			false,
+			"With queue, plays the queue with playback Dolphin instead of printing it.",
+		)
+		yesPtr := replayFlags.Bool(
+			"yes",
+			false,
+			"Skips the confirmation prompt.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			replayFlags.Parse(os.Args[3:])
+		}
+
+		switch action {
+		case "info":
+			replay, err := execReplayInfo(replayFlags.Arg(0), *jsonPtr && !jsonOutput)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, replay)
+		case "index":
+			index, err := execReplayIndex(ctx, replayFlags.Arg(0), *outputPtr, *workersPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, map[string]interface{}{"path": replayIndexPath(index.Dir, *outputPtr), "replays": len(index.Replays)})
+		case "search":
+			since, err := parseQueryDate(*sincePtr)
+			if err != nil {
+				log.Panicf("Invalid -since %s. %s", *sincePtr, err.Error())
+			}
+			until, err := parseQueryDate(*untilPtr)
+			if err != nil {
+				log.Panicf("Invalid -until %s. %s", *untilPtr, err.Error())
+			}
+			query := replayQuery{Code: *codePtr, Character: *characterPtr, Stage: *stagePtr, Since: since, Until: until}
+
+			matches, err := execReplaySearch(replayFlags.Arg(0), query, *jsonPtr && !jsonOutput)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, matches)
+		case "prune":
+			policy := replayPrunePolicy{ShorterThan: *shorterThanPtr, OlderThanDays: *olderThanDaysPtr, Duplicates: *duplicatesPtr}
+			result, err := execReplayPrune(ctx, replayFlags.Arg(0), policy, *dryRunPtr, *yesPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, result)
+		case "play":
+			result, err := execReplayPlay(cfg, replayFlags.Arg(0), *replayIsoPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, result)
+		case "queue":
+			queue, err := execReplayQueue(ctx, cfg, replayFlags.Args(), *fromPtr, *outputPtr, *playPtr, *replayIsoPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, queue)
+		case "archive":
+			result, err := execReplayArchive(ctx, replayFlags.Arg(0), *outputPtr, *olderThanDaysPtr, *keepPtr, *dryRunPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, result)
+		case "extract":
+			names := []string{}
+			if replayFlags.NArg() > 1 {
+				names = replayFlags.Args()[1:]
+			}
+			extracted, err := execReplayExtract(replayFlags.Arg(0), *outputPtr, names)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, extracted)
+		default:
+			log.Panicf("Unknown replay action %s, must be info, play, queue, index, search, prune, archive or extract", action)
+		}
+	case "migrate":
+		migrateFlags := flag.NewFlagSet("migrate", flag.ExitOnError)
+		registerConfigFlags(migrateFlags, &cfg)
+		fromPtr := migrateFlags.String(
+			"from",
+			"",
+			"Version the install is being updated from, empty for versions before 2.2.1.",
+		)
+		dryRunPtr := migrateFlags.Bool(
+			"dry-run",
+			false,
+			"If true, only shows what the migrations would change.",
+		)
+		migrateFlags.Parse(os.Args[2:])
+
+		results := execMigrate(cfg, *fromPtr, *dryRunPtr)
+		emitResult(command, results)
+	case "installs":
+		installsFlags := flag.NewFlagSet("installs", flag.ExitOnError)
+		typePtr := installsFlags.String(
+			"type",
+			"",
+			"Dolphin build of the install being added, netplay or playback. Detected from the install if empty.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			installsFlags.Parse(os.Args[3:])
+		}
+
+		entries := execInstalls(action, installsFlags.Arg(0), *typePtr)
+		emitResult(command, entries)
+	case "version":
+		versionFlags := flag.NewFlagSet("version", flag.ExitOnError)
+		registerConfigFlags(versionFlags, &cfg)
+		jsonPtr := versionFlags.Bool(
+			"json",
+			false,
+			"Print the versions as json.",
+		)
+		versionFlags.Parse(os.Args[2:])
+
+		execVersion(cfg, *jsonPtr || jsonOutput)
+	case "fleet":
+		fleetFlags := flag.NewFlagSet("fleet", flag.ExitOnError)
+		registerConfigFlags(fleetFlags, &cfg)
+		filePtr := fleetFlags.String(
+			"file",
+			defaultFleetPath(),
+			"Fleet file listing the installs to update.",
+		)
+		parallelPtr := fleetFlags.Int(
+			"parallel",
+			0,
+			"Number of setups updated at once. Defaults to parallel in the fleet file, or 4.",
+		)
+		action := ""
+		if len(os.Args) > 2 {
+			action = os.Args[2]
+			fleetFlags.Parse(os.Args[3:])
+		}
+		if action != "update" {
+			log.Panicf("Unknown fleet action %s, must be update", action)
+		}
+
+		results, err := execFleet(ctx, cfg, *filePtr, *parallelPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, results)
+	case "serve-cache":
+		serveCacheFlags := flag.NewFlagSet("serve-cache", flag.ExitOnError)
+		registerConfigFlags(serveCacheFlags, &cfg)
+		listenPtr := serveCacheFlags.String(
+			"listen",
+			":8484",
+			"Address the cache listens on.",
+		)
+		cacheDirPtr := serveCacheFlags.String(
+			"cache-dir",
+			defaultCacheDir(),
+			"Folder the downloaded releases are kept in.",
+		)
+		serveCacheFlags.Parse(os.Args[2:])
+
+		err := execServeCache(ctx, cfg, *listenPtr, *cacheDirPtr)
+		if err != nil {
+			exitAfterFailure(cfg.InstallDir, command, err, 0)
+		}
+		emitResult(command, nil)
+	case "history":
+		historyFlags := flag.NewFlagSet("history", flag.ExitOnError)
+		registerConfigFlags(historyFlags, &cfg)
+		jsonPtr := historyFlags.Bool(
+			"json",
+			false,
+			"Print the history as json.",
+		)
+		limitPtr := historyFlags.Int(
+			"limit",
+			20,
+			"Number of most recent updates to list, 0 for all of them.",
+		)
+		historyFlags.Parse(os.Args[2:])
+		resolveTarget(&cfg)
+
+		entries := execHistory(cfg, *jsonPtr, *limitPtr)
+		emitResult(command, entries)
+	case "channel":
+		channelFlags := flag.NewFlagSet("channel", flag.ExitOnError)
+		registerConfigFlags(channelFlags, &cfg)
+		channelFlags.Parse(os.Args[2:])
+
+		execChannel(cfg, channelFlags.Arg(0))
+		emitResult(command, map[string]string{"channel": cfg.channel(readInstalledVersion(cfg.InstallDir))})
+	case "config", "env":
+		configFlags := flag.NewFlagSet("config", flag.ExitOnError)
+		registerConfigFlags(configFlags, &cfg)
+		jsonPtr := configFlags.Bool(
+			"json",
+			false,
+			"Print the configuration as json.",
+		)
+		userDirPtr := configFlags.String(
+			"user-dir",
+			"",
+			"Dolphin user folder whose config is edited. Defaults to the one the install uses.",
+		)
+		fixPtr := configFlags.Bool(
+			"fix",
+			false,
+			"With audit, sets the recommended value of every setting that isn't netplay safe.",
+		)
+
+		// config get, set and unset edit the Dolphin config and audit checks it, without an action the tools config is shown
+		action := ""
+		if command == "config" && len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "-") {
+			action = os.Args[2]
+			configFlags.Parse(os.Args[3:])
+		} else {
+			configFlags.Parse(os.Args[2:])
+		}
+
+		if action == "audit" {
+			result, err := execConfigAudit(cfg, *userDirPtr, *fixPtr)
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, result)
+			break
+		}
+		if action != "" {
+			setting, err := execDolphinConfig(cfg, *userDirPtr, action, configFlags.Args())
+			if err != nil {
+				exitAfterFailure(cfg.InstallDir, command, err, 0)
+			}
+			emitResult(command, setting)
+			break
+		}
+
+		execConfig(cfg, *jsonPtr || jsonOutput)
 	default:
 		fmt.Println("Command not valid")
 	}
 
 }
+
+// handleFailure exits with the error's code when running non-interactively or in json mode, since
+// nobody is there to read the console, or when the user cancelled. Otherwise the window is kept open
+func handleFailure(cfg toolsConfig, command string, err error, nonInteractive bool, countdown int) {
+	if err == nil {
+		return
+	}
+
+	if nonInteractive || jsonOutput || isCancelled(err) {
+		exitAfterFailure(cfg.InstallDir, command, err, countdown)
+	}
+
+	waitAfterFailure()
+}
+
+func waitAfterFailure() {
+	fmt.Println("")
+	fmt.Println("Something went wrong. Read above messages to see if there's additional help info. If Dolphin isn't working, screenshot this and head to the Slippi Discord")
+	for {
+		time.Sleep(1 * time.Second)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/semver"
+)
+
+// migration changes an install once when it is updated from a version in From. Run gets the install
+// and returns what it changed, or would change when dryRun is true, such that it can be run
+// against any folder
+type migration struct {
+	Name string
+	// From is a space separated list of constraints such as "<2.2.1" or ">=3.0.0 <3.2.0" that all
+	// have to match the version updated from
+	From string
+	// Unknown runs the migration when the version updated from can't be found, neither passed nor
+	// read from the binary
+	Unknown bool
+	Run     func(exPath string, dryRun bool) ([]string, error)
+}
+
+// migrations run in this order, new ones go at the end
+var migrations = []migration{
+	// After 2.2.0 we stopped supporting non-melee games by default, this deletes all old inis.
+	// Versions before 2.2.1 didn't pass their version, an unknown one is one of them
+	{Name: "remove-non-melee-game-settings", From: "<2.2.1", Unknown: true, Run: removeGameSettings},
+}
+
+// migrationResult is one migration that applies to an update and what it changed
+type migrationResult struct {
+	Name    string   `json:"name"`
+	Changes []string `json:"changes"`
+}
+
+// versionMatches reports whether version satisfies every constraint in constraints. An unknown or
+// invalid version matches nothing, migrations delete files and guessing wrong would delete the
+// user's
+func versionMatches(version, constraints string) bool {
+	if !semver.IsValid(version) {
+		return false
+	}
+
+	for _, constraint := range strings.Fields(constraints) {
+		bound := strings.TrimLeft(constraint, "<>=")
+		operator := strings.TrimSuffix(constraint, bound)
+		if !semver.IsValid(bound) {
+			log.Printf("Ignoring invalid version constraint %s\n", constraint)
+			return false
+		}
+
+		cmp := semver.Compare(version, bound)
+
+		var ok bool
+		switch operator {
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "=", "==", "":
+			ok = cmp == 0
+		default:
+			log.Printf("Ignoring unknown version constraint %s\n", constraint)
+			ok = false
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// runMigrations runs every migration that applies when updating from prevVersion, in order
+func runMigrations(exPath, prevVersion string, dryRun bool) ([]migrationResult, error) {
+	results := []migrationResult{}
+	if prevVersion != "" && !semver.IsValid(prevVersion) {
+		log.Printf("Warning: skipping migrations, %s is not a version\n", prevVersion)
+		return results, nil
+	}
+
+	for _, m := range migrations {
+		if prevVersion == "" && !m.Unknown {
+			continue
+		}
+		if prevVersion != "" && !versionMatches(prevVersion, m.From) {
+			continue
+		}
+
+		if dryRun {
+			log.Printf("Would run migration %s\n", m.Name)
+		} else {
+			log.Printf("Running migration %s\n", m.Name)
+		}
+
+		changes, err := m.Run(exPath, dryRun)
+		results = append(results, migrationResult{Name: m.Name, Changes: changes})
+		if err != nil {
+			return results, fmt.Errorf("migration %s failed. %s", m.Name, err.Error())
+		}
+	}
+
+	return results, nil
+}
+
+// execMigrate shows or runs the migrations an update from fromVersion applies to the install
+func execMigrate(cfg toolsConfig, fromVersion string, dryRun bool) []migrationResult {
+	if !dryRun {
+		ensureWritable(cfg.InstallDir)
+		waitForDolphinClose(cfg.InstallDir)
+	}
+
+	if fromVersion == "" {
+		fromVersion = resolvePrevVersion(cfg.InstallDir, "")
+	}
+
+	results, err := runMigrations(cfg.InstallDir, fromVersion, dryRun)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No migrations apply")
+	}
+	for _, result := range results {
+		fmt.Printf("%s:\n", result.Name)
+		if len(result.Changes) == 0 {
+			fmt.Println("  nothing to change")
+		}
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+
+	return results
+}
+
+func removeGameSettings(exPath string, dryRun bool) ([]string, error) {
+	changes := []string{}
+	gameSettingsPath := filepath.Join(exPath, "Sys", "GameSettings")
+
+	// Attempt to delete all files inside the Sys/GameSettings folder
+	dir, err := ioutil.ReadDir(gameSettingsPath)
+	if os.IsNotExist(err) {
+		return changes, nil
+	}
+	if err != nil {
+		return changes, err
+	}
+
+	for _, d := range dir {
+		changes = append(changes, "remove "+filepath.ToSlash(filepath.Join("Sys", "GameSettings", d.Name())))
+		if dryRun {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(gameSettingsPath, d.Name()))
+		if err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
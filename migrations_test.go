@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveGameSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		changes int
+	}{
+		{"fresh install without GameSettings", map[string]string{"Sys/Resources/x.png": "png"}, 0},
+		{"old inis", map[string]string{"Sys/Resources/x.png": "png", "Sys/GameSettings/GALE01.ini": "", "Sys/GameSettings/RSBE01.ini": ""}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exPath := t.TempDir()
+			writeTestFiles(t, exPath, test.files)
+
+			changes, err := removeGameSettings(exPath, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != test.changes {
+				t.Errorf("got changes %v, want %d", changes, test.changes)
+			}
+
+			left, _ := filepath.Glob(filepath.Join(exPath, "Sys", "GameSettings", "*"))
+			if len(left) != 0 {
+				t.Errorf("%v are left in GameSettings", left)
+			}
+			if got := readTestFile(t, filepath.Join(exPath, "Sys", "Resources", "x.png")); got != "png" {
+				t.Error("the rest of Sys was touched")
+			}
+		})
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraints string
+		want        bool
+	}{
+		{"2.2.0", "<2.2.1", true},
+		{"2.2.1", "<2.2.1", false},
+		{"2.2.1", "<=2.2.1", true},
+		{"3.1.0", ">=3.0.0 <3.2.0", true},
+		{"3.2.0", ">=3.0.0 <3.2.0", false},
+		{"2.9.9", ">=3.0.0 <3.2.0", false},
+		{"3.0.0", "3.0.0", true},
+		{"3.0.0", "=3.0.1", false},
+		{"3.0.0-beta.1", "<3.0.0", true},
+		{"", "<2.2.1", false},
+		{"unknown", "<2.2.1", false},
+		{"2.x", "<2.2.1", false},
+		{"2.0.0", "<two", false},
+		{"2.0.0", "~2.2.1", false},
+	}
+
+	for _, test := range tests {
+		if got := versionMatches(test.version, test.constraints); got != test.want {
+			t.Errorf("versionMatches(%q, %q) = %t, want %t", test.version, test.constraints, got, test.want)
+		}
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	tests := []struct {
+		name        string
+		prevVersion string
+		dryRun      bool
+		results     int
+		left        string
+	}{
+		{"dry run", "2.2.0", true, 1, "ini"},
+		{"old version", "2.2.0", false, 1, "<missing>"},
+		{"new version", "3.0.0", false, 0, "ini"},
+		{"unknown version", "", false, 1, "<missing>"},
+		{"unknown version dry run", "", true, 1, "ini"},
+		{"invalid version", "garbage", false, 0, "ini"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exPath := t.TempDir()
+			writeTestFiles(t, exPath, map[string]string{"Sys/GameSettings/RSBE01.ini": "ini"})
+
+			results, err := runMigrations(exPath, test.prevVersion, test.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != test.results {
+				t.Fatalf("got %d migrations, want %d", len(results), test.results)
+			}
+			if test.results > 0 && (len(results[0].Changes) != 1 || results[0].Changes[0] != "remove Sys/GameSettings/RSBE01.ini") {
+				t.Errorf("got changes %v", results[0].Changes)
+			}
+			if got := readTestFile(t, filepath.Join(exPath, "Sys", "GameSettings", "RSBE01.ini")); got != test.left {
+				t.Errorf("the ini is %q, want %q", got, test.left)
+			}
+		})
+	}
+}
+
+func TestRunMigrationsUnknownVersion(t *testing.T) {
+	defer func(saved []migration) { migrations = saved }(migrations)
+
+	ran := []string{}
+	record := func(name string) func(string, bool) ([]string, error) {
+		return func(string, bool) ([]string, error) {
+			ran = append(ran, name)
+			return nil, nil
+		}
+	}
+	migrations = []migration{
+		{Name: "old", From: "<2.2.1", Unknown: true, Run: record("old")},
+		{Name: "ranged", From: ">=3.0.0 <3.2.0", Run: record("ranged")},
+	}
+
+	if _, err := runMigrations(t.TempDir(), "", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != "old" {
+		t.Errorf("ran %v for an unknown version, want only old", ran)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/netprobe"
+)
+
+// Slippi matchmaking speaks ENet over UDP, the same as netplay between players
+const netcheckServer = "mm.slippi.gg:43113"
+
+const (
+	netcheckPingInterval = 100 * time.Millisecond
+	netcheckTimeout      = 2 * time.Second
+	// Resolved addresses past this many aren't pinged, they are the same servers
+	netcheckMaxAddresses = 4
+
+	netcheckMaxLoss   = 0.02
+	netcheckMaxJitter = 10 * time.Millisecond
+	// ENet packets are up to 1392 bytes, plus the IP and UDP headers
+	netcheckMinMTU = 1420
+)
+
+// Two operators such that the mapping is compared across unrelated addresses
+var netcheckStunServers = []string{
+	"stun.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+type netcheckPing struct {
+	Address     string  `json:"address"`
+	Sent        int     `json:"sent"`
+	Received    int     `json:"received"`
+	LossPercent float64 `json:"lossPercent"`
+	MinMS       float64 `json:"minMs"`
+	AverageMS   float64 `json:"averageMs"`
+	JitterMS    float64 `json:"jitterMs"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// netcheckReport is what netcheck prints. Problems are explained for users, an empty list means
+// nothing looked wrong
+type netcheckReport struct {
+	CheckedAt    time.Time         `json:"checkedAt"`
+	Server       string            `json:"server"`
+	Addresses    []string          `json:"addresses"`
+	Pings        []netcheckPing    `json:"pings"`
+	NAT          string            `json:"nat"`
+	LocalAddress string            `json:"localAddress,omitempty"`
+	Mapped       map[string]string `json:"mapped"`
+	Interface    string            `json:"interface,omitempty"`
+	MTU          int               `json:"mtu,omitempty"`
+	Problems     []string          `json:"problems"`
+	// Reachable is false when the server can't be resolved or never answered over UDP
+	Reachable bool `json:"reachable"`
+}
+
+type netcheckEvent struct {
+	Type string `json:"type"`
+	netcheckReport
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// pingServer pings every address the server resolves to
+func pingServer(ctx context.Context, report *netcheckReport, count int) {
+	host, port, err := net.SplitHostPort(report.Server)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("%s is not a host:port", report.Server))
+		return
+	}
+
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("Could not resolve %s, check your DNS settings. %s", host, err.Error()))
+		return
+	}
+	for _, address := range addresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() != nil && len(report.Addresses) < netcheckMaxAddresses {
+			report.Addresses = append(report.Addresses, address)
+		}
+	}
+
+	for _, address := range report.Addresses {
+		fmt.Printf("Pinging %s...\n", address)
+		result, err := netprobe.PingENet(ctx, net.JoinHostPort(address, port), count, netcheckPingInterval, netcheckTimeout)
+		failIfCancelled(ctx)
+
+		ping := netcheckPing{
+			Address:     result.Address,
+			Sent:        result.Sent,
+			Received:    len(result.RTTs),
+			LossPercent: result.Loss() * 100,
+			MinMS:       milliseconds(result.Min()),
+			AverageMS:   milliseconds(result.Average()),
+			JitterMS:    milliseconds(result.Jitter()),
+		}
+		if err != nil {
+			ping.Error = err.Error()
+		}
+		report.Pings = append(report.Pings, ping)
+
+		switch {
+		case err == netprobe.ErrNoResponse:
+			report.Problems = append(report.Problems, fmt.Sprintf("%s didn't answer over UDP. A firewall or antivirus is likely blocking Dolphin", address))
+		case err != nil:
+			report.Problems = append(report.Problems, fmt.Sprintf("Pinging %s failed. %s", address, err.Error()))
+		default:
+			report.Reachable = true
+			if result.Loss() > netcheckMaxLoss {
+				report.Problems = append(report.Problems, fmt.Sprintf("%.0f%% of the packets to %s were lost, netplay will stutter. Use a wired connection if you can", ping.LossPercent, address))
+			}
+			if result.Jitter() > netcheckMaxJitter {
+				report.Problems = append(report.Problems, fmt.Sprintf("The latency to %s varies by %.0fms between packets, which causes rollbacks. Use a wired connection if you can", address, ping.JitterMS))
+			}
+		}
+	}
+}
+
+// checkNAT finds out whether other players can reach the UDP ports Dolphin opens, and the MTU of
+// the interface it goes out through
+func checkNAT(ctx context.Context, report *netcheckReport) {
+	fmt.Println("Checking NAT...")
+	nat, err := netprobe.DetectNAT(ctx, netcheckStunServers, netcheckTimeout)
+	failIfCancelled(ctx)
+	if err != nil {
+		report.NAT = netprobe.NATUnknown
+		report.Problems = append(report.Problems, fmt.Sprintf("Could not check the NAT. %s", err.Error()))
+		return
+	}
+	report.NAT = nat.Type
+	report.LocalAddress = nat.LocalAddress
+	report.Mapped = nat.Mapped
+
+	switch nat.Type {
+	case netprobe.NATBlocked:
+		report.Problems = append(report.Problems, "No STUN server answered, outgoing UDP seems to be blocked")
+	case netprobe.NATSymmetric:
+		report.Problems = append(report.Problems, "Your router gives every destination a different port (symmetric NAT). Direct connections to other players will often fail, enable UPnP or forward a port to Dolphin")
+	}
+
+	if local, err := net.ResolveUDPAddr("udp4", nat.LocalAddress); err == nil {
+		report.Interface, report.MTU, err = netprobe.InterfaceMTU(local.IP)
+		if err != nil {
+			logDebugf("Could not find the interface of %s. %s", local.IP, err.Error())
+		}
+	}
+	if report.MTU > 0 && report.MTU < netcheckMinMTU {
+		report.Problems = append(report.Problems, fmt.Sprintf("The MTU of %s is %d, below the %d bytes netplay packets can take. Large packets will be fragmented, which some routers drop", report.Interface, report.MTU, netcheckMinMTU))
+	}
+}
+
+func formatNetcheckReport(report netcheckReport) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Checked:              %s\n", report.CheckedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "dolphin-slippi-tools: %s\n", toolsVersion)
+	fmt.Fprintf(&b, "Platform:             %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Server:               %s\n", report.Server)
+	for _, ping := range report.Pings {
+		if ping.Error != "" && ping.Received == 0 {
+			fmt.Fprintf(&b, "  %-20s %s\n", ping.Address, ping.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "  %-20s %d/%d answered, %.0f%% loss, %.0fms average, %.0fms min, %.1fms jitter\n", ping.Address, ping.Received, ping.Sent, ping.LossPercent, ping.AverageMS, ping.MinMS, ping.JitterMS)
+	}
+	fmt.Fprintf(&b, "NAT:                  %s\n", report.NAT)
+	for _, server := range netcheckStunServers {
+		if mapped, ok := report.Mapped[server]; ok {
+			fmt.Fprintf(&b, "  %-20s seen as %s from %s\n", report.LocalAddress, mapped, server)
+		}
+	}
+	if report.Interface != "" {
+		fmt.Fprintf(&b, "Interface:            %s, MTU %d\n", report.Interface, report.MTU)
+	}
+
+	if len(report.Problems) == 0 {
+		b.WriteString("\nNo problems found\n")
+	} else {
+		b.WriteString("\nProblems:\n")
+		for _, problem := range report.Problems {
+			fmt.Fprintf(&b, "  - %s\n", problem)
+		}
+	}
+
+	return b.String()
+}
+
+// execNetcheck measures the connection to matchmaking and how reachable this machine is for other
+// players, then prints a report to share when netplay fails to connect. It also goes to output
+func execNetcheck(ctx context.Context, server string, count int, output string) (report netcheckReport, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered checking the network")
+		}
+	}()
+
+	if server == "" {
+		server = netcheckServer
+	}
+	if count <= 0 {
+		log.Panic("-count must be at least 1")
+	}
+
+	report = netcheckReport{CheckedAt: time.Now(), Server: server, Addresses: []string{}, Pings: []netcheckPing{}, Mapped: map[string]string{}, Problems: []string{}}
+	pingServer(ctx, &report, count)
+	checkNAT(ctx, &report)
+
+	text := formatNetcheckReport(report)
+	fmt.Printf("\n%s", text)
+	if output != "" {
+		err := ioutil.WriteFile(output, []byte(text), 0644)
+		if err != nil {
+			log.Printf("Failed to save the report. %s\n", err.Error())
+		} else {
+			fmt.Printf("Report saved to %s\n", output)
+		}
+	}
+
+	// The report is what a failure is about, it goes out as an event before the error
+	if !report.Reachable {
+		if jsonOutput {
+			emitEvent(netcheckEvent{Type: "netcheck", netcheckReport: report})
+		}
+		failf(exitNetwork, "Could not reach %s over UDP", server)
+	}
+
+	return report, nil
+}
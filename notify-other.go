@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Neither osascript nor notify-send can run a command when the notification is clicked
+const updateOnClickSupported = false
+
+// showNotification uses osascript on macOS and notify-send (libnotify) on Linux. The text is passed
+// as arguments such that it never needs quoting
+func showNotification(cfg toolsConfig, title, message string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command(
+			"osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, message,
+		)
+	} else {
+		cmd = exec.Command("notify-send", "--app-name", "Slippi Dolphin", title, message)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s. %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const updateOnClickSupported = true
+
+// Toasts need an app id registered with Windows, PowerShell's is always there
+const toastAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// updateScriptName is what clicking the notification opens
+const updateScriptName = "Update Slippi Dolphin.cmd"
+
+// toastScript shows a toast through the WinRT API. The text comes in through environment variables
+// such that it never needs quoting
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$title = [Security.SecurityElement]::Escape($env:SLIPPI_TOAST_TITLE)
+$message = [Security.SecurityElement]::Escape($env:SLIPPI_TOAST_MESSAGE)
+$launch = [Security.SecurityElement]::Escape($env:SLIPPI_TOAST_LAUNCH)
+$attributes = ''
+if ($launch) { $attributes = ' activationType="protocol" launch="' + $launch + '"' }
+$xml = New-Object Windows.Data.Xml.Dom.XmlDocument
+$xml.LoadXml('<toast' + $attributes + '><visual><binding template="ToastGeneric"><text>' + $title + '</text><text>' + $message + '</text></binding></visual></toast>')
+$toast = New-Object Windows.UI.Notifications.ToastNotification $xml
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($env:SLIPPI_TOAST_APP_ID).Show($toast)
+`
+
+func showNotification(cfg toolsConfig, title, message string) error {
+	launch := ""
+	scriptPath, err := writeUpdateScript(cfg)
+	if err == nil {
+		launch = (&url.URL{Scheme: "file", Path: "/" + filepath.ToSlash(scriptPath)}).String()
+	}
+
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", toastScript)
+	cmd.Env = append(
+		os.Environ(),
+		"SLIPPI_TOAST_TITLE="+title,
+		"SLIPPI_TOAST_MESSAGE="+message,
+		"SLIPPI_TOAST_LAUNCH="+launch,
+		"SLIPPI_TOAST_APP_ID="+toastAppID,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s. %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// writeUpdateScript writes a script next to Dolphin that runs app-update with the current config and
+// launches Dolphin afterwards
+func writeUpdateScript(cfg toolsConfig) (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{exePath, "app-update", "-launch"}
+	args = append(args, cfg.args()...)
+
+	quoted := []string{}
+	for _, arg := range args {
+		quoted = append(quoted, `"`+strings.ReplaceAll(arg, `"`, `""`)+`"`)
+	}
+
+	script := "@echo off\r\n" + strings.Join(quoted, " ") + "\r\n"
+	scriptPath := filepath.Join(cfg.InstallDir, updateScriptName)
+	return scriptPath, ioutil.WriteFile(scriptPath, []byte(script), 0644)
+}
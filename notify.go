@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// notifyUpdate raises a native notification about a new version, for setups where nobody reads the
+// console. Failing to show it is only a warning since the update check itself worked
+func notifyUpdate(cfg toolsConfig, installed, latest string) {
+	title := fmt.Sprintf("Slippi Dolphin %s available", latest)
+	message := fmt.Sprintf("You have %s installed.", installed)
+	if updateOnClickSupported {
+		message += " Click to update."
+	}
+
+	err := showNotification(cfg, title, message)
+	if err != nil {
+		log.Printf("Warning: failed to show a notification. %s\n", err.Error())
+	}
+}
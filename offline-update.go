@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// localVersion stands in for the API response when installing from a local archive. The version
+// can't be known offline so it's taken from -target-version if passed
+func localVersion(opts appUpdateOptions) slippiapi.DolphinVersion {
+	version := opts.TargetVersion
+	if version == "" {
+		version = "local"
+	}
+
+	return slippiapi.DolphinVersion{Version: version}
+}
+
+// fetchArtifact puts the release artifact at path, either from the archive passed with -from-file
+// or by downloading it. Both are verified before anything is extracted
+func fetchArtifact(ctx context.Context, cfg toolsConfig, opts appUpdateOptions, path string, urls []string, expectedHash, signature string, validate func(string) error) {
+	if opts.FromFile != "" {
+		useLocalArchive(opts.FromFile, path, validate, cfg.extractLimits())
+		return
+	}
+
+	err := cfg.downloader().Download(ctx, path, urls, expectedHash, validate)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitNetwork, "Failed to download update. %s", err.Error())
+	}
+
+	err = verifyReleaseSignature(path, signature)
+	if err != nil {
+		failf(exitVerification, "Failed to verify download. %s", err.Error())
+	}
+}
+
+// useLocalArchive checks the structure of a locally supplied archive and copies it into staging.
+// A detached signature next to it (archive.sig) is verified if present
+func useLocalArchive(source, path string, validate func(string) error, limits updater.ExtractLimits) {
+	log.Printf("Installing from %s, skipping the download\n", source)
+
+	err := validate(source)
+	if err == nil {
+		if format, _ := updater.DetectFormat(source); format != updater.FormatUnknown {
+			err = validateArchiveStructure(source, limits)
+		}
+	}
+	if err != nil {
+		failf(exitVerification, "%s can't be installed. %s", source, err.Error())
+	}
+
+	signature, err := ioutil.ReadFile(source + ".sig")
+	if err == nil {
+		err = verifyReleaseSignature(source, strings.TrimSpace(string(signature)))
+		if err != nil {
+			failf(exitVerification, "Failed to verify %s. %s", source, err.Error())
+		}
+	} else if releasePublicKey != "" {
+		log.Printf("Warning: %s.sig was not found, the archive's signature can't be verified\n", source)
+	}
+
+	err = copyFile(source, path)
+	if err != nil {
+		failf(exitInstall, "Failed to copy %s. %s", source, err.Error())
+	}
+}
+
+// validateArchiveStructure checks that an archive is readable and holds a Dolphin build, which is
+// more than we check for downloads since a local file may be anything
+func validateArchiveStructure(archivePath string, limits updater.ExtractLimits) error {
+	archive, err := updater.OpenArchiveWithLimits(archivePath, limits)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.Entries() {
+		if !entry.IsDir() && (isDolphinExe(path.Base(entry.Name)) || strings.Contains(entry.Name, ".app/")) {
+			return nil
+		}
+	}
+
+	return errors.New("archive does not contain a Dolphin build")
+}
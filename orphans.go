@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+type orphansEvent struct {
+	Type    string   `json:"type"`
+	Removed []string `json:"removed"`
+}
+
+// ownedFiles lists the files the previous version installed, from its release manifest where one
+// is published and from the record of the last update. Anything else in the install was put there
+// by the user and is never an orphan
+func ownedFiles(ctx context.Context, cfg toolsConfig, exPath, prevVersion string, prevManifest updateManifest) []string {
+	files := []updater.UpdatedFile{}
+	files = append(files, prevManifest.Files...)
+
+	// Only Windows archives are published with a manifest
+	if runtime.GOOS == "windows" && prevVersion != "" {
+		manifest, err := fetchReleaseManifest(ctx, cfg, exPath, prevVersion)
+		if err == nil {
+			files = append(files, manifest.Files...)
+		} else {
+			logDebugf("No release manifest for %s, only the last update's files are cleaned up. %s", prevVersion, err.Error())
+		}
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		if !seen[strings.ToLower(file.Path)] {
+			seen[strings.ToLower(file.Path)] = true
+			paths = append(paths, file.Path)
+		}
+	}
+
+	return paths
+}
+
+// findOrphans returns the owned files the new version doesn't have that are still in the install.
+// Config files are left alone since users edit them, as are the tools themselves which are updated
+// on their own
+func findOrphans(exPath string, owned []string, files []updater.UpdatedFile) []string {
+	current := map[string]bool{}
+	for _, file := range files {
+		current[strings.ToLower(file.Path)] = true
+	}
+
+	orphans := []string{}
+	for _, relPath := range owned {
+		if current[strings.ToLower(relPath)] || isPreservableConfig(relPath) || updaterUpdateGen(relPath) != "" {
+			continue
+		}
+
+		// Everything under Sys was swapped out as a whole, most orphans are gone already
+		if _, err := os.Lstat(fsutil.LongPath(filepath.Join(exPath, filepath.FromSlash(relPath)))); err != nil {
+			continue
+		}
+		orphans = append(orphans, relPath)
+	}
+
+	sort.Strings(orphans)
+	return orphans
+}
+
+// removeOrphans moves the orphans into the backup of the update, such that they come back with it
+// if something turns out to need them, and removes the folders left empty
+func removeOrphans(exPath, backupDir string, orphans []string) []string {
+	exPath = fsutil.LongPath(exPath)
+
+	removed := []string{}
+	for _, relPath := range orphans {
+		// The list comes from the manifest of the previous update, which may have been tampered with
+		if !updater.IsSafeRelPath(relPath) {
+			log.Printf("Warning: not removing %s, it is outside of the install\n", relPath)
+			continue
+		}
+
+		path := filepath.Join(exPath, filepath.FromSlash(relPath))
+		backupPath := filepath.Join(backupDir, filepath.FromSlash(relPath))
+
+		err := os.MkdirAll(filepath.Dir(backupPath), 0755)
+		if err == nil {
+			err = renameWithRetry(path, backupPath)
+		}
+		if err != nil {
+			log.Printf("Failed to remove %s. %s\n", relPath, err.Error())
+			continue
+		}
+		removed = append(removed, relPath)
+
+		// Remove fails on folders that still have something in them, which is where we stop
+		for dir := filepath.Dir(path); dir != exPath && strings.HasPrefix(dir, exPath); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return removed
+}
+
+// cleanupOrphans removes the files of the previous version the new one no longer ships, such as
+// DLLs that were dropped. It runs once the update is complete, failing to remove a file only logs
+func cleanupOrphans(ctx context.Context, cfg toolsConfig, exPath, backupDir, prevVersion string, prevManifest updateManifest, files []updater.UpdatedFile) {
+	owned := ownedFiles(ctx, cfg, exPath, prevVersion, prevManifest)
+	orphans := findOrphans(exPath, owned, files)
+	if len(orphans) == 0 {
+		return
+	}
+
+	fmt.Printf("Removing %d files the new version no longer has...\n", len(orphans))
+	removed := removeOrphans(exPath, backupDir, orphans)
+	for _, relPath := range removed {
+		logDebugf("Removed %s", relPath)
+	}
+
+	if jsonOutput {
+		emitEvent(orphansEvent{Type: "orphans", Removed: removed})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveOrphansStaysInTheInstall(t *testing.T) {
+	dir := t.TempDir()
+	exPath := filepath.Join(dir, "install")
+	backupDir := filepath.Join(dir, "backup")
+	writeTestFiles(t, dir, map[string]string{
+		"install/Sys/old.dll": "old",
+		"outside.txt":         "not ours",
+	})
+
+	removed := removeOrphans(exPath, backupDir, []string{"Sys/old.dll", "../outside.txt", "/etc/passwd"})
+	if len(removed) != 1 || removed[0] != "Sys/old.dll" {
+		t.Errorf("removed %v, want only Sys/old.dll", removed)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "outside.txt")); got != "not ours" {
+		t.Error("a file outside of the install was moved")
+	}
+	if got := readTestFile(t, filepath.Join(backupDir, "Sys", "old.dll")); got != "old" {
+		t.Error("the orphan wasn't moved into the backup")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// jsonOutput is set by the global --json flag. Every command then writes newline delimited json
+// events to stdout while the human readable output goes to stderr
+var jsonOutput = false
+
+// jsonStdout is where events are written. In json mode os.Stdout is pointed at stderr such that
+// the existing human readable prints can't corrupt the event stream
+var jsonStdout io.Writer = os.Stdout
+
+var outputMu sync.Mutex
+
+// logEvent carries a log line in json mode
+type logEvent struct {
+	Type    string `json:"type"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// resultEvent is the last event of every command in json mode
+type resultEvent struct {
+	Type    string       `json:"type"`
+	Command string       `json:"command"`
+	Success bool         `json:"success"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   *updateError `json:"error,omitempty"`
+}
+
+func useJSONOutput() {
+	jsonOutput = true
+	jsonStdout = os.Stdout
+	os.Stdout = os.Stderr
+
+	progress = &jsonProgress{out: jsonStdout}
+}
+
+func emitEvent(event interface{}) {
+	contents, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	fmt.Fprintln(jsonStdout, string(contents))
+}
+
+// emitResult ends a command in json mode, does nothing otherwise
+func emitResult(command string, data interface{}) {
+	if jsonOutput {
+		emitEvent(resultEvent{Type: "result", Command: command, Success: true, Data: data})
+	}
+}
+
+// jsonLogWriter keeps logs on stderr for humans and also sends each line as a log event
+type jsonLogWriter struct{}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	os.Stderr.Write(p)
+
+	// Events are consumed as they arrive so the timestamp isn't needed
+	message := stripLogPrefix(string(p))
+	level := strings.ToLower(logLevel(message))
+	if level == "warn" {
+		level = "warning"
+	}
+
+	emitEvent(logEvent{Type: "log", Level: level, Message: message})
+	return len(p), nil
+}
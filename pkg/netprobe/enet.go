@@ -0,0 +1,354 @@
+// Package netprobe measures the network paths netplay depends on. It pings ENet servers such as
+// Slippi matchmaking over UDP and asks STUN servers how the router maps outgoing UDP
+package netprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"time"
+)
+
+// ENet protocol constants, everything is big endian on the wire
+const (
+	enetCommandAcknowledge     = 1
+	enetCommandConnect         = 2
+	enetCommandVerifyConnect   = 3
+	enetCommandDisconnect      = 4
+	enetCommandPing            = 5
+	enetCommandSendReliable    = 6
+	enetCommandSendUnreliable  = 7
+	enetCommandSendFragment    = 8
+	enetCommandSendUnsequenced = 9
+	enetCommandBandwidthLimit  = 10
+	enetCommandThrottle        = 11
+	enetCommandUnreliableFrag  = 12
+
+	enetCommandMask          = 0x0F
+	enetFlagAcknowledge      = 0x80
+	enetFlagUnsequenced      = 0x40
+	enetHeaderFlagSentTime   = 0x8000
+	enetHeaderFlagCompressed = 0x4000
+	enetHeaderSessionShift   = 12
+	enetMaxPeerID            = 0x0FFF
+
+	// Commands on this channel are the connection's own, not application data
+	enetControlChannel = 0xFF
+	enetMTU            = 1392
+	enetWindowSize     = 32768
+)
+
+// ErrNoResponse is returned when the server never answered the handshake, which usually means UDP
+// to it is blocked
+var ErrNoResponse = errors.New("no response")
+
+// PingResult holds the round trips of the pings that were answered
+type PingResult struct {
+	Address string
+	Sent    int
+	RTTs    []time.Duration
+}
+
+// Loss is the share of pings that weren't answered, between 0 and 1
+func (r PingResult) Loss() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+
+	return float64(r.Sent-len(r.RTTs)) / float64(r.Sent)
+}
+
+func (r PingResult) Min() time.Duration {
+	if len(r.RTTs) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, r.RTTs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[0]
+}
+
+func (r PingResult) Average() time.Duration {
+	if len(r.RTTs) == 0 {
+		return 0
+	}
+
+	total := time.Duration(0)
+	for _, rtt := range r.RTTs {
+		total += rtt
+	}
+	return total / time.Duration(len(r.RTTs))
+}
+
+// Jitter is the mean difference between consecutive round trips, like RTP measures it
+func (r PingResult) Jitter() time.Duration {
+	if len(r.RTTs) < 2 {
+		return 0
+	}
+
+	total := 0.0
+	for i := 1; i < len(r.RTTs); i++ {
+		total += math.Abs(float64(r.RTTs[i] - r.RTTs[i-1]))
+	}
+	return time.Duration(total / float64(len(r.RTTs)-1))
+}
+
+// enetPeer is the client side of a single ENet connection, only as much as pinging needs
+type enetPeer struct {
+	conn  *net.UDPConn
+	start time.Time
+	// Assigned by the server in its verify connect
+	peerID    uint16
+	sessionID uint16
+	sequence  uint16
+	connected bool
+}
+
+func (p *enetPeer) sentTime() uint16 {
+	return uint16(time.Since(p.start) / time.Millisecond)
+}
+
+// send writes one packet with a single command. Commands the server has to acknowledge carry the
+// time they were sent
+func (p *enetPeer) send(command byte, sequence uint16, body []byte) error {
+	var packet bytes.Buffer
+
+	header := p.peerID | p.sessionID<<enetHeaderSessionShift
+	if command&enetFlagAcknowledge != 0 {
+		binary.Write(&packet, binary.BigEndian, []uint16{header | enetHeaderFlagSentTime, p.sentTime()})
+	} else {
+		binary.Write(&packet, binary.BigEndian, header)
+	}
+
+	packet.Write([]byte{command, enetControlChannel})
+	binary.Write(&packet, binary.BigEndian, sequence)
+	packet.Write(body)
+
+	_, err := p.conn.Write(packet.Bytes())
+	return err
+}
+
+func (p *enetPeer) connect() error {
+	connectID := make([]byte, 4)
+	_, err := rand.Read(connectID)
+	if err != nil {
+		return err
+	}
+
+	// Our peer id and session ids, then the connection settings ENet clients send by default
+	var body bytes.Buffer
+	body.Write([]byte{0, 0, 0xFF, 0xFF})
+	binary.Write(&body, binary.BigEndian, []uint32{enetMTU, enetWindowSize, 1, 0, 0, 5000, 2, 2})
+	body.Write(connectID)
+	body.Write([]byte{0, 0, 0, 0})
+
+	p.peerID = enetMaxPeerID
+	p.sequence = 1
+	return p.send(enetCommandConnect|enetFlagAcknowledge, p.sequence, body.Bytes())
+}
+
+func (p *enetPeer) ping() (uint16, error) {
+	p.sequence++
+	return p.sequence, p.send(enetCommandPing|enetFlagAcknowledge, p.sequence, nil)
+}
+
+// disconnect tells the server to drop the connection right away instead of letting it time out
+func (p *enetPeer) disconnect() error {
+	if !p.connected {
+		return nil
+	}
+
+	return p.send(enetCommandDisconnect|enetFlagUnsequenced, 0, []byte{0, 0, 0, 0})
+}
+
+// enetCommandSize returns how long the command at the start of data is, 0 if it can't be told
+func enetCommandSize(data []byte) int {
+	if len(data) < 4 {
+		return 0
+	}
+
+	withData := func(fixed, lengthAt int) int {
+		if len(data) < lengthAt+2 {
+			return 0
+		}
+		return fixed + int(binary.BigEndian.Uint16(data[lengthAt:]))
+	}
+
+	switch data[0] & enetCommandMask {
+	case enetCommandAcknowledge, enetCommandDisconnect:
+		return 8
+	case enetCommandConnect:
+		return 48
+	case enetCommandVerifyConnect:
+		return 44
+	case enetCommandPing:
+		return 4
+	case enetCommandSendReliable:
+		return withData(6, 4)
+	case enetCommandSendUnreliable, enetCommandSendUnsequenced:
+		return withData(8, 6)
+	case enetCommandSendFragment, enetCommandUnreliableFrag:
+		return withData(24, 4)
+	case enetCommandBandwidthLimit:
+		return 12
+	case enetCommandThrottle:
+		return 16
+	}
+
+	return 0
+}
+
+// receive handles one packet from the server. The sequence numbers it acknowledged are returned, and
+// commands it wants acknowledged are acknowledged
+func (p *enetPeer) receive(packet []byte) ([]uint16, bool, error) {
+	if len(packet) < 2 {
+		return nil, false, nil
+	}
+
+	header := binary.BigEndian.Uint16(packet)
+	if header&enetHeaderFlagCompressed != 0 {
+		return nil, false, nil
+	}
+	offset := 2
+	sentTime := uint16(0)
+	if header&enetHeaderFlagSentTime != 0 {
+		if len(packet) < 4 {
+			return nil, false, nil
+		}
+		sentTime = binary.BigEndian.Uint16(packet[2:])
+		offset = 4
+	}
+
+	acknowledged := []uint16{}
+	for offset < len(packet) {
+		size := enetCommandSize(packet[offset:])
+		if size == 0 || offset+size > len(packet) {
+			break
+		}
+		command := packet[offset : offset+size]
+		offset += size
+
+		switch command[0] & enetCommandMask {
+		case enetCommandAcknowledge:
+			acknowledged = append(acknowledged, binary.BigEndian.Uint16(command[4:]))
+		case enetCommandVerifyConnect:
+			p.peerID = binary.BigEndian.Uint16(command[4:]) & enetMaxPeerID
+			p.sessionID = uint16(command[7]) & 0x03
+			p.connected = true
+		case enetCommandDisconnect:
+			p.connected = false
+			return acknowledged, true, nil
+		}
+
+		if command[0]&enetFlagAcknowledge != 0 {
+			sequence := binary.BigEndian.Uint16(command[2:])
+			body := make([]byte, 4)
+			binary.BigEndian.PutUint16(body, sequence)
+			binary.BigEndian.PutUint16(body[2:], sentTime)
+			err := p.send(enetCommandAcknowledge, sequence, body)
+			if err != nil {
+				return acknowledged, false, err
+			}
+		}
+	}
+
+	return acknowledged, false, nil
+}
+
+// PingENet connects to the ENet server at address, sends count pings interval apart and
+// disconnects. Pings not answered within timeout count as lost. ErrNoResponse is returned when
+// the handshake isn't answered at all
+func PingENet(ctx context.Context, address string, count int, interval, timeout time.Duration) (PingResult, error) {
+	result := PingResult{Address: address, RTTs: []time.Duration{}}
+
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return result, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	peer := &enetPeer{conn: conn, start: time.Now()}
+	defer peer.disconnect()
+
+	sentAt := map[uint16]time.Time{}
+	err = peer.connect()
+	if err != nil {
+		return result, err
+	}
+	connectSentAt := time.Now()
+
+	buf := make([]byte, 4096)
+	deadline := connectSentAt.Add(timeout)
+	nextPing := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		now := time.Now()
+		if peer.connected && result.Sent < count && !now.Before(nextPing) {
+			sequence, err := peer.ping()
+			if err != nil {
+				return result, err
+			}
+			sentAt[sequence] = now
+			result.Sent++
+			nextPing = now.Add(interval)
+			deadline = now.Add(timeout)
+		}
+		if !now.Before(deadline) {
+			break
+		}
+
+		wait := deadline
+		if peer.connected && result.Sent < count && nextPing.Before(wait) {
+			wait = nextPing
+		}
+		conn.SetReadDeadline(wait)
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			// Unreachable ports are reported as read errors on some systems
+			if !peer.connected {
+				return result, err
+			}
+			continue
+		}
+
+		acknowledged, disconnected, err := peer.receive(buf[:n])
+		if err != nil {
+			return result, err
+		}
+		for _, sequence := range acknowledged {
+			if at, ok := sentAt[sequence]; ok {
+				result.RTTs = append(result.RTTs, time.Since(at))
+				delete(sentAt, sequence)
+			}
+		}
+		if disconnected {
+			return result, errors.New("the server closed the connection")
+		}
+		if peer.connected && result.Sent == count && len(sentAt) == 0 {
+			break
+		}
+	}
+
+	if !peer.connected && result.Sent == 0 {
+		return result, ErrNoResponse
+	}
+
+	return result, nil
+}
@@ -0,0 +1,230 @@
+package netprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderSize      = 20
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXorMappedAddress = 0x0020
+)
+
+// NAT types DetectNAT tells apart. Hole punching, which direct netplay connections rely on, works
+// unless the NAT is symmetric
+const (
+	NATBlocked             = "blocked"
+	NATNone                = "none"
+	NATEndpointIndependent = "endpoint-independent"
+	NATSymmetric           = "symmetric"
+	NATUnknown             = "unknown"
+)
+
+// NATResult is what the STUN servers saw of a single local UDP port
+type NATResult struct {
+	Type         string
+	LocalAddress string
+	// Mapped has the address each server answered with, by server
+	Mapped map[string]string
+	Errors map[string]string
+}
+
+// stunRequest builds a binding request with a random transaction id
+func stunRequest() ([]byte, []byte, error) {
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request, stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	_, err := rand.Read(request[8:])
+	return request, request[8:], err
+}
+
+// parseStunResponse returns the mapped address of a binding response to transaction
+func parseStunResponse(response, transaction []byte) (*net.UDPAddr, bool) {
+	if len(response) < stunHeaderSize || binary.BigEndian.Uint16(response) != stunBindingResponse {
+		return nil, false
+	}
+	if !bytes.Equal(response[8:stunHeaderSize], transaction) {
+		return nil, false
+	}
+
+	length := int(binary.BigEndian.Uint16(response[2:]))
+	if stunHeaderSize+length > len(response) {
+		return nil, false
+	}
+	attributes := response[stunHeaderSize : stunHeaderSize+length]
+
+	var mapped *net.UDPAddr
+	for len(attributes) >= 4 {
+		kind := binary.BigEndian.Uint16(attributes)
+		size := int(binary.BigEndian.Uint16(attributes[2:]))
+		if 4+size > len(attributes) {
+			break
+		}
+		value := attributes[4 : 4+size]
+
+		// Only IPv4 is asked for, the sockets are udp4
+		if (kind == stunAttrXorMappedAddress || kind == stunAttrMappedAddress) && size >= 8 && value[1] == 0x01 {
+			port := binary.BigEndian.Uint16(value[2:])
+			ip := net.IP(append([]byte{}, value[4:8]...))
+			if kind == stunAttrXorMappedAddress {
+				port ^= stunMagicCookie >> 16
+				cookie := make([]byte, 4)
+				binary.BigEndian.PutUint32(cookie, stunMagicCookie)
+				for i := range ip {
+					ip[i] ^= cookie[i]
+				}
+			}
+
+			// The xor'd address is preferred, some routers rewrite addresses they find in packets
+			mapped = &net.UDPAddr{IP: ip, Port: int(port)}
+			if kind == stunAttrXorMappedAddress {
+				return mapped, true
+			}
+		}
+
+		// Attributes are padded to 4 bytes, a response can still end without the padding
+		next := 4 + (size+3)/4*4
+		if next > len(attributes) {
+			break
+		}
+		attributes = attributes[next:]
+	}
+
+	return mapped, mapped != nil
+}
+
+// MappedAddress asks the STUN server which address the packets of conn come from, retrying a
+// couple of times within timeout since UDP can drop the request or the answer
+func MappedAddress(ctx context.Context, conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return nil, err
+	}
+
+	request, transaction, err := stunRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1024)
+	deadline := time.Now().Add(timeout)
+	for attempt := 0; attempt < 3 && time.Now().Before(deadline); attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		_, err = conn.WriteToUDP(request, raddr)
+		if err != nil {
+			return nil, err
+		}
+
+		wait := time.Now().Add(timeout / 3)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				break
+			}
+			if !from.IP.Equal(raddr.IP) {
+				continue
+			}
+			if mapped, ok := parseStunResponse(buf[:n], transaction); ok {
+				return mapped, nil
+			}
+		}
+	}
+
+	return nil, ErrNoResponse
+}
+
+// DetectNAT asks every STUN server for the mapping of the same local port. The same mapping for
+// every server means the router keeps it per port and other players can reach it
+func DetectNAT(ctx context.Context, servers []string, timeout time.Duration) (NATResult, error) {
+	result := NATResult{Type: NATUnknown, Mapped: map[string]string{}, Errors: map[string]string{}}
+	if len(servers) == 0 {
+		return result, errors.New("no STUN servers")
+	}
+
+	// Find the address of the interface the servers are reached through, listening on every
+	// interface would leave it unknown
+	probe, err := net.Dial("udp4", servers[0])
+	if err != nil {
+		return result, err
+	}
+	localIP := probe.LocalAddr().(*net.UDPAddr).IP
+	probe.Close()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: localIP})
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr)
+	result.LocalAddress = local.String()
+
+	mappings := []string{}
+	for _, server := range servers {
+		mapped, err := MappedAddress(ctx, conn, server, timeout)
+		if err != nil {
+			result.Errors[server] = err.Error()
+			continue
+		}
+		result.Mapped[server] = mapped.String()
+		mappings = append(mappings, mapped.String())
+	}
+
+	same := true
+	for i := 1; i < len(mappings); i++ {
+		same = same && mappings[i] == mappings[0]
+	}
+
+	switch {
+	case len(mappings) == 0:
+		result.Type = NATBlocked
+	case same && mappings[0] == local.String():
+		result.Type = NATNone
+	case !same:
+		result.Type = NATSymmetric
+	case len(mappings) < 2:
+		result.Type = NATUnknown
+	default:
+		result.Type = NATEndpointIndependent
+	}
+
+	return result, nil
+}
+
+// InterfaceMTU returns the name and MTU of the interface that has ip
+func InterfaceMTU(ip net.IP) (string, int, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name, iface.MTU, nil
+			}
+		}
+	}
+
+	return "", 0, errors.New("no interface has " + ip.String())
+}
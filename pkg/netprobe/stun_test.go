@@ -0,0 +1,47 @@
+package netprobe
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testStunResponse builds a binding response to transaction with the given attributes
+func testStunResponse(transaction []byte, attributes []byte) []byte {
+	response := make([]byte, stunHeaderSize, stunHeaderSize+len(attributes))
+	binary.BigEndian.PutUint16(response, stunBindingResponse)
+	binary.BigEndian.PutUint16(response[2:], uint16(len(attributes)))
+	binary.BigEndian.PutUint32(response[4:], stunMagicCookie)
+	copy(response[8:], transaction)
+
+	return append(response, attributes...)
+}
+
+func TestParseStunResponse(t *testing.T) {
+	transaction := []byte("0123456789ab")
+	mapped := []byte{0x00, 0x01, 0x00, 0x08, 0x00, 0x01, 0x1F, 0x90, 192, 168, 1, 2}
+
+	tests := []struct {
+		name       string
+		attributes []byte
+		want       string
+	}{
+		{"mapped address", mapped, "192.168.1.2:8080"},
+		{"unpadded last attribute", append(append([]byte{}, mapped...), 0x80, 0x22, 0x00, 0x05, 'S', 'T', 'U', 'N', '!'), "192.168.1.2:8080"},
+		{"attribute longer than the response", []byte{0x00, 0x01, 0x00, 0x40, 0x00, 0x01}, ""},
+		{"truncated header", []byte{0x00, 0x01}, ""},
+		{"no attributes", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr, ok := parseStunResponse(testStunResponse(transaction, test.attributes), transaction)
+			got := ""
+			if ok {
+				got = addr.String()
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package slippiapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/machinebox/graphql"
+)
+
+// GraphQL talks to the GraphQL gateway, failing over between Endpoints in order
+type GraphQL struct {
+	Endpoints []string
+	Client    *http.Client
+	// DolphinType selects the build Dolphin queries are about, netplay when empty
+	DolphinType string
+}
+
+// dolphinVersionFields is the selection shared by every query returning a DolphinVersion
+const dolphinVersionFields = `
+	windowsDownloadUrl
+	windowsDownloadMirrors
+	windowsDownloadSha256
+	windowsDownloadSignature
+	macDownloadUrl
+	macDownloadMirrors
+	macDownloadSha256
+	macDownloadSignature
+	linuxDownloadUrl
+	linuxDownloadMirrors
+	linuxDownloadSignature
+	linuxZipDownloadUrl
+	linuxZipDownloadMirrors
+	linuxZipDownloadSignature
+	version
+	windowsExeSha256
+	windowsManifestUrl
+	windowsManifestSignature
+	minReplayVersion
+`
+
+func (p GraphQL) Name() string {
+	return "GraphQL"
+}
+
+// Run runs a request against each endpoint until one answers, and returns the one that did
+func (p GraphQL) Run(ctx context.Context, req *graphql.Request, resp interface{}) (string, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	err := errors.New("no endpoint configured")
+	for i, endpoint := range p.Endpoints {
+		err = graphql.NewClient(endpoint, graphql.WithHTTPClient(client)).Run(ctx, req, resp)
+		if err == nil {
+			return endpoint, nil
+		}
+
+		if ctx.Err() != nil {
+			return "", err
+		}
+		if i+1 < len(p.Endpoints) {
+			log.Printf("Warning: request to %s failed, trying the next endpoint. %s\n", endpoint, err.Error())
+		}
+	}
+
+	return "", err
+}
+
+// typedRequest creates a request for a query about a Dolphin build. {typeVar} and {typeArg} in the
+// query become the variable and argument selecting the Dolphin type, they are left out for netplay
+// such that older servers keep accepting the queries
+func (p GraphQL) typedRequest(query string) *graphql.Request {
+	typeVar, typeArg := "", ""
+	if p.DolphinType != "" && p.DolphinType != TypeNetplay {
+		typeVar, typeArg = ", $dolphinType: String", ", dolphinType: $dolphinType"
+	}
+
+	req := graphql.NewRequest(strings.NewReplacer("{typeVar}", typeVar, "{typeArg}", typeArg).Replace(query))
+	if typeVar != "" {
+		req.Var("dolphinType", p.DolphinType)
+	}
+
+	return req
+}
+
+func (p GraphQL) run(ctx context.Context, req *graphql.Request, resp interface{}) error {
+	_, err := p.Run(ctx, req, resp)
+	return err
+}
+
+func (p GraphQL) LatestVersion(ctx context.Context, channel string) (DolphinVersion, error) {
+	req := p.typedRequest(`
+		query GetLatestDolphin($includeBeta: Boolean, $channel: String{typeVar}) {
+			getLatestDolphin(includeBeta: $includeBeta, channel: $channel{typeArg}) {` + dolphinVersionFields + `}
+		}
+	`)
+
+	// includeBeta is still sent for servers that don't know about channels
+	req.Var("includeBeta", channel != "stable")
+	req.Var("channel", channel)
+
+	var resp struct {
+		DolphinVersion DolphinVersion `json:"getLatestDolphin"`
+	}
+	err := p.run(ctx, req, &resp)
+	if err == nil && resp.DolphinVersion.Version == "" {
+		err = errors.New("no version returned")
+	}
+
+	return resp.DolphinVersion, err
+}
+
+func (p GraphQL) Version(ctx context.Context, version string) (DolphinVersion, error) {
+	req := p.typedRequest(`
+		query GetDolphinVersion($version: String!{typeVar}) {
+			getDolphinVersion(version: $version{typeArg}) {` + dolphinVersionFields + `}
+		}
+	`)
+
+	req.Var("version", version)
+
+	var resp struct {
+		DolphinVersion DolphinVersion `json:"getDolphinVersion"`
+	}
+	err := p.run(ctx, req, &resp)
+	return resp.DolphinVersion, err
+}
+
+func (p GraphQL) Changelog(ctx context.Context, fromVersion, toVersion string) ([]ReleaseNotes, error) {
+	req := p.typedRequest(`
+		query GetDolphinChangelog($fromVersion: String, $toVersion: String!{typeVar}) {
+			getDolphinChangelog(fromVersion: $fromVersion, toVersion: $toVersion{typeArg}) {
+				version
+				releaseNotes
+			}
+		}
+	`)
+
+	req.Var("fromVersion", fromVersion)
+	req.Var("toVersion", toVersion)
+
+	var resp struct {
+		Changelog []ReleaseNotes `json:"getDolphinChangelog"`
+	}
+	err := p.run(ctx, req, &resp)
+	return resp.Changelog, err
+}
+
+func (p GraphQL) Delta(ctx context.Context, fromVersion, toVersion string) (DolphinDelta, error) {
+	req := p.typedRequest(`
+		query GetDolphinDelta($fromVersion: String!, $toVersion: String!{typeVar}) {
+			getDolphinDelta(fromVersion: $fromVersion, toVersion: $toVersion{typeArg}) {
+				baseVersion
+				windowsPatchUrl
+				windowsPatchSha256
+				windowsPatchSignature
+			}
+		}
+	`)
+
+	req.Var("fromVersion", fromVersion)
+	req.Var("toVersion", toVersion)
+
+	var resp struct {
+		Delta DolphinDelta `json:"getDolphinDelta"`
+	}
+	err := p.run(ctx, req, &resp)
+	return resp.Delta, err
+}
+
+func (p GraphQL) LatestTools(ctx context.Context, goos, goarch, channel string) (ToolsRelease, error) {
+	req := graphql.NewRequest(`
+		query GetLatestSlippiTools($os: String!, $arch: String!, $channel: String) {
+			getLatestSlippiTools(os: $os, arch: $arch, channel: $channel) {
+				version
+				downloadUrl
+				downloadMirrors
+				sha256
+				signature
+			}
+		}
+	`)
+
+	req.Var("os", goos)
+	req.Var("arch", goarch)
+	req.Var("channel", channel)
+
+	var resp struct {
+		Tools ToolsRelease `json:"getLatestSlippiTools"`
+	}
+	err := p.run(ctx, req, &resp)
+	return resp.Tools, err
+}
@@ -0,0 +1,109 @@
+package slippiapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const retryBaseDelay = time.Second
+
+// RetryMaxDelay is the longest a single retry waits
+const RetryMaxDelay = 30 * time.Second
+
+// StatusError is returned when a server answers with a status we can't use
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %s", e.Status)
+}
+
+// IsRetryable reports whether a failed request may succeed when tried again. Server errors, rate
+// limiting and network errors are temporary, other client errors such as a 404 are not
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return IsRetryableStatus(se.StatusCode)
+	}
+
+	return true
+}
+
+func IsRetryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// RetryDelay is an exponential backoff with jitter such that many clients failing at once don't
+// all come back at the same moment
+func RetryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt)
+	if delay > RetryMaxDelay || delay <= 0 {
+		delay = RetryMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// RetryTransport retries requests that fail with a retryable error. Meant for API requests, which
+// are small and safe to repeat. Downloads retry at a higher level such that they can resume
+type RetryTransport struct {
+	Base    http.RoundTripper
+	Retries int
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(attemptReq)
+		if err == nil && !IsRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		// Out of attempts, or the body was already used and can't be sent again
+		if attempt+1 >= t.Retries || (req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := RetryDelay(attempt)
+		if err == nil {
+			// Respect the server asking us to back off
+			if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+
+			err = &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		log.Printf("Request to %s failed, trying again in %s. %s\n", req.URL.Host, delay.Round(time.Second), err.Error())
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
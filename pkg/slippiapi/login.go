@@ -0,0 +1,55 @@
+package slippiapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Device login statuses returned while polling
+const (
+	LoginPending  = "pending"
+	LoginSlowDown = "slow_down"
+	LoginApproved = "approved"
+	LoginDenied   = "denied"
+)
+
+// DeviceAuthorization is the start of the device code flow. The user enters UserCode at
+// VerificationURI while the client polls with DeviceCode
+type DeviceAuthorization struct {
+	DeviceCode      string `json:"deviceCode"`
+	UserCode        string `json:"userCode"`
+	VerificationURI string `json:"verificationUri"`
+	Interval        int    `json:"interval"`
+	ExpiresIn       int    `json:"expiresIn"`
+}
+
+// DeviceToken is the answer to a poll. Status is pending until the user approves or denies the
+// login, slow_down asks for a longer interval
+type DeviceToken struct {
+	Status      string `json:"status"`
+	AccessToken string `json:"accessToken"`
+}
+
+func (p REST) StartDeviceLogin(ctx context.Context, client string) (DeviceAuthorization, error) {
+	var auth DeviceAuthorization
+	err := p.Do(ctx, http.MethodPost, "/auth/device", nil, map[string]string{"client": client}, "", &auth)
+	if err == nil && auth.DeviceCode == "" {
+		err = errors.New("no device code returned")
+	}
+
+	return auth, err
+}
+
+func (p REST) PollDeviceLogin(ctx context.Context, deviceCode string) (DeviceToken, error) {
+	var token DeviceToken
+	err := p.Do(ctx, http.MethodPost, "/auth/device/token", nil, map[string]string{"deviceCode": deviceCode}, "", &token)
+	return token, err
+}
+
+// Me returns the account a login token belongs to
+func (p REST) Me(ctx context.Context, token string) (User, error) {
+	var user User
+	err := p.Do(ctx, http.MethodGet, "/user/me", nil, nil, token, &user)
+	return user, err
+}
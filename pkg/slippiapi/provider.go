@@ -0,0 +1,14 @@
+package slippiapi
+
+import "context"
+
+// Provider is a backend that publishes Dolphin and tools releases. The REST API is the current
+// one, GraphQL is kept as a fallback such that old deployments keep working
+type Provider interface {
+	Name() string
+	LatestVersion(ctx context.Context, channel string) (DolphinVersion, error)
+	Version(ctx context.Context, version string) (DolphinVersion, error)
+	Changelog(ctx context.Context, fromVersion, toVersion string) ([]ReleaseNotes, error)
+	Delta(ctx context.Context, fromVersion, toVersion string) (DolphinDelta, error)
+	LatestTools(ctx context.Context, goos, goarch, channel string) (ToolsRelease, error)
+}
@@ -0,0 +1,144 @@
+package slippiapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultRESTEndpoint = "https://slippi.gg/api/v1"
+
+// Responses are small json documents, anything larger is not something we asked for
+const maxRESTResponseBytes = 10 * 1024 * 1024
+
+// REST talks to the slippi.gg REST API. Responses use the same field names as the GraphQL schema
+// so they decode into the same types
+type REST struct {
+	BaseURL   string
+	Client    *http.Client
+	UserAgent string
+	// DolphinType selects the build Dolphin queries are about, netplay when empty
+	DolphinType string
+}
+
+func NewREST(baseURL string, client *http.Client, userAgent string) REST {
+	return REST{BaseURL: strings.TrimRight(baseURL, "/"), Client: client, UserAgent: userAgent}
+}
+
+func (p REST) Name() string {
+	return "REST"
+}
+
+func (p REST) get(ctx context.Context, path string, query url.Values, resp interface{}) error {
+	return p.Do(ctx, http.MethodGet, path, query, nil, "", resp)
+}
+
+// Do sends body as json when set, and authenticates with token when set
+func (p REST) Do(ctx context.Context, method, path string, query url.Values, body interface{}, token string, resp interface{}) error {
+	if p.BaseURL == "" {
+		return errors.New("no REST endpoint configured")
+	}
+
+	target := p.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		contents, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(contents)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.UserAgent != "" {
+		req.Header.Set("User-Agent", p.UserAgent)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxRESTResponseBytes)).Decode(resp)
+}
+
+// typed adds the Dolphin type to a query, it is left out for netplay such that older servers keep
+// answering
+func (p REST) typed(query url.Values) url.Values {
+	if p.DolphinType != "" && p.DolphinType != TypeNetplay {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("type", p.DolphinType)
+	}
+
+	return query
+}
+
+func (p REST) LatestVersion(ctx context.Context, channel string) (DolphinVersion, error) {
+	var resp DolphinVersion
+	err := p.get(ctx, "/dolphin/latest", p.typed(url.Values{"channel": {channel}}), &resp)
+	if err == nil && resp.Version == "" {
+		err = errors.New("no version returned")
+	}
+
+	return resp, err
+}
+
+func (p REST) Version(ctx context.Context, version string) (DolphinVersion, error) {
+	var resp DolphinVersion
+	err := p.get(ctx, "/dolphin/versions/"+url.PathEscape(version), p.typed(nil), &resp)
+	return resp, err
+}
+
+func (p REST) Changelog(ctx context.Context, fromVersion, toVersion string) ([]ReleaseNotes, error) {
+	var resp []ReleaseNotes
+	err := p.get(ctx, "/dolphin/changelog", p.typed(url.Values{"from": {fromVersion}, "to": {toVersion}}), &resp)
+	return resp, err
+}
+
+func (p REST) Delta(ctx context.Context, fromVersion, toVersion string) (DolphinDelta, error) {
+	var resp DolphinDelta
+	err := p.get(ctx, "/dolphin/delta", p.typed(url.Values{"from": {fromVersion}, "to": {toVersion}}), &resp)
+	return resp, err
+}
+
+func (p REST) LatestTools(ctx context.Context, goos, goarch, channel string) (ToolsRelease, error) {
+	var resp ToolsRelease
+	err := p.get(ctx, "/tools/latest", url.Values{
+		"os":      {goos},
+		"arch":    {goarch},
+		"channel": {channel},
+	}, &resp)
+
+	return resp, err
+}
@@ -0,0 +1,72 @@
+// Package slippiapi talks to the Slippi servers to look up Dolphin and tools releases and user
+// accounts, over the slippi.gg REST API or the GraphQL gateway
+package slippiapi
+
+// Dolphin builds published by the API. Netplay is the one used to play online, playback is the
+// build that plays back replays
+const (
+	TypeNetplay  = "netplay"
+	TypePlayback = "playback"
+)
+
+// DolphinVersion is a published Dolphin release with its downloads for every platform
+type DolphinVersion struct {
+	URL             string   `json:"windowsDownloadUrl"`
+	Version         string   `json:"version"`
+	Mirrors         []string `json:"windowsDownloadMirrors"`
+	ArchiveSHA256   string   `json:"windowsDownloadSha256"`
+	Signature       string   `json:"windowsDownloadSignature"`
+	MacURL          string   `json:"macDownloadUrl"`
+	MacMirrors      []string `json:"macDownloadMirrors"`
+	MacSHA256       string   `json:"macDownloadSha256"`
+	MacSignature    string   `json:"macDownloadSignature"`
+	AppImageURL     string   `json:"linuxDownloadUrl"`
+	AppImageMirrors []string `json:"linuxDownloadMirrors"`
+	AppImageSig     string   `json:"linuxDownloadSignature"`
+	LinuxZipURL     string   `json:"linuxZipDownloadUrl"`
+	LinuxZipMirrors []string `json:"linuxZipDownloadMirrors"`
+	LinuxZipSig     string   `json:"linuxZipDownloadSignature"`
+	ExeSHA256       string   `json:"windowsExeSha256"`
+	// ManifestURL points at the hashes of every file in the Windows archive
+	ManifestURL       string `json:"windowsManifestUrl"`
+	ManifestSignature string `json:"windowsManifestSignature"`
+	// MinReplayVersion is the oldest .slp format a playback build can play back
+	MinReplayVersion string `json:"minReplayVersion"`
+}
+
+// DolphinDelta is a patch set that updates BaseVersion to a newer version
+type DolphinDelta struct {
+	BaseVersion string `json:"baseVersion"`
+	URL         string `json:"windowsPatchUrl"`
+	SHA256      string `json:"windowsPatchSha256"`
+	Signature   string `json:"windowsPatchSignature"`
+}
+
+type ReleaseNotes struct {
+	Version string `json:"version"`
+	Notes   string `json:"releaseNotes"`
+}
+
+// ToolsRelease is a published build of dolphin-slippi-tools for one platform
+type ToolsRelease struct {
+	Version   string   `json:"version"`
+	URL       string   `json:"downloadUrl"`
+	Mirrors   []string `json:"downloadMirrors"`
+	SHA256    string   `json:"sha256"`
+	Signature string   `json:"signature"`
+}
+
+// User is the account info that goes into user.json
+type User struct {
+	UID         string `json:"uid"`
+	PlayKey     string `json:"playKey"`
+	ConnectCode string `json:"connectCode"`
+	DisplayName string `json:"displayName"`
+}
+
+// AccountStatus is what the server knows about the account behind a play key
+type AccountStatus struct {
+	PlayKeyValid bool   `json:"playKeyValid"`
+	Status       string `json:"status"`
+	Rank         string `json:"rank,omitempty"`
+}
@@ -0,0 +1,68 @@
+package slippiapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/machinebox/graphql"
+)
+
+// UserResponse is the user's account together with the latest netplay version, which user.json
+// also records
+type UserResponse struct {
+	User            User             `json:"user"`
+	DolphinVersions []DolphinVersion `json:"dolphinVersions"`
+}
+
+// User looks up an account on the user endpoints, which have their own schema
+func (p GraphQL) User(ctx context.Context, uid string) (UserResponse, error) {
+	req := graphql.NewRequest(`
+		query ($type: String!, $uid: String!) {
+			dolphinVersions(order_by: {releasedAt: desc}, limit: 1, where: {type: {_eq: $type}}) {
+				version
+			}
+			user (uid: $uid) {
+				uid
+				connectCode
+				displayName
+			}
+		}	
+	`)
+
+	req.Var("type", "ishii")
+	req.Var("uid", uid)
+
+	var resp UserResponse
+	err := p.run(ctx, req, &resp)
+	return resp, err
+}
+
+// AccountStatus checks the playKey against the server. Kept separate from the user query such
+// that servers without it can still update user.json
+func (p GraphQL) AccountStatus(ctx context.Context, uid, playKey string) (AccountStatus, error) {
+	req := graphql.NewRequest(`
+		query ($uid: String!, $playKey: String!) {
+			accountStatus: getAccountStatus(uid: $uid, playKey: $playKey) {
+				playKeyValid
+				status
+				rank
+			}
+		}
+	`)
+
+	req.Var("uid", uid)
+	req.Var("playKey", playKey)
+
+	var resp struct {
+		Account *AccountStatus `json:"accountStatus"`
+	}
+	err := p.run(ctx, req, &resp)
+	if err == nil && resp.Account == nil {
+		err = fmt.Errorf("account %s was not found", uid)
+	}
+	if err != nil {
+		return AccountStatus{}, err
+	}
+
+	return *resp.Account, nil
+}
@@ -0,0 +1,63 @@
+package slp
+
+import "strconv"
+
+// characters are indexed by the external character ID the Game Start event uses
+var characters = []string{
+	"Captain Falcon", "Donkey Kong", "Fox", "Mr. Game & Watch", "Kirby", "Bowser", "Link", "Luigi",
+	"Mario", "Marth", "Mewtwo", "Ness", "Peach", "Pikachu", "Ice Climbers", "Jigglypuff", "Samus",
+	"Yoshi", "Zelda", "Sheik", "Falco", "Young Link", "Dr. Mario", "Roy", "Pichu", "Ganondorf",
+	"Master Hand", "Male Wireframe", "Female Wireframe", "Giga Bowser", "Crazy Hand", "Sandbag",
+	"Popo",
+}
+
+var stages = map[int]string{
+	2:  "Fountain of Dreams",
+	3:  "Pokémon Stadium",
+	4:  "Princess Peach's Castle",
+	5:  "Kongo Jungle",
+	6:  "Brinstar",
+	7:  "Corneria",
+	8:  "Yoshi's Story",
+	9:  "Onett",
+	10: "Mute City",
+	11: "Rainbow Cruise",
+	12: "Jungle Japes",
+	13: "Great Bay",
+	14: "Hyrule Temple",
+	15: "Brinstar Depths",
+	16: "Yoshi's Island",
+	17: "Green Greens",
+	18: "Fourside",
+	19: "Mushroom Kingdom I",
+	20: "Mushroom Kingdom II",
+	22: "Venom",
+	23: "Poké Floats",
+	24: "Big Blue",
+	25: "Icicle Mountain",
+	26: "Icetop",
+	27: "Flat Zone",
+	28: "Dream Land N64",
+	29: "Yoshi's Island N64",
+	30: "Kongo Jungle N64",
+	31: "Battlefield",
+	32: "Final Destination",
+}
+
+// CharacterName returns the name of an external character ID
+func CharacterName(id int) string {
+	if id >= 0 && id < len(characters) {
+		return characters[id]
+	}
+
+	return "Character " + strconv.Itoa(id)
+}
+
+// StageName returns the name of a stage ID
+func StageName(id int) string {
+	if name, ok := stages[id]; ok {
+		return name
+	}
+
+	return "Stage " + strconv.Itoa(id)
+}
@@ -0,0 +1,52 @@
+package slp
+
+import "strings"
+
+// fullWidthSymbols maps the double byte punctuation of Shift JIS that tags and names can be typed
+// with in game to ASCII
+var fullWidthSymbols = map[uint16]byte{
+	0x8140: ' ', 0x8143: ',', 0x8144: '.', 0x8146: ':', 0x8147: ';', 0x8148: '?', 0x8149: '!',
+	0x814F: '^', 0x8151: '_', 0x815E: '/', 0x8160: '~', 0x8162: '|', 0x8169: '(', 0x816A: ')',
+	0x816D: '[', 0x816E: ']', 0x816F: '{', 0x8170: '}', 0x817B: '+', 0x817C: '-', 0x8181: '=',
+	0x8183: '<', 0x8184: '>', 0x8190: '$', 0x8193: '%', 0x8194: '#', 0x8195: '&', 0x8196: '*',
+	0x8197: '@',
+}
+
+// decodeShiftJIS decodes the parts of Shift JIS Melee lets players type: ASCII, and full width
+// letters, digits and punctuation, which are turned into their ASCII form. Other characters such as
+// kana become ? since a full decoder isn't worth a dependency for player names
+func decodeShiftJIS(raw []byte) string {
+	var builder strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c < 0x80 {
+			builder.WriteByte(c)
+			continue
+		}
+
+		// Lead bytes of double byte characters, everything else is a single byte
+		if (c < 0x81 || c > 0x9F) && (c < 0xE0 || c > 0xFC) || i+1 == len(raw) {
+			builder.WriteByte('?')
+			continue
+		}
+
+		code := uint16(c)<<8 | uint16(raw[i+1])
+		i++
+		switch {
+		case code >= 0x824F && code <= 0x8258:
+			builder.WriteByte(byte('0' + code - 0x824F))
+		case code >= 0x8260 && code <= 0x8279:
+			builder.WriteByte(byte('A' + code - 0x8260))
+		case code >= 0x8281 && code <= 0x829A:
+			builder.WriteByte(byte('a' + code - 0x8281))
+		default:
+			if symbol, ok := fullWidthSymbols[code]; ok {
+				builder.WriteByte(symbol)
+			} else {
+				builder.WriteByte('?')
+			}
+		}
+	}
+
+	return builder.String()
+}
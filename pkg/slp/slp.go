@@ -0,0 +1,435 @@
+// Package slp reads Slippi replay files (.slp). A replay is a UBJSON object whose raw element holds
+// the game as a stream of events, followed by a metadata element written when the game ends
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every replay starts with the UBJSON header of its raw element, the length of the raw element
+// follows as a big endian int32
+var rawHeader = []byte("{U\x03raw[$U#l")
+
+const (
+	eventPayloads     = 0x35
+	eventGameStart    = 0x36
+	eventPreFrame     = 0x37
+	eventPostFrame    = 0x38
+	eventGameEnd      = 0x39
+	eventFrameBookend = 0x3C
+
+	// The first frame of a game is -123, frame 0 is the first one players can act on
+	FirstFrame = -123
+
+	playerTypeEmpty = 3
+)
+
+// ErrNotReplay is returned for files that don't start like a replay
+var ErrNotReplay = errors.New("not a Slippi replay")
+
+// Player is one of the four ports of a game. Name and Code come from the netplay info in the Game
+// Start event or the metadata, depending on which the replay has
+type Player struct {
+	Port        int    `json:"port"`
+	CharacterID int    `json:"characterId"`
+	Character   string `json:"character"`
+	Costume     int    `json:"costume"`
+	Type        string `json:"type"`
+	Stocks      int    `json:"startStocks"`
+	Team        int    `json:"team,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+}
+
+// Replay is what Parse reads from a replay. Frames counts the frames from the first one, such that
+// Duration is the length of the recording
+type Replay struct {
+	Version    string        `json:"slippiVersion"`
+	StageID    int           `json:"stageId"`
+	Stage      string        `json:"stage"`
+	IsTeams    bool          `json:"isTeams"`
+	IsPAL      bool          `json:"isPal"`
+	Players    []Player      `json:"players"`
+	Frames     int           `json:"frames"`
+	Duration   time.Duration `json:"-"`
+	Seconds    float64       `json:"durationSeconds"`
+	EndMethod  string        `json:"endMethod,omitempty"`
+	StartAt    *time.Time    `json:"startAt,omitempty"`
+	PlayedOn   string        `json:"playedOn,omitempty"`
+	MatchID    string        `json:"matchId,omitempty"`
+	GameNumber int           `json:"gameNumber,omitempty"`
+	Complete   bool          `json:"complete"`
+
+	// Metadata is the whole metadata element, for values not read into the fields above
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// gameStart is the payload of the Game Start event. Its fields read 0 or empty when the replay's
+// version doesn't have them yet. Offsets are the ones in the replay spec, which count the command
+// byte
+type gameStart []byte
+
+func (payload gameStart) has(offset, size int) bool {
+	return offset+size <= len(payload)+1
+}
+
+func (payload gameStart) u8(offset int) int {
+	if !payload.has(offset, 1) {
+		return 0
+	}
+	return int(payload[offset-1])
+}
+
+func (payload gameStart) u16(offset int) int {
+	if !payload.has(offset, 2) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(payload[offset-1:]))
+}
+
+func (payload gameStart) u32(offset int) uint32 {
+	if !payload.has(offset, 4) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(payload[offset-1:])
+}
+
+// text reads a null terminated string, Shift JIS for names entered in game
+func (payload gameStart) text(offset, size int, shiftJIS bool) string {
+	if !payload.has(offset, size) {
+		return ""
+	}
+
+	raw := payload[offset-1 : offset-1+size]
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	if shiftJIS {
+		return strings.TrimSpace(decodeShiftJIS(raw))
+	}
+
+	return strings.TrimSpace(strings.ToValidUTF8(string(raw), "?"))
+}
+
+// nametag reads the in game tag, stored as up to 8 Shift JIS characters of two bytes
+func (payload gameStart) nametag(offset int) string {
+	if !payload.has(offset, 16) {
+		return ""
+	}
+
+	raw := []byte{}
+	for i := 0; i < 8; i++ {
+		c := payload[offset-1+2*i : offset-1+2*i+2]
+		if c[0] == 0 && c[1] == 0 {
+			break
+		}
+		if c[0] == 0 {
+			raw = append(raw, c[1])
+		} else {
+			raw = append(raw, c...)
+		}
+	}
+
+	return strings.TrimSpace(decodeShiftJIS(raw))
+}
+
+// ReadVersion returns the replay format version a replay was recorded with, reading only the start
+// of the file
+func ReadVersion(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	_, sizes, err := readStart(r)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := readEvent(r, sizes, eventGameStart)
+	if err != nil {
+		return "", err
+	}
+
+	return gameStart(payload).version(), nil
+}
+
+func (payload gameStart) version() string {
+	return fmt.Sprintf("%d.%d.%d", payload.u8(0x1), payload.u8(0x2), payload.u8(0x3))
+}
+
+// readStart checks the header and reads the raw length and the Event Payloads event, which lists
+// the payload size of every other event
+func readStart(r *bufio.Reader) (int64, map[byte]int, error) {
+	header := make([]byte, len(rawHeader)+4)
+	_, err := io.ReadFull(r, header)
+	if err != nil || !bytes.Equal(header[:len(rawHeader)], rawHeader) {
+		return 0, nil, ErrNotReplay
+	}
+	rawLength := int64(binary.BigEndian.Uint32(header[len(rawHeader):]))
+
+	command, err := r.ReadByte()
+	if err != nil || command != eventPayloads {
+		return 0, nil, ErrNotReplay
+	}
+
+	// The size counts itself, each entry is a command and its uint16 size
+	size, err := r.ReadByte()
+	if err != nil || size == 0 || (size-1)%3 != 0 {
+		return 0, nil, errors.New("replay has invalid event payloads")
+	}
+	entries := make([]byte, size-1)
+	_, err = io.ReadFull(r, entries)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	sizes := map[byte]int{eventPayloads: int(size)}
+	for i := 0; i < len(entries); i += 3 {
+		sizes[entries[i]] = int(binary.BigEndian.Uint16(entries[i+1:]))
+	}
+
+	return rawLength, sizes, nil
+}
+
+// readEvent reads the next event, which has to be command, and returns its payload
+func readEvent(r *bufio.Reader, sizes map[byte]int, command byte) ([]byte, error) {
+	next, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if next != command {
+		return nil, fmt.Errorf("expected event 0x%02X but found 0x%02X", command, next)
+	}
+
+	size, ok := sizes[command]
+	if !ok {
+		return nil, fmt.Errorf("replay has no payload size for event 0x%02X", command)
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	return payload, err
+}
+
+// Parse reads the game settings, players and length of a replay and its metadata. Replays of games
+// that didn't end cleanly have no metadata and a raw length of 0, they are read up to where the
+// recording stops
+func Parse(path string) (Replay, error) {
+	var replay Replay
+
+	file, err := os.Open(path)
+	if err != nil {
+		return replay, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	rawLength, sizes, err := readStart(r)
+	if err != nil {
+		return replay, err
+	}
+
+	payload, err := readEvent(r, sizes, eventGameStart)
+	if err != nil {
+		return replay, err
+	}
+	start := gameStart(payload)
+	replay.readGameStart(start)
+
+	// Events after Game Start, skipping all but the frame number of frames
+	read := int64(1+sizes[eventPayloads]) + int64(1+sizes[eventGameStart])
+	lastFrame := FirstFrame - 1
+events:
+	for rawLength == 0 || read < rawLength {
+		command, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return replay, err
+		}
+		if rawLength == 0 && command == 'U' {
+			// The metadata element starts where an unfinished raw element would have its next event
+			r.UnreadByte()
+			break
+		}
+
+		size, ok := sizes[command]
+		if !ok {
+			return replay, fmt.Errorf("unknown event 0x%02X at byte %d", command, read+int64(len(rawHeader))+4)
+		}
+
+		switch command {
+		case eventPreFrame, eventPostFrame, eventFrameBookend, eventGameEnd:
+			event := make([]byte, size)
+			_, err = io.ReadFull(r, event)
+			if err == io.ErrUnexpectedEOF {
+				break events
+			}
+			if err != nil {
+				return replay, err
+			}
+
+			if command == eventGameEnd && len(event) > 0 {
+				replay.EndMethod = endMethodName(int(event[0]))
+			} else if command != eventGameEnd && len(event) >= 4 {
+				if frame := int(int32(binary.BigEndian.Uint32(event))); frame > lastFrame {
+					lastFrame = frame
+				}
+			}
+		default:
+			_, err = r.Discard(size)
+			if err != nil && err != io.EOF {
+				return replay, err
+			}
+		}
+		read += int64(1 + size)
+	}
+
+	if lastFrame >= FirstFrame {
+		replay.Frames = lastFrame - FirstFrame + 1
+	}
+
+	// Lengths in the metadata are checked against what is left of the file
+	info, err := file.Stat()
+	if err != nil {
+		return replay, err
+	}
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return replay, err
+	}
+
+	err = replay.readMetadata(r, info.Size()-pos+int64(r.Buffered()))
+	if err != nil {
+		return replay, err
+	}
+
+	replay.Duration = time.Duration(replay.Frames) * time.Second / 60
+	replay.Seconds = replay.Duration.Seconds()
+	return replay, nil
+}
+
+func (replay *Replay) readGameStart(start gameStart) {
+	replay.Version = start.version()
+	replay.StageID = start.u16(0x13)
+	replay.Stage = StageName(replay.StageID)
+	replay.IsTeams = start.u8(0xD) != 0
+	replay.IsPAL = start.u8(0x1A1) != 0
+	replay.MatchID = start.text(0x2BE, 51, false)
+	replay.GameNumber = int(start.u32(0x2F1))
+	replay.Players = []Player{}
+
+	for port := 0; port < 4; port++ {
+		offset := 0x65 + 0x24*port
+		playerType := start.u8(offset + 0x1)
+		if playerType == playerTypeEmpty {
+			continue
+		}
+
+		player := Player{
+			Port:        port + 1,
+			CharacterID: start.u8(offset),
+			Type:        playerTypeName(playerType),
+			Stocks:      start.u8(offset + 0x2),
+			Costume:     start.u8(offset + 0x3),
+			Tag:         start.nametag(0x161 + 0x10*port),
+			Name:        start.text(0x1A5+0x1F*port, 0x1F, true),
+			Code:        start.text(0x221+0xA*port, 0xA, true),
+		}
+		player.Character = CharacterName(player.CharacterID)
+		if replay.IsTeams {
+			player.Team = start.u8(offset+0x9) + 1
+		}
+
+		replay.Players = append(replay.Players, player)
+	}
+}
+
+// readMetadata reads the metadata element after the raw element if the replay has one
+func (replay *Replay) readMetadata(r *bufio.Reader, left int64) error {
+	header, err := r.Peek(len("U\x08metadata"))
+	if err != nil || string(header) != "U\x08metadata" {
+		return nil
+	}
+	r.Discard(len(header))
+
+	value, err := decodeUBJSON(r, left-int64(len(header)))
+	if err != nil {
+		return fmt.Errorf("invalid metadata. %s", err.Error())
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("invalid metadata, not an object")
+	}
+
+	replay.Metadata = metadata
+	replay.Complete = true
+	if startAt, ok := metadata["startAt"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339, startAt); err == nil {
+			replay.StartAt = &parsed
+		}
+	}
+	if playedOn, ok := metadata["playedOn"].(string); ok {
+		replay.PlayedOn = playedOn
+	}
+	if lastFrame, ok := metadata["lastFrame"].(int64); ok && replay.Frames == 0 {
+		replay.Frames = int(lastFrame) - FirstFrame + 1
+	}
+
+	// Older replays only have the netplay names in the metadata
+	players, _ := metadata["players"].(map[string]interface{})
+	for i := range replay.Players {
+		player, _ := players[strconv.Itoa(replay.Players[i].Port-1)].(map[string]interface{})
+		names, _ := player["names"].(map[string]interface{})
+		if name, ok := names["netplay"].(string); ok && replay.Players[i].Name == "" {
+			replay.Players[i].Name = name
+		}
+		if code, ok := names["code"].(string); ok && replay.Players[i].Code == "" {
+			replay.Players[i].Code = code
+		}
+	}
+
+	return nil
+}
+
+func playerTypeName(playerType int) string {
+	switch playerType {
+	case 0:
+		return "human"
+	case 1:
+		return "cpu"
+	case 2:
+		return "demo"
+	}
+
+	return "unknown"
+}
+
+func endMethodName(method int) string {
+	switch method {
+	case 1:
+		return "time"
+	case 2:
+		return "game"
+	case 3:
+		return "resolved"
+	case 7:
+		return "no-contest"
+	}
+
+	return "unresolved"
+}
@@ -0,0 +1,131 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testReplay builds a replay with the given payload sizes, events after Game Start and metadata.
+// A raw length of 0 is written like an unfinished recording
+func testReplay(sizes map[byte]uint16, events [][]byte, metadata []byte) []byte {
+	payloads := []byte{}
+	for command, size := range sizes {
+		payloads = append(payloads, command, byte(size>>8), byte(size))
+	}
+
+	raw := []byte{eventPayloads, byte(len(payloads) + 1)}
+	raw = append(raw, payloads...)
+	raw = append(raw, eventGameStart)
+	raw = append(raw, make([]byte, sizes[eventGameStart])...)
+	for _, event := range events {
+		raw = append(raw, event...)
+	}
+
+	replay := append([]byte{}, rawHeader...)
+	length := make([]byte, 4)
+	if metadata != nil {
+		binary.BigEndian.PutUint32(length, uint32(len(raw)))
+	}
+	replay = append(replay, length...)
+	replay = append(replay, raw...)
+	if metadata != nil {
+		replay = append(replay, "U\x08metadata"...)
+		replay = append(replay, metadata...)
+		replay = append(replay, '}')
+	}
+
+	return replay
+}
+
+func writeTestReplay(t *testing.T, contents []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Game.slp")
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseMalformed(t *testing.T) {
+	sizes := map[byte]uint16{eventGameStart: 8, eventGameEnd: 0, eventPostFrame: 4}
+	frame := []byte{eventPostFrame, 0xFF, 0xFF, 0xFF, 0x85}
+
+	tests := []struct {
+		name     string
+		contents []byte
+		wantErr  bool
+	}{
+		{"empty game end", testReplay(sizes, [][]byte{frame, {eventGameEnd}}, nil), false},
+		{"empty game end with metadata", testReplay(sizes, [][]byte{{eventGameEnd}}, []byte("{}")), false},
+		{"truncated frame", testReplay(sizes, [][]byte{frame[:3]}, nil), false},
+		{"unknown event", testReplay(sizes, [][]byte{{0x50}}, nil), true},
+		{"not a replay", []byte("{U\x03abc"), true},
+		{"huge metadata string", testReplay(sizes, nil, []byte("{U\x01aSl\x7f\xff\xff\xff")), true},
+		{"huge metadata key", testReplay(sizes, nil, []byte("{l\x7f\xff\xff\xff")), true},
+		{"huge array of nulls", testReplay(sizes, nil, []byte("{U\x01a[$Z#l\x7f\xff\xff\xff")), true},
+		{"huge object count", testReplay(sizes, nil, []byte("{#l\x7f\xff\xff\xff")), true},
+		{"negative length", testReplay(sizes, nil, []byte("{U\x01aSi\xff")), true},
+		{"truncated metadata", testReplay(sizes, nil, []byte("{U\x07startAtSU\x14 2020")), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(writeTestReplay(t, test.contents))
+			if test.wantErr && err == nil {
+				t.Error("parsing succeeded")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("parsing failed. %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestParseGameEnd(t *testing.T) {
+	sizes := map[byte]uint16{eventGameStart: 8, eventGameEnd: 1}
+	contents := testReplay(sizes, [][]byte{{eventGameEnd, 2}}, []byte("{U\x09lastFramel\x00\x00\x00\x3C"))
+
+	replay, err := Parse(writeTestReplay(t, contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.EndMethod != "game" {
+		t.Errorf("end method is %q, want game", replay.EndMethod)
+	}
+	if !replay.Complete || replay.Frames != 60-FirstFrame+1 {
+		t.Errorf("complete %t with %d frames, want the metadata's last frame", replay.Complete, replay.Frames)
+	}
+}
+
+func TestDecodeUBJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"object", "{U\x01aU\x05U\x01bSU\x02hi}", false},
+		{"counted array", "[$U#U\x03\x01\x02\x03", false},
+		{"string longer than the data", "Sl\x00\x01\x00\x00abc", true},
+		{"count longer than the data", "[$i#l\x00\x10\x00\x00\x01", true},
+		{"unterminated object", "{U\x01aT", true},
+		{"unknown marker", "?", true},
+		{"too deep", string(bytes.Repeat([]byte("["), maxUBJSONDepth+2)), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeUBJSON(bufio.NewReader(bytes.NewReader([]byte(test.data))), int64(len(test.data)))
+			if test.wantErr && err == nil {
+				t.Error("decoding succeeded")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("decoding failed. %s", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package slp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Nested containers deeper than this are rejected, metadata is only a few levels deep
+const maxUBJSONDepth = 32
+
+// ubjsonReader counts the bytes left in the file, such that a length or count can't claim more than
+// there is and make us allocate gigabytes for a few bytes of replay
+type ubjsonReader struct {
+	r    *bufio.Reader
+	left int64
+}
+
+func (u *ubjsonReader) Read(p []byte) (int, error) {
+	if u.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > u.left {
+		p = p[:u.left]
+	}
+
+	n, err := u.r.Read(p)
+	u.left -= int64(n)
+	return n, err
+}
+
+func (u *ubjsonReader) ReadByte() (byte, error) {
+	if u.left <= 0 {
+		return 0, io.EOF
+	}
+
+	c, err := u.r.ReadByte()
+	if err == nil {
+		u.left--
+	}
+	return c, err
+}
+
+func (u *ubjsonReader) Peek(n int) ([]byte, error) {
+	if int64(n) > u.left {
+		return nil, io.EOF
+	}
+	return u.r.Peek(n)
+}
+
+// decodeUBJSON reads one UBJSON value from the next left bytes of r. Objects become
+// map[string]interface{}, arrays []interface{}, numbers int64 or float64
+func decodeUBJSON(r *bufio.Reader, left int64) (interface{}, error) {
+	u := &ubjsonReader{r: r, left: left}
+	marker, err := u.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeUBJSONValue(u, marker, 0)
+}
+
+func decodeUBJSONValue(r *ubjsonReader, marker byte, depth int) (interface{}, error) {
+	if depth > maxUBJSONDepth {
+		return nil, fmt.Errorf("ubjson nested too deep")
+	}
+
+	switch marker {
+	case 'Z':
+		return nil, nil
+	case 'T':
+		return true, nil
+	case 'F':
+		return false, nil
+	case 'i', 'U', 'I', 'l', 'L':
+		return readUBJSONInt(r, marker)
+	case 'd':
+		var bits uint32
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return float64(math.Float32frombits(bits)), err
+	case 'D':
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 'C':
+		c, err := r.ReadByte()
+		return string([]byte{c}), err
+	case 'S', 'H':
+		return readUBJSONString(r)
+	case '{':
+		return decodeUBJSONObject(r, depth)
+	case '[':
+		return decodeUBJSONArray(r, depth)
+	}
+
+	return nil, fmt.Errorf("unknown ubjson marker %q", marker)
+}
+
+func readUBJSONInt(r *ubjsonReader, marker byte) (int64, error) {
+	var err error
+	switch marker {
+	case 'i':
+		var v int8
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), err
+	case 'U':
+		var v uint8
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), err
+	case 'I':
+		var v int16
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), err
+	case 'l':
+		var v int32
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), err
+	case 'L':
+		var v int64
+		err = binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	}
+
+	return 0, fmt.Errorf("ubjson marker %q is not an integer", marker)
+}
+
+// readUBJSONLength reads the length of a string or the count of a container
+func readUBJSONLength(r *ubjsonReader) (int, error) {
+	marker, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	length, err := readUBJSONInt(r, marker)
+	if err != nil {
+		return 0, err
+	}
+	if length < 0 || length > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid ubjson length %d", length)
+	}
+	// Strings take a byte per unit of length and container elements at least one, except for
+	// types without a payload that nothing real has many of
+	if length > r.left {
+		return 0, fmt.Errorf("ubjson length %d is longer than the %d bytes left", length, r.left)
+	}
+
+	return int(length), nil
+}
+
+func readUBJSONString(r *ubjsonReader) (string, error) {
+	length, err := readUBJSONLength(r)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+// readUBJSONContainer reads the optional $type and #count after the opening marker. count is -1
+// when the container ends with a closing marker instead
+func readUBJSONContainer(r *ubjsonReader) (byte, int, error) {
+	next, err := r.Peek(1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var valueType byte
+	if next[0] == '$' {
+		r.ReadByte()
+		valueType, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		next, err = r.Peek(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if next[0] != '#' {
+			return 0, 0, fmt.Errorf("ubjson container type without count")
+		}
+	}
+
+	if next[0] != '#' {
+		return valueType, -1, nil
+	}
+
+	r.ReadByte()
+	count, err := readUBJSONLength(r)
+	return valueType, count, err
+}
+
+func decodeUBJSONObject(r *ubjsonReader, depth int) (interface{}, error) {
+	valueType, count, err := readUBJSONContainer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	object := map[string]interface{}{}
+	for i := 0; count < 0 || i < count; i++ {
+		if count < 0 {
+			next, err := r.Peek(1)
+			if err != nil {
+				return nil, err
+			}
+			if next[0] == '}' {
+				r.ReadByte()
+				break
+			}
+		}
+
+		key, err := readUBJSONString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		marker := valueType
+		if marker == 0 {
+			marker, err = r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		object[key], err = decodeUBJSONValue(r, marker, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return object, nil
+}
+
+func decodeUBJSONArray(r *ubjsonReader, depth int) (interface{}, error) {
+	valueType, count, err := readUBJSONContainer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	array := []interface{}{}
+	for i := 0; count < 0 || i < count; i++ {
+		marker := valueType
+		if marker == 0 {
+			marker, err = r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if count < 0 && marker == ']' {
+				break
+			}
+		}
+
+		value, err := decodeUBJSONValue(r, marker, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+
+	return array, nil
+}
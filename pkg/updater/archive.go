@@ -0,0 +1,502 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+// Entry describes an entry of a release archive independent of the archive format. Names
+// are slash separated. For symlinks the contents are the link target, like in zip files
+type Entry struct {
+	Name string
+	Size uint64
+	Mode os.FileMode
+	// ModTime is zero when the archive doesn't record it
+	ModTime time.Time
+}
+
+func (entry Entry) IsDir() bool {
+	return entry.Mode.IsDir()
+}
+
+func (entry Entry) IsSymlink() bool {
+	return entry.Mode&os.ModeSymlink != 0
+}
+
+// Archive is implemented for every format releases are published in. Entries is known up
+// front such that sizes can be checked before anything is written, Walk then streams the contents
+// in archive order since formats like tar.gz can't be read out of order
+type Archive interface {
+	Entries() []Entry
+	Walk(fn func(entry Entry, contents io.Reader) error) error
+	Close() error
+}
+
+// RandomAccess is implemented by the formats whose entries can be read in any order and several
+// at once, Extract then writes files in parallel
+type RandomAccess interface {
+	Open(entry Entry) (io.ReadCloser, error)
+}
+
+const (
+	FormatUnknown = ""
+	FormatZip     = "zip"
+	FormatTarGz   = "tar.gz"
+	Format7z      = "7z"
+	FormatDmg     = "dmg"
+)
+
+// DetectFormat sniffs the format from the file contents, downloads are always staged under
+// the same name so the extension can't be relied on
+func DetectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 6)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return FormatZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(header, []byte("7z\xbc\xaf\x27\x1c")):
+		return Format7z, nil
+	}
+
+	// Disk images have their signature in a 512 byte trailer at the end of the file
+	info, err := f.Stat()
+	if err != nil || info.Size() < 512 {
+		return FormatUnknown, err
+	}
+
+	trailer := make([]byte, 4)
+	_, err = f.ReadAt(trailer, info.Size()-512)
+	if err == nil && string(trailer) == "koly" {
+		return FormatDmg, nil
+	}
+
+	return FormatUnknown, nil
+}
+
+// OpenArchive opens an archive of any supported format without limits, see OpenArchiveWithLimits
+func OpenArchive(path string) (Archive, error) {
+	return OpenArchiveWithLimits(path, ExtractLimits{})
+}
+
+// OpenArchiveWithLimits opens an archive of any supported format. 7z archives are unpacked and disk
+// images mounted to be read, their sizes are checked against limits before that happens. The other
+// formats are read as they are extracted, which is where Extract checks them
+func OpenArchiveWithLimits(path string, limits ExtractLimits) (Archive, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	debugf("Opening %s as %s", path, format)
+
+	switch format {
+	case FormatZip:
+		return openZipArchive(path)
+	case FormatTarGz:
+		return openTarGzArchive(path)
+	case Format7z:
+		return open7zArchive(path, limits)
+	case FormatDmg:
+		return openDmgArchive(path, limits)
+	}
+
+	return nil, fmt.Errorf("%s is not a supported archive", filepath.Base(path))
+}
+
+type zipArchive struct {
+	reader *zip.ReadCloser
+	files  map[string]*zip.File
+}
+
+func openZipArchive(path string) (*zipArchive, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+
+	return &zipArchive{reader: reader, files: files}, nil
+}
+
+func (a *zipArchive) Entries() []Entry {
+	entries := []Entry{}
+	for _, file := range a.reader.File {
+		entries = append(entries, zipEntry(file))
+	}
+
+	return entries
+}
+
+func zipEntry(file *zip.File) Entry {
+	return Entry{Name: file.Name, Size: file.UncompressedSize64, Mode: file.Mode(), ModTime: file.Modified}
+}
+
+func (a *zipArchive) Walk(fn func(entry Entry, contents io.Reader) error) error {
+	for _, file := range a.reader.File {
+		entry := zipEntry(file)
+		if entry.IsDir() {
+			err := fn(entry, bytes.NewReader(nil))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = fn(entry, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Open reads an entry on its own, zip entries each have their own offset in the file
+func (a *zipArchive) Open(entry Entry) (io.ReadCloser, error) {
+	file, ok := a.files[entry.Name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the archive", entry.Name)
+	}
+
+	return file.Open()
+}
+
+func (a *zipArchive) Close() error {
+	return a.reader.Close()
+}
+
+type tarGzArchive struct {
+	path    string
+	entries []Entry
+}
+
+// openTarGzArchive reads through the archive once to list its entries
+func openTarGzArchive(path string) (*tarGzArchive, error) {
+	a := &tarGzArchive{path: path}
+	err := a.Walk(func(entry Entry, contents io.Reader) error {
+		a.entries = append(a.entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *tarGzArchive) Entries() []Entry {
+	return a.entries
+}
+
+func (a *tarGzArchive) Walk(fn func(entry Entry, contents io.Reader) error) error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := Entry{
+			Name:    strings.TrimPrefix(header.Name, "./"),
+			Size:    uint64(header.Size),
+			Mode:    header.FileInfo().Mode(),
+			ModTime: header.ModTime,
+		}
+		if entry.Name == "" {
+			continue
+		}
+
+		var contents io.Reader = reader
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if !strings.HasSuffix(entry.Name, "/") {
+				entry.Name += "/"
+			}
+		case tar.TypeSymlink:
+			contents = strings.NewReader(header.Linkname)
+			entry.Size = uint64(len(header.Linkname))
+		case tar.TypeReg:
+		default:
+			// Hard links, devices and the like never appear in release archives
+			continue
+		}
+
+		err = fn(entry, contents)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *tarGzArchive) Close() error {
+	return nil
+}
+
+// dirArchive exposes a directory as an archive. Formats Go can't read are unpacked or mounted with
+// the platform tools and then read through this
+type dirArchive struct {
+	dir     string
+	entries []Entry
+	cleanup func() error
+}
+
+func openDirArchive(dir string, cleanup func() error) (*dirArchive, error) {
+	a := &dirArchive{dir: dir, cleanup: cleanup}
+	err := a.Walk(func(entry Entry, contents io.Reader) error {
+		a.entries = append(a.entries, entry)
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *dirArchive) Entries() []Entry {
+	return a.entries
+}
+
+func (a *dirArchive) Walk(fn func(entry Entry, contents io.Reader) error) error {
+	return filepath.Walk(a.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(a.dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		entry := Entry{Name: filepath.ToSlash(rel), Size: uint64(info.Size()), Mode: info.Mode(), ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Name += "/"
+			return fn(entry, bytes.NewReader(nil))
+		case entry.IsSymlink():
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.Size = uint64(len(target))
+			return fn(entry, strings.NewReader(target))
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return fn(entry, f)
+	})
+}
+
+func (a *dirArchive) Open(entry Entry) (io.ReadCloser, error) {
+	path := filepath.Join(a.dir, filepath.FromSlash(entry.Name))
+	if entry.IsSymlink() {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader(target)), nil
+	}
+
+	return os.Open(path)
+}
+
+func (a *dirArchive) Close() error {
+	return a.cleanup()
+}
+
+// check fails if an entry or all of them together are over the limits
+func (limits ExtractLimits) check(entries []Entry) error {
+	var totalSize uint64
+	for _, entry := range entries {
+		if limits.MaxFileBytes > 0 && entry.Size > limits.MaxFileBytes {
+			return fmt.Errorf("%s is too large to extract (%d bytes)", entry.Name, entry.Size)
+		}
+
+		totalSize += entry.Size
+		if limits.MaxTotalBytes > 0 && totalSize > limits.MaxTotalBytes {
+			return fmt.Errorf("archive is too large to extract (over %d bytes)", limits.MaxTotalBytes)
+		}
+	}
+
+	return nil
+}
+
+// parse7zList reads the entries of the technical listing printed by 7z l -slt. The archive itself
+// is described before the ---------- line, then each entry is a block of "Key = Value" lines
+func parse7zList(output string) []Entry {
+	entries := []Entry{}
+	started := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "----------" {
+			started = true
+			continue
+		}
+
+		parts := strings.SplitN(line, " = ", 2)
+		if !started || len(parts) != 2 {
+			continue
+		}
+		if parts[0] == "Path" {
+			entries = append(entries, Entry{Name: filepath.ToSlash(parts[1])})
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		entry := &entries[len(entries)-1]
+		switch parts[0] {
+		case "Size":
+			entry.Size, _ = strconv.ParseUint(parts[1], 10, 64)
+		case "Folder":
+			if parts[1] == "+" {
+				entry.Mode |= os.ModeDir
+			}
+		}
+	}
+
+	return entries
+}
+
+// open7zArchive unpacks the archive next to it with the 7-Zip command line tool. The sizes in its
+// headers are checked first, unpacking is what would fill the disk
+func open7zArchive(path string, limits ExtractLimits) (*dirArchive, error) {
+	tool := ""
+	for _, name := range []string{"7z", "7za", "7zz"} {
+		if found, err := exec.LookPath(name); err == nil {
+			tool = found
+			break
+		}
+	}
+	if tool == "" {
+		return nil, fmt.Errorf("7-Zip is required to extract %s but was not found", filepath.Base(path))
+	}
+
+	output, err := exec.Command(tool, "l", "-slt", path).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("7-Zip failed to list %s. %s", filepath.Base(path), strings.TrimSpace(string(output)))
+	}
+	err = limits.check(parse7zList(string(output)))
+	if err != nil {
+		return nil, err
+	}
+
+	// 7-Zip understands the long form too, the archive's files may be nested deeper than MAX_PATH
+	dir, err := ioutil.TempDir(fsutil.LongPath(filepath.Dir(path)), "7z")
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = exec.Command(tool, "x", "-y", "-o"+dir, path).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("7-Zip failed to extract %s. %s", filepath.Base(path), strings.TrimSpace(string(output)))
+	}
+
+	return openDirArchive(dir, func() error { return os.RemoveAll(dir) })
+}
+
+// dmgTotalBytes reads the size of the disk image's contents from hdiutil imageinfo, a compressed
+// image can be much larger than its file
+func dmgTotalBytes(path string) (uint64, error) {
+	output, err := exec.Command("hdiutil", "imageinfo", path).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s. %s", filepath.Base(path), strings.TrimSpace(string(output)))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) == 2 && parts[0] == "Total Bytes" {
+			return strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("hdiutil did not tell the size of %s", filepath.Base(path))
+}
+
+// openDmgArchive mounts the disk image read-only with hdiutil, only available on macOS. The size
+// of its contents is checked before mounting
+func openDmgArchive(path string, limits ExtractLimits) (*dirArchive, error) {
+	if limits.MaxTotalBytes > 0 {
+		size, err := dmgTotalBytes(path)
+		if err != nil {
+			return nil, err
+		}
+		if size > limits.MaxTotalBytes {
+			return nil, fmt.Errorf("archive is too large to extract (over %d bytes)", limits.MaxTotalBytes)
+		}
+	}
+
+	mountPoint, err := ioutil.TempDir(filepath.Dir(path), "dmg")
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := exec.Command("hdiutil", "attach", path, "-readonly", "-nobrowse", "-noautoopen", "-mountpoint", mountPoint).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(mountPoint)
+		return nil, fmt.Errorf("failed to mount %s. %s", filepath.Base(path), strings.TrimSpace(string(output)))
+	}
+
+	return openDirArchive(mountPoint, func() error {
+		err := exec.Command("hdiutil", "detach", mountPoint, "-force").Run()
+		os.Remove(mountPoint)
+		return err
+	})
+}
@@ -0,0 +1,68 @@
+package updater
+
+import "testing"
+
+// test7zList is what 7z l -slt prints, the archive's own Path comes before the ---------- line
+const test7zList = `
+7-Zip [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21
+
+Listing archive: release.7z
+
+--
+Path = release.7z
+Type = 7z
+Physical Size = 1024
+
+----------
+Path = Sys
+Size = 0
+Folder = +
+
+Path = Sys\GameSettings\GALE01.ini
+Size = 120
+Folder = -
+
+Path = Slippi Dolphin.exe
+Size = 4096
+Folder = -
+`
+
+func TestParse7zList(t *testing.T) {
+	entries := parse7zList(test7zList)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if !entries[0].IsDir() || entries[1].IsDir() {
+		t.Error("folders weren't told apart from files")
+	}
+	if entries[2].Name != "Slippi Dolphin.exe" || entries[2].Size != 4096 {
+		t.Errorf("got %+v, want the exe with its size", entries[2])
+	}
+}
+
+func TestExtractLimitsCheck(t *testing.T) {
+	entries := parse7zList(test7zList)
+
+	tests := []struct {
+		name   string
+		limits ExtractLimits
+		ok     bool
+	}{
+		{"no limits", ExtractLimits{}, true},
+		{"within", ExtractLimits{MaxFileBytes: 4096, MaxTotalBytes: 4216}, true},
+		{"file too large", ExtractLimits{MaxFileBytes: 4095}, false},
+		{"total too large", ExtractLimits{MaxTotalBytes: 4215}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.limits.check(entries)
+			if test.ok && err != nil {
+				t.Error(err)
+			}
+			if !test.ok && err == nil {
+				t.Error("the archive passed")
+			}
+		})
+	}
+}
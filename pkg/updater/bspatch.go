@@ -0,0 +1,89 @@
+package updater
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"io"
+)
+
+// Bspatch applies a patch in the BSDIFF40 format produced by bsdiff to old and returns the result.
+// Format reference: http://www.daemonology.net/bsdiff/
+func Bspatch(old, patch []byte) ([]byte, error) {
+	errCorrupt := errors.New("corrupt patch")
+
+	if len(patch) < 32 || string(patch[:8]) != "BSDIFF40" {
+		return nil, errCorrupt
+	}
+
+	ctrlLen := offtin(patch[8:16])
+	diffLen := offtin(patch[16:24])
+	newSize := offtin(patch[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || 32+ctrlLen+diffLen > int64(len(patch)) {
+		return nil, errCorrupt
+	}
+
+	ctrlReader := bzip2.NewReader(bytes.NewReader(patch[32 : 32+ctrlLen]))
+	diffReader := bzip2.NewReader(bytes.NewReader(patch[32+ctrlLen : 32+ctrlLen+diffLen]))
+	extraReader := bzip2.NewReader(bytes.NewReader(patch[32+ctrlLen+diffLen:]))
+
+	result := make([]byte, newSize)
+	ctrl := make([]byte, 24)
+	var oldPos, newPos int64
+	for newPos < newSize {
+		_, err := io.ReadFull(ctrlReader, ctrl)
+		if err != nil {
+			return nil, errCorrupt
+		}
+		addLen := offtin(ctrl[0:8])
+		copyLen := offtin(ctrl[8:16])
+		seek := offtin(ctrl[16:24])
+
+		// Add diff bytes to the old data
+		if addLen < 0 || newPos+addLen > newSize {
+			return nil, errCorrupt
+		}
+		_, err = io.ReadFull(diffReader, result[newPos:newPos+addLen])
+		if err != nil {
+			return nil, errCorrupt
+		}
+		for i := int64(0); i < addLen; i++ {
+			if oldPos+i >= 0 && oldPos+i < int64(len(old)) {
+				result[newPos+i] += old[oldPos+i]
+			}
+		}
+		newPos += addLen
+		oldPos += addLen
+
+		// Copy the extra bytes as they are
+		if copyLen < 0 || newPos+copyLen > newSize {
+			return nil, errCorrupt
+		}
+		_, err = io.ReadFull(extraReader, result[newPos:newPos+copyLen])
+		if err != nil {
+			return nil, errCorrupt
+		}
+		newPos += copyLen
+		oldPos += seek
+	}
+
+	return result, nil
+}
+
+// offtin decodes bsdiff's sign-magnitude little endian 64 bit integers
+func offtin(buf []byte) int64 {
+	var y int64
+	for i := 7; i >= 0; i-- {
+		b := buf[i]
+		if i == 7 {
+			b &= 0x7f
+		}
+		y = y*256 + int64(b)
+	}
+
+	if buf[7]&0x80 != 0 {
+		y = -y
+	}
+
+	return y
+}
@@ -0,0 +1,283 @@
+// Package updater downloads, verifies and extracts Dolphin releases
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// Downloader downloads release files with retries, resuming, mirror fail over and optionally
+// several connections per file
+type Downloader struct {
+	// Client should only bound the wait for the response, downloads can legitimately take long
+	Client *http.Client
+	// Connections a download is split over when the server supports ranges, 1 to disable
+	Connections int
+	// Retries is the number of rounds through the urls before giving up
+	Retries int
+	// MinBytesPerSecond is the average speed below which we fail over to the next url, 0 to
+	// disable
+	MinBytesPerSecond float64
+	// LimitBytesPerSecond caps the speed of a download over all of its connections, 0 for no
+	// limit
+	LimitBytesPerSecond int64
+	Progress            Reporter
+	// Cache is the address of a LAN cache, see CacheURL. It is tried before the urls
+	Cache string
+}
+
+// CacheURL is where a LAN cache at cache serves the file at url, downloading it on the first
+// request
+func CacheURL(cache, url string) string {
+	return strings.TrimSuffix(cache, "/") + "/fetch?url=" + neturl.QueryEscape(url)
+}
+
+// WithMirrors returns the primary url followed by its mirrors, skipping empty ones
+func WithMirrors(url string, mirrors []string) []string {
+	urls := []string{}
+	for _, u := range append([]string{url}, mirrors...) {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls
+}
+
+// Download downloads a file with retries, checking the result with validate and the expected hash
+// (if there is one) before accepting it. Each attempt goes through the urls in order, failing over
+// to the next mirror when a host errors or is too slow. Cancelling ctx stops the download, the
+// partial file is kept such that the next attempt can resume it
+func (d Downloader) Download(ctx context.Context, path string, urls []string, expectedHash string, validate func(string) error) error {
+	if len(urls) == 0 {
+		return errors.New("no download url available")
+	}
+	path = fsutil.LongPath(path)
+
+	cacheURL := ""
+	if d.Cache != "" {
+		cacheURL = CacheURL(d.Cache, urls[0])
+		urls = append([]string{cacheURL}, urls...)
+	}
+
+	// Hosts that answered with an error retrying won't fix, such as a 404, are not tried again
+	failed := map[string]bool{}
+
+	var err error
+	for attempt := 0; attempt < len(urls)*d.Retries || attempt == 0; attempt++ {
+		urlIdx := attempt % len(urls)
+		if len(failed) == len(urls) {
+			break
+		}
+		if failed[urls[urlIdx]] {
+			continue
+		}
+
+		round := attempt / len(urls)
+		if attempt > 0 && urlIdx == 0 {
+			delay := slippiapi.RetryDelay(round - 1)
+			log.Printf("Download failed, trying again in %s. %s\n", delay.Round(time.Second), err.Error())
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else if attempt > 0 {
+			log.Printf("Download failed, trying the next mirror. %s\n", err.Error())
+		}
+
+		// Only give up on a slow host if there is another one to fail over to. The cache is as fast
+		// as its own download of the file, failing over would download it a second time
+		var guard *speedGuard
+		if urlIdx < len(urls)-1 && urls[urlIdx] != cacheURL {
+			minSpeed := d.MinBytesPerSecond
+			// Leave room below the rate limit, otherwise every mirror would look too slow
+			if limit := float64(d.LimitBytesPerSecond); limit > 0 && minSpeed > limit/2 {
+				minSpeed = limit / 2
+			}
+			guard = newSpeedGuard(minSpeed)
+		}
+
+		err = d.downloadFrom(ctx, path, urls[urlIdx], guard)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if !slippiapi.IsRetryable(err) {
+				failed[urls[urlIdx]] = true
+			}
+			continue
+		}
+
+		// Bad downloads are deleted such that the next attempt doesn't resume from them
+		err = validate(path)
+		if err != nil {
+			os.Remove(path)
+			continue
+		}
+
+		if expectedHash != "" {
+			err = VerifyFileHash(path, expectedHash)
+			if err != nil {
+				err = fmt.Errorf("download failed checksum verification. %s", err.Error())
+				os.Remove(path)
+				continue
+			}
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+// downloadFile downloads a url to a local file. It's efficient because it will write as it
+// downloads and not load the whole file into memory. Data is written to a .part file first, if
+// one is left over from an interrupted attempt we resume from where it stopped.
+// Based on: https://golangcode.com/download-a-file-from-a-url/
+func (d Downloader) downloadFile(ctx context.Context, filepath string, url string, wrap func(io.Reader) io.Reader) error {
+	partPath := filepath + ".part"
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Get the data
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		log.Printf("Resuming download from byte %d\n", offset)
+		flags |= os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The previous attempt already got the whole file
+		return os.Rename(partPath, filepath)
+	case resp.StatusCode == http.StatusOK:
+		// Server doesn't support ranges (or nothing to resume), start over
+		flags |= os.O_TRUNC
+	default:
+		return &slippiapi.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// Create the file
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Write the body to file
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = resp.ContentLength
+	}
+	if flags&os.O_APPEND == 0 {
+		offset = 0
+	} else if total >= 0 {
+		total += offset
+	}
+	reader := &progressReader{reader: wrap(resp.Body), tracker: newDownloadTracker(d.Progress, offset, total)}
+	_, err = io.Copy(out, reader)
+	out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(partPath, filepath)
+}
+
+func (d Downloader) client() *http.Client {
+	if d.Client == nil {
+		return http.DefaultClient
+	}
+
+	return d.Client
+}
+
+// VerifyFileHash compares the SHA256 of a file against the expected hex encoded hash
+func VerifyFileHash(path, expected string) error {
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("hash mismatch for %s, expected %s but got %s", filepath.Base(path), expected, actual)
+	}
+
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ValidateFileMagic checks that a downloaded file is non-empty and starts with the expected bytes
+func ValidateFileMagic(path string, magic []byte, errMsg string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(magic))
+	_, err = io.ReadFull(f, header)
+	if err != nil || !bytes.Equal(header, magic) {
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+// ValidateArchive checks that the downloaded file is an archive in a format we can extract
+func ValidateArchive(path string) error {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return err
+	}
+	if format == FormatUnknown {
+		return errors.New("download did not return a valid archive")
+	}
+
+	return nil
+}
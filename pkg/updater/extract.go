@@ -0,0 +1,567 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+// ExtractLimits protect against archives that would fill the disk, 0 means no limit
+type ExtractLimits struct {
+	MaxFileBytes  uint64
+	MaxTotalBytes uint64
+}
+
+type ExtractOptions struct {
+	Limits ExtractLimits
+	// IsDolphinExe finds the folder holding the build, only the files next to Dolphin are
+	// extracted
+	IsDolphinExe func(name string) bool
+	// Root, when set, is the folder of the archive to extract instead of the one holding Dolphin,
+	// such as the folder a macOS bundle is in
+	Root     string
+	Progress Reporter
+	// Workers is the number of files written at once for formats that can be read out of order,
+	// 1 or less to write them one at a time
+	Workers int
+}
+
+// UpdatedFile is a file written by an update, recorded such that it can be verified or restored
+type UpdatedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Windows errors for a file an antivirus flagged while it was being written
+const (
+	errorVirusInfected = syscall.Errno(225)
+	errorVirusDeleted  = syscall.Errno(226)
+)
+
+// Link targets are paths, anything longer isn't one
+const maxSymlinkTarget = 4096
+
+// IsSafeRelPath rejects paths that would escape the folder they are joined onto, such as ../x, /x
+// or C:x
+func IsSafeRelPath(path string) bool {
+	native := filepath.FromSlash(path)
+	clean := filepath.ToSlash(filepath.Clean(native))
+	return path != "" && !filepath.IsAbs(native) && filepath.VolumeName(native) == "" && !strings.HasPrefix(clean, "/") &&
+		clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// IsBlockedByAntivirus tells whether Windows refused a file because an antivirus flagged it
+func IsBlockedByAntivirus(err error) bool {
+	var errno syscall.Errno
+	return runtime.GOOS == "windows" && errors.As(err, &errno) && (errno == errorVirusInfected || errno == errorVirusDeleted)
+}
+
+// Extract extracts the Dolphin build in source into target. genTargetFile maps the path of each
+// file relative to Dolphin to where it goes in target, or skips it by returning an empty string.
+// Cancelling ctx stops before the next file, what was already extracted is left in target
+func Extract(ctx context.Context, target, source string, genTargetFile func(string) string, opts ExtractOptions) ([]UpdatedFile, error) {
+	limits := opts.Limits
+	// Deep installs and long file names can go over MAX_PATH on Windows
+	target = fsutil.LongPath(target)
+	progress := orNop(opts.Progress)
+
+	archive, err := OpenArchiveWithLimits(source, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files := []UpdatedFile{}
+
+	// First find Dolphin.exe, unless we were told which folder to extract
+	dolphinPath := strings.TrimSuffix(opts.Root, "/")
+	for _, entry := range archive.Entries() {
+		if dolphinPath != "" {
+			break
+		}
+
+		filePathName := entry.Name
+		baseFile := filepath.Base(filePathName)
+
+		if opts.IsDolphinExe(baseFile) {
+			dolphinPath = filepath.Dir(filePathName)
+		}
+	}
+
+	// Everything below the folder holding Dolphin. filepath.Match can't be used for this, * only
+	// crosses slashes on Windows where they aren't the separator
+	dolphinPrefix := ""
+	if dolphinPath != "" && dolphinPath != "." {
+		dolphinPrefix = filepath.ToSlash(dolphinPath) + "/"
+	}
+
+	// Iterate through all files, deciding whether to extract
+	targetRelPaths := map[string]string{}
+	fileCount := 0
+	var totalSize uint64
+	for _, entry := range archive.Entries() {
+		// An entry like ../../x or /etc/x would be written outside of target
+		if !IsSafeRelPath(entry.Name) {
+			return files, fmt.Errorf("archive contains invalid path %s", entry.Name)
+		}
+		if !strings.HasPrefix(entry.Name, dolphinPrefix) || entry.Name == dolphinPrefix {
+			continue
+		}
+
+		relPath, err := filepath.Rel(dolphinPath, entry.Name)
+		if err != nil {
+			continue
+		}
+
+		targetRelPath := genTargetFile(relPath)
+		if targetRelPath == "" {
+			continue
+		}
+		if !IsSafeRelPath(targetRelPath) {
+			return files, fmt.Errorf("archive contains invalid path %s", entry.Name)
+		}
+
+		// Check sizes up front such that a bad archive can't fill the disk
+		size := entry.Size
+		if limits.MaxFileBytes > 0 && size > limits.MaxFileBytes {
+			return files, fmt.Errorf("%s is too large to extract (%d bytes)", entry.Name, size)
+		}
+
+		totalSize += size
+		if limits.MaxTotalBytes > 0 && totalSize > limits.MaxTotalBytes {
+			return files, fmt.Errorf("archive is too large to extract (over %d bytes)", limits.MaxTotalBytes)
+		}
+
+		targetRelPaths[entry.Name] = targetRelPath
+		if !entry.IsDir() {
+			fileCount++
+		}
+	}
+
+	var mu sync.Mutex
+	var written int64
+	start := time.Now()
+	links := []pendingLink{}
+
+	// record adds a written file to the list and reports it. Workers call it with mu held
+	record := func(entry Entry, targetRelPath string, hash []byte, n int64) {
+		files = append(files, UpdatedFile{
+			Path:   filepath.ToSlash(targetRelPath),
+			Size:   int64(entry.Size),
+			SHA256: hex.EncodeToString(hash),
+		})
+		written += n
+
+		event := Event{
+			Type:    "extract",
+			File:    filepath.ToSlash(targetRelPath),
+			Current: int64(len(files)),
+			Total:   int64(fileCount),
+		}
+		if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+			event.BytesPerSecond = float64(written) / elapsed
+		}
+		progress.Report(event)
+	}
+
+	// writeEntry writes one file, it is called from several workers at once when the archive can
+	// be read out of order. Links are only kept for later, such that no file is written through one
+	writeEntry := func(ctx context.Context, entry Entry, contents io.Reader) error {
+		targetRelPath := targetRelPaths[entry.Name]
+		path := filepath.Join(target, targetRelPath)
+
+		if entry.IsSymlink() {
+			linkTarget, err := ioutil.ReadAll(io.LimitReader(contents, maxSymlinkTarget))
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			links = append(links, pendingLink{entry: entry, targetRelPath: targetRelPath, linkTarget: string(linkTarget)})
+			return nil
+		}
+
+		// Not every archive lists the folders before their files
+		err := checkNoSymlinks(target, filepath.Dir(targetRelPath))
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+		}
+		if err == nil {
+			err = checkNoSymlinks(target, targetRelPath)
+		}
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		n, err := writeFile(ctx, path, entry, contents, hash)
+		if err != nil {
+			return err
+		}
+
+		// Release zips made on Windows carry no unix permissions, Dolphin has to be runnable anyway
+		perm := entry.Mode.Perm()
+		if opts.IsDolphinExe(filepath.Base(path)) {
+			perm |= 0111
+		}
+		err = restoreMetadata(path, entry, perm)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		record(entry, targetRelPath, hash.Sum(nil), n)
+
+		return nil
+	}
+
+	randomAccess, ok := archive.(RandomAccess)
+	if ok && opts.Workers > 1 {
+		err = extractParallel(ctx, archive, randomAccess, target, targetRelPaths, opts.Workers, writeEntry)
+	} else {
+		err = archive.Walk(func(entry Entry, contents io.Reader) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			targetRelPath, ok := targetRelPaths[entry.Name]
+			if !ok {
+				return nil
+			}
+			if entry.IsDir() {
+				return os.MkdirAll(filepath.Join(target, targetRelPath), 0755)
+			}
+
+			return writeEntry(ctx, entry, contents)
+		})
+	}
+	if err == nil {
+		err = writeSymlinks(target, links, record)
+	}
+	if err == nil {
+		err = restoreDirMetadata(archive, target, targetRelPaths)
+	}
+
+	// Workers finish in any order, sorted the list doesn't change from one update to the next
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	if elapsed := time.Since(start); err == nil && len(files) > 0 {
+		debugf("Extracted %d files (%s) in %s, %s/s", len(files), FormatBytes(written), elapsed.Round(time.Millisecond), FormatBytes(int64(float64(written)/elapsed.Seconds())))
+	}
+
+	return files, err
+}
+
+// extractParallel writes the entries with a pool of workers reading from the archive at the same
+// time, which mostly helps with the many small files in Sys. Folders are created up front such
+// that workers don't race to create them. The first error stops the other workers
+func extractParallel(ctx context.Context, archive Archive, randomAccess RandomAccess, target string, targetRelPaths map[string]string, workers int, writeEntry func(context.Context, Entry, io.Reader) error) error {
+	entries := []Entry{}
+	for _, entry := range archive.Entries() {
+		targetRelPath, ok := targetRelPaths[entry.Name]
+		if !ok {
+			continue
+		}
+
+		if entry.IsDir() {
+			err := os.MkdirAll(filepath.Join(target, targetRelPath), 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	jobs := make(chan Entry)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for entry := range jobs {
+				err := extractEntry(ctx, randomAccess, entry, writeEntry)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+queue:
+	for _, entry := range entries {
+		select {
+		case jobs <- entry:
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func extractEntry(ctx context.Context, randomAccess RandomAccess, entry Entry, writeEntry func(context.Context, Entry, io.Reader) error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	contents, err := randomAccess.Open(entry)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	return writeEntry(ctx, entry, contents)
+}
+
+// writeFile streams a regular file into path. Windows can briefly hold a file we are replacing,
+// waiting won't make an antivirus change its mind though
+func writeFile(ctx context.Context, path string, entry Entry, contents io.Reader, hash io.Writer) (int64, error) {
+	policy := fsutil.FileRetryPolicy
+	policy.Retryable = func(err error) bool { return !IsBlockedByAntivirus(err) }
+
+	var targetFile *os.File
+	err := policy.Do(ctx, func() error {
+		var err error
+		targetFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+		return err
+	}, func(err error, delay time.Duration) {
+		log.Printf("Failed to open %s for writing, trying again in %s. %s\n", path, delay, err.Error())
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The contents are streamed so a failed copy can't be retried. A partial file is removed
+	// such that it can't be mistaken for the real one
+	n, err := io.Copy(io.MultiWriter(targetFile, hash), contents)
+	closeErr := targetFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return n, fmt.Errorf("failed to write %s. %w", path, err)
+	}
+
+	return n, nil
+}
+
+// pendingLink is a link of the archive, created once every regular file is written
+type pendingLink struct {
+	entry         Entry
+	targetRelPath string
+	linkTarget    string
+}
+
+// Links pointing at links are followed this many times at most, like the OS does
+const maxLinkHops = 40
+
+// checkNoSymlinks fails if any part of relPath is a link that already exists in target, writing
+// there would follow it to wherever it points
+func checkNoSymlinks(target, relPath string) error {
+	current := target
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through the link %s", current)
+		}
+	}
+
+	return nil
+}
+
+// isAbsLink tells whether the link target is absolute on any platform, those always lead out of
+// the install
+func isAbsLink(linkTarget string) bool {
+	native := filepath.FromSlash(linkTarget)
+	return linkTarget == "" || filepath.IsAbs(native) || filepath.VolumeName(native) != "" || strings.HasPrefix(filepath.ToSlash(linkTarget), "/")
+}
+
+// resolveInRoot follows relPath inside root the way the OS would, links included, and fails as
+// soon as it leaves root. Parts that don't exist yet are taken as they are
+func resolveInRoot(root, relPath string, hops int) (string, error) {
+	resolved := []string{}
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, part := range parts {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", fmt.Errorf("%s points outside of the folder", relPath)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, part)
+		current := filepath.Join(root, filepath.FromSlash(strings.Join(resolved, "/")))
+		info, err := os.Lstat(current)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		if hops >= maxLinkHops {
+			return "", fmt.Errorf("%s has too many levels of links", relPath)
+		}
+		linkTarget, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		if isAbsLink(linkTarget) {
+			return "", fmt.Errorf("%s points outside of the folder", current)
+		}
+
+		// The rest is taken relative to where the link points, without cleaning it since .. after
+		// a link goes up from its target
+		rest := append(append([]string{}, resolved[:len(resolved)-1]...), filepath.ToSlash(linkTarget))
+		rest = append(rest, parts[i+1:]...)
+		return resolveInRoot(root, strings.Join(rest, "/"), hops+1)
+	}
+
+	return strings.Join(resolved, "/"), nil
+}
+
+// writeSymlinks creates the links of the archive once every regular file is written, replacing
+// whatever is at their path. A link that is absolute or leads out of target, also through other
+// links, fails the extraction and all of them are removed again. The link target is what gets
+// hashed, like VerifyInstall does for links
+func writeSymlinks(target string, links []pendingLink, record func(Entry, string, []byte, int64)) error {
+	created := []string{}
+	removeCreated := func() {
+		for _, path := range created {
+			os.Remove(path)
+		}
+	}
+
+	for _, link := range links {
+		if isAbsLink(link.linkTarget) {
+			removeCreated()
+			return fmt.Errorf("link %s points outside of the install (%s)", link.targetRelPath, link.linkTarget)
+		}
+
+		path := filepath.Join(target, link.targetRelPath)
+		err := checkNoSymlinks(target, filepath.Dir(link.targetRelPath))
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+		}
+		if err == nil {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err == nil {
+			err = os.Symlink(link.linkTarget, path)
+		}
+		if err != nil {
+			removeCreated()
+			return err
+		}
+		created = append(created, path)
+	}
+
+	// Checked once all of them exist, a link made later can change where an earlier one leads
+	for _, link := range links {
+		_, err := resolveInRoot(target, link.targetRelPath, 0)
+		if err != nil {
+			removeCreated()
+			return fmt.Errorf("link %s points outside of the install. %w", link.targetRelPath, err)
+		}
+	}
+
+	for _, link := range links {
+		hash := sha256.Sum256([]byte(link.linkTarget))
+		record(link.entry, link.targetRelPath, hash[:], int64(len(link.linkTarget)))
+	}
+
+	return nil
+}
+
+// restoreMetadata gives a written file the permissions and modification time it has in the
+// archive. Windows only knows the read-only attribute, which would get in the way of the next
+// update, so permissions are left alone there. Links get neither, Go can't change them without
+// following the link
+func restoreMetadata(path string, entry Entry, perm os.FileMode) error {
+	if entry.IsSymlink() {
+		return nil
+	}
+
+	if runtime.GOOS != "windows" && perm != 0 {
+		err := os.Chmod(path, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.ModTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, entry.ModTime, entry.ModTime)
+}
+
+// restoreDirMetadata applies the folder permissions and times once every file is written, writing
+// a file changes its folder's modification time and a read-only folder couldn't be written to
+func restoreDirMetadata(archive Archive, target string, targetRelPaths map[string]string) error {
+	for _, entry := range archive.Entries() {
+		if _, ok := targetRelPaths[entry.Name]; !ok || !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(target, targetRelPaths[entry.Name])
+		// Keep the owner able to write such that later updates and the swap can change it
+		err := restoreMetadata(path, entry, entry.Mode.Perm()|0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
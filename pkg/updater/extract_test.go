@@ -0,0 +1,288 @@
+package updater
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+func isTestDolphinExe(name string) bool {
+	return name == "Dolphin.exe"
+}
+
+func identityTarget(relPath string) string {
+	return relPath
+}
+
+func writeTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	return writeTestZipWithLinks(t, files, nil)
+}
+
+// writeTestZipWithLinks also stores links, with their target as contents like zip does
+func writeTestZipWithLinks(t *testing.T, files map[string]string, links map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "release.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	for name, contents := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, linkTarget := range links {
+		header := &zip.FileHeader{Name: name}
+		header.SetMode(os.ModeSymlink | 0777)
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(linkTarget)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestExtractRejectsEscapingPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"parent", "../../evil.txt"},
+		{"nested parent", "Sys/../../evil.txt"},
+		{"absolute", "/tmp/evil.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := writeTestZip(t, map[string]string{"Dolphin.exe": "exe", test.entry: "evil"})
+			target := filepath.Join(t.TempDir(), "install", "staging")
+
+			_, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe})
+			if err == nil {
+				t.Fatalf("extracting %s succeeded", test.entry)
+			}
+			if _, err := os.Stat(filepath.Join(target, "..", "..", "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("%s was written outside the target", test.entry)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsEscapingTargets(t *testing.T) {
+	source := writeTestZip(t, map[string]string{"Dolphin.exe": "exe", "Sys/file.txt": "data"})
+	target := t.TempDir()
+
+	_, err := Extract(context.Background(), target, source, func(relPath string) string {
+		return "../" + relPath
+	}, ExtractOptions{IsDolphinExe: isTestDolphinExe})
+	if err == nil {
+		t.Fatal("extracting to ../ succeeded")
+	}
+}
+
+func TestIsSafeRelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		safe bool
+	}{
+		{"Sys/GameSettings/GALE01.ini", true},
+		{"Dolphin.exe", true},
+		{"Sys/", true},
+		{"a/../b", true},
+		{"", false},
+		{"..", false},
+		{"../x", false},
+		{"a/../../x", false},
+		{"/etc/x", false},
+	}
+
+	for _, test := range tests {
+		if got := IsSafeRelPath(test.path); got != test.safe {
+			t.Errorf("IsSafeRelPath(%q) = %t, want %t", test.path, got, test.safe)
+		}
+	}
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating links needs extra privileges on Windows")
+	}
+
+	tests := []struct {
+		name  string
+		links map[string]string
+		ok    bool
+	}{
+		{"relative", map[string]string{"libfoo.so": "libfoo.so.1"}, true},
+		{"up and back in", map[string]string{"Sys/exe": "../Dolphin.exe"}, true},
+		{"absolute", map[string]string{"passwd": "/etc/passwd"}, false},
+		{"escaping", map[string]string{"Sys/out": "../../../outside"}, false},
+		{"escaping through another link", map[string]string{"a": ".", "b": "a/../outside"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := writeTestZipWithLinks(t, map[string]string{"Dolphin.exe": "exe", "libfoo.so.1": "lib", "Sys/file.txt": "data"}, test.links)
+			target := filepath.Join(t.TempDir(), "staging")
+
+			files, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe})
+			if test.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !test.ok {
+				if err == nil {
+					t.Fatal("extracting the link succeeded")
+				}
+				for name := range test.links {
+					if _, err := os.Lstat(filepath.Join(target, name)); !os.IsNotExist(err) {
+						t.Errorf("the link %s was left behind", name)
+					}
+				}
+				return
+			}
+
+			if len(files) != 3+len(test.links) {
+				t.Errorf("got %d files, want %d", len(files), 3+len(test.links))
+			}
+			for name, linkTarget := range test.links {
+				got, err := os.Readlink(filepath.Join(target, name))
+				if err != nil || got != linkTarget {
+					t.Errorf("%s links to %q, want %q", name, got, linkTarget)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractDoesNotWriteThroughLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating links needs extra privileges on Windows")
+	}
+
+	outside := t.TempDir()
+	target := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(target, "Sys")); err != nil {
+		t.Fatal(err)
+	}
+
+	source := writeTestZip(t, map[string]string{"Dolphin.exe": "exe", "Sys/file.txt": "data"})
+	_, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe})
+	if err == nil {
+		t.Fatal("extracting through the link succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file.txt")); !os.IsNotExist(err) {
+		t.Error("the file was written through the link")
+	}
+}
+
+func TestExtractLinkOverFileOfSameArchive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating links needs extra privileges on Windows")
+	}
+
+	// Links come last, so the file can't have been written through the link to the outside
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	source := writeTestZipWithLinks(t, map[string]string{"Dolphin.exe": "exe", "Sys/file.txt": "data"}, map[string]string{"Sys": "../outside"})
+	target := filepath.Join(dir, "staging")
+
+	_, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe, Workers: 4})
+	if err == nil {
+		t.Fatal("extracting the escaping link succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file.txt")); !os.IsNotExist(err) {
+		t.Error("the file was written through the link")
+	}
+}
+
+func TestExtractIntoLongPath(t *testing.T) {
+	// Windows counts characters, not bytes
+	dir := strings.Repeat("スリッピ フォルダ", 8)
+	target := filepath.Join(t.TempDir(), dir, dir, dir, "staging")
+	if utf8.RuneCountInString(target) <= 260 {
+		t.Fatalf("the target is only %d characters", utf8.RuneCountInString(target))
+	}
+
+	source := writeTestZip(t, map[string]string{"Dolphin.exe": "exe", "Sys/GameSettings/GALE01.ini": "ini"})
+	files, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2", len(files))
+	}
+	if _, err := os.Stat(fsutil.LongPath(filepath.Join(target, "Sys", "GameSettings", "GALE01.ini"))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating links needs extra privileges on Windows")
+	}
+
+	tests := []struct {
+		name  string
+		links map[string]string
+		ok    bool
+	}{
+		{"bundle", map[string]string{"build/Slippi Dolphin.app/Contents/Frameworks/lib.dylib": "lib.1.dylib"}, true},
+		{"absolute link", map[string]string{"build/Slippi Dolphin.app/Contents/evil": "/Applications"}, false},
+		{"escaping link", map[string]string{"build/Slippi Dolphin.app/Contents/evil": "../../../.."}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := writeTestZipWithLinks(t, map[string]string{
+				"build/Slippi Dolphin.app/Contents/MacOS/Slippi Dolphin":   "exe",
+				"build/Slippi Dolphin.app/Contents/Frameworks/lib.1.dylib": "lib",
+				"build/README.txt": "not part of the bundle",
+			}, test.links)
+			target := filepath.Join(t.TempDir(), "staging")
+
+			files, err := Extract(context.Background(), target, source, identityTarget, ExtractOptions{IsDolphinExe: isTestDolphinExe, Root: "build"})
+			if !test.ok {
+				if err == nil {
+					t.Fatal("extracting the link succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 4 {
+				t.Errorf("got %d files, want 4", len(files))
+			}
+			if _, err := os.Stat(filepath.Join(target, "Slippi Dolphin.app", "Contents", "MacOS", "Slippi Dolphin")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+)
+
+// Manifest lists every file of a release with its hash. It is published next to the archive such
+// that an install can be checked without downloading the release again
+type Manifest struct {
+	Version string        `json:"version"`
+	Files   []UpdatedFile `json:"files"`
+}
+
+// VerifyResult lists the install relative paths that don't match a manifest
+type VerifyResult struct {
+	Missing  []string `json:"missing"`
+	Modified []string `json:"modified"`
+	Extra    []string `json:"extra"`
+}
+
+// OK reports whether every file in the manifest is intact, extra files don't break an install
+func (r VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0
+}
+
+// ReadManifest parses a manifest file
+func ReadManifest(path string) (Manifest, error) {
+	var manifest Manifest
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(contents, &manifest)
+	if err == nil && len(manifest.Files) == 0 {
+		err = errors.New("manifest lists no files")
+	}
+
+	return manifest, err
+}
+
+// installedSHA256 hashes a file of the install, or the target of a link like Extract does
+func installedSHA256(path string, info os.FileInfo) (string, error) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fileSHA256(path)
+	}
+
+	linkTarget, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(linkTarget))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// ValidateManifest checks that a downloaded file is a manifest
+func ValidateManifest(path string) error {
+	_, err := ReadManifest(path)
+	return err
+}
+
+// VerifyInstall compares the files in dir against the manifest. Files are compared by hash, or by
+// size where the manifest has no hash. Files under extraRoots that the manifest doesn't list are
+// reported as extra, only a complete manifest can tell those apart
+func VerifyInstall(ctx context.Context, dir string, manifest Manifest, extraRoots []string) (VerifyResult, error) {
+	result := VerifyResult{Missing: []string{}, Modified: []string{}, Extra: []string{}}
+	dir = fsutil.LongPath(dir)
+
+	listed := map[string]bool{}
+	for _, file := range manifest.Files {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		listed[strings.ToLower(file.Path)] = true
+
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		// Links are recorded by their target, which may be a folder or point outside the install
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			result.Missing = append(result.Missing, file.Path)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if file.SHA256 == "" {
+			if info.Size() != file.Size {
+				result.Modified = append(result.Modified, file.Path)
+			}
+			continue
+		}
+
+		hash, err := installedSHA256(path, info)
+		if err != nil {
+			return result, err
+		}
+		if !strings.EqualFold(hash, file.SHA256) {
+			result.Modified = append(result.Modified, file.Path)
+		}
+	}
+
+	for _, root := range extraRoots {
+		err := filepath.Walk(filepath.Join(dir, root), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if !listed[strings.ToLower(relPath)] {
+				result.Extra = append(result.Extra, relPath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	sort.Strings(result.Missing)
+	sort.Strings(result.Modified)
+	sort.Strings(result.Extra)
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// Files smaller than this aren't worth splitting over several connections
+const minParallelDownloadSize = 8 * 1024 * 1024
+
+// How long a download gets to ramp up before its speed is checked
+const speedGracePeriod = 15 * time.Second
+
+var errNoRangeSupport = errors.New("server does not support range requests")
+var errTooSlow = errors.New("download is too slow")
+
+// speedGuard fails a download that is slower than a minimum average speed such that we can fail
+// over to a mirror. A nil guard never fails
+type speedGuard struct {
+	mu                sync.Mutex
+	minBytesPerSecond float64
+	start             time.Time
+	read              int64
+}
+
+func newSpeedGuard(minBytesPerSecond float64) *speedGuard {
+	return &speedGuard{minBytesPerSecond: minBytesPerSecond, start: time.Now()}
+}
+
+func (g *speedGuard) add(n int) error {
+	if g == nil || g.minBytesPerSecond <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.read += int64(n)
+	elapsed := time.Since(g.start)
+	if elapsed > speedGracePeriod && float64(g.read)/elapsed.Seconds() < g.minBytesPerSecond {
+		return fmt.Errorf("%w, %s/s on average", errTooSlow, FormatBytes(int64(float64(g.read)/elapsed.Seconds())))
+	}
+
+	return nil
+}
+
+type guardedReader struct {
+	reader io.Reader
+	guard  *speedGuard
+}
+
+func (r *guardedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if guardErr := r.guard.add(n); guardErr != nil && err == nil {
+		return n, guardErr
+	}
+
+	return n, err
+}
+
+// downloadFrom downloads a single url, over several connections if configured and possible. An
+// interrupted single connection download is always resumed instead of restarted in parallel
+func (d Downloader) downloadFrom(ctx context.Context, path, url string, guard *speedGuard) error {
+	debugf("Downloading %s to %s", url, path)
+
+	// The limit is shared by all connections
+	limiter := newRateLimiter(d.LimitBytesPerSecond)
+	wrap := func(reader io.Reader) io.Reader {
+		return &limitedReader{reader: &guardedReader{reader: reader, guard: guard}, limiter: limiter}
+	}
+
+	if _, err := os.Stat(path + ".part"); d.Connections > 1 && os.IsNotExist(err) {
+		err = d.downloadParallel(ctx, path, url, wrap)
+		if err != errNoRangeSupport {
+			return err
+		}
+	}
+
+	return d.downloadFile(ctx, path, url, wrap)
+}
+
+// downloadParallel splits the file in ranges which are fetched concurrently and written into place
+func (d Downloader) downloadParallel(ctx context.Context, path, url string, wrap func(io.Reader) io.Reader) error {
+	client := d.client()
+	connections := d.Connections
+	size, err := probeRangeSupport(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	if size < minParallelDownloadSize {
+		return errNoRangeSupport
+	}
+
+	// Not the .part file used by single connection downloads, this one has holes until it's done
+	partPath := path + ".parallel"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+
+	err = out.Truncate(size)
+	if err != nil {
+		out.Close()
+		os.Remove(partPath)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	debugf("Downloading %d bytes over %d connections", size, connections)
+	tracker := newDownloadTracker(d.Progress, 0, size)
+	chunkSize := size / int64(connections)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, connections)
+	for i := 0; i < connections; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if i == connections-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+
+			err := downloadRange(ctx, client, url, out, start, end, tracker, wrap)
+			if err != nil {
+				// Stop the other connections, the first error is the one reported
+				errs <- err
+				cancel()
+			}
+		}(start, end)
+	}
+
+	wg.Wait()
+	out.Close()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		os.Remove(partPath)
+		return err
+	}
+
+	return os.Rename(partPath, path)
+}
+
+// RemoteSize asks the server how large the file at url is without downloading it
+func RemoteSize(ctx context.Context, client *http.Client, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return 0, &slippiapi.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if resp.ContentLength > 0 {
+		return resp.ContentLength, nil
+	}
+
+	// Some hosts don't answer HEAD with a length, the first byte of a range request tells it too
+	return probeRangeSupport(ctx, client, url)
+}
+
+// probeRangeSupport asks for the first byte of the file to learn whether ranges are supported and
+// how large the file is
+func probeRangeSupport(ctx context.Context, client *http.Client, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return 0, &slippiapi.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errNoRangeSupport
+	}
+
+	// Content-Range looks like "bytes 0-0/12345"
+	contentRange := resp.Header.Get("Content-Range")
+	idx := strings.LastIndex(contentRange, "/")
+	if idx == -1 {
+		return 0, errNoRangeSupport
+	}
+
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, errNoRangeSupport
+	}
+
+	return size, nil
+}
+
+func downloadRange(ctx context.Context, client *http.Client, url string, out *os.File, start, end int64, tracker *downloadTracker, wrap func(io.Reader) io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return &slippiapi.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	reader := wrap(resp.Body)
+	buf := make([]byte, 32*1024)
+	offset := start
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if offset+int64(n) > end+1 {
+				return fmt.Errorf("server sent more data than requested")
+			}
+
+			_, writeErr := out.WriteAt(buf[:n], offset)
+			if writeErr != nil {
+				return writeErr
+			}
+			offset += int64(n)
+			tracker.add(n)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if offset != end+1 {
+		return fmt.Errorf("download ended early")
+	}
+
+	return nil
+}
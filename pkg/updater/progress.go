@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event is download or extraction progress. Type is download or extract
+type Event struct {
+	Type           string  `json:"type"`
+	File           string  `json:"file,omitempty"`
+	Current        int64   `json:"current"`
+	Total          int64   `json:"total"`
+	BytesPerSecond float64 `json:"bytesPerSecond,omitempty"`
+	ETASeconds     float64 `json:"etaSeconds,omitempty"`
+}
+
+// Reporter receives progress, it may be called from several goroutines at once
+type Reporter interface {
+	Report(event Event)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(event Event) {}
+
+func orNop(reporter Reporter) Reporter {
+	if reporter == nil {
+		return nopReporter{}
+	}
+
+	return reporter
+}
+
+// downloadTracker reports download progress. It is shared by every connection of a download
+type downloadTracker struct {
+	mu       sync.Mutex
+	reporter Reporter
+	current  int64
+	total    int64
+	resumed  int64
+	start    time.Time
+}
+
+func newDownloadTracker(reporter Reporter, offset, total int64) *downloadTracker {
+	return &downloadTracker{reporter: orNop(reporter), current: offset, resumed: offset, total: total, start: time.Now()}
+}
+
+func (t *downloadTracker) add(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.current += int64(n)
+
+	event := Event{Type: "download", Current: t.current, Total: t.total}
+	elapsed := time.Since(t.start).Seconds()
+	if elapsed > 0 {
+		event.BytesPerSecond = float64(t.current-t.resumed) / elapsed
+		if event.BytesPerSecond > 0 && t.total > 0 {
+			event.ETASeconds = float64(t.total-t.current) / event.BytesPerSecond
+		}
+	}
+	t.reporter.Report(event)
+}
+
+// progressReader reports download progress as data is read through it
+type progressReader struct {
+	reader  io.Reader
+	tracker *downloadTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.tracker.add(n)
+
+	return n, err
+}
+
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+
+	return fmt.Sprintf("%d B", n)
+}
+
+// debugf logs like the tools' debug logs, which are only shown on the console with --verbose
+func debugf(format string, args ...interface{}) {
+	log.Output(2, "Debug: "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,93 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParseRate parses a rate such as 500K, 2M or 1G into bytes per second. Plain numbers are bytes
+func ParseRate(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("invalid rate %s", value)
+	}
+
+	return int64(rate * float64(multiplier)), nil
+}
+
+// rateLimiter is a token bucket shared by every connection of a download. It holds at most one
+// second worth of tokens such that an idle period doesn't allow a burst over the limit
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until the bucket is no longer in debt. A nil limiter never waits
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// Keep single reads below the bucket size such that slow limits stay smooth
+	if r.limiter != nil && len(p) > int(r.limiter.rate) && r.limiter.rate >= 1 {
+		p = p[:int(r.limiter.rate)]
+	}
+
+	n, err := r.reader.Read(p)
+	r.limiter.wait(n)
+
+	return n, err
+}
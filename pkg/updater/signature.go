@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+)
+
+// VerifySignature checks a detached signature of a downloaded release against the base64 encoded
+// ed25519 publicKey. Releases are signed over the SHA-256 digest of the file such that large
+// archives don't need to be read into memory
+func VerifySignature(path, signature, publicKey string) error {
+	if signature == "" {
+		return errors.New("release is not signed")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("release key is invalid")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("release signature is malformed")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), hash.Sum(nil), sig) {
+		return errors.New("release signature does not match, the download may have been tampered with")
+	}
+
+	return nil
+}
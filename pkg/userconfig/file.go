@@ -0,0 +1,180 @@
+// Package userconfig reads and writes the user.json Dolphin logs in to Slippi Online with
+package userconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// knownFields are the user.json fields this package knows about, anything else Dolphin or the
+// launcher keeps in there is carried over untouched
+var knownFields = []string{"uid", "playKey", "connectCode", "displayName", "latestVersion"}
+
+// File is the contents of user.json
+type File struct {
+	UID           string `json:"uid"`
+	PlayKey       string `json:"playKey"`
+	ConnectCode   string `json:"connectCode"`
+	DisplayName   string `json:"displayName"`
+	LatestVersion string `json:"latestVersion"`
+
+	extra map[string]json.RawMessage
+}
+
+// plainFile has the fields of File without its methods, such that (un)marshalling it doesn't
+// recurse
+type plainFile File
+
+func (file *File) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	// Fails if a known field isn't a string
+	var known plainFile
+	err = json.Unmarshal(data, &known)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range knownFields {
+		delete(fields, name)
+	}
+
+	*file = File(known)
+	file.extra = fields
+	return nil
+}
+
+func (file File) MarshalJSON() ([]byte, error) {
+	contents, err := json.Marshal(plainFile(file))
+	if err != nil || len(file.extra) == 0 {
+		return contents, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(contents, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range file.extra {
+		fields[name] = value
+	}
+
+	return json.Marshal(fields)
+}
+
+// Validate checks the fields Dolphin needs to log in are set
+func (file File) Validate() error {
+	if file.UID == "" {
+		return errors.New("uid is missing")
+	}
+	if file.PlayKey == "" {
+		return errors.New("playKey is missing")
+	}
+
+	return nil
+}
+
+// SetUser replaces the account in the file, keeping everything else
+func (file *File) SetUser(user slippiapi.User) {
+	file.UID = user.UID
+	file.PlayKey = user.PlayKey
+	file.ConnectCode = user.ConnectCode
+	file.DisplayName = user.DisplayName
+}
+
+// Merge applies the user info from the server onto the file. Fields the server omitted are left
+// alone, most importantly we never want to wipe out a valid playKey
+func (file *File) Merge(server slippiapi.User) {
+	file.ConnectCode = server.ConnectCode
+
+	if server.DisplayName != "" {
+		file.DisplayName = server.DisplayName
+	}
+
+	if server.PlayKey != "" {
+		file.PlayKey = server.PlayKey
+	}
+}
+
+func (file File) sameFields(other File) bool {
+	return file.UID == other.UID &&
+		file.PlayKey == other.PlayKey &&
+		file.ConnectCode == other.ConnectCode &&
+		file.DisplayName == other.DisplayName &&
+		file.LatestVersion == other.LatestVersion &&
+		len(file.extra) == len(other.extra)
+}
+
+// Read parses the file at path as is
+func Read(path string) (File, error) {
+	var file File
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+
+	err = json.Unmarshal(contents, &file)
+	return file, err
+}
+
+// Load reads user.json, falling back to the backup kept by Write if it can't be parsed
+func Load(path string) (File, error) {
+	file, err := Read(path)
+	if err == nil || os.IsNotExist(err) {
+		return file, err
+	}
+
+	backup, backupErr := Read(path + ".bak")
+	if backupErr != nil {
+		return file, err
+	}
+
+	log.Printf("Warning: %s is corrupted, using the backup from before the last change. %s\n", path, err.Error())
+	return backup, nil
+}
+
+// Write replaces user.json atomically, such that a crash can't leave it truncated, after checking
+// the new contents read back the same. The previous file is kept as user.json.bak
+func Write(path string, file File) error {
+	err := file.Validate()
+	if err != nil {
+		return fmt.Errorf("refusing to write an invalid user.json, %s", err.Error())
+	}
+
+	contents, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	var check File
+	err = json.Unmarshal(contents, &check)
+	if err != nil || !check.sameFields(file) {
+		return errors.New("user.json did not read back the same as it was written")
+	}
+
+	// Only back up a file that is valid, a corrupted one would replace a good backup
+	if prev, err := Read(path); err == nil && prev.Validate() == nil {
+		prevContents, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(path+".bak", prevContents, 0644)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to back up user.json. %s\n", err.Error())
+		}
+	}
+
+	return fsutil.WriteFileAtomic(path, contents, 0644)
+}
@@ -0,0 +1,61 @@
+package userconfig
+
+import (
+	"testing"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+func TestMerge(t *testing.T) {
+	existing := File{UID: "uid", PlayKey: "key", ConnectCode: "ABC#123", DisplayName: "Name", LatestVersion: "3.0.0"}
+
+	tests := []struct {
+		name   string
+		server slippiapi.User
+		want   File
+	}{
+		{
+			"server sends everything",
+			slippiapi.User{UID: "uid", PlayKey: "new key", ConnectCode: "XYZ#9", DisplayName: "New Name"},
+			File{UID: "uid", PlayKey: "new key", ConnectCode: "XYZ#9", DisplayName: "New Name", LatestVersion: "3.0.0"},
+		},
+		{
+			"server omits displayName",
+			slippiapi.User{UID: "uid", PlayKey: "key", ConnectCode: "ABC#123"},
+			File{UID: "uid", PlayKey: "key", ConnectCode: "ABC#123", DisplayName: "Name", LatestVersion: "3.0.0"},
+		},
+		{
+			"server omits playKey",
+			slippiapi.User{UID: "uid", ConnectCode: "ABC#123", DisplayName: "Renamed"},
+			File{UID: "uid", PlayKey: "key", ConnectCode: "ABC#123", DisplayName: "Renamed", LatestVersion: "3.0.0"},
+		},
+		{
+			"server omits both",
+			slippiapi.User{UID: "uid", ConnectCode: "ABC#123"},
+			existing,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := existing
+			file.Merge(test.server)
+			if !file.sameFields(test.want) {
+				t.Errorf("got %+v, want %+v", file, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeKeepsExtraFields(t *testing.T) {
+	var file File
+	err := file.UnmarshalJSON([]byte(`{"uid": "uid", "playKey": "key", "launcherSetting": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.Merge(slippiapi.User{UID: "uid", DisplayName: "Name"})
+	if file.PlayKey != "key" || len(file.extra) != 1 {
+		t.Errorf("got %+v, want the play key and launcherSetting kept", file)
+	}
+}
@@ -0,0 +1,55 @@
+package userconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Variants are the Dolphin builds that each have their own user.json on macOS
+var Variants = []string{"netplay", "playback"}
+
+// Path returns where the user.json of a Dolphin lives. Windows and Linux builds are portable and
+// keep it next to Dolphin in installDir, macOS keeps it in Application Support per variant. An
+// override wins, it may be the file or the folder containing it
+func Path(installDir, variant, override string) (string, error) {
+	if override != "" {
+		if info, err := os.Stat(override); err == nil && info.IsDir() {
+			return filepath.Join(override, "user.json"), nil
+		}
+
+		return override, nil
+	}
+
+	if !isVariant(variant) {
+		return "", fmt.Errorf("unknown variant %s, expected one of %s", variant, strings.Join(Variants, ", "))
+	}
+
+	if runtime.GOOS != "darwin" {
+		return filepath.Join(installDir, "user.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	appName := "Slippi Dolphin"
+	if strings.EqualFold(variant, "playback") {
+		appName = "Slippi Playback"
+	}
+
+	return filepath.Join(home, "Library", "Application Support", appName, "user.json"), nil
+}
+
+func isVariant(variant string) bool {
+	for _, v := range Variants {
+		if strings.EqualFold(v, variant) {
+			return true
+		}
+	}
+
+	return false
+}
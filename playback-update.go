@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/semver"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slp"
+)
+
+// replayCompatibilityEvent is emitted in json mode when a playback update drops support for replays
+type replayCompatibilityEvent struct {
+	Type             string `json:"type"`
+	Version          string `json:"version"`
+	MinReplayVersion string `json:"minReplayVersion"`
+	Incompatible     int    `json:"incompatibleReplays"`
+	Oldest           string `json:"oldestReplayVersion,omitempty"`
+}
+
+// findIncompatibleReplays counts the replays in dir recorded before minVersion
+func findIncompatibleReplays(ctx context.Context, dir, minVersion string) (int, string, error) {
+	count := 0
+	oldest := ""
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".slp") {
+			return nil
+		}
+
+		version, err := slp.ReadVersion(path)
+		if err != nil {
+			logDebugf("Skipping %s. %s", path, err.Error())
+			return nil
+		}
+
+		if semver.Compare(version, minVersion) < 0 {
+			count++
+			if oldest == "" || semver.Compare(version, oldest) < 0 {
+				oldest = version
+			}
+		}
+
+		return nil
+	})
+
+	return count, oldest, err
+}
+
+// checkReplayCompatibility warns before a playback update when the new build can't play replays
+// the installed one can. With -replay-dir the replays that would stop working are counted
+func checkReplayCompatibility(ctx context.Context, cfg toolsConfig, opts appUpdateOptions, latest slippiapi.DolphinVersion) {
+	if latest.MinReplayVersion == "" {
+		return
+	}
+
+	result := replayCompatibilityEvent{Type: "replay-compatibility", Version: latest.Version, MinReplayVersion: latest.MinReplayVersion}
+
+	dropsSupport := false
+	installed := opts.PrevVersion
+	if installed == "" {
+		installed = readInstalledVersion(cfg.InstallDir)
+	}
+	if installed != "" {
+		var current slippiapi.DolphinVersion
+		err := queryProviders(ctx, cfg, cfg.versionCacheKey("version:"+installed), &current, func(provider slippiapi.Provider) (err error) {
+			current, err = provider.Version(ctx, installed)
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to look up the installed playback build. %s\n", err.Error())
+		}
+
+		dropsSupport = current.MinReplayVersion != "" && semver.Compare(latest.MinReplayVersion, current.MinReplayVersion) > 0
+	}
+
+	if opts.ReplayDir != "" {
+		var err error
+		result.Incompatible, result.Oldest, err = findIncompatibleReplays(ctx, opts.ReplayDir, latest.MinReplayVersion)
+		if err != nil {
+			failIfCancelled(ctx)
+			log.Printf("Failed to check the replays in %s. %s\n", opts.ReplayDir, err.Error())
+		}
+	}
+
+	if !dropsSupport && result.Incompatible == 0 {
+		return
+	}
+
+	log.Printf("Warning: playback %s can't play replays recorded before %s\n", latest.Version, latest.MinReplayVersion)
+	if result.Incompatible > 0 {
+		log.Printf("Warning: %d replays in %s are older, the oldest is from %s\n", result.Incompatible, opts.ReplayDir, result.Oldest)
+	}
+	if !opts.KeepOldPlayback {
+		log.Printf("Run app-update with -keep-old-playback to keep the current build next to the new one\n")
+	}
+	if jsonOutput {
+		emitEvent(result)
+	}
+}
+
+// keepOldPlayback copies the playback build about to be replaced next to it, such that replays it
+// can still play stay playable. Copies of an install folder are registered as archived
+func keepOldPlayback(exPath, source, version string) {
+	if version == "" {
+		version = readInstalledVersion(exPath)
+	}
+	if version == "" {
+		version = "old"
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		failf(exitInstall, "Failed to keep the old playback build, nothing was changed. %s", err.Error())
+	}
+
+	// Install folders can have dots in their name, only files and bundles keep their extension last
+	ext := ""
+	isInstallDir := info.IsDir() && filepath.Ext(source) != ".app"
+	if !isInstallDir {
+		ext = filepath.Ext(source)
+	}
+	target := strings.TrimSuffix(source, ext) + "-" + version + ext
+	if _, err := os.Lstat(target); err == nil {
+		log.Printf("Playback %s is already kept at %s\n", version, target)
+		return
+	}
+
+	fmt.Printf("Keeping playback %s at %s...\n", version, target)
+	err = copyTree(source, target)
+	if err != nil {
+		os.RemoveAll(target)
+		failf(exitInstall, "Failed to keep the old playback build, nothing was changed. %s", err.Error())
+	}
+
+	if isInstallDir {
+		installs := append(withoutInstall(loadInstalls(), target), registeredInstall{Path: target, Type: slippiapi.TypePlayback, Archived: true})
+		err = saveInstalls(installs)
+		if err != nil {
+			log.Printf("Failed to register the kept playback build. %s\n", err.Error())
+		}
+	}
+}
+
+// copyTree copies a file or folder, keeping symlinks and permissions. The staging folders of the
+// install are left out
+func copyTree(source, target string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		isStaging := strings.HasPrefix(info.Name(), "dolphin-") || strings.HasPrefix(info.Name(), configDefaultsDirName)
+		if info.IsDir() && isStaging && relPath != "." {
+			return filepath.SkipDir
+		}
+		targetPath := filepath.Join(target, relPath)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, targetPath)
+		case info.IsDir():
+			return os.MkdirAll(targetPath, info.Mode().Perm())
+		default:
+			err = copyFile(path, targetPath)
+			if err != nil {
+				return err
+			}
+			return os.Chmod(targetPath, info.Mode().Perm())
+		}
+	})
+}
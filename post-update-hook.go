@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runPostUpdateHook runs the user configured command after a successful update. The new version is
+// passed both as the last argument and through the SLIPPI_DOLPHIN_VERSION environment variable
+func runPostUpdateHook(command, version string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command+" "+version)
+	} else {
+		cmd = exec.Command("sh", "-c", command+` "$1"`, "sh", version)
+	}
+	cmd.Env = append(os.Environ(), "SLIPPI_DOLPHIN_VERSION="+version)
+
+	log.Printf("Running post-update command: %s\n", command)
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\r\n"), "\n") {
+		if line != "" {
+			log.Printf("[post-update] %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("post-update command failed: %s", err.Error())
+	}
+
+	return nil
+}
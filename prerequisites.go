@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// prerequisite is a system component Dolphin needs that doesn't come with it. The ones with an
+// installer URL can be installed by the tools, the others only come with a hint
+type prerequisite struct {
+	Name      string   `json:"name"`
+	Missing   []string `json:"missing"`
+	URL       string   `json:"url,omitempty"`
+	Hint      string   `json:"hint,omitempty"`
+	Installed bool     `json:"installed"`
+
+	installArgs []string
+}
+
+type prerequisitesResult struct {
+	Prerequisites []prerequisite `json:"prerequisites"`
+}
+
+type prerequisitesEvent struct {
+	Type string `json:"type"`
+	prerequisitesResult
+}
+
+// Microsoft's installers, they stay at these urls across versions
+const (
+	vcRedistURL = "https://aka.ms/vs/17/release/vc_redist.x64.exe"
+	directXURL  = "https://download.microsoft.com/download/1/7/1/1718CCC4-6315-4D8E-9543-8E28A4E18C4C/dxwebsetup.exe"
+)
+
+const fuse2Hint = "Install FUSE 2 with your package manager, it is libfuse2 on Debian and Ubuntu, fuse2 on Arch and fuse-libs on Fedora"
+
+// Installer exit codes that mean success: 3010 asks for a reboot, 1638 means a newer version is
+// already installed
+var installerSuccessCodes = []int{0, 3010, 1638}
+
+// windowsPrerequisites are checked by the files they put in the system folder
+var windowsPrerequisites = []prerequisite{
+	{
+		Name:        "Visual C++ Redistributable",
+		Missing:     []string{"vcruntime140.dll", "vcruntime140_1.dll", "msvcp140.dll"},
+		URL:         vcRedistURL,
+		installArgs: []string{"/install", "/passive", "/norestart"},
+	},
+	{
+		Name:        "DirectX",
+		Missing:     []string{"d3dcompiler_47.dll"},
+		URL:         directXURL,
+		installArgs: []string{"/Q"},
+	},
+}
+
+// hasLibrary asks the dynamic linker's cache for a shared library
+func hasLibrary(name string) bool {
+	output, err := exec.Command("ldconfig", "-p").Output()
+	if err != nil {
+		// Without ldconfig we can't tell, don't report what may well be there
+		return true
+	}
+
+	return strings.Contains(string(output), name+" ")
+}
+
+// findMissingPrerequisites returns the prerequisites of the install that aren't present. Libraries
+// the installed Dolphin links against are checked as well, those missing on Windows are part of
+// the install itself
+func findMissingPrerequisites(exPath string) []prerequisite {
+	missing := []prerequisite{}
+	exe := findDolphinExe(exPath)
+	_, exeErr := os.Stat(exe)
+
+	switch runtime.GOOS {
+	case "windows":
+		known := []string{}
+		for _, prereq := range windowsPrerequisites {
+			files := []string{}
+			for _, name := range prereq.Missing {
+				if !findWindowsDLL(exPath, name) {
+					files = append(files, name)
+				}
+				known = append(known, name)
+			}
+			if len(files) > 0 {
+				prereq.Missing = files
+				missing = append(missing, prereq)
+			}
+		}
+
+		if exeErr != nil {
+			break
+		}
+		dlls, err := missingWindowsDLLs(exe)
+		if err != nil {
+			logDebugf("Could not list the libraries of %s. %s", exe, err.Error())
+		}
+		files := []string{}
+		for _, name := range dlls {
+			if !containsFold(known, name) {
+				files = append(files, name)
+			}
+		}
+		if len(files) > 0 {
+			missing = append(missing, prerequisite{Name: "Dolphin files", Missing: files, Hint: "Run reinstall to restore them"})
+		}
+	case "linux":
+		if findAppImage(exPath) != "" {
+			if !hasLibrary("libfuse.so.2") {
+				missing = append(missing, prerequisite{Name: "FUSE 2", Missing: []string{"libfuse.so.2"}, Hint: fuse2Hint})
+			}
+			break
+		}
+
+		if exeErr != nil {
+			break
+		}
+		libraries, err := missingLinuxLibraries(exe)
+		if err != nil {
+			logDebugf("Could not list the libraries of %s. %s", exe, err.Error())
+		}
+		if len(libraries) > 0 {
+			missing = append(missing, prerequisite{Name: "Shared libraries", Missing: libraries, Hint: "Install the packages that provide them with your package manager"})
+		}
+	}
+
+	return missing
+}
+
+// installPrerequisite downloads the prerequisite's installer and runs it. The installers ask for
+// administrator rights themselves
+func installPrerequisite(ctx context.Context, cfg toolsConfig, prereq prerequisite) error {
+	dir, err := ioutil.TempDir(cfg.TempDir, "prerequisite")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	installerPath := filepath.Join(dir, filepath.Base(prereq.URL))
+	fmt.Printf("Downloading %s...\n", prereq.Name)
+	err = cfg.downloader().Download(ctx, installerPath, []string{prereq.URL}, "", func(path string) error {
+		return updater.ValidateFileMagic(path, []byte("MZ"), "download did not return an installer")
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Installing %s...\n", prereq.Name)
+	err = exec.CommandContext(ctx, installerPath, prereq.installArgs...).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := exitErr.ExitCode()
+		for _, success := range installerSuccessCodes {
+			if code == success {
+				return nil
+			}
+		}
+		return fmt.Errorf("the installer exited with code %d", code)
+	}
+
+	return err
+}
+
+func describePrerequisite(prereq prerequisite) string {
+	description := fmt.Sprintf("%s is missing (%s)", prereq.Name, strings.Join(prereq.Missing, ", "))
+	if prereq.Hint != "" {
+		description += ". " + prereq.Hint
+	}
+
+	return description
+}
+
+// ensurePrerequisites handles missing prerequisites during app-update according to mode: install
+// installs them, skip only warns and ask prompts unless nobody is there to answer
+func ensurePrerequisites(ctx context.Context, cfg toolsConfig, exPath, mode string, interactive bool) {
+	if mode == "skip" {
+		return
+	}
+
+	for _, prereq := range findMissingPrerequisites(exPath) {
+		if prereq.URL == "" {
+			log.Printf("Warning: %s\n", describePrerequisite(prereq))
+			continue
+		}
+
+		install := mode == "install" || (mode == "ask" && interactive && confirm(describePrerequisite(prereq)+". Install it now?"))
+		if !install {
+			log.Printf("Warning: %s. Install it from %s\n", describePrerequisite(prereq), prereq.URL)
+			continue
+		}
+
+		err := installPrerequisite(ctx, cfg, prereq)
+		failIfCancelled(ctx)
+		if err != nil {
+			// Dolphin may still start, the health check or the user will tell
+			log.Printf("Warning: Failed to install %s, install it from %s. %s\n", prereq.Name, prereq.URL, err.Error())
+		}
+	}
+}
+
+// execPrerequisites lists the missing prerequisites of the install, and with install set installs
+// the ones that have an installer
+func execPrerequisites(ctx context.Context, cfg toolsConfig, install bool) (result prerequisitesResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered checking prerequisites")
+		}
+	}()
+
+	result.Prerequisites = findMissingPrerequisites(cfg.InstallDir)
+	if len(result.Prerequisites) == 0 {
+		fmt.Println("All prerequisites are installed")
+		return result, nil
+	}
+
+	remaining := 0
+	for i, prereq := range result.Prerequisites {
+		fmt.Printf("- %s\n", describePrerequisite(prereq))
+		if !install || prereq.URL == "" {
+			remaining++
+			continue
+		}
+
+		err := installPrerequisite(ctx, cfg, prereq)
+		failIfCancelled(ctx)
+		if err != nil {
+			failf(exitInstall, "Failed to install %s, install it from %s. %s", prereq.Name, prereq.URL, err.Error())
+		}
+		result.Prerequisites[i].Installed = true
+		fmt.Printf("Installed %s\n", prereq.Name)
+	}
+
+	if remaining > 0 {
+		if jsonOutput {
+			emitEvent(prerequisitesEvent{Type: "prerequisites", prerequisitesResult: result})
+		}
+		failf(exitVerification, "%d prerequisites are missing", remaining)
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listProcesses enumerates running processes through /proc where available (Linux) and falls back
+// to ps elsewhere (macOS), which reports the full executable path
+func listProcesses() ([]processInfo, error) {
+	if _, err := os.Stat("/proc/self/exe"); err == nil {
+		return listProcProcesses()
+	}
+
+	output, err := exec.Command("ps", "-axo", "pid=,comm=").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	processes := []processInfo{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) < 2 {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		path := strings.TrimSpace(fields[1])
+		processes = append(processes, processInfo{PID: pid, Name: filepath.Base(path), Path: path})
+	}
+
+	return processes, nil
+}
+
+func listProcProcesses() ([]processInfo, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	processes := []processInfo{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// The exe link can't be read for other users' processes, use the command name then
+		path, _ := os.Readlink(filepath.Join("/proc", entry.Name(), "exe"))
+		name := filepath.Base(path)
+		if path == "" {
+			comm, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+			if err != nil {
+				continue
+			}
+			name = strings.TrimSpace(string(comm))
+		}
+
+		processes = append(processes, processInfo{PID: pid, Name: name, Path: path})
+	}
+
+	return processes, nil
+}
+
+// requestClose asks the process to exit with SIGTERM
+func requestClose(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,84 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const processQueryLimitedInformation = 0x1000
+
+var procQueryFullProcessImageName = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryFullProcessImageNameW")
+
+// listProcesses enumerates running processes with the toolhelp API. The path is left empty for
+// processes we aren't allowed to query
+func listProcesses() ([]processInfo, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	processes := []processInfo{}
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		processes = append(processes, processInfo{
+			PID:  int(entry.ProcessID),
+			Name: syscall.UTF16ToString(entry.ExeFile[:]),
+			Path: processPath(entry.ProcessID),
+		})
+	}
+
+	return processes, nil
+}
+
+func processPath(pid uint32) string {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(handle)
+
+	buf := make([]uint16, syscall.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procQueryFullProcessImageName.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return ""
+	}
+
+	return syscall.UTF16ToString(buf[:size])
+}
+
+const wmClose = 0x0010
+
+var (
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessID = user32.NewProc("GetWindowThreadProcessId")
+	procPostMessage              = user32.NewProc("PostMessageW")
+)
+
+// requestClose posts WM_CLOSE to every top level window of the process, same as clicking the X
+func requestClose(pid int) error {
+	callback := syscall.NewCallback(func(hwnd uintptr, lparam uintptr) uintptr {
+		var windowPID uint32
+		procGetWindowThreadProcessID.Call(hwnd, uintptr(unsafe.Pointer(&windowPID)))
+		if int(windowPID) == pid {
+			procPostMessage.Call(hwnd, wmClose, 0, 0)
+		}
+
+		// Keep enumerating
+		return 1
+	})
+
+	ret, _, err := procEnumWindows.Call(callback, 0)
+	if ret == 0 {
+		return err
+	}
+
+	return nil
+}
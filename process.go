@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// When forceClose is set, waitForDolphinClose asks Dolphin to close after forceCloseGrace and kills
+// it if it is still running after another grace period. Set by the -force-close flags
+var (
+	forceClose      = false
+	forceCloseGrace = 30 * time.Second
+)
+
+type processInfo struct {
+	PID  int
+	Name string
+	Path string
+}
+
+// findDolphinProcesses returns running Dolphin processes started from the install directory.
+// Processes whose path couldn't be read are matched on name alone
+func findDolphinProcesses(installDir string) []processInfo {
+	processes, err := listProcesses()
+	if err != nil {
+		log.Printf("Failed to list processes. %s\n", err.Error())
+		return nil
+	}
+
+	found := []processInfo{}
+	for _, process := range processes {
+		if !isDolphinProcessName(process.Name) {
+			continue
+		}
+
+		if installDir != "" && process.Path != "" && !isPathInside(installDir, process.Path) {
+			continue
+		}
+
+		found = append(found, process)
+	}
+
+	return found
+}
+
+// isDolphinProcessName compares against the exe names, ignoring the extension since processes
+// outside of Windows don't have one
+func isDolphinProcessName(name string) bool {
+	for _, exeName := range dolphinExeNames {
+		if strings.EqualFold(name, exeName) || strings.EqualFold(name, strings.TrimSuffix(exeName, ".exe")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPathInside(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	if runtime.GOOS == "windows" {
+		// Paths may differ in case on Windows
+		rel, err = filepath.Rel(strings.ToLower(dir), strings.ToLower(path))
+		if err != nil {
+			return false
+		}
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// closeProcesses escalates from asking the processes to close to killing them
+func closeProcesses(processes []processInfo, kill bool) {
+	for _, process := range processes {
+		if !kill {
+			log.Printf("Asking Dolphin (pid %d) to close...\n", process.PID)
+			err := requestClose(process.PID)
+			if err != nil {
+				log.Printf("Failed to ask Dolphin to close. %s\n", err.Error())
+			}
+			continue
+		}
+
+		log.Printf("Dolphin (pid %d) didn't close, killing it...\n", process.PID)
+		p, err := os.FindProcess(process.PID)
+		if err == nil {
+			err = p.Kill()
+		}
+		if err != nil {
+			log.Printf("Failed to kill Dolphin. %s\n", err.Error())
+		}
+	}
+}
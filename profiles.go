@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/userconfig"
+)
+
+// keychainService is the name secrets are stored under in the OS keychain
+const keychainService = "dolphin-slippi-tools"
+
+var errSecretNotFound = errors.New("secret not found")
+
+// secretStore keeps playKeys out of plain files where the OS has a keychain
+type secretStore interface {
+	name() string
+	set(account, secret string) error
+	get(account string) (string, error)
+	delete(account string) error
+}
+
+// userProfile is one stored Slippi account. The playKey is only kept in the file when no keychain
+// is available
+type userProfile struct {
+	Name        string `json:"name"`
+	UID         string `json:"uid"`
+	ConnectCode string `json:"connectCode"`
+	DisplayName string `json:"displayName"`
+	InKeychain  bool   `json:"inKeychain"`
+	PlayKey     string `json:"playKey,omitempty"`
+}
+
+type userProfiles struct {
+	Active   string        `json:"active,omitempty"`
+	Profiles []userProfile `json:"profiles"`
+}
+
+func profilesPath(exPath string) string {
+	return filepath.Join(exPath, "slippi-tools-profiles.json")
+}
+
+func loadProfiles(exPath string) (userProfiles, error) {
+	profiles := userProfiles{Profiles: []userProfile{}}
+
+	contents, err := ioutil.ReadFile(profilesPath(exPath))
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+
+	err = json.Unmarshal(contents, &profiles)
+	return profiles, err
+}
+
+func saveProfiles(exPath string, profiles userProfiles) error {
+	sort.Slice(profiles.Profiles, func(i, j int) bool {
+		return profiles.Profiles[i].Name < profiles.Profiles[j].Name
+	})
+
+	contents, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Readable by the user only since it may hold playKeys
+	return fsutil.WriteFileAtomic(profilesPath(exPath), contents, 0600)
+}
+
+func (profiles userProfiles) find(name string) (int, bool) {
+	for i, profile := range profiles.Profiles {
+		if profile.Name == name {
+			return i, true
+		}
+	}
+
+	return -1, false
+}
+
+// withoutSecrets is what gets reported, play keys never leave the profiles file
+func (profiles userProfiles) withoutSecrets() userProfiles {
+	redacted := userProfiles{Active: profiles.Active, Profiles: []userProfile{}}
+	for _, profile := range profiles.Profiles {
+		profile.PlayKey = ""
+		redacted.Profiles = append(redacted.Profiles, profile)
+	}
+
+	return redacted
+}
+
+// execProfiles runs the user profiles subcommands. userPath is the user.json profiles are saved
+// from and switched into
+func execProfiles(cfg toolsConfig, action, name, userPath string) (profiles userProfiles, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered managing profiles")
+		}
+	}()
+
+	exPath := cfg.InstallDir
+
+	profiles, err := loadProfiles(exPath)
+	if err != nil {
+		return profiles, fmt.Errorf("failed to read profiles. %s", err.Error())
+	}
+
+	if action != "list" && name == "" {
+		return profiles, fmt.Errorf("%s needs a profile name", action)
+	}
+
+	switch action {
+	case "list":
+		printProfiles(profiles)
+		return profiles, nil
+	case "add":
+		err = addProfile(&profiles, name, userPath)
+	case "use":
+		err = useProfile(&profiles, name, userPath)
+	case "remove":
+		err = removeProfile(&profiles, name)
+	default:
+		return profiles, fmt.Errorf("unknown action %s, expected list, add, use or remove", action)
+	}
+	if err != nil {
+		return profiles, err
+	}
+
+	return profiles, saveProfiles(exPath, profiles)
+}
+
+func printProfiles(profiles userProfiles) {
+	if len(profiles.Profiles) == 0 {
+		fmt.Println("No profiles saved, add the current user.json with: user profiles add <name>")
+		return
+	}
+
+	for _, profile := range profiles.Profiles {
+		marker := " "
+		if profile.Name == profiles.Active {
+			marker = "*"
+		}
+		fmt.Printf("%s %-20s %-10s %s\n", marker, profile.Name, profile.ConnectCode, profile.DisplayName)
+	}
+}
+
+// addProfile saves the account in user.json under name, replacing a profile with the same name
+func addProfile(profiles *userProfiles, name, userPath string) error {
+	file := parseCurrentFile(userPath)
+	if file.UID == "" || file.PlayKey == "" {
+		return fmt.Errorf("%s is not logged in", userPath)
+	}
+
+	profile := userProfile{
+		Name:        name,
+		UID:         file.UID,
+		ConnectCode: file.ConnectCode,
+		DisplayName: file.DisplayName,
+	}
+
+	keychain := newKeychain()
+	if keychain != nil {
+		err := keychain.set(name, file.PlayKey)
+		if err == nil {
+			profile.InKeychain = true
+		} else {
+			log.Printf("Warning: failed to store the play key in the %s, keeping it in the profiles file. %s\n", keychain.name(), err.Error())
+		}
+	} else {
+		log.Printf("Warning: no keychain is available, the play key is kept in the profiles file\n")
+	}
+	if !profile.InKeychain {
+		profile.PlayKey = file.PlayKey
+	}
+
+	if i, ok := profiles.find(name); ok {
+		profiles.Profiles[i] = profile
+	} else {
+		profiles.Profiles = append(profiles.Profiles, profile)
+	}
+	profiles.Active = name
+
+	fmt.Printf("Saved %s (%s) as profile %s\n", profile.DisplayName, profile.ConnectCode, name)
+	return nil
+}
+
+// useProfile writes the profile's account into user.json, keeping the fields that aren't part of
+// the account such as latestVersion
+func useProfile(profiles *userProfiles, name, userPath string) error {
+	i, ok := profiles.find(name)
+	if !ok {
+		return fmt.Errorf("no profile named %s", name)
+	}
+	profile := profiles.Profiles[i]
+
+	playKey := profile.PlayKey
+	if profile.InKeychain {
+		keychain := newKeychain()
+		if keychain == nil {
+			return fmt.Errorf("profile %s is stored in a keychain that isn't available", name)
+		}
+
+		var err error
+		playKey, err = keychain.get(name)
+		if err != nil {
+			return fmt.Errorf("failed to read the play key of %s from the %s. %s", name, keychain.name(), err.Error())
+		}
+	}
+
+	var file userconfig.File
+	if _, err := os.Stat(userPath); err == nil {
+		file = parseCurrentFile(userPath)
+	}
+	file.UID = profile.UID
+	file.PlayKey = playKey
+	file.ConnectCode = profile.ConnectCode
+	file.DisplayName = profile.DisplayName
+
+	err := userconfig.Write(userPath, file)
+	if err != nil {
+		return err
+	}
+
+	profiles.Active = name
+	fmt.Printf("Switched to %s (%s)\n", profile.DisplayName, profile.ConnectCode)
+	return nil
+}
+
+func removeProfile(profiles *userProfiles, name string) error {
+	i, ok := profiles.find(name)
+	if !ok {
+		return fmt.Errorf("no profile named %s", name)
+	}
+
+	if profiles.Profiles[i].InKeychain {
+		if keychain := newKeychain(); keychain != nil {
+			err := keychain.delete(name)
+			if err != nil {
+				log.Printf("Warning: failed to remove the play key from the %s. %s\n", keychain.name(), err.Error())
+			}
+		}
+	}
+
+	profiles.Profiles = append(profiles.Profiles[:i], profiles.Profiles[i+1:]...)
+	if profiles.Active == name {
+		profiles.Active = ""
+	}
+
+	fmt.Printf("Removed profile %s\n", name)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// progress is where download and extraction progress is sent. Replaced with a json reporter by
+// the -json-progress flag
+var progress updater.Reporter = &terminalProgress{}
+
+// terminalProgress renders progress on a single updating console line
+type terminalProgress struct {
+	mu         sync.Mutex
+	lastType   string
+	lastReport time.Time
+}
+
+func (p *terminalProgress) Report(event updater.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Don't flood the console, but always show the final update
+	isLast := event.Total > 0 && event.Current >= event.Total
+	if event.Type == p.lastType && !isLast && time.Since(p.lastReport) < 200*time.Millisecond {
+		return
+	}
+	p.lastType = event.Type
+	p.lastReport = time.Now()
+
+	switch event.Type {
+	case "download":
+		line := fmt.Sprintf("Downloading: %s", updater.FormatBytes(event.Current))
+		if event.Total > 0 {
+			line = fmt.Sprintf("Downloading: %d%% of %s", event.Current*100/event.Total, updater.FormatBytes(event.Total))
+		}
+		if event.BytesPerSecond > 0 {
+			line += fmt.Sprintf(" (%s/s", updater.FormatBytes(int64(event.BytesPerSecond)))
+			if event.ETASeconds > 0 {
+				line += fmt.Sprintf(", %s left", (time.Duration(event.ETASeconds) * time.Second).String())
+			}
+			line += ")"
+		}
+		fmt.Printf("\r%-79s", line)
+	case "extract":
+		line := fmt.Sprintf("Extracting (%d/%d): %s", event.Current, event.Total, event.File)
+		if event.BytesPerSecond > 0 {
+			line = fmt.Sprintf("Extracting (%d/%d, %s/s): %s", event.Current, event.Total, updater.FormatBytes(int64(event.BytesPerSecond)), event.File)
+		}
+		fmt.Printf("\r%-79s", line)
+	case "index":
+		fmt.Printf("\r%-79s", fmt.Sprintf("Indexing (%d/%d): %s", event.Current, event.Total, event.File))
+	}
+
+	if isLast {
+		fmt.Println("")
+	}
+}
+
+// jsonProgress writes one json object per line such that the launcher can consume it. Each type
+// of event is throttled on its own, downloads report on every read
+type jsonProgress struct {
+	mu         sync.Mutex
+	out        io.Writer
+	lastReport map[string]time.Time
+}
+
+func (p *jsonProgress) Report(event updater.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The final update is always sent, the launcher shows it as done
+	isLast := event.Total > 0 && event.Current >= event.Total
+	if !isLast && time.Since(p.lastReport[event.Type]) < 200*time.Millisecond {
+		return
+	}
+	if p.lastReport == nil {
+		p.lastReport = map[string]time.Time{}
+	}
+	p.lastReport[event.Type] = time.Now()
+
+	contents, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(p.out, string(contents))
+}
+
+func useJSONProgress() {
+	progress = &jsonProgress{out: os.Stdout}
+}
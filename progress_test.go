@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+func TestJSONProgressThrottles(t *testing.T) {
+	var out bytes.Buffer
+	p := &jsonProgress{out: &out}
+
+	for i := int64(1); i <= 1000; i++ {
+		p.Report(updater.Event{Type: "download", Current: i, Total: 1000})
+		p.Report(updater.Event{Type: "extract", Current: i / 10, Total: 100})
+	}
+
+	last := map[string]updater.Event{}
+	counts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event updater.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		counts[event.Type]++
+		last[event.Type] = event
+	}
+
+	for _, eventType := range []string{"download", "extract"} {
+		// The first event and the final ones, unless the machine took over 200ms for the loop
+		if counts[eventType] < 2 || counts[eventType] > 20 {
+			t.Errorf("got %d %s events", counts[eventType], eventType)
+		}
+		if last[eventType].Current != last[eventType].Total {
+			t.Errorf("the last %s event is %d of %d, want the final one", eventType, last[eventType].Current, last[eventType].Total)
+		}
+	}
+}
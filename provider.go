@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// providers returns the providers in the order they are tried
+func (cfg toolsConfig) providers() []slippiapi.Provider {
+	rest := cfg.rest()
+	gql := cfg.graphQL()
+
+	switch cfg.Provider {
+	case "rest":
+		return []slippiapi.Provider{rest}
+	case "graphql":
+		return []slippiapi.Provider{gql}
+	case "", "auto":
+	default:
+		log.Printf("Ignoring unknown provider %s\n", cfg.Provider)
+	}
+
+	return []slippiapi.Provider{rest, gql}
+}
+
+func (cfg toolsConfig) rest() slippiapi.REST {
+	rest := slippiapi.NewREST(cfg.RESTEndpoint, cfg.httpClient(), "dolphin-slippi-tools/"+toolsVersion)
+	rest.DolphinType = cfg.dolphinType()
+	return rest
+}
+
+func (cfg toolsConfig) graphQL() slippiapi.GraphQL {
+	return slippiapi.GraphQL{Endpoints: cfg.endpoints(), Client: cfg.httpClient(), DolphinType: cfg.dolphinType()}
+}
+
+func (cfg toolsConfig) userGraphQL() slippiapi.GraphQL {
+	return slippiapi.GraphQL{Endpoints: cfg.userEndpoints(), Client: cfg.httpClient()}
+}
+
+// versionCacheKey keeps cached versions of different Dolphin types apart
+func (cfg toolsConfig) versionCacheKey(key string) string {
+	if dolphinType := cfg.dolphinType(); dolphinType != slippiapi.TypeNetplay {
+		return dolphinType + ":" + key
+	}
+
+	return key
+}
+
+// queryProviders calls each provider until one succeeds. With a cache key the result in resp is
+// saved, and used when no provider can be reached
+func queryProviders(ctx context.Context, cfg toolsConfig, cacheKey string, resp interface{}, call func(slippiapi.Provider) error) error {
+	err := errors.New("no provider configured")
+
+	providers := cfg.providers()
+	for i, provider := range providers {
+		err = call(provider)
+		if err == nil {
+			if cacheKey != "" {
+				saveCachedResponse(cfg, cacheKey, provider.Name(), resp)
+			}
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+		if i+1 < len(providers) {
+			log.Printf("Warning: %s API failed, trying %s. %s\n", provider.Name(), providers[i+1].Name(), err.Error())
+		}
+	}
+
+	if cacheKey == "" {
+		return err
+	}
+
+	return useCachedResponse(cfg, cacheKey, resp, err)
+}
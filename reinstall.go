@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// Files kept when wiping the install, on top of any passed with -preserve
+var reinstallPreserved = []string{
+	"user.json",
+	"config.json",
+	"slippi-tools-state.json",
+	"update-history.json",
+	logDirName,
+	"dolphin-slippi-tools.exe",
+}
+
+func execReinstall(ctx context.Context, cfg toolsConfig, prevVersion string, preserve []string, skipConfirm bool) (returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered reinstalling app")
+		}
+	}()
+
+	exPath := cfg.InstallDir
+
+	ensureWritable(exPath)
+
+	preserve = append(preserve, reinstallPreserved...)
+	if !skipConfirm && !confirm(fmt.Sprintf(
+		"This will delete everything in %s except %s and install a fresh copy of Dolphin. Continue?",
+		exPath, strings.Join(preserve, ", "),
+	)) {
+		fmt.Println("Reinstall cancelled")
+		updateSkipped = true
+		return nil
+	}
+
+	waitForDolphinClose(exPath)
+	repairBeforeUpdate(exPath)
+
+	latest := getLatestVersion(ctx, cfg, cfg.channel(prevVersion))
+	updateTargetVersion = latest.Version
+	dir, err := createStagingDir(cfg.TempDir, exPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Download before deleting anything such that a failed download leaves the install alone
+	zipFilePath := filepath.Join(dir, "dolphin.zip")
+	preflightDiskSpace(ctx, cfg, appUpdateOptions{}, dir, exPath, updater.WithMirrors(latest.URL, latest.Mirrors))
+	err = cfg.downloader().Download(ctx, zipFilePath, updater.WithMirrors(latest.URL, latest.Mirrors), latest.ArchiveSHA256, updater.ValidateArchive)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitNetwork, "Failed to download update. %s", err.Error())
+	}
+
+	err = verifyReleaseSignature(zipFilePath, latest.Signature)
+	if err != nil {
+		failf(exitVerification, "Failed to verify download. %s", err.Error())
+	}
+
+	// The staging dir may live inside the install, make sure we don't delete it
+	if rel, err := filepath.Rel(exPath, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		preserve = append(preserve, strings.Split(filepath.ToSlash(rel), "/")[0])
+	}
+
+	// Last chance to stop, once the old install is deleted there is nothing to roll back to
+	failIfCancelled(ctx)
+
+	err = wipeInstall(exPath, preserve)
+	if err != nil {
+		failf(exitInstall, "Failed to delete old install. %s", err.Error())
+	}
+
+	installArchive(context.Background(), cfg, exPath, zipFilePath, prevVersion, latest)
+
+	fmt.Printf("Reinstalled Dolphin %s\n", latest.Version)
+	return nil
+}
+
+// wipeInstall deletes everything at the top level of the install except the preserved names
+func wipeInstall(exPath string, preserve []string) error {
+	entries, err := ioutil.ReadDir(exPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if containsFold(preserve, entry.Name()) {
+			continue
+		}
+
+		log.Printf("Deleting: %s\n", entry.Name())
+		err = os.RemoveAll(filepath.Join(exPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Windows file names are case insensitive so we compare them that way
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
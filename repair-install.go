@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// repairResult is reported at the end of app-update -repair
+type repairResult struct {
+	Version  string   `json:"version"`
+	Replaced []string `json:"replaced"`
+}
+
+// execRepairInstall replaces only the files of the installed version that are missing or
+// damaged. The archive of that version is taken from -from-file, an archive kept by
+// -keep-archive, or downloaded. Config files are left alone since users are expected to change them
+func execRepairInstall(ctx context.Context, cfg toolsConfig, opts appUpdateOptions) (result repairResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered repairing install")
+		}
+	}()
+
+	exPath := cfg.InstallDir
+	if runtime.GOOS == "darwin" || findAppImage(exPath) != "" {
+		failf(exitInstall, "Repairing single files isn't possible for this install, run reinstall instead")
+	}
+
+	ensureWritable(exPath)
+	waitForDolphinClose(exPath)
+	repairBeforeUpdate(exPath)
+
+	installed := opts.PrevVersion
+	if installed == "" {
+		installed = readInstalledVersion(exPath)
+	}
+	if installed == "" {
+		failf(exitVerification, "Could not tell which version is installed, run reinstall to fix the install")
+	}
+
+	dir, err := createStagingDir(cfg.TempDir, exPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zipFilePath := filepath.Join(dir, "dolphin.zip")
+	fetchRepairArchive(ctx, cfg, opts, exPath, installed, zipFilePath)
+
+	newDir, err := ioutil.TempDir(exPath, "dolphin-new")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(newDir)
+
+	fmt.Printf("Checking the files of Dolphin %s...\n", installed)
+	files, err := updater.Extract(ctx, newDir, zipFilePath, fullUpdateGen, cfg.extractOptions())
+	if err == nil {
+		var exeFiles []updater.UpdatedFile
+		exeFiles, err = updater.Extract(ctx, newDir, zipFilePath, exeUpdateGen, cfg.extractOptions())
+		files = append(files, exeFiles...)
+	}
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitInstall, "Failed to extract %s. %s", installed, err.Error())
+	}
+
+	// The extracted archive is the manifest, its hashes are what the install should have
+	res, err := updater.VerifyInstall(ctx, exPath, updater.Manifest{Version: installed, Files: files}, nil)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitGeneric, "Failed to verify the install. %s", err.Error())
+	}
+
+	damaged := []string{}
+	for _, path := range append(res.Missing, res.Modified...) {
+		if !isPreservableConfig(path) {
+			damaged = append(damaged, path)
+		}
+	}
+	sort.Strings(damaged)
+
+	result = repairResult{Version: installed, Replaced: damaged}
+	if len(damaged) == 0 {
+		fmt.Println("All files are intact, nothing to repair")
+		return result, nil
+	}
+
+	failIfCancelled(ctx)
+	err = replaceDamagedFiles(exPath, newDir, installed, damaged)
+	if err != nil {
+		failf(exitInstall, "Failed to repair the install, the damaged files were put back. %s", err.Error())
+	}
+
+	for _, path := range damaged {
+		fmt.Printf("Replaced %s\n", path)
+	}
+	fmt.Printf("Repaired %d files of Dolphin %s\n", len(damaged), installed)
+	return result, nil
+}
+
+// fetchRepairArchive puts the archive of the installed version at path, reusing one kept by
+// -keep-archive when it's still valid
+func fetchRepairArchive(ctx context.Context, cfg toolsConfig, opts appUpdateOptions, exPath, installed, path string) {
+	if opts.FromFile != "" {
+		fetchArtifact(ctx, cfg, opts, path, nil, "", "", updater.ValidateArchive)
+		return
+	}
+
+	release := getVersion(ctx, cfg, installed)
+
+	keptPath := opts.ArchivePath
+	if keptPath == "" {
+		keptPath = filepath.Join(filepath.Dir(exPath), fmt.Sprintf("dolphin-%s.zip", installed))
+	}
+	if validKeptArchive(keptPath, release) {
+		log.Printf("Using the kept archive %s\n", keptPath)
+		err := copyFile(keptPath, path)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to copy the kept archive, downloading instead. %s\n", err.Error())
+	}
+
+	if runtime.GOOS == "linux" {
+		fetchArtifact(ctx, cfg, opts, path, updater.WithMirrors(release.LinuxZipURL, release.LinuxZipMirrors), "", release.LinuxZipSig, updater.ValidateArchive)
+		return
+	}
+
+	fetchArtifact(ctx, cfg, opts, path, updater.WithMirrors(release.URL, release.Mirrors), release.ArchiveSHA256, release.Signature, updater.ValidateArchive)
+}
+
+func validKeptArchive(path string, release slippiapi.DolphinVersion) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	if runtime.GOOS == "windows" && release.ArchiveSHA256 != "" {
+		return updater.VerifyFileHash(path, release.ArchiveSHA256) == nil
+	}
+
+	return updater.ValidateArchive(path) == nil
+}
+
+// replaceDamagedFiles moves the good copies from newDir over the damaged files. The damaged ones
+// are moved aside through the journal such that a failure, or a crash, puts them back
+func replaceDamagedFiles(exPath, newDir, version string, damaged []string) error {
+	asideDir := filepath.Join(newDir, ".damaged")
+
+	journal, err := beginJournal(exPath, "repair", version, version, newDir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range damaged {
+		if !updater.IsSafeRelPath(path) {
+			log.Printf("Warning: not repairing %s, it is outside of the install\n", path)
+			continue
+		}
+
+		relPath := filepath.FromSlash(path)
+		installPath := filepath.Join(exPath, relPath)
+
+		if _, err := os.Lstat(installPath); err == nil {
+			err = journal.move(installPath, filepath.Join(asideDir, relPath))
+			if err != nil {
+				journal.rollback()
+				journal.finish()
+				return err
+			}
+		}
+
+		err = journal.move(filepath.Join(newDir, relPath), installPath)
+		if err != nil {
+			journal.rollback()
+			journal.finish()
+			return err
+		}
+	}
+
+	journal.finish()
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceDamagedFilesStaysInTheInstall(t *testing.T) {
+	dir := t.TempDir()
+	exPath := filepath.Join(dir, "install")
+	newDir := filepath.Join(exPath, "dolphin-new")
+	writeTestFiles(t, dir, map[string]string{
+		"install/Sys/broken.dll":             "damaged",
+		"install/dolphin-new/Sys/broken.dll": "good",
+		"outside.txt":                        "not ours",
+	})
+
+	err := replaceDamagedFiles(exPath, newDir, "3.0.0", []string{"Sys/broken.dll", "../outside.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(exPath, "Sys", "broken.dll")); got != "good" {
+		t.Errorf("the damaged file is %q, want it replaced", got)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "outside.txt")); got != "not ours" {
+		t.Errorf("the file outside of the install is %q", got)
+	}
+}
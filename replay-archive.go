@@ -0,0 +1,555 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const (
+	replayArchiveDirName = "archive"
+	replayArchiveExt     = ".tar.zst"
+	replayArchiveVersion = 1
+	replayArchiveDays    = 30
+
+	// Every chunk of an archive is its own zstd frame, such that a single replay can be extracted by
+	// decompressing only its chunk. Bigger chunks compress a little better
+	replayArchiveChunkSize = 16 * 1024 * 1024
+)
+
+// archivedReplay is a replay in an archive. It starts Offset bytes into the decompressed chunk
+type archivedReplay struct {
+	replayIndexEntry
+	SHA256 string `json:"sha256"`
+	Chunk  int    `json:"chunk"`
+	Offset int64  `json:"offset"`
+}
+
+// replayArchiveIndex is kept next to every archive as <archive>.json. Chunks are the offsets of the
+// zstd frames in the archive, Dir is the folder the replays were archived from
+type replayArchiveIndex struct {
+	Version   int              `json:"version"`
+	Month     string           `json:"month"`
+	Dir       string           `json:"dir"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Size      int64            `json:"size"`
+	Chunks    []int64          `json:"chunks"`
+	Replays   []archivedReplay `json:"replays"`
+}
+
+type replayArchiveResult struct {
+	Archives []string `json:"archives"`
+	Replays  int      `json:"replays"`
+	Bytes    int64    `json:"bytes"`
+	Archived int64    `json:"archivedBytes"`
+}
+
+// countingWriter keeps track of how much was written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// chunkedArchiveWriter writes a tar stream compressed as a series of zstd frames. A tar reader
+// sees a single archive, and since frames can be decompressed on their own, so can every chunk
+type chunkedArchiveWriter struct {
+	file    *countingWriter
+	encoder *zstd.Encoder
+	chunk   *countingWriter
+	tar     *tar.Writer
+	index   *replayArchiveIndex
+}
+
+func newChunkedArchiveWriter(out io.Writer, index *replayArchiveIndex) (*chunkedArchiveWriter, error) {
+	file := &countingWriter{w: out}
+	encoder, err := zstd.NewWriter(file, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &chunkedArchiveWriter{file: file, encoder: encoder, chunk: &countingWriter{w: encoder}, index: index}
+	aw.tar = tar.NewWriter(aw.chunk)
+	index.Chunks = []int64{0}
+	return aw, nil
+}
+
+// nextChunk ends the current zstd frame and starts a new one
+func (aw *chunkedArchiveWriter) nextChunk() error {
+	err := aw.tar.Flush()
+	if err == nil {
+		err = aw.encoder.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	aw.encoder.Reset(aw.file)
+	aw.chunk.n = 0
+	aw.index.Chunks = append(aw.index.Chunks, aw.file.n)
+	return nil
+}
+
+func (aw *chunkedArchiveWriter) add(path string, entry replayIndexEntry) error {
+	if aw.chunk.n >= replayArchiveChunkSize {
+		err := aw.nextChunk()
+		if err != nil {
+			return err
+		}
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The tar padding of the previous replay has to be written before the offset is taken
+	err = aw.tar.Flush()
+	if err != nil {
+		return err
+	}
+	archived := archivedReplay{replayIndexEntry: entry, Chunk: len(aw.index.Chunks) - 1, Offset: aw.chunk.n}
+
+	header := &tar.Header{
+		Name:    entry.Path,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Format:  tar.FormatPAX,
+	}
+	err = aw.tar.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(aw.tar, hash), in)
+	if err != nil {
+		return err
+	}
+
+	archived.Size = info.Size()
+	archived.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	aw.index.Replays = append(aw.index.Replays, archived)
+	return nil
+}
+
+func (aw *chunkedArchiveWriter) close() error {
+	err := aw.tar.Close()
+	if err == nil {
+		err = aw.encoder.Close()
+	}
+
+	aw.index.Size = aw.file.n
+	return err
+}
+
+func replayArchiveIndexPath(archivePath string) string {
+	return archivePath + ".json"
+}
+
+func loadReplayArchiveIndex(archivePath string) (replayArchiveIndex, error) {
+	var index replayArchiveIndex
+
+	contents, err := ioutil.ReadFile(replayArchiveIndexPath(archivePath))
+	if err != nil {
+		return index, err
+	}
+
+	err = json.Unmarshal(contents, &index)
+	if err == nil && index.Version != replayArchiveVersion {
+		err = fmt.Errorf("archive index was written by another version of the tools")
+	}
+
+	return index, err
+}
+
+// verifyReplayArchive reads the whole archive back and checks every replay against its hash,
+// before the replays it holds are deleted
+func verifyReplayArchive(archivePath string, index replayArchiveIndex) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder, err := zstd.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	reader := tar.NewReader(decoder)
+	for _, replay := range index.Replays {
+		header, err := reader.Next()
+		if err != nil {
+			return fmt.Errorf("%s is missing. %s", replay.Path, err.Error())
+		}
+		if header.Name != replay.Path {
+			return fmt.Errorf("expected %s but found %s", replay.Path, header.Name)
+		}
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, reader)
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != replay.SHA256 {
+			return fmt.Errorf("%s doesn't match the original", replay.Path)
+		}
+	}
+
+	return nil
+}
+
+// nextReplayArchivePath names the archive after the month, with a number added when the month
+// was already archived before
+func nextReplayArchivePath(dir, month string) string {
+	path := filepath.Join(dir, "replays-"+month+replayArchiveExt)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, "replays-"+month+"-"+strconv.Itoa(i)+replayArchiveExt)
+	}
+}
+
+// writeReplayArchive archives the entries into a new archive in outDir and verifies it
+func writeReplayArchive(dir, outDir, month string, entries []replayIndexEntry) (string, replayArchiveIndex, error) {
+	index := replayArchiveIndex{Version: replayArchiveVersion, Month: month, Dir: dir, CreatedAt: time.Now(), Replays: []archivedReplay{}}
+	archivePath := nextReplayArchivePath(outDir, month)
+
+	out, err := os.Create(archivePath + ".part")
+	if err != nil {
+		return archivePath, index, err
+	}
+
+	aw, err := newChunkedArchiveWriter(out, &index)
+	if err == nil {
+		for _, entry := range entries {
+			err = aw.add(filepath.Join(dir, filepath.FromSlash(entry.Path)), entry)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = aw.close()
+	}
+	out.Close()
+	if err == nil {
+		err = verifyReplayArchive(archivePath+".part", index)
+	}
+	if err != nil {
+		os.Remove(archivePath + ".part")
+		return archivePath, index, err
+	}
+
+	contents, err := json.Marshal(index)
+	if err == nil {
+		err = fsutil.WriteFileAtomic(replayArchiveIndexPath(archivePath), contents, 0644)
+	}
+	if err == nil {
+		err = os.Rename(archivePath+".part", archivePath)
+	}
+	if err != nil {
+		os.Remove(archivePath + ".part")
+		os.Remove(replayArchiveIndexPath(archivePath))
+	}
+
+	return archivePath, index, err
+}
+
+// execReplayArchive moves the replays in dir played more than olderThanDays ago into one
+// compressed archive per month. Originals are deleted once their archive is verified, unless keep
+func execReplayArchive(ctx context.Context, dir, outDir string, olderThanDays int, keep, dryRun bool) (result replayArchiveResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered archiving replays")
+		}
+	}()
+
+	if dir == "" {
+		log.Panic("Must provide the replay folder to archive")
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Panic(err)
+	}
+	if outDir == "" {
+		outDir = filepath.Join(dir, replayArchiveDirName)
+	}
+	if olderThanDays <= 0 {
+		olderThanDays = replayArchiveDays
+	}
+
+	indexPath := replayIndexPath(dir, "")
+	previous, err := loadReplayIndex(indexPath)
+	if err != nil || !samePath(previous.Dir, dir) {
+		previous = replayIndex{}
+	}
+
+	index, _, err := buildReplayIndex(ctx, dir, previous, runtime.NumCPU())
+	if err != nil {
+		failIfCancelled(ctx)
+		log.Panicf("Failed to read the replays in %s. %s", dir, err.Error())
+	}
+
+	// Replays that couldn't be read are archived by the month they were last written
+	cutoff := time.Now().AddDate(0, 0, -olderThanDays)
+	months := map[string][]replayIndexEntry{}
+	for _, entry := range index.Replays {
+		playedAt := entry.ModTime
+		if entry.Replay.StartAt != nil {
+			playedAt = *entry.Replay.StartAt
+		}
+		if !playedAt.Before(cutoff) {
+			continue
+		}
+
+		month := playedAt.Local().Format("2006-01")
+		months[month] = append(months[month], entry)
+	}
+
+	names := []string{}
+	for month := range months {
+		names = append(names, month)
+	}
+	sort.Strings(names)
+
+	result.Archives = []string{}
+	if len(names) == 0 {
+		fmt.Printf("No replays older than %d days\n", olderThanDays)
+		return result, nil
+	}
+
+	if !dryRun {
+		err = os.MkdirAll(outDir, 0755)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	archived := map[string]bool{}
+	for _, month := range names {
+		if ctx.Err() != nil {
+			break
+		}
+
+		entries := months[month]
+		size := int64(0)
+		for _, entry := range entries {
+			size += entry.Size
+		}
+		result.Replays += len(entries)
+		result.Bytes += size
+
+		if dryRun {
+			fmt.Printf("Would archive %d replays of %s, %s\n", len(entries), month, updater.FormatBytes(size))
+			continue
+		}
+
+		fmt.Printf("Archiving %d replays of %s, %s...\n", len(entries), month, updater.FormatBytes(size))
+		archivePath, archiveIndex, err := writeReplayArchive(dir, outDir, month, entries)
+		if err != nil {
+			failf(exitInstall, "Failed to archive the replays of %s, nothing was deleted for it. %s", month, err.Error())
+		}
+
+		result.Archives = append(result.Archives, archivePath)
+		result.Archived += archiveIndex.Size
+		fmt.Printf("Saved %s, %s\n", archivePath, updater.FormatBytes(archiveIndex.Size))
+
+		if keep {
+			continue
+		}
+		for _, entry := range entries {
+			err := os.Remove(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete %s after archiving it. %s\n", entry.Path, err.Error())
+				continue
+			}
+			archived[entry.Path] = true
+		}
+	}
+	failIfCancelled(ctx)
+
+	if len(archived) > 0 {
+		remaining := []replayIndexEntry{}
+		for _, entry := range index.Replays {
+			if !archived[entry.Path] {
+				remaining = append(remaining, entry)
+			}
+		}
+		index.Replays = remaining
+
+		contents, err := json.Marshal(index)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(indexPath, contents, 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to update the replay index. %s\n", err.Error())
+		}
+	}
+
+	if !dryRun {
+		fmt.Printf("Archived %d replays, %s down to %s\n", result.Replays, updater.FormatBytes(result.Bytes), updater.FormatBytes(result.Archived))
+	}
+	return result, nil
+}
+
+// extractArchivedReplay writes one replay of the archive to path by decompressing only its chunk
+func extractArchivedReplay(archive *os.File, index replayArchiveIndex, replay archivedReplay, path string) error {
+	if replay.Chunk < 0 || replay.Chunk >= len(index.Chunks) {
+		return fmt.Errorf("invalid chunk %d", replay.Chunk)
+	}
+	start := index.Chunks[replay.Chunk]
+	end := index.Size
+	if replay.Chunk+1 < len(index.Chunks) {
+		end = index.Chunks[replay.Chunk+1]
+	}
+
+	decoder, err := zstd.NewReader(io.NewSectionReader(archive, start, end-start))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	_, err = io.CopyN(ioutil.Discard, decoder, replay.Offset)
+	if err != nil {
+		return err
+	}
+
+	reader := tar.NewReader(decoder)
+	header, err := reader.Next()
+	if err != nil {
+		return err
+	}
+	if header.Name != replay.Path {
+		return fmt.Errorf("archive has %s where %s should be", header.Name, replay.Path)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(path + ".part")
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), reader)
+	out.Close()
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != replay.SHA256 {
+		err = fmt.Errorf("%s doesn't match its hash", replay.Path)
+	}
+	if err == nil {
+		err = os.Rename(path+".part", path)
+	}
+	if err != nil {
+		os.Remove(path + ".part")
+		return err
+	}
+
+	return os.Chtimes(path, header.ModTime, header.ModTime)
+}
+
+// execReplayExtract restores replays from an archive into the folder they were archived from, or
+// outDir. Without names every replay is extracted, names can also be folders or file names
+func execReplayExtract(archivePath, outDir string, names []string) (extracted []string, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered extracting replays")
+		}
+	}()
+
+	if archivePath == "" {
+		log.Panic("Must provide the archive to extract from")
+	}
+
+	index, err := loadReplayArchiveIndex(archivePath)
+	if err != nil {
+		failf(exitVerification, "Failed to read the index of %s. %s", archivePath, err.Error())
+	}
+	if outDir == "" {
+		outDir = index.Dir
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer archive.Close()
+
+	extracted = []string{}
+	for _, replay := range index.Replays {
+		if len(names) > 0 && !matchesArchivedReplay(replay.Path, names) {
+			continue
+		}
+		if !updater.IsSafeRelPath(replay.Path) {
+			log.Printf("Skipping %s, the path isn't safe\n", replay.Path)
+			continue
+		}
+
+		path := filepath.Join(outDir, filepath.FromSlash(replay.Path))
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("Skipping %s, it already exists\n", path)
+			continue
+		}
+
+		err := extractArchivedReplay(archive, index, replay, path)
+		if err != nil {
+			failf(exitInstall, "Failed to extract %s. %s", replay.Path, err.Error())
+		}
+
+		extracted = append(extracted, path)
+		fmt.Println(path)
+	}
+
+	if len(extracted) == 0 {
+		fmt.Println("No replays were extracted")
+	}
+	return extracted, nil
+}
+
+// matchesArchivedReplay matches a replay by its path in the archive, a folder it is in or its
+// file name
+func matchesArchivedReplay(path string, names []string) bool {
+	for _, name := range names {
+		name = strings.Trim(filepath.ToSlash(name), "/")
+		if path == name || strings.HasPrefix(path, name+"/") || filepath.Base(filepath.FromSlash(path)) == name {
+			return true
+		}
+	}
+
+	return false
+}
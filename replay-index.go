@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slp"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const (
+	replayIndexName    = "slippi-replay-index.json"
+	replayIndexVersion = 1
+)
+
+// replayIndexEntry is one replay of the index. Size and ModTime tell whether the file changed since
+// it was indexed, Error is set for files that couldn't be read
+type replayIndexEntry struct {
+	Path    string     `json:"path"`
+	Size    int64      `json:"size"`
+	ModTime time.Time  `json:"modTime"`
+	Replay  slp.Replay `json:"replay"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// replayIndex is written by replay index. Paths are relative to Dir
+type replayIndex struct {
+	Version   int                `json:"version"`
+	Dir       string             `json:"dir"`
+	IndexedAt time.Time          `json:"indexedAt"`
+	Replays   []replayIndexEntry `json:"replays"`
+}
+
+// replayQuery is what replay search filters by, empty fields match everything. Code, character and
+// stage are case insensitive and a replay matches when any player has the code or character
+type replayQuery struct {
+	Code      string
+	Character string
+	Stage     string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (query replayQuery) matches(entry replayIndexEntry) bool {
+	if entry.Error != "" {
+		return false
+	}
+
+	replay := entry.Replay
+	if query.Stage != "" && !strings.EqualFold(replay.Stage, query.Stage) {
+		return false
+	}
+
+	playedAt := entry.ModTime
+	if replay.StartAt != nil {
+		playedAt = *replay.StartAt
+	}
+	if !query.Since.IsZero() && playedAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !playedAt.Before(query.Until) {
+		return false
+	}
+
+	codeFound := query.Code == ""
+	characterFound := query.Character == ""
+	for _, player := range replay.Players {
+		if strings.EqualFold(player.Code, query.Code) {
+			codeFound = true
+		}
+		if strings.EqualFold(player.Character, query.Character) {
+			characterFound = true
+		}
+	}
+
+	return codeFound && characterFound
+}
+
+// parseQueryDate accepts a day or a full timestamp, days are in local time
+func parseQueryDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func replayIndexPath(dir, output string) string {
+	if output != "" {
+		return output
+	}
+
+	return filepath.Join(dir, replayIndexName)
+}
+
+func loadReplayIndex(path string) (replayIndex, error) {
+	var index replayIndex
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return index, err
+	}
+
+	err = json.Unmarshal(contents, &index)
+	if err == nil && index.Version != replayIndexVersion {
+		err = fmt.Errorf("index was written by another version of the tools, run replay index again")
+	}
+
+	return index, err
+}
+
+// findReplays lists the .slp files under dir
+func findReplays(ctx context.Context, dir string) ([]string, error) {
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".slp") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+// buildReplayIndex parses the replays in dir with workers goroutines. Entries of the previous
+// index whose file didn't change are reused, such that indexing again only reads new replays
+func buildReplayIndex(ctx context.Context, dir string, previous replayIndex, workers int) (replayIndex, int, error) {
+	index := replayIndex{Version: replayIndexVersion, Dir: dir, IndexedAt: time.Now()}
+
+	paths, err := findReplays(ctx, dir)
+	if err != nil {
+		return index, 0, err
+	}
+
+	known := map[string]replayIndexEntry{}
+	for _, entry := range previous.Replays {
+		known[entry.Path] = entry
+	}
+
+	entries := make([]replayIndexEntry, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	parsed := 0
+	done := int64(0)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry, read := indexReplay(dir, paths[i], known)
+				entries[i] = entry
+
+				mu.Lock()
+				done++
+				if read {
+					parsed++
+				}
+				progress.Report(updater.Event{Type: "index", File: entries[i].Path, Current: done, Total: int64(len(paths))})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return index, parsed, ctx.Err()
+	}
+
+	index.Replays = entries
+	sort.Slice(index.Replays, func(i, j int) bool { return index.Replays[i].Path < index.Replays[j].Path })
+	return index, parsed, nil
+}
+
+// indexReplay returns the index entry of a replay and whether it had to be read. It runs on the
+// workers, where a panic on a corrupt replay would take down the whole process instead of just
+// failing that replay
+func indexReplay(dir, path string, known map[string]replayIndexEntry) (entry replayIndexEntry, read bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	entry = replayIndexEntry{Path: filepath.ToSlash(rel)}
+	defer func() {
+		if r := recover(); r != nil {
+			entry.Replay = slp.Replay{}
+			entry.Error = fmt.Sprintf("failed to read the replay: %v", r)
+		}
+	}()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, false
+	}
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+
+	if cached, ok := known[entry.Path]; ok && cached.Size == entry.Size && cached.ModTime.Equal(entry.ModTime) {
+		return cached, false
+	}
+
+	entry.Replay, err = slp.Parse(path)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	// The raw metadata makes the index several times bigger, everything searched for is in Replay
+	entry.Replay.Metadata = nil
+	return entry, true
+}
+
+// execReplayIndex indexes the replays in dir and writes the index to output, or into dir
+func execReplayIndex(ctx context.Context, dir, output string, workers int) (index replayIndex, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered indexing replays")
+		}
+	}()
+
+	if dir == "" {
+		log.Panic("Must provide the replay folder to index")
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Panic(err)
+	}
+	path := replayIndexPath(dir, output)
+
+	previous, err := loadReplayIndex(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Indexing all replays again. %s\n", err.Error())
+	}
+	if !samePath(previous.Dir, dir) {
+		previous = replayIndex{}
+	}
+
+	start := time.Now()
+	index, parsed, err := buildReplayIndex(ctx, dir, previous, workers)
+	if err != nil {
+		failIfCancelled(ctx)
+		log.Panicf("Failed to index %s. %s", dir, err.Error())
+	}
+
+	contents, err := json.Marshal(index)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = fsutil.WriteFileAtomic(path, contents, 0644)
+	if err != nil {
+		log.Panicf("Failed to write %s. %s", path, err.Error())
+	}
+
+	failed := 0
+	for _, entry := range index.Replays {
+		if entry.Error != "" {
+			failed++
+		}
+	}
+
+	fmt.Printf("Indexed %d replays in %s, %d read again", len(index.Replays), time.Since(start).Round(time.Millisecond), parsed)
+	if failed > 0 {
+		fmt.Printf(", %d couldn't be read", failed)
+	}
+	fmt.Printf("\nIndex saved to %s\n", path)
+
+	return index, nil
+}
+
+// execReplaySearch lists the replays of an index that match the query. source is the replay folder
+// or the index file itself
+func execReplaySearch(source string, query replayQuery, printJSON bool) (matches []replayIndexEntry, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered searching replays")
+		}
+	}()
+
+	if source == "" {
+		log.Panic("Must provide the replay folder or index to search")
+	}
+
+	path := source
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		path = replayIndexPath(source, "")
+	}
+
+	index, err := loadReplayIndex(path)
+	if os.IsNotExist(err) {
+		failf(exitGeneric, "No index at %s, run replay index first", path)
+	}
+	if err != nil {
+		log.Panicf("Failed to read %s. %s", path, err.Error())
+	}
+
+	matches = []replayIndexEntry{}
+	for _, entry := range index.Replays {
+		if query.matches(entry) {
+			entry.Path = filepath.Join(index.Dir, filepath.FromSlash(entry.Path))
+			matches = append(matches, entry)
+		}
+	}
+
+	if printJSON {
+		contents, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+		return matches, nil
+	}
+
+	for _, entry := range matches {
+		players := []string{}
+		for _, player := range entry.Replay.Players {
+			name := player.Character
+			if player.Code != "" {
+				name += " (" + player.Code + ")"
+			}
+			players = append(players, name)
+		}
+
+		played := entry.ModTime
+		if entry.Replay.StartAt != nil {
+			played = *entry.Replay.StartAt
+		}
+		fmt.Printf("%s  %-20s %5s  %s\n    %s\n", played.Local().Format("2006-01-02 15:04"), entry.Replay.Stage, formatReplayDuration(time.Duration(entry.Replay.Frames)*time.Second/60), strings.Join(players, " vs "), entry.Path)
+	}
+	fmt.Printf("%d of %d replays match\n", len(matches), len(index.Replays))
+
+	return matches, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slp"
+)
+
+// The comm file is how playback Dolphin is told what to play. A running Dolphin keeps watching it
+// and plays the next replay when a command with a new id is written
+const playbackCommFileName = "slippi-playback-comm.json"
+
+// playbackCommand is the contents of the comm file, as written by the launcher. Mode is normal for
+// a single replay and queue to play the clips in Queue one after another
+type playbackCommand struct {
+	Mode           string              `json:"mode"`
+	Replay         string              `json:"replay"`
+	IsRealTimeMode bool                `json:"isRealTimeMode"`
+	CommandID      string              `json:"commandId"`
+	Queue          []playbackQueueItem `json:"queue,omitempty"`
+}
+
+type replayPlayResult struct {
+	Replay   string `json:"replay"`
+	Install  string `json:"install"`
+	Iso      string `json:"iso"`
+	CommFile string `json:"commFile"`
+	// Launched is false when the replay was handed to a playback Dolphin already running
+	Launched bool `json:"launched"`
+}
+
+// encodePlaybackCommand gives the command a new id, such that a running Dolphin picks it up
+func encodePlaybackCommand(command playbackCommand) ([]byte, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	command.CommandID = hex.EncodeToString(id)
+
+	return json.MarshalIndent(command, "", "  ")
+}
+
+func writePlaybackCommFile(path string, command playbackCommand) error {
+	contents, err := encodePlaybackCommand(command)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(path, contents, 0644)
+}
+
+// playbackLaunchCommand builds the command that starts the playback Dolphin of an install with args
+func playbackLaunchCommand(exPath string, args []string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", append([]string{"-n", "-a", findAppBundle(exPath), "--args"}, args...)...)
+	case "linux":
+		if appImagePath := findAppImage(exPath); appImagePath != "" {
+			return exec.Command(appImagePath, args...)
+		}
+	}
+
+	return exec.Command(findDolphinExe(exPath), args...)
+}
+
+// startPlayback hands the command to playback Dolphin of the install cfg points at, launching it
+// unless it is already running. Without isoPath the Melee ISO is picked like app-update -launch does
+func startPlayback(cfg toolsConfig, command playbackCommand, isoPath string) replayPlayResult {
+	if cfg.Target == "" {
+		cfg.Target = slippiapi.TypePlayback
+	}
+	resolveTarget(&cfg)
+	exPath := cfg.InstallDir
+
+	result := replayPlayResult{Replay: command.Replay, Install: exPath, CommFile: filepath.Join(os.TempDir(), playbackCommFileName)}
+	err := writePlaybackCommFile(result.CommFile, command)
+	if err != nil {
+		log.Panicf("Failed to write the playback comm file. %s", err.Error())
+	}
+
+	if len(findDolphinProcesses(exPath)) > 0 {
+		fmt.Println("Playback Dolphin is already running, it will switch over")
+		return result
+	}
+
+	if isoPath == "" {
+		if len(findMeleeIsos(exPath)) == 0 {
+			failf(exitGeneric, "No Melee ISO found in the playback Dolphin config, pass -iso")
+		}
+		isoPath = pickMeleeIso(exPath, !jsonOutput)
+	}
+	result.Iso = isoPath
+
+	cmd := playbackLaunchCommand(exPath, []string{"-i", result.CommFile, "-e", isoPath})
+	cmd.Dir = exPath
+	if runtime.GOOS == "darwin" {
+		err = cmd.Run()
+	} else {
+		err = startDetached(cmd)
+	}
+	if err != nil {
+		log.Panicf("Failed to start playback Dolphin. %s", err.Error())
+	}
+
+	result.Launched = true
+	return result
+}
+
+// execReplayPlay plays a replay with the playback install
+func execReplayPlay(cfg toolsConfig, path, isoPath string) (result replayPlayResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered launching playback")
+		}
+	}()
+
+	if path == "" {
+		log.Panic("Must provide the replay to play")
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		log.Panic(err)
+	}
+	_, err = slp.ReadVersion(path)
+	if err != nil {
+		failf(exitGeneric, "%s is not a replay. %s", path, err.Error())
+	}
+
+	result = startPlayback(cfg, playbackCommand{Mode: "normal", Replay: path}, isoPath)
+	fmt.Printf("Playing %s\n", path)
+	return result, nil
+}
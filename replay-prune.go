@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// replayPrunePolicy picks the replays replay prune deletes, zero values are off
+type replayPrunePolicy struct {
+	ShorterThan   time.Duration
+	OlderThanDays int
+	Duplicates    bool
+}
+
+// prunedReplay is a replay replay prune deletes, or would delete in a dry run
+type prunedReplay struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Size   int64  `json:"size"`
+	// Original is the copy that is kept of a duplicate
+	Original string `json:"original,omitempty"`
+}
+
+type replayPruneResult struct {
+	DryRun  bool           `json:"dryRun"`
+	Replays []prunedReplay `json:"replays"`
+	Bytes   int64          `json:"bytes"`
+}
+
+func hashReplayFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// findDuplicateReplays returns the replays that are byte for byte copies of another, mapped to the
+// one that is kept, which is the oldest copy. Only files of the same size are hashed
+func findDuplicateReplays(ctx context.Context, dir string, entries []replayIndexEntry) (map[string]string, error) {
+	bySize := map[int64][]replayIndexEntry{}
+	for _, entry := range entries {
+		bySize[entry.Size] = append(bySize[entry.Size], entry)
+	}
+
+	duplicates := map[string]string{}
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.Slice(group, func(i, j int) bool {
+			if !group[i].ModTime.Equal(group[j].ModTime) {
+				return group[i].ModTime.Before(group[j].ModTime)
+			}
+			return group[i].Path < group[j].Path
+		})
+
+		kept := map[string]string{}
+		for _, entry := range group {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			hash, err := hashReplayFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+			if err != nil {
+				return nil, err
+			}
+
+			if original, ok := kept[hash]; ok {
+				duplicates[entry.Path] = original
+			} else {
+				kept[hash] = entry.Path
+			}
+		}
+	}
+
+	return duplicates, nil
+}
+
+// selectPrunedReplays applies the policy to the index. Replays that couldn't be read are never
+// picked for their length or age, since neither is known
+func selectPrunedReplays(ctx context.Context, index replayIndex, policy replayPrunePolicy) ([]prunedReplay, error) {
+	duplicates := map[string]string{}
+	if policy.Duplicates {
+		var err error
+		duplicates, err = findDuplicateReplays(ctx, index.Dir, index.Replays)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cutoff := time.Time{}
+	if policy.OlderThanDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -policy.OlderThanDays)
+	}
+
+	pruned := []prunedReplay{}
+	for _, entry := range index.Replays {
+		replay := prunedReplay{Path: entry.Path, Size: entry.Size}
+
+		playedAt := entry.ModTime
+		if entry.Replay.StartAt != nil {
+			playedAt = *entry.Replay.StartAt
+		}
+		length := time.Duration(entry.Replay.Frames) * time.Second / 60
+
+		switch {
+		case duplicates[entry.Path] != "":
+			replay.Reason = "duplicate"
+			replay.Original = duplicates[entry.Path]
+		case entry.Error != "":
+			continue
+		case policy.ShorterThan > 0 && length < policy.ShorterThan:
+			replay.Reason = "short"
+		case !cutoff.IsZero() && playedAt.Before(cutoff):
+			replay.Reason = "old"
+		default:
+			continue
+		}
+
+		pruned = append(pruned, replay)
+	}
+
+	return pruned, nil
+}
+
+// execReplayPrune deletes the replays in dir that match the policy, only listing them with dryRun.
+// The replay index of the folder is used and updated such that the replays are only read once
+func execReplayPrune(ctx context.Context, dir string, policy replayPrunePolicy, dryRun, skipConfirm bool) (result replayPruneResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered pruning replays")
+		}
+	}()
+
+	if dir == "" {
+		log.Panic("Must provide the replay folder to prune")
+	}
+	if policy.ShorterThan <= 0 && policy.OlderThanDays <= 0 && !policy.Duplicates {
+		log.Panic("Must pass -shorter-than, -older-than-days or -duplicates to pick the replays to delete")
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Panic(err)
+	}
+	indexPath := replayIndexPath(dir, "")
+
+	previous, err := loadReplayIndex(indexPath)
+	if err != nil || !samePath(previous.Dir, dir) {
+		previous = replayIndex{}
+	}
+
+	index, _, err := buildReplayIndex(ctx, dir, previous, runtime.NumCPU())
+	if err != nil {
+		failIfCancelled(ctx)
+		log.Panicf("Failed to read the replays in %s. %s", dir, err.Error())
+	}
+
+	result.DryRun = dryRun
+	result.Replays, err = selectPrunedReplays(ctx, index, policy)
+	if err != nil {
+		failIfCancelled(ctx)
+		log.Panicf("Failed to look for duplicates. %s", err.Error())
+	}
+
+	for _, replay := range result.Replays {
+		result.Bytes += replay.Size
+		line := fmt.Sprintf("%-9s %s", replay.Reason, replay.Path)
+		if replay.Original != "" {
+			line += " (copy of " + replay.Original + ")"
+		}
+		fmt.Println(line)
+	}
+
+	if len(result.Replays) == 0 {
+		fmt.Println("No replays to delete")
+		return result, nil
+	}
+
+	summary := fmt.Sprintf("%d of %d replays, %s", len(result.Replays), len(index.Replays), updater.FormatBytes(result.Bytes))
+	if dryRun {
+		fmt.Printf("Would delete %s\n", summary)
+		return result, nil
+	}
+	if !skipConfirm && !confirm("Delete "+summary+"?") {
+		fmt.Println("Nothing was deleted")
+		result.Replays = []prunedReplay{}
+		result.Bytes = 0
+		return result, nil
+	}
+
+	deleted := map[string]bool{}
+	for _, replay := range result.Replays {
+		err := os.Remove(filepath.Join(dir, filepath.FromSlash(replay.Path)))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete %s. %s\n", replay.Path, err.Error())
+			continue
+		}
+		deleted[replay.Path] = true
+	}
+
+	// Keep the index in step with the folder such that search doesn't list deleted replays
+	remaining := []replayIndexEntry{}
+	for _, entry := range index.Replays {
+		if !deleted[entry.Path] {
+			remaining = append(remaining, entry)
+		}
+	}
+	index.Replays = remaining
+
+	contents, err := json.Marshal(index)
+	if err == nil {
+		err = fsutil.WriteFileAtomic(indexPath, contents, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to update the replay index. %s\n", err.Error())
+	}
+
+	fmt.Printf("Deleted %d replays\n", len(deleted))
+	if len(deleted) < len(result.Replays) {
+		failf(exitGeneric, "%d replays couldn't be deleted", len(result.Replays)-len(deleted))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slp"
+)
+
+// playbackQueueItem is one clip of a queue. Without frames the whole replay is played
+type playbackQueueItem struct {
+	Path       string `json:"path"`
+	StartFrame *int   `json:"startFrame,omitempty"`
+	EndFrame   *int   `json:"endFrame,omitempty"`
+}
+
+// queueEntryPattern matches a replay with a frame range such as game.slp:-123-600. Either end of the
+// range can be left out, the first frame of a game is negative
+var queueEntryPattern = regexp.MustCompile(`(?i)^(.+\.slp):(-?\d*)-(-?\d*)$`)
+
+// parseQueueEntry splits an entry into the replay path and its optional frame range
+func parseQueueEntry(entry string) (string, *int, *int, error) {
+	match := queueEntryPattern.FindStringSubmatch(entry)
+	if match == nil {
+		return entry, nil, nil, nil
+	}
+
+	frames := []*int{nil, nil}
+	for i, value := range match[2:] {
+		if value == "" {
+			continue
+		}
+
+		frame, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid frame %s in %s", value, entry)
+		}
+		frames[i] = &frame
+	}
+
+	return match[1], frames[0], frames[1], nil
+}
+
+// readQueueFile reads the entries of a file with one per line. Empty lines and lines starting with
+// # are skipped
+func readQueueFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// queueItems turns an entry into the clips it stands for. Folders add all of their replays in
+// order, replays are read to check the frame range
+func queueItems(ctx context.Context, entry string) ([]playbackQueueItem, error) {
+	path, start, end, err := parseQueueEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		paths, err := findReplays(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+
+		items := []playbackQueueItem{}
+		for _, path := range paths {
+			items = append(items, playbackQueueItem{Path: path})
+		}
+		return items, nil
+	}
+
+	replay, err := slp.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a replay. %s", path, err.Error())
+	}
+
+	lastFrame := slp.FirstFrame + replay.Frames - 1
+	switch {
+	case start != nil && (*start < slp.FirstFrame || *start > lastFrame):
+		return nil, fmt.Errorf("start frame %d of %s is outside of the game, which has frames %d to %d", *start, path, slp.FirstFrame, lastFrame)
+	case end != nil && (*end < slp.FirstFrame || *end > lastFrame):
+		return nil, fmt.Errorf("end frame %d of %s is outside of the game, which has frames %d to %d", *end, path, slp.FirstFrame, lastFrame)
+	case start != nil && end != nil && *start >= *end:
+		return nil, fmt.Errorf("start frame %d of %s is not before its end frame %d", *start, path, *end)
+	}
+
+	return []playbackQueueItem{{Path: path, StartFrame: start, EndFrame: end}}, nil
+}
+
+// execReplayQueue builds a playback queue from replays, folders and clips, with the entries listed
+// in the from file first. The queue is written to output or printed, or played right away with play
+func execReplayQueue(ctx context.Context, cfg toolsConfig, entries []string, from, output string, play bool, isoPath string) (command playbackCommand, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered building the playback queue")
+		}
+	}()
+
+	if from != "" {
+		listed, err := readQueueFile(from)
+		if err != nil {
+			log.Panicf("Failed to read %s. %s", from, err.Error())
+		}
+		entries = append(listed, entries...)
+	}
+	if len(entries) == 0 {
+		log.Panic("Must provide the replays to queue, or -from")
+	}
+
+	command = playbackCommand{Mode: "queue", Queue: []playbackQueueItem{}}
+	for _, entry := range entries {
+		items, err := queueItems(ctx, entry)
+		if err != nil {
+			failIfCancelled(ctx)
+			failf(exitGeneric, "Failed to queue %s. %s", entry, err.Error())
+		}
+		command.Queue = append(command.Queue, items...)
+	}
+	if len(command.Queue) == 0 {
+		failf(exitGeneric, "No replays to queue")
+	}
+
+	switch {
+	case play:
+		startPlayback(cfg, command, isoPath)
+		fmt.Printf("Playing %d clips\n", len(command.Queue))
+	case output != "":
+		contents, err := encodePlaybackCommand(command)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(output, contents, 0644)
+		}
+		if err != nil {
+			log.Panicf("Failed to write %s. %s", output, err.Error())
+		}
+		fmt.Printf("Queued %d clips in %s\n", len(command.Queue), output)
+	case !jsonOutput:
+		contents, err := encodePlaybackCommand(command)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+	}
+
+	return command, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slp"
+)
+
+// formatReplayDuration prints a duration as minutes and seconds like the in game timer
+func formatReplayDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func describeReplayPlayer(player slp.Player) string {
+	description := fmt.Sprintf("P%d %s", player.Port, player.Character)
+	details := []string{player.Type, fmt.Sprintf("%d stocks", player.Stocks)}
+	if player.Team > 0 {
+		details = append(details, fmt.Sprintf("team %d", player.Team))
+	}
+	description += " (" + strings.Join(details, ", ") + ")"
+
+	switch {
+	case player.Name != "" && player.Code != "":
+		description += fmt.Sprintf(" %s [%s]", player.Name, player.Code)
+	case player.Name != "":
+		description += " " + player.Name
+	case player.Tag != "":
+		description += " " + player.Tag
+	}
+
+	return description
+}
+
+// execReplayInfo prints what a replay contains, as json with printJSON
+func execReplayInfo(path string, printJSON bool) (replay slp.Replay, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered reading replay")
+		}
+	}()
+
+	if path == "" {
+		log.Panic("Must provide the replay to read")
+	}
+
+	replay, err := slp.Parse(path)
+	if err != nil {
+		failf(exitVerification, "Failed to read %s. %s", path, err.Error())
+	}
+
+	if printJSON {
+		contents, err := json.MarshalIndent(replay, "", "  ")
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+		return replay, nil
+	}
+
+	fmt.Printf("Replay:   %s\n", path)
+	fmt.Printf("Slippi:   %s\n", replay.Version)
+	if replay.StartAt != nil {
+		played := replay.StartAt.Local().Format("2006-01-02 15:04")
+		if replay.PlayedOn != "" {
+			played += " on " + replay.PlayedOn
+		}
+		fmt.Printf("Played:   %s\n", played)
+	}
+	if replay.MatchID != "" {
+		fmt.Printf("Match:    %s game %d\n", replay.MatchID, replay.GameNumber)
+	}
+	fmt.Printf("Stage:    %s\n", replay.Stage)
+	fmt.Printf("Duration: %s (%d frames)\n", formatReplayDuration(replay.Duration), replay.Frames)
+	if replay.EndMethod != "" {
+		fmt.Printf("Ended:    %s\n", replay.EndMethod)
+	}
+	if !replay.Complete {
+		fmt.Println("The replay has no metadata, the game was probably cut off")
+	}
+	fmt.Println("Players:")
+	for _, player := range replay.Players {
+		fmt.Printf("  %s\n", describeReplayPlayer(player))
+	}
+
+	return replay, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func systemdUserDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// systemdQuote quotes an ExecStart argument, % and $ would otherwise be expanded by systemd
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	return `"` + arg + `"`
+}
+
+// installLinuxSchedule writes a oneshot service and a timer that starts it, and enables the timer
+// for the current user. The first run is 10 minutes after boot or after enabling it
+func installLinuxSchedule(name, exePath string, args []string, intervalHours int) error {
+	dir, err := systemdUserDir()
+	if err != nil {
+		return err
+	}
+
+	quoted := []string{}
+	for _, arg := range append([]string{exePath}, args...) {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	service := fmt.Sprintf(`[Unit]
+Description=Slippi Dolphin update
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, strings.Join(quoted, " "))
+
+	timer := fmt.Sprintf(`[Unit]
+Description=Slippi Dolphin update every %d hours
+
+[Timer]
+OnBootSec=10min
+OnActiveSec=10min
+OnUnitActiveSec=%dh
+
+[Install]
+WantedBy=timers.target
+`, intervalHours, intervalHours)
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, name+".service"), []byte(service), 0644)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, name+".timer"), []byte(timer), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = runScheduler("systemctl", "--user", "daemon-reload")
+	if err != nil {
+		return err
+	}
+
+	return runScheduler("systemctl", "--user", "enable", "--now", name+".timer")
+}
+
+func removeLinuxSchedule(name string) error {
+	dir, err := systemdUserDir()
+	if err != nil {
+		return err
+	}
+
+	timerPath := filepath.Join(dir, name+".timer")
+	if _, err := os.Stat(timerPath); os.IsNotExist(err) {
+		return fmt.Errorf("no scheduled updates found")
+	}
+
+	runScheduler("systemctl", "--user", "disable", "--now", name+".timer")
+	os.Remove(filepath.Join(dir, name+".service"))
+	err = os.Remove(timerPath)
+	if err != nil {
+		return err
+	}
+
+	return runScheduler("systemctl", "--user", "daemon-reload")
+}
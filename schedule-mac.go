@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func launchAgentPath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "Library", "LaunchAgents", "gg.slippi."+name+".plist"), nil
+}
+
+// installMacSchedule writes a launch agent for the current user and loads it, replacing an agent
+// loaded by an earlier install
+func installMacSchedule(name, exePath string, args []string, intervalHours int) error {
+	path, err := launchAgentPath(name)
+	if err != nil {
+		return err
+	}
+
+	var programArgs bytes.Buffer
+	for _, arg := range append([]string{exePath}, args...) {
+		programArgs.WriteString("\t\t<string>")
+		xml.EscapeText(&programArgs, []byte(arg))
+		programArgs.WriteString("</string>\n")
+	}
+
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>gg.slippi.%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>StartInterval</key>
+	<integer>%d</integer>
+</dict>
+</plist>
+`, name, programArgs.String(), intervalHours*60*60)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, []byte(plist), 0644)
+	if err != nil {
+		return err
+	}
+
+	runScheduler("launchctl", "unload", path)
+	return runScheduler("launchctl", "load", "-w", path)
+}
+
+func removeMacSchedule(name string) error {
+	path, err := launchAgentPath(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no scheduled updates found")
+	}
+
+	runScheduler("launchctl", "unload", "-w", path)
+	return os.Remove(path)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var scheduleCommands = []string{"check", "app-update"}
+
+// scheduleName identifies the scheduled job of an install, such that several installs on the same
+// machine can each have their own
+func scheduleName(cfg toolsConfig) string {
+	sum := sha1.Sum([]byte(strings.ToLower(cfg.InstallDir)))
+	return "slippi-dolphin-update-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// scheduledArgs is what the scheduler runs. Only the install is passed, the rest of the config
+// comes from config.json since schedulers don't run with the user's environment
+func scheduledArgs(cfg toolsConfig, command string) []string {
+	if command == "check" {
+		return []string{"check", "-notify", "-install-dir", cfg.InstallDir}
+	}
+
+	// Nobody is there to answer an administrator prompt
+	return []string{"-no-elevate", "app-update", "-non-interactive", "-install-dir", cfg.InstallDir}
+}
+
+// execSchedule registers the tools with Task Scheduler on Windows, launchd on macOS or a systemd
+// user timer on Linux to run command every intervalHours
+func execSchedule(cfg toolsConfig, action, command string, intervalHours int) error {
+	name := scheduleName(cfg)
+
+	if action == "remove" {
+		var err error
+		switch runtime.GOOS {
+		case "windows":
+			err = removeWindowsSchedule(name)
+		case "darwin":
+			err = removeMacSchedule(name)
+		default:
+			err = removeLinuxSchedule(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Removed scheduled updates")
+		return nil
+	}
+
+	if action != "install" {
+		return fmt.Errorf("unknown action %s, expected install or remove", action)
+	}
+	if !containsFold(scheduleCommands, command) {
+		return fmt.Errorf("unknown command %s, expected one of %s", command, strings.Join(scheduleCommands, ", "))
+	}
+	if intervalHours < 1 {
+		return fmt.Errorf("interval must be at least 1 hour, got %d", intervalHours)
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := scheduledArgs(cfg, strings.ToLower(command))
+
+	switch runtime.GOOS {
+	case "windows":
+		err = installWindowsSchedule(name, exePath, args, intervalHours)
+	case "darwin":
+		err = installMacSchedule(name, exePath, args, intervalHours)
+	default:
+		err = installLinuxSchedule(name, exePath, args, intervalHours)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Scheduled %s to run every %d hours as %s\n", command, intervalHours, name)
+	return nil
+}
+
+func runScheduler(name string, args ...string) error {
+	log.Printf("Running %s %s\n", name, strings.Join(args, " "))
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %s. %s", name, err.Error(), strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// installWindowsSchedule creates a task for the current user. Whole days use a daily schedule since
+// hourly ones only go up to 23
+func installWindowsSchedule(name, exePath string, args []string, intervalHours int) error {
+	quoted := []string{}
+	for _, arg := range append([]string{exePath}, args...) {
+		quoted = append(quoted, `"`+arg+`"`)
+	}
+
+	schedule, modifier := "HOURLY", intervalHours
+	if intervalHours%24 == 0 {
+		schedule, modifier = "DAILY", intervalHours/24
+	} else if intervalHours > 23 {
+		return fmt.Errorf("intervals above 23 hours must be whole days on Windows, got %d", intervalHours)
+	}
+
+	return runScheduler(
+		"schtasks", "/Create", "/F",
+		"/TN", name,
+		"/SC", schedule,
+		"/MO", strconv.Itoa(modifier),
+		"/TR", strings.Join(quoted, " "),
+	)
+}
+
+func removeWindowsSchedule(name string) error {
+	return runScheduler("schtasks", "/Delete", "/F", "/TN", name)
+}
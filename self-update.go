@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+type selfUpdateResult struct {
+	PrevVersion string `json:"prevVersion"`
+	Version     string `json:"version"`
+	Updated     bool   `json:"updated"`
+}
+
+func getLatestTools(ctx context.Context, cfg toolsConfig, channel string) (slippiapi.ToolsRelease, error) {
+	var release slippiapi.ToolsRelease
+	err := queryProviders(ctx, cfg, "", &release, func(provider slippiapi.Provider) (err error) {
+		release, err = provider.LatestTools(ctx, runtime.GOOS, runtime.GOARCH, channel)
+		return err
+	})
+
+	return release, err
+}
+
+// execSelfUpdate updates only the tools, independently of Dolphin. The running binary is renamed
+// out of the way first since Windows doesn't allow replacing a running exe but does allow renaming
+// it
+func execSelfUpdate(ctx context.Context, cfg toolsConfig, checkOnly, force bool) (result selfUpdateResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered updating dolphin-slippi-tools")
+		}
+	}()
+
+	result.PrevVersion = toolsVersion
+
+	exePath, err := os.Executable()
+	if err == nil {
+		exePath, err = filepath.EvalSymlinks(exePath)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	exDir := filepath.Dir(exePath)
+	oldExePath := filepath.Join(exDir, "old-"+filepath.Base(exePath))
+
+	// Left over from the previous self update, it can only be deleted once that process exited
+	os.RemoveAll(oldExePath)
+
+	release, err := getLatestTools(ctx, cfg, cfg.channel(readInstalledVersion(cfg.InstallDir)))
+	if err != nil {
+		failf(exitNetwork, "Failed to look up the latest dolphin-slippi-tools. %s", err.Error())
+	}
+	if release.Version == "" || release.URL == "" {
+		failf(exitNetwork, "No dolphin-slippi-tools release is available for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	result.Version = release.Version
+
+	if !updateAvailable(toolsVersion, release.Version) && !force {
+		fmt.Printf("dolphin-slippi-tools %s is up to date\n", toolsVersion)
+		return result, nil
+	}
+
+	if checkOnly {
+		fmt.Printf("dolphin-slippi-tools %s is available, you have %s\n", release.Version, toolsVersion)
+		return result, nil
+	}
+
+	// Development builds have no comparable version, don't replace them by accident
+	if toolsVersion == "dev" && !force {
+		fmt.Println("This is a development build, pass -force to replace it with the latest release")
+		return result, nil
+	}
+
+	ensureWritable(exDir)
+
+	dir, err := createStagingDir(cfg.TempDir, exDir)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	downloadPath := filepath.Join(dir, filepath.Base(exePath))
+	fmt.Printf("Downloading dolphin-slippi-tools %s...\n", release.Version)
+	err = cfg.downloader().Download(ctx, downloadPath, updater.WithMirrors(release.URL, release.Mirrors), release.SHA256, validateExecutable)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitNetwork, "Failed to download dolphin-slippi-tools. %s", err.Error())
+	}
+
+	err = verifyReleaseSignature(downloadPath, release.Signature)
+	if err != nil {
+		failf(exitVerification, "Failed to verify download. %s", err.Error())
+	}
+
+	// Copied next to the exe such that the swap is just renames on the same volume
+	newExePath := exePath + ".new"
+	err = copyFile(downloadPath, newExePath)
+	if err == nil {
+		err = os.Chmod(newExePath, 0755)
+	}
+	if err != nil {
+		os.RemoveAll(newExePath)
+		failf(exitInstall, "Failed to stage the new dolphin-slippi-tools. %s", err.Error())
+	}
+
+	err = os.Rename(exePath, oldExePath)
+	if err != nil {
+		os.RemoveAll(newExePath)
+		failf(exitInstall, "Failed to rename dolphin-slippi-tools. %s", err.Error())
+	}
+
+	err = os.Rename(newExePath, exePath)
+	if err == nil {
+		err = checkToolsRun(ctx, exePath)
+	}
+	if err != nil {
+		os.RemoveAll(newExePath)
+		restoreUpdater(exePath, oldExePath)
+		failf(exitInstall, "Failed to install the new dolphin-slippi-tools, the previous one was restored. %s", err.Error())
+	}
+
+	// Windows keeps the running exe locked, it is removed by the next self update
+	if runtime.GOOS != "windows" {
+		os.RemoveAll(oldExePath)
+	}
+
+	result.Updated = true
+	fmt.Printf("Updated dolphin-slippi-tools from %s to %s\n", toolsVersion, release.Version)
+	return result, nil
+}
+
+// checkToolsRun makes sure the new binary starts on this machine before we commit to it
+func checkToolsRun(ctx context.Context, exePath string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, exePath, "version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("new version failed to run: %s. %s", err.Error(), bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// validateExecutable checks that a download is a binary for this platform
+func validateExecutable(path string) error {
+	magics := [][]byte{[]byte("\x7fELF")}
+	switch runtime.GOOS {
+	case "windows":
+		magics = [][]byte{[]byte("MZ")}
+	case "darwin":
+		// 64-bit Mach-O and universal binaries
+		magics = [][]byte{{0xcf, 0xfa, 0xed, 0xfe}, {0xca, 0xfe, 0xba, 0xbe}}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	n, _ := io.ReadFull(f, header)
+	for _, magic := range magics {
+		if n >= len(magic) && bytes.Equal(header[:len(magic)], magic) {
+			return nil
+		}
+	}
+
+	return errors.New("download did not return a valid executable")
+}
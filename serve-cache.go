@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// completeSuffix marks a cached file as fully downloaded. A marker instead of renaming a .part
+// file, Windows can't rename a file clients are still reading
+const completeSuffix = ".complete"
+
+// releaseRefresh bounds how often a url that isn't a known release download makes the cache ask
+// the version API again
+const releaseRefresh = time.Minute
+
+// cacheFill is a download from upstream in progress. Every client asking for the file follows it
+// as it grows, such that it is downloaded once however many setups want it
+type cacheFill struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	path    string
+	// size is -1 until upstream answered, and stays -1 when it doesn't tell
+	size    int64
+	started bool
+	written int64
+	done    bool
+	err     error
+}
+
+type cacheServer struct {
+	cfg   toolsConfig
+	dir   string
+	mu    sync.Mutex
+	fills map[string]*cacheFill
+
+	releasesMu  sync.Mutex
+	releaseURLs map[string]bool
+	resolvedAt  time.Time
+	// refresh is closed when the lookup of the releases in progress is done, nil when there is none
+	refresh chan struct{}
+}
+
+func defaultCacheDir() string {
+	return filepath.Join(getExecutableDir(), "release-cache")
+}
+
+// cachePath names the file after a hash of the url, with the file name kept for whoever looks
+// into the folder
+func (s *cacheServer) cachePath(source *url.URL) string {
+	hash := sha256.Sum256([]byte(source.String()))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:8])+"-"+path.Base(source.Path))
+}
+
+// dolphinDownloads lists the downloads of a release for every platform, with their mirrors
+func dolphinDownloads(release slippiapi.DolphinVersion) []string {
+	urls := updater.WithMirrors(release.URL, release.Mirrors)
+	urls = append(urls, updater.WithMirrors(release.MacURL, release.MacMirrors)...)
+	urls = append(urls, updater.WithMirrors(release.AppImageURL, release.AppImageMirrors)...)
+	return append(urls, updater.WithMirrors(release.LinuxZipURL, release.LinuxZipMirrors)...)
+}
+
+// isReleaseURL checks that a url is a download of the latest netplay or playback release of a
+// channel, otherwise anyone on the network could make the cache fetch anything. Releases are looked
+// up again when an unknown url is asked for, urls of earlier releases stay allowed. Known urls are
+// answered right away, also while a lookup is in progress
+func (s *cacheServer) isReleaseURL(ctx context.Context, url string) bool {
+	s.releasesMu.Lock()
+	if s.releaseURLs[url] {
+		s.releasesMu.Unlock()
+		return true
+	}
+	refresh := s.refresh
+	if refresh == nil && time.Since(s.resolvedAt) >= releaseRefresh {
+		refresh = make(chan struct{})
+		s.refresh = refresh
+		s.resolvedAt = time.Now()
+		go s.lookUpReleases(refresh)
+	}
+	s.releasesMu.Unlock()
+
+	if refresh != nil {
+		select {
+		case <-refresh:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	s.releasesMu.Lock()
+	defer s.releasesMu.Unlock()
+	return s.releaseURLs[url]
+}
+
+// lookUpReleases adds the downloads of the latest releases to the known urls and closes done. It
+// isn't tied to the request that started it, the others asking in the meantime wait for it too
+func (s *cacheServer) lookUpReleases(done chan struct{}) {
+	urls := []string{}
+	for _, target := range []string{slippiapi.TypeNetplay, slippiapi.TypePlayback} {
+		cfg := s.cfg
+		cfg.Target = target
+		for _, channel := range validChannels {
+			urls = append(urls, dolphinDownloads(getLatestVersion(context.Background(), cfg, channel))...)
+		}
+	}
+
+	s.releasesMu.Lock()
+	for _, url := range urls {
+		s.releaseURLs[url] = true
+	}
+	s.refresh = nil
+	s.releasesMu.Unlock()
+	close(done)
+}
+
+func (s *cacheServer) handleFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rawURL := r.URL.Query().Get("url")
+	source, err := url.Parse(rawURL)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+		http.Error(w, "url must be an http or https url", http.StatusBadRequest)
+		return
+	}
+	if !s.isReleaseURL(r.Context(), rawURL) {
+		log.Printf("%s %s (refused, not a release download)\n", r.RemoteAddr, source)
+		http.Error(w, "only downloads of Dolphin releases are cached", http.StatusForbidden)
+		return
+	}
+
+	cachePath := s.cachePath(source)
+	if _, err := os.Stat(cachePath + completeSuffix); err == nil {
+		log.Printf("%s %s (cached)\n", r.RemoteAddr, source)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeFile(w, r, cachePath)
+		return
+	}
+
+	s.mu.Lock()
+	fill, ok := s.fills[cachePath]
+	if !ok {
+		fill = &cacheFill{path: cachePath, size: -1}
+		fill.changed = sync.NewCond(&fill.mu)
+		s.fills[cachePath] = fill
+		go s.download(fill, source)
+		log.Printf("%s %s (downloading)\n", r.RemoteAddr, source)
+	} else {
+		log.Printf("%s %s (joining the download)\n", r.RemoteAddr, source)
+	}
+	s.mu.Unlock()
+
+	s.follow(w, r, fill)
+}
+
+// download fetches the file from upstream into the cache. It doesn't stop when the client that
+// started it goes away, the others and the next setup still want it
+func (s *cacheServer) download(fill *cacheFill, source *url.URL) {
+	finish := func(err error) {
+		fill.mu.Lock()
+		fill.done = true
+		fill.err = err
+		fill.changed.Broadcast()
+		fill.mu.Unlock()
+
+		// A failed download is tried again by the next request
+		s.mu.Lock()
+		delete(s.fills, fill.path)
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to download %s. %s\n", source, err.Error())
+		}
+	}
+
+	res, err := s.cfg.downloadClient().Get(source.String())
+	if err != nil {
+		finish(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		finish(&slippiapi.StatusError{StatusCode: res.StatusCode, Status: res.Status})
+		return
+	}
+	// The same limit as for a file in an archive, a release is never near it
+	maxBytes := int64(s.cfg.extractLimits().MaxFileBytes)
+	if maxBytes > 0 && res.ContentLength > maxBytes {
+		finish(fmt.Errorf("the file is larger than %d MB", s.cfg.MaxFileMB))
+		return
+	}
+
+	os.Remove(fill.path + completeSuffix)
+	f, err := os.Create(fill.path)
+	if err != nil {
+		finish(err)
+		return
+	}
+
+	fill.mu.Lock()
+	fill.size = res.ContentLength
+	fill.started = true
+	fill.changed.Broadcast()
+	fill.mu.Unlock()
+
+	buf := make([]byte, 256*1024)
+	for {
+		n, readErr := res.Body.Read(buf)
+		if n > 0 {
+			_, err = f.Write(buf[:n])
+			if err != nil {
+				break
+			}
+			fill.mu.Lock()
+			fill.written += int64(n)
+			fill.changed.Broadcast()
+			fill.mu.Unlock()
+			if maxBytes > 0 && fill.written > maxBytes {
+				err = fmt.Errorf("the file is larger than %d MB", s.cfg.MaxFileMB)
+				break
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && fill.size >= 0 && fill.written != fill.size {
+		err = fmt.Errorf("got %d of %d bytes", fill.written, fill.size)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(fill.path+completeSuffix, nil, 0644)
+	}
+	if err != nil {
+		os.Remove(fill.path)
+	} else {
+		log.Printf("Cached %s\n", source)
+	}
+	finish(err)
+}
+
+// follow sends the file to the client as the download writes it. Ranges can't be served until the
+// file is complete, clients then get all of it, which the downloader handles
+func (s *cacheServer) follow(w http.ResponseWriter, r *http.Request, fill *cacheFill) {
+	fill.mu.Lock()
+	for !fill.started && !fill.done {
+		fill.changed.Wait()
+	}
+	size, err := fill.size, fill.err
+	if !fill.started && err != nil {
+		fill.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	fill.mu.Unlock()
+
+	f, err := os.Open(fill.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var sent int64
+	for {
+		fill.mu.Lock()
+		for fill.written == sent && !fill.done {
+			fill.changed.Wait()
+		}
+		written, done, err := fill.written, fill.done, fill.err
+		fill.mu.Unlock()
+
+		// Cutting the response short tells the client the download failed
+		if err != nil || r.Context().Err() != nil {
+			return
+		}
+
+		n, copyErr := io.CopyN(w, f, written-sent)
+		sent += n
+		if copyErr != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done && sent == written {
+			return
+		}
+	}
+}
+
+// execServeCache runs the LAN cache until it is stopped with Ctrl+C
+func execServeCache(ctx context.Context, cfg toolsConfig, listen, dir string) (returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered serving the cache")
+		}
+	}()
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		failf(exitNotWritable, "Failed to create the cache folder. %s", err.Error())
+	}
+
+	s := &cacheServer{cfg: cfg, dir: dir, fills: map[string]*cacheFill{}, releaseURLs: map[string]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", s.handleFetch)
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	address := listen
+	if strings.HasPrefix(address, ":") {
+		address = "<this machine>" + address
+	}
+	fmt.Printf("Serving release downloads from %s, point setups at it with -lan-cache http://%s\n", dir, address)
+	err = server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		failf(exitNetwork, "Failed to serve the cache. %s", err.Error())
+	}
+
+	return nil
+}
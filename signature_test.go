@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestVerifyReleaseSignatureWithoutKey(t *testing.T) {
+	defer func(key string, allow bool) {
+		releasePublicKey, allowUnsigned = key, allow
+	}(releasePublicKey, allowUnsigned)
+	releasePublicKey = ""
+
+	allowUnsigned = false
+	if err := verifyReleaseSignature("release.zip", ""); err == nil {
+		t.Error("a build without a key accepted the download")
+	}
+
+	allowUnsigned = true
+	if err := verifyReleaseSignature("release.zip", ""); err != nil {
+		t.Errorf("-allow-unsigned didn't skip the check. %s", err.Error())
+	}
+}
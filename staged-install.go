@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/fsutil"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+const backupDirName = "dolphin-backup"
+
+// installArchive extracts the downloaded version into a staging directory, verifies it, and then
+// swaps it into the install. Everything replaced is moved to a backup first such that a failure at
+// any step restores the previous install, as does cancelling ctx before the new version is complete
+func installArchive(ctx context.Context, cfg toolsConfig, exPath, zipFilePath, prevVersion string, latest slippiapi.DolphinVersion) {
+	// Extract next to the install such that the swap is just renames on the same volume
+	newDir, err := ioutil.TempDir(exPath, "dolphin-new")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(newDir)
+
+	// The exact size is known now, better to fail here than halfway through extracting
+	checkDiskSpace([]spaceNeed{{Dir: exPath, Bytes: extractedSize(zipFilePath), What: "new version"}})
+
+	// Extract all non-exe files used for update
+	files, err := updater.Extract(ctx, newDir, zipFilePath, fullUpdateGen, cfg.extractOptions())
+	if err != nil {
+		failIfCancelled(ctx)
+		failIfAntivirus(exPath, err)
+		failf(exitInstall, "Failed to extract update. %s", err.Error())
+	}
+
+	// Now extract the exe
+	exeFiles, err := updater.Extract(ctx, newDir, zipFilePath, exeUpdateGen, cfg.extractOptions())
+	if err != nil {
+		failIfCancelled(ctx)
+		failIfAntivirus(exPath, err)
+		failf(exitInstall, "Failed to extract update. %s", err.Error())
+	}
+
+	// The exe was written, if it's gone already an antivirus took it
+	if _, err := os.Stat(findDolphinExe(newDir)); os.IsNotExist(err) && len(exeFiles) > 0 && runtime.GOOS == "windows" {
+		failAntivirus(exPath, findDolphinExe(newDir), "quarantined")
+	}
+
+	if latest.ExeSHA256 != "" {
+		err = updater.VerifyFileHash(findDolphinExe(newDir), latest.ExeSHA256)
+		if err != nil {
+			failf(exitVerification, "Extracted Dolphin failed verification. %s", err.Error())
+		}
+	}
+
+	// Find the config files the user changed before the swap moves them to the backup
+	prevManifest, _ := readUpdateManifest(exPath)
+	modifiedConfig := findModifiedConfig(exPath, prevManifest)
+
+	defaultsDir, err := stageConfigDefaults(exPath, newDir, files)
+	if err != nil {
+		failf(exitInstall, "Failed to stage config defaults. %s", err.Error())
+	}
+	defer os.RemoveAll(defaultsDir)
+
+	// From here on the install changes, a crash is repaired from the journal on the next run
+	failIfCancelled(ctx)
+	journal, err := beginJournal(exPath, "update", prevVersion, latest.Version, newDir, defaultsDir)
+	if err != nil {
+		failf(exitInstall, "Failed to start the update journal, nothing was changed. %s", err.Error())
+	}
+
+	swap, err := swapIntoInstall(journal, exPath, newDir)
+	if err != nil {
+		journal.finish()
+		failf(exitInstall, "Failed to install new version, previous version was restored. %s", err.Error())
+	}
+
+	// Some antivirus products only look at the exe once it's in the install
+	if _, err := os.Stat(findDolphinExe(exPath)); os.IsNotExist(err) && runtime.GOOS == "windows" {
+		swap.rollback()
+		journal.finish()
+		failAntivirus(exPath, findDolphinExe(exPath), "quarantined")
+	}
+
+	// Catch the exe being corrupted or tampered with after it was moved (antivirus, interrupted writes)
+	if latest.ExeSHA256 != "" {
+		err = updater.VerifyFileHash(findDolphinExe(exPath), latest.ExeSHA256)
+		if err != nil {
+			swap.rollback()
+			journal.finish()
+			failf(exitVerification, "Installed Dolphin failed verification, previous version was restored. %s", err.Error())
+		}
+	}
+
+	// A matching hash doesn't mean it runs, a missing Visual C++ runtime only shows when it starts
+	if cfg.HealthCheck {
+		version, err := checkDolphinStarts(ctx, exPath)
+		if err != nil && ctx.Err() == nil {
+			swap.rollback()
+			journal.finish()
+			failf(exitVerification, "Installed Dolphin failed to start, previous version was restored. %s", err.Error())
+		}
+		if version != "" {
+			log.Printf("Health check passed: %s\n", version)
+		}
+	}
+
+	// Cancelled during the swap, the renames are quick so it completed but isn't wanted anymore
+	if ctx.Err() != nil {
+		swap.rollback()
+		journal.finish()
+		failf(exitCancelled, "Cancelled, previous version was restored")
+	}
+
+	// The new version is complete, what is left can be finished from the journal after a crash
+	journal.BackupDir = backupDirName
+	journal.DefaultsDir = filepath.Base(defaultsDir)
+	journal.ModifiedConfig = modifiedConfig
+	journal.Files = append(files, exeFiles...)
+	journal.setPhase(journalFinishing)
+
+	// Restores the user's config, saves the defaults and records which files were written, which
+	// is useful for support to diagnose issues
+	journal.finishUpdate()
+	journal.finish()
+
+	if cfg.CleanupOrphans {
+		cleanupOrphans(ctx, cfg, exPath, swap.backupDir, prevVersion, prevManifest, journal.Files)
+	}
+}
+
+type installSwap struct {
+	journal   *updateJournal
+	backupDir string
+}
+
+// swapIntoInstall moves the new version into the install. Dolphin owned entries (Sys and the exe)
+// are swapped as a whole, any the new version no longer has included, and top level files are
+// replaced one by one. Other folders, such as User in portable installs, are merged file by file
+// since they hold what the user made. Everything replaced goes to the backup directory. The exe is
+// moved last such that a partial swap never leaves a runnable install
+func swapIntoInstall(journal *updateJournal, exPath, newDir string) (*installSwap, error) {
+	exPath, newDir = fsutil.LongPath(exPath), fsutil.LongPath(newDir)
+	swap := &installSwap{journal: journal, backupDir: filepath.Join(exPath, backupDirName)}
+
+	// Only keep the backup of the most recent update
+	err := os.RemoveAll(swap.backupDir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(swap.backupDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	exeNames := []string{}
+	merged := []string{}
+	for _, entry := range entries {
+		switch {
+		case isDolphinExe(entry.Name()):
+			exeNames = append(exeNames, entry.Name())
+		case entry.IsDir() && !containsFold(managedEntries(), entry.Name()):
+			merged = append(merged, entry.Name())
+		default:
+			names = append(names, entry.Name())
+		}
+	}
+
+	// Merged before the exe too, folders next to it can hold what it needs to start
+	for _, name := range merged {
+		err = swap.merge(newDir, exPath, name)
+		if err != nil {
+			swap.rollback()
+			return nil, fmt.Errorf("failed to move %s into install. %s", name, err.Error())
+		}
+	}
+
+	names = append(names, exeNames...)
+
+	// Back up everything we are about to replace
+	toBackUp := append(managedEntries(), names...)
+	backedUp := []string{}
+	for _, name := range toBackUp {
+		if containsFold(backedUp, name) {
+			continue
+		}
+
+		err = swap.backUp(exPath, name)
+		if err != nil {
+			swap.rollback()
+			return nil, fmt.Errorf("failed to back up %s. %s", name, err.Error())
+		}
+		backedUp = append(backedUp, name)
+	}
+
+	for _, name := range names {
+		err = journal.move(filepath.Join(newDir, name), filepath.Join(exPath, name))
+		if err != nil {
+			swap.rollback()
+			return nil, fmt.Errorf("failed to move %s into install. %s", name, err.Error())
+		}
+	}
+
+	return swap, nil
+}
+
+// backUp moves the entry at relPath of the install into the backup directory, if there is one
+func (swap *installSwap) backUp(exPath, relPath string) error {
+	path := filepath.Join(exPath, relPath)
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	return swap.journal.move(path, filepath.Join(swap.backupDir, relPath))
+}
+
+// merge moves the files of the folder name of newDir into the same folder of the install, backing
+// up only the files it replaces. Files of the install the new version doesn't have are kept
+func (swap *installSwap) merge(newDir, exPath, name string) error {
+	return filepath.Walk(filepath.Join(newDir, name), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(newDir, path)
+		if err != nil {
+			return err
+		}
+		installPath := filepath.Join(exPath, relPath)
+
+		// A file where the new version has a folder is in the way, a folder is merged into
+		if info.IsDir() {
+			existing, err := os.Lstat(installPath)
+			if err == nil && !existing.IsDir() {
+				return swap.backUp(exPath, relPath)
+			}
+			return nil
+		}
+
+		err = swap.backUp(exPath, relPath)
+		if err != nil {
+			return err
+		}
+		return swap.journal.move(path, installPath)
+	})
+}
+
+// rollback moves anything the swap installed back out and the backed up entries back in
+func (swap *installSwap) rollback() {
+	swap.journal.rollback()
+}
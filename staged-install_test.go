@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for rel, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "<missing>"
+	}
+	return string(contents)
+}
+
+func TestSwapIntoInstallMergesUserFolder(t *testing.T) {
+	exPath := t.TempDir()
+	exe := dolphinExeNames[0]
+	writeTestFiles(t, exPath, map[string]string{
+		exe:                                  "old exe",
+		"Sys/old.txt":                        "old",
+		"User/Config/Profiles/GCPad/box.ini": "mine",
+		"User/Config/Dolphin.ini":            "my settings",
+		"User/Wii/title/card.raw":            "memory card",
+		"portable.txt":                       "",
+	})
+
+	newDir := filepath.Join(exPath, "dolphin-new")
+	writeTestFiles(t, newDir, map[string]string{
+		exe:                       "new exe",
+		"Sys/new.txt":             "new",
+		"User/Config/Dolphin.ini": "release defaults",
+		"portable.txt":            "",
+	})
+
+	journal, err := beginJournal(exPath, "update", "1.0.0", "2.0.0", newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap, err := swapIntoInstall(journal, exPath, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installed := map[string]string{
+		exe:                                  "new exe",
+		"Sys/new.txt":                        "new",
+		"Sys/old.txt":                        "<missing>",
+		"User/Config/Profiles/GCPad/box.ini": "mine",
+		"User/Config/Dolphin.ini":            "release defaults",
+		"User/Wii/title/card.raw":            "memory card",
+	}
+	for rel, want := range installed {
+		if got := readTestFile(t, filepath.Join(exPath, filepath.FromSlash(rel))); got != want {
+			t.Errorf("%s is %q after the swap, want %q", rel, got, want)
+		}
+	}
+
+	// Only what was replaced is in the backup, which the next update deletes
+	backedUp := map[string]string{
+		exe:                       "old exe",
+		"Sys/old.txt":             "old",
+		"User/Config/Dolphin.ini": "my settings",
+		"User/Wii/title/card.raw": "<missing>",
+	}
+	for rel, want := range backedUp {
+		if got := readTestFile(t, filepath.Join(swap.backupDir, filepath.FromSlash(rel))); got != want {
+			t.Errorf("%s is %q in the backup, want %q", rel, got, want)
+		}
+	}
+
+	swap.rollback()
+	journal.finish()
+	restored := map[string]string{
+		exe:                                  "old exe",
+		"Sys/old.txt":                        "old",
+		"Sys/new.txt":                        "<missing>",
+		"User/Config/Profiles/GCPad/box.ini": "mine",
+		"User/Config/Dolphin.ini":            "my settings",
+		"User/Wii/title/card.raw":            "memory card",
+	}
+	for rel, want := range restored {
+		if got := readTestFile(t, filepath.Join(exPath, filepath.FromSlash(rel))); got != want {
+			t.Errorf("%s is %q after the rollback, want %q", rel, got, want)
+		}
+	}
+}
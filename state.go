@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// toolsState holds values the tools persist between runs, stored next to the install
+type toolsState struct {
+	SnoozedVersion string `json:"snoozedVersion,omitempty"`
+	Channel        string `json:"channel,omitempty"`
+}
+
+func statePath(exPath string) string {
+	return filepath.Join(exPath, "slippi-tools-state.json")
+}
+
+func loadState(exPath string) toolsState {
+	var state toolsState
+
+	contents, err := ioutil.ReadFile(statePath(exPath))
+	if os.IsNotExist(err) {
+		return state
+	}
+	if err != nil {
+		log.Printf("Failed to read state file, ignoring it. %s\n", err.Error())
+		return state
+	}
+
+	err = json.Unmarshal(contents, &state)
+	if err != nil {
+		log.Printf("Failed to parse state file, ignoring it. %s\n", err.Error())
+	}
+
+	return state
+}
+
+func saveState(exPath string, state toolsState) error {
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(statePath(exPath), contents, 0644)
+}
+
+// isSnoozed returns true if the user asked not to be told about this version
+func (state toolsState) isSnoozed(version string) bool {
+	return state.SnoozedVersion != "" && state.SnoozedVersion == version
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// texturePack is an installed pack, a folder in Load/Textures/GALE01 of the user folder
+type texturePack struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// meleeTexturesDir is where Dolphin loads custom textures for Melee from, including subfolders
+func meleeTexturesDir(userDir string) string {
+	return filepath.Join(userDir, "Load", "Textures", meleeGameID)
+}
+
+// isTextureFile matches the names Dolphin gives dumped textures, which packs have to keep
+func isTextureFile(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	ext := path.Ext(base)
+	return strings.HasPrefix(base, "tex1_") && (ext == ".png" || ext == ".dds")
+}
+
+// looksLikeGameID matches folders named after a game such as GALE01
+func looksLikeGameID(name string) bool {
+	if len(name) != 6 || name[0] != 'G' {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// texturePackLayout returns where each texture of the archive goes inside the pack folder. Packs
+// are zipped in all kinds of ways, so everything up to a GALE01 folder, or else the folders all
+// textures share, is dropped. Fails for archives without textures or with textures for other games
+func texturePackLayout(entries []updater.Entry) (map[string]string, error) {
+	textures := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isTextureFile(entry.Name) {
+			continue
+		}
+		if !updater.IsSafeRelPath(entry.Name) {
+			return nil, fmt.Errorf("pack contains an unsafe path: %s", entry.Name)
+		}
+
+		textures = append(textures, strings.TrimPrefix(path.Clean(entry.Name), "./"))
+	}
+	if len(textures) == 0 {
+		return nil, fmt.Errorf("no textures found, texture files are named like tex1_64x64_..._14.png")
+	}
+
+	// Drop everything up to the game folder, which has to be Melee's if there is one
+	layout := map[string]string{}
+	common := []string(nil)
+	for _, name := range textures {
+		parts := strings.Split(name, "/")
+		rel := parts
+		for i, part := range parts[:len(parts)-1] {
+			if looksLikeGameID(part) {
+				if part != meleeGameID {
+					return nil, fmt.Errorf("pack is made for %s, not Melee (%s)", part, meleeGameID)
+				}
+				rel = parts[i+1:]
+			}
+		}
+		layout[name] = strings.Join(rel, "/")
+
+		dir := rel[:len(rel)-1]
+		if common == nil {
+			common = dir
+		}
+		for i := range common {
+			if i >= len(dir) || dir[i] != common[i] {
+				common = common[:i]
+				break
+			}
+		}
+	}
+
+	// Also drop the folders every texture is in, the pack gets its own folder anyway
+	for name, rel := range layout {
+		layout[name] = strings.Join(strings.Split(rel, "/")[len(common):], "/")
+	}
+
+	return layout, nil
+}
+
+// texturePackName names the pack after the archive, or the last part of the url
+func texturePackName(source string) string {
+	name := source
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Host != "" {
+		name = path.Base(u.Path)
+	}
+
+	name = filepath.Base(name)
+	for _, ext := range []string{".zip", ".7z", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+
+	return name
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetchTexturePack returns a local path to the archive, downloading it into the staging directory
+// if source is a url
+func fetchTexturePack(ctx context.Context, cfg toolsConfig, source, stagingDir string) string {
+	if !isURL(source) {
+		return source
+	}
+
+	archivePath := filepath.Join(stagingDir, "textures")
+	log.Printf("Downloading %s...\n", source)
+	err := cfg.downloader().Download(ctx, archivePath, []string{source}, "", updater.ValidateArchive)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitNetwork, "Failed to download the texture pack. %s", err.Error())
+	}
+
+	return archivePath
+}
+
+// installTexturePack extracts the textures into a folder next to the pack's and swaps it in, such
+// that a failure leaves the old version of the pack
+func installTexturePack(ctx context.Context, archivePath, packDir string) (texturePack, error) {
+	pack := texturePack{Name: filepath.Base(packDir)}
+
+	archive, err := updater.OpenArchive(archivePath)
+	if err != nil {
+		return pack, err
+	}
+	defer archive.Close()
+
+	layout, err := texturePackLayout(archive.Entries())
+	if err != nil {
+		return pack, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(packDir), 0755)
+	if err != nil {
+		return pack, err
+	}
+	newDir, err := ioutil.TempDir(filepath.Dir(packDir), "."+pack.Name+"-new")
+	if err != nil {
+		return pack, err
+	}
+	defer os.RemoveAll(newDir)
+
+	err = archive.Walk(func(entry updater.Entry, contents io.Reader) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, ok := layout[strings.TrimPrefix(path.Clean(entry.Name), "./")]
+		if !ok || entry.IsDir() {
+			return nil
+		}
+
+		target := filepath.Join(newDir, filepath.FromSlash(rel))
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		written, err := io.Copy(out, contents)
+		out.Close()
+
+		pack.Files++
+		pack.Bytes += written
+		return err
+	})
+	if err != nil {
+		return pack, err
+	}
+
+	err = os.RemoveAll(packDir)
+	if err != nil {
+		return pack, err
+	}
+
+	return pack, os.Rename(newDir, packDir)
+}
+
+// listTexturePacks returns the packs in the Melee texture folder. Textures lying directly in it
+// aren't part of a pack and are left out
+func listTexturePacks(userDir string) ([]texturePack, error) {
+	packs := []texturePack{}
+
+	entries, err := ioutil.ReadDir(meleeTexturesDir(userDir))
+	if os.IsNotExist(err) {
+		return packs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		pack := texturePack{Name: entry.Name()}
+		err := filepath.Walk(filepath.Join(meleeTexturesDir(userDir), entry.Name()), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				pack.Files++
+				pack.Bytes += info.Size()
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+
+	return packs, nil
+}
+
+// setHiresTextures turns custom textures on or off in GFX.ini
+func setHiresTextures(userDir string, enabled bool) error {
+	value := "False"
+	if enabled {
+		value = "True"
+	}
+
+	return setDolphinSetting(userDir, dolphinSetting{File: "GFX", Section: "Settings", Key: "HiresTextures", Value: value})
+}
+
+// execTextures installs, lists or removes texture packs of the install
+func execTextures(ctx context.Context, cfg toolsConfig, userDir, action, arg, name string) (packs []texturePack, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered managing texture packs")
+		}
+	}()
+
+	if userDir == "" {
+		userDir = dolphinUserDir(cfg.InstallDir)
+	}
+
+	// Dolphin writes GFX.ini when it closes, which would undo enabling the textures
+	if action != "list" && len(findDolphinProcesses(cfg.InstallDir)) > 0 {
+		failf(exitGeneric, "Close Dolphin before changing texture packs")
+	}
+
+	switch action {
+	case "install":
+		if arg == "" {
+			log.Panic("Must provide the zip or url of the texture pack to install")
+		}
+		if name == "" {
+			name = texturePackName(arg)
+		}
+		if !updater.IsSafeRelPath(name) || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			log.Panicf("Invalid texture pack name %s", name)
+		}
+
+		stagingDir, err := createStagingDir(cfg.TempDir, cfg.InstallDir)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer os.RemoveAll(stagingDir)
+
+		archivePath := fetchTexturePack(ctx, cfg, arg, stagingDir)
+		pack, err := installTexturePack(ctx, archivePath, filepath.Join(meleeTexturesDir(userDir), name))
+		if err != nil {
+			failIfCancelled(ctx)
+			failf(exitInstall, "Failed to install %s. %s", name, err.Error())
+		}
+
+		err = setHiresTextures(userDir, true)
+		if err != nil {
+			log.Panicf("Failed to enable custom textures in GFX.ini. %s", err.Error())
+		}
+
+		fmt.Printf("Installed texture pack %s with %d textures, custom textures are enabled\n", pack.Name, pack.Files)
+		return []texturePack{pack}, nil
+	case "list":
+		packs, err := listTexturePacks(userDir)
+		if err != nil {
+			log.Panicf("Failed to list texture packs. %s", err.Error())
+		}
+
+		if len(packs) == 0 {
+			fmt.Println("No texture packs installed")
+		}
+		for _, pack := range packs {
+			fmt.Printf("%-32s %6d textures %8.1f MB\n", pack.Name, pack.Files, float64(pack.Bytes)/1024/1024)
+		}
+		return packs, nil
+	case "remove":
+		if arg == "" || strings.ContainsAny(arg, `/\`) || strings.HasPrefix(arg, ".") {
+			log.Panic("Must provide the name of the texture pack to remove, as shown by textures list")
+		}
+
+		packDir := filepath.Join(meleeTexturesDir(userDir), arg)
+		if _, err := os.Stat(packDir); err != nil {
+			failf(exitGeneric, "Texture pack %s is not installed", arg)
+		}
+		err := os.RemoveAll(packDir)
+		if err != nil {
+			log.Panicf("Failed to remove %s. %s", arg, err.Error())
+		}
+
+		// Loose textures still need custom textures enabled
+		entries, _ := ioutil.ReadDir(meleeTexturesDir(userDir))
+		if len(entries) == 0 {
+			err = setHiresTextures(userDir, false)
+			if err != nil {
+				log.Printf("Failed to disable custom textures in GFX.ini. %s\n", err.Error())
+			}
+		}
+
+		fmt.Printf("Removed texture pack %s\n", arg)
+		return []texturePack{}, nil
+	}
+
+	log.Panicf("Unknown textures action %s, must be install, list or remove", action)
+	return nil, nil
+}
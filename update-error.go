@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Exit codes used when running non-interactively, such that scripts can tell failures apart
+const (
+	exitGeneric      = 1
+	exitNotWritable  = 3
+	exitNetwork      = 4
+	exitInstall      = 5
+	exitVerification = 6
+	exitAntivirus    = 7
+	exitCancelled    = 130
+)
+
+type updateError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *updateError) Error() string {
+	return e.Message
+}
+
+// failf logs the message and panics with an updateError carrying the exit code. Like log.Panicf,
+// it is recovered at the top of the command
+func failf(code int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Output(2, msg)
+	panic(&updateError{Code: code, Message: msg})
+}
+
+// recoveredError converts a recovered panic into an updateError, panics that didn't come from
+// failf get the generic exit code
+func recoveredError(r interface{}, fallback string) *updateError {
+	if err, ok := r.(*updateError); ok {
+		return err
+	}
+
+	return &updateError{Code: exitGeneric, Message: fmt.Sprintf("%s: %v", fallback, r)}
+}
+
+// failIfCancelled stops the command once it was cancelled with Ctrl+C, SIGTERM or over ipc. The
+// deferred cleanups remove whatever was staged
+func failIfCancelled(ctx context.Context) {
+	if ctx.Err() != nil {
+		failf(exitCancelled, "Cancelled")
+	}
+}
+
+func isCancelled(err error) bool {
+	uerr, ok := err.(*updateError)
+	return ok && uerr.Code == exitCancelled
+}
+
+// ensureWritable makes sure we can write to the install before doing anything destructive. Since
+// nothing changed yet, a permission error can still be fixed by running the command elevated
+func ensureWritable(dir string) {
+	err := checkWritable(dir)
+	if err != nil {
+		elevateIfNotWritable(err)
+		fmt.Println("The install directory isn't writable. Try moving Dolphin to a folder you own or running as administrator.")
+		failf(exitNotWritable, "Install directory %s isn't writable. %s", dir, err.Error())
+	}
+}
+
+type failureReport struct {
+	Command  string       `json:"command"`
+	Args     []string     `json:"args"`
+	FailedAt time.Time    `json:"failedAt"`
+	Error    *updateError `json:"error"`
+}
+
+// exitAfterFailure prints the error in a structured form, writes a report next to the install
+// and exits with the error's code after the countdown
+func exitAfterFailure(exPath, command string, err error, countdown int) {
+	uerr, ok := err.(*updateError)
+	if !ok {
+		uerr = &updateError{Code: exitGeneric, Message: err.Error()}
+	}
+
+	report := failureReport{
+		Command:  command,
+		Args:     os.Args[2:],
+		FailedAt: time.Now(),
+		Error:    uerr,
+	}
+
+	if jsonOutput {
+		emitEvent(resultEvent{Type: "result", Command: command, Success: false, Error: uerr})
+	} else {
+		contents, _ := json.Marshal(map[string]*updateError{"error": uerr})
+		fmt.Println(string(contents))
+	}
+
+	contents, _ := json.MarshalIndent(report, "", "  ")
+	reportErr := ioutil.WriteFile(filepath.Join(exPath, "last-failure.json"), contents, 0644)
+	if reportErr != nil {
+		log.Printf("Failed to write failure report. %s\n", reportErr.Error())
+	}
+
+	for i := countdown; i > 0; i-- {
+		fmt.Printf("\rExiting in %d...", i)
+		time.Sleep(time.Second)
+	}
+	if countdown > 0 {
+		fmt.Println("")
+	}
+
+	os.Exit(uerr.Code)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/userconfig"
+)
+
+// tokenPageURL is where logged in users can copy a token from when the device flow can't be used
+const tokenPageURL = "https://slippi.gg/settings/token"
+
+func execUserLogin(ctx context.Context, cfg toolsConfig, variant, pathOverride, token string, paste bool) (result userUpdateResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered logging in")
+		}
+	}()
+
+	path, err := userFilePath(cfg, variant, pathOverride)
+	if err != nil {
+		log.Panicf("Could not find where user.json goes, got %s", err.Error())
+	}
+
+	api := cfg.rest()
+	switch {
+	case token != "":
+	case paste:
+		token = readPastedToken()
+	default:
+		token, err = deviceLogin(ctx, api)
+		if err != nil {
+			failf(exitNetwork, "Failed to log in, got %s. Use -paste to log in with a token from %s instead", err.Error(), tokenPageURL)
+		}
+	}
+
+	account, err := api.Me(ctx, token)
+	if err != nil {
+		failf(exitNetwork, "Failed to fetch your account, got %s", err.Error())
+	}
+	if account.UID == "" || account.PlayKey == "" {
+		failf(exitVerification, "The server did not return a play key. Make sure you have set up Slippi Online on slippi.gg")
+	}
+
+	// Keep what Dolphin tracks in user.json that isn't part of the account, the response can also
+	// hold fields that don't belong in user.json
+	var prev userconfig.File
+	if _, err := os.Stat(path); err == nil {
+		prev = parseCurrentFile(path)
+	}
+	file := prev
+	file.SetUser(account)
+
+	result.ConnectCode = file.ConnectCode
+	result.DisplayName = file.DisplayName
+	checkAccount(ctx, cfg, prev, file, &result)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		log.Panicf("Failed to create the user.json folder, got %s", err.Error())
+	}
+
+	err = userconfig.Write(path, file)
+	if err != nil {
+		log.Panicf("Failed to write user json file, got %s", err.Error())
+	}
+
+	fmt.Printf("Logged in as %s (%s), saved %s\n", file.DisplayName, file.ConnectCode, path)
+	return result, nil
+}
+
+func readPastedToken() string {
+	fmt.Printf("Open %s, copy the token and paste it here: ", tokenPageURL)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	token := strings.TrimSpace(answer)
+	if token == "" {
+		log.Panic("No token was entered")
+	}
+
+	return token
+}
+
+// deviceLogin asks the user to approve the login in their browser and waits for them to do so
+func deviceLogin(ctx context.Context, api slippiapi.REST) (string, error) {
+	auth, err := api.StartDeviceLogin(ctx, "dolphin-slippi-tools")
+	if err != nil {
+		return "", err
+	}
+	if auth.DeviceCode == "" {
+		return "", errors.New("no device code returned")
+	}
+
+	fmt.Printf("Open %s and enter the code %s to log in\n", auth.VerificationURI, auth.UserCode)
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(auth.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 15 * time.Minute
+	}
+	deadline := time.Now().Add(expiresIn)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		resp, err := api.PollDeviceLogin(ctx, auth.DeviceCode)
+		if err != nil {
+			return "", err
+		}
+
+		switch resp.Status {
+		case slippiapi.LoginPending:
+		case slippiapi.LoginSlowDown:
+			interval += 5 * time.Second
+		case slippiapi.LoginApproved:
+			if resp.AccessToken == "" {
+				return "", errors.New("login was approved but no token was returned")
+			}
+			return resp.AccessToken, nil
+		case slippiapi.LoginDenied:
+			return "", errors.New("login was denied")
+		default:
+			return "", fmt.Errorf("unexpected login status %s", resp.Status)
+		}
+	}
+
+	return "", errors.New("the code expired before the login was approved")
+}
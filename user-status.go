@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/userconfig"
+)
+
+// Account statuses that stop the user from playing online
+const (
+	accountBanned  = "banned"
+	accountExpired = "expired"
+)
+
+// userUpdateResult is reported at the end of user-update
+type userUpdateResult struct {
+	ConnectCode     string                   `json:"connectCode"`
+	DisplayName     string                   `json:"displayName"`
+	PrevConnectCode string                   `json:"prevConnectCode,omitempty"`
+	Account         *slippiapi.AccountStatus `json:"account,omitempty"`
+}
+
+// checkAccount prints what changed about the account and fails with an actionable message if it
+// can't be used to play online anymore
+func checkAccount(ctx context.Context, cfg toolsConfig, prev, updated userconfig.File, result *userUpdateResult) {
+	if prev.ConnectCode != "" && prev.ConnectCode != updated.ConnectCode {
+		result.PrevConnectCode = prev.ConnectCode
+		fmt.Printf("Your connect code changed from %s to %s\n", prev.ConnectCode, updated.ConnectCode)
+	}
+	if prev.DisplayName != "" && prev.DisplayName != updated.DisplayName {
+		fmt.Printf("Your display name changed from %s to %s\n", prev.DisplayName, updated.DisplayName)
+	}
+
+	account, err := cfg.userGraphQL().AccountStatus(ctx, updated.UID, updated.PlayKey)
+	if err != nil {
+		log.Printf("Warning: could not check your account status. %s\n", err.Error())
+		return
+	}
+	result.Account = &account
+
+	switch strings.ToLower(account.Status) {
+	case accountBanned:
+		failf(exitVerification, "Your account %s is banned from Slippi Online. Contact the Slippi team through Discord if you think this is a mistake", updated.ConnectCode)
+	case accountExpired:
+		failf(exitVerification, "Your account %s has expired. Log in again on slippi.gg to reactivate it", updated.ConnectCode)
+	}
+
+	if !account.PlayKeyValid {
+		failf(exitVerification, "The play key in user.json is no longer valid. Log out and back in from Dolphin's Slippi Online settings to get a new one")
+	}
+
+	if account.Rank != "" {
+		fmt.Printf("Account %s is active, rank: %s\n", updated.ConnectCode, account.Rank)
+	} else {
+		fmt.Printf("Account %s is active\n", updated.ConnectCode)
+	}
+}
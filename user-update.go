@@ -2,90 +2,71 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"io/ioutil"
 	"log"
-	"os"
-	"path/filepath"
 
-	"github.com/machinebox/graphql"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/userconfig"
 )
 
-type userGqlResponse struct {
-	User            userFile         `json:"user"`
-	DolphinVersions []dolphinVersion `json:"dolphinVersions"`
+// userFilePath returns where the user.json of a Dolphin lives, see userconfig.Path. A path passed
+// with -path wins
+func userFilePath(cfg toolsConfig, variant, override string) (string, error) {
+	return userconfig.Path(cfg.InstallDir, variant, override)
 }
 
-type userFile struct {
-	UID           string `json:"uid"`
-	PlayKey       string `json:"playKey"`
-	ConnectCode   string `json:"connectCode"`
-	DisplayName   string `json:"displayName"`
-	LatestVersion string `json:"latestVersion"`
-}
+func execUserUpdate(ctx context.Context, cfg toolsConfig, variant, pathOverride string) (result userUpdateResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered updating user")
+		}
+	}()
 
-func execUserUpdate() {
-	// Get executable path
-	ex, err := os.Executable()
+	path, err := userFilePath(cfg, variant, pathOverride)
 	if err != nil {
-		log.Panic(err)
+		log.Panicf("Could not find user.json, got %s", err.Error())
 	}
-	exPath := filepath.Dir(ex)
-
-	file := parseCurrentFile(exPath)
-	resp := getGqlResponse(file.UID)
 
-	file.ConnectCode = resp.User.ConnectCode
-	file.LatestVersion = resp.DolphinVersions[0].Version
+	prev := parseCurrentFile(path)
+	resp := getUser(ctx, cfg, prev.UID)
 
-	contents, err := json.Marshal(file)
-	if err != nil {
-		log.Panicf("Failed to create json file, got %s", err.Error())
+	file := prev
+	file.Merge(resp.User)
+	if len(resp.DolphinVersions) > 0 {
+		file.LatestVersion = resp.DolphinVersions[0].Version
 	}
 
-	err = ioutil.WriteFile(filepath.Join(exPath, "user.json"), contents, 0644)
-	if err != nil {
-		log.Panicf("Failed to write user json file, got %s", err.Error())
-	}
-}
+	result.ConnectCode = file.ConnectCode
+	result.DisplayName = file.DisplayName
+	checkAccount(ctx, cfg, prev, file, &result)
 
-func parseCurrentFile(exPath string) userFile {
-	f, err := os.Open(filepath.Join(exPath, "user.json"))
+	err = userconfig.Write(path, file)
 	if err != nil {
-		log.Panicf("Could not open user.json file, got %s", err.Error())
+		log.Panicf("Failed to write user json file, got %s", err.Error())
 	}
 
-	decoder := json.NewDecoder(f)
+	return result, nil
+}
 
-	var uf userFile
-	err = decoder.Decode(&uf)
+func parseCurrentFile(path string) userconfig.File {
+	file, err := userconfig.Load(path)
 	if err != nil {
-		log.Panicf("Failed to get message type, got %s", err.Error())
+		log.Panicf("Could not read user.json file, got %s", err.Error())
 	}
 
-	return uf
+	return file
 }
 
-func getGqlResponse(uid string) userGqlResponse {
-	client := graphql.NewClient("https://slippi-hasura.herokuapp.com/v1/graphql")
-	req := graphql.NewRequest(`
-		query ($type: String!, $uid: String!) {
-			dolphinVersions(order_by: {releasedAt: desc}, limit: 1, where: {type: {_eq: $type}}) {
-				version
-			}
-			user (uid: $uid) {
-				uid
-				connectCode
-			}
-		}	
-	`)
+// getUser fetches the account from the user endpoints. The last good response is used when none
+// of them can be reached
+func getUser(ctx context.Context, cfg toolsConfig, uid string) slippiapi.UserResponse {
+	gql := cfg.userGraphQL()
 
-	req.Var("type", "ishii")
-	req.Var("uid", uid)
-	ctx := context.Background()
-
-	var resp userGqlResponse
-	err := client.Run(ctx, req, &resp)
+	resp, err := gql.User(ctx, uid)
+	if err == nil {
+		saveCachedResponse(cfg, "user:"+uid, gql.Name(), resp)
+	} else {
+		err = useCachedResponse(cfg, "user:"+uid, &resp, err)
+	}
 	if err != nil {
 		log.Panicf("Failed to fetch user info from graphql server, got %s", err.Error())
 	}
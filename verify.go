@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/updater"
+)
+
+// verifyResult is reported at the end of verify. Config files the user changed are listed apart
+// since they are expected to differ
+type verifyResult struct {
+	Version        string   `json:"version"`
+	Source         string   `json:"source"`
+	Missing        []string `json:"missing"`
+	Modified       []string `json:"modified"`
+	ModifiedConfig []string `json:"modifiedConfig"`
+	Extra          []string `json:"extra"`
+}
+
+// verifyIssueEvent is emitted in json mode for every file that doesn't match, before the result
+type verifyIssueEvent struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+// execVerify checks the install against the manifest of the installed version and fails if files
+// are missing or damaged
+func execVerify(ctx context.Context, cfg toolsConfig) (result verifyResult, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered verifying install")
+		}
+	}()
+
+	exPath := cfg.InstallDir
+	installed := readInstalledVersion(exPath)
+	if installed == "" {
+		failf(exitVerification, "Could not tell which version is installed, run reinstall to fix the install")
+	}
+
+	manifest, complete := installManifest(ctx, cfg, exPath, installed)
+	result.Version = installed
+	result.Source = "last-update"
+	extraRoots := []string{}
+	if complete {
+		result.Source = "release"
+		extraRoots = []string{"Sys"}
+	}
+
+	fmt.Printf("Verifying %d files of Dolphin %s...\n", len(manifest.Files), installed)
+	res, err := updater.VerifyInstall(ctx, exPath, manifest, extraRoots)
+	if err != nil {
+		failIfCancelled(ctx)
+		failf(exitGeneric, "Failed to verify the install. %s", err.Error())
+	}
+
+	result.Missing = res.Missing
+	result.Extra = res.Extra
+	result.Modified = []string{}
+	result.ModifiedConfig = []string{}
+	for _, path := range res.Modified {
+		if isPreservableConfig(path) {
+			result.ModifiedConfig = append(result.ModifiedConfig, path)
+		} else {
+			result.Modified = append(result.Modified, path)
+		}
+	}
+
+	reportVerifyIssues("missing", result.Missing)
+	reportVerifyIssues("modified", result.Modified)
+	reportVerifyIssues("modified-config", result.ModifiedConfig)
+	reportVerifyIssues("extra", result.Extra)
+
+	if len(result.Missing) > 0 || len(result.Modified) > 0 {
+		failf(exitVerification, "%d files are missing and %d are damaged, run app-update -repair to fix them", len(result.Missing), len(result.Modified))
+	}
+
+	fmt.Println("All files are intact")
+	return result, nil
+}
+
+func reportVerifyIssues(problem string, paths []string) {
+	for _, path := range paths {
+		if jsonOutput {
+			emitEvent(verifyIssueEvent{Type: "verify-issue", Path: path, Problem: problem})
+		}
+		fmt.Printf("%-16s %s\n", problem+":", path)
+	}
+}
+
+// installManifest returns the published manifest of the installed version, falling back to the
+// files recorded by the last update when there is none. complete is false for the latter since a
+// delta update only records the files it changed
+func installManifest(ctx context.Context, cfg toolsConfig, exPath, installed string) (updater.Manifest, bool) {
+	// Only Windows archives are published with a manifest
+	if runtime.GOOS == "windows" {
+		manifest, err := fetchReleaseManifest(ctx, cfg, exPath, installed)
+		if err == nil {
+			return manifest, true
+		}
+		failIfCancelled(ctx)
+		log.Printf("Release manifest not available, checking the files of the last update instead. %s\n", err.Error())
+	}
+
+	local, err := readUpdateManifest(exPath)
+	if err != nil || len(local.Files) == 0 {
+		failf(exitVerification, "No record of the installed files, run reinstall to fix the install")
+	}
+
+	return updater.Manifest{Version: local.Version, Files: local.Files}, false
+}
+
+// fetchReleaseManifest downloads and checks the manifest published with a version
+func fetchReleaseManifest(ctx context.Context, cfg toolsConfig, exPath, version string) (updater.Manifest, error) {
+	var manifest updater.Manifest
+
+	var release slippiapi.DolphinVersion
+	err := queryProviders(ctx, cfg, cfg.versionCacheKey("version:"+version), &release, func(provider slippiapi.Provider) (err error) {
+		release, err = provider.Version(ctx, version)
+		return err
+	})
+	if err != nil {
+		return manifest, err
+	}
+	if release.ManifestURL == "" {
+		return manifest, fmt.Errorf("no manifest published for %s", version)
+	}
+
+	dir, err := createStagingDir(cfg.TempDir, exPath)
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.json")
+	err = cfg.downloader().Download(ctx, path, []string{release.ManifestURL}, "", updater.ValidateManifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = verifyReleaseSignature(path, release.ManifestSignature)
+	if err != nil {
+		return manifest, err
+	}
+
+	manifest, err = updater.ReadManifest(path)
+	if err == nil && manifest.Version != version {
+		err = fmt.Errorf("manifest is for %s instead of %s", manifest.Version, version)
+	}
+
+	// The tools are updated on their own and aren't expected to match the release
+	files := []updater.UpdatedFile{}
+	for _, file := range manifest.Files {
+		if updaterUpdateGen(file.Path) == "" {
+			files = append(files, file)
+		}
+	}
+	manifest.Files = files
+
+	return manifest, err
+}
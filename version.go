@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/project-slippi/dolphin-slippi-tools/internal/semver"
+)
+
+// toolsVersion is set at build time with -ldflags "-X main.toolsVersion=x.y.z"
+var toolsVersion = "dev"
+
+type versionInfo struct {
+	ToolsVersion   string `json:"toolsVersion"`
+	DolphinVersion string `json:"dolphinVersion"`
+}
+
+// readInstalledVersion returns the installed Dolphin version as read from the binary. The version
+// recorded by the last update is preferred while it is the same release, since it is formatted
+// like the API. Returns an empty string if it isn't known
+func readInstalledVersion(exPath string) string {
+	recorded := readRecordedVersion(exPath)
+
+	binary, err := readDolphinBinaryVersion(exPath)
+	if err != nil || binary == "" {
+		if err != nil {
+			logDebugf("Could not read the version of the Dolphin binary. %s", err.Error())
+		}
+		return recorded
+	}
+
+	// Dolphin was replaced without the tools, such as by the launcher
+	if !sameRelease(recorded, binary) {
+		return binary
+	}
+
+	return recorded
+}
+
+// readRecordedVersion returns the version the tools last installed, as recorded in the update
+// manifest
+func readRecordedVersion(exPath string) string {
+	manifest, err := readUpdateManifest(exPath)
+	if err == nil && manifest.Version != "" {
+		return manifest.Version
+	}
+
+	// Installs set up by copying another install don't have the manifest but keep their metadata
+	metadata, err := loadInstallMetadata(exPath)
+	if err != nil {
+		return ""
+	}
+
+	return metadata.Version
+}
+
+// sameVersion reports whether both versions are the same, such that 3.0.0 and v3.0.0+build are
+func sameVersion(a, b string) bool {
+	if semver.IsValid(a) && semver.IsValid(b) {
+		return semver.Compare(a, b) == 0
+	}
+
+	return a == b
+}
+
+// sameRelease reports whether both versions have the same major, minor and patch number. Version
+// resources don't always carry the prerelease
+func sameRelease(a, b string) bool {
+	versionA, errA := semver.Parse(a)
+	versionB, errB := semver.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	return versionA.Major == versionB.Major && versionA.Minor == versionB.Minor && versionA.Patch == versionB.Patch
+}
+
+func execVersion(cfg toolsConfig, asJSON bool) {
+	info := versionInfo{
+		ToolsVersion:   toolsVersion,
+		DolphinVersion: readInstalledVersion(cfg.InstallDir),
+	}
+
+	if asJSON && jsonOutput {
+		emitResult("version", info)
+		return
+	} else if asJSON {
+		contents, err := json.Marshal(info)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(contents))
+		return
+	}
+
+	dolphinVersion := info.DolphinVersion
+	if dolphinVersion == "" {
+		dolphinVersion = "unknown"
+	}
+
+	fmt.Printf("dolphin-slippi-tools: %s\n", info.ToolsVersion)
+	fmt.Printf("Dolphin:              %s\n", dolphinVersion)
+}
+
+// updateAvailable reports whether latest is newer than installed. Versions that can't be compared
+// are only checked for being different
+func updateAvailable(installed, latest string) bool {
+	if !semver.IsValid(installed) || !semver.IsValid(latest) {
+		return latest != installed
+	}
+
+	return semver.Compare(latest, installed) > 0
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSameVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"3.0.0", "3.0.0", true},
+		{"v3.0.0", "3.0.0", true},
+		{"3.0", "3.0.0", true},
+		{"3.0.0+build.5", "3.0.0", true},
+		{"3.0.0-beta.1", "3.0.0", false},
+		{"3.0.1", "3.0.0", false},
+		{"", "3.0.0", false},
+		{"custom", "custom", true},
+		{"custom", "3.0.0", false},
+	}
+
+	for _, test := range tests {
+		if got := sameVersion(test.a, test.b); got != test.want {
+			t.Errorf("sameVersion(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
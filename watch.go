@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/project-slippi/dolphin-slippi-tools/pkg/slippiapi"
+)
+
+// Polling faster than this only hits the cache and the server for nothing
+const minWatchInterval = time.Minute
+
+type watchOptions struct {
+	Interval  time.Duration
+	AutoApply bool
+	Webhook   string
+	Notify    bool
+}
+
+// updateAvailableEvent is emitted in json mode, and posted to the webhook, once per new version
+type updateAvailableEvent struct {
+	Type             string `json:"type"`
+	InstallDir       string `json:"installDir"`
+	InstalledVersion string `json:"installedVersion"`
+	LatestVersion    string `json:"latestVersion"`
+}
+
+// execWatch checks for updates until ctx is cancelled. Each new version is announced once, and
+// with AutoApply installed as soon as Dolphin isn't running
+func execWatch(ctx context.Context, cfg toolsConfig, opts watchOptions) error {
+	if opts.Interval < minWatchInterval {
+		opts.Interval = minWatchInterval
+	}
+
+	log.Printf("Checking for updates every %s\n", opts.Interval)
+
+	announced := ""
+	for {
+		latest, installed, err := watchCheck(ctx, cfg)
+		if err != nil {
+			log.Printf("Warning: failed to check for updates. %s\n", err.Error())
+		} else if latest != installed && !loadState(cfg.InstallDir).isSnoozed(latest) {
+			if latest != announced {
+				announced = latest
+				announceUpdate(cfg, opts, installed, latest)
+			}
+
+			if opts.AutoApply {
+				applyWatchedUpdate(ctx, cfg, latest)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopped watching for updates\n")
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// watchCheck turns the panics of the version lookup into an error such that one failed check
+// doesn't stop the watch
+func watchCheck(ctx context.Context, cfg toolsConfig) (latest, installed string, returnErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returnErr = recoveredError(r, "Error encountered checking for updates")
+		}
+	}()
+
+	installed = readInstalledVersion(cfg.InstallDir)
+	latest = getLatestVersion(ctx, cfg, cfg.channel(installed)).Version
+	if latest == "" {
+		return "", installed, fmt.Errorf("no latest version returned")
+	}
+
+	return latest, installed, nil
+}
+
+func announceUpdate(cfg toolsConfig, opts watchOptions, installed, latest string) {
+	event := updateAvailableEvent{
+		Type:             "update-available",
+		InstallDir:       cfg.InstallDir,
+		InstalledVersion: installed,
+		LatestVersion:    latest,
+	}
+
+	if jsonOutput {
+		emitEvent(event)
+	}
+	fmt.Printf("Update available: %s (installed: %s)\n", latest, installed)
+
+	if opts.Notify {
+		notifyUpdate(cfg, installed, latest)
+	}
+
+	if opts.Webhook != "" {
+		err := sendWebhook(cfg, opts.Webhook, event, discordEmbed{
+			Title: fmt.Sprintf("Dolphin %s is available", latest),
+			Color: discordGray,
+			Fields: []discordField{
+				{Name: "Install", Value: discordValue(cfg.InstallDir)},
+				{Name: "Installed", Value: discordValue(installed), Inline: true},
+			},
+		})
+		if err != nil {
+			log.Printf("Warning: failed to call the webhook. %s\n", err.Error())
+		}
+	}
+}
+
+func postWebhook(cfg toolsConfig, url string, event interface{}) error {
+	contents, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	res, err := cfg.httpClient().Post(url, "application/json", bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &slippiapi.StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	return nil
+}
+
+// applyWatchedUpdate runs app-update as a separate process such that a failed update can't take
+// the watch down with it. Nothing happens while Dolphin is running, the next check tries again
+func applyWatchedUpdate(ctx context.Context, cfg toolsConfig, latest string) {
+	if processes := findDolphinProcesses(cfg.InstallDir); len(processes) > 0 {
+		log.Printf("Dolphin is running, will update to %s once it's closed\n", latest)
+		return
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Printf("Failed to find the tools to run the update. %s\n", err.Error())
+		return
+	}
+
+	log.Printf("Updating to %s\n", latest)
+	args := append([]string{"app-update", "-non-interactive"}, cfg.args()...)
+	cmd := exec.CommandContext(ctx, exePath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+
+	err = cmd.Run()
+	if err != nil {
+		log.Printf("Warning: update to %s failed, retrying on the next check. %s\n", latest, err.Error())
+		return
+	}
+
+	log.Printf("Finished updating to %s\n", latest)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Discord rejects embeds with longer field values
+const discordFieldLimit = 1024
+
+const (
+	discordGreen = 0x2ecc71
+	discordRed   = 0xe74c3c
+	discordGray  = 0x95a5a6
+)
+
+// updateResultEvent is what a generic webhook gets once an update ended
+type updateResultEvent struct {
+	Type       string `json:"type"`
+	Host       string `json:"host"`
+	InstallDir string `json:"installDir"`
+	historyEntry
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields"`
+	Timestamp string         `json:"timestamp,omitempty"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// isDiscordWebhook picks the Discord format when asked to, or for Discord's own webhook urls
+func isDiscordWebhook(cfg toolsConfig, webhook string) bool {
+	switch cfg.WebhookFormat {
+	case "discord":
+		return true
+	case "generic":
+		return false
+	}
+
+	parsed, err := url.Parse(webhook)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(parsed.Hostname(), "ptb."), "canary.")
+	return (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(parsed.Path, "/api/webhooks/")
+}
+
+// sendWebhook posts the event as is to generic webhooks and the message to Discord ones
+func sendWebhook(cfg toolsConfig, webhook string, event interface{}, message discordEmbed) error {
+	if !isDiscordWebhook(cfg, webhook) {
+		return postWebhook(cfg, webhook, event)
+	}
+
+	host, _ := os.Hostname()
+	message.Fields = append([]discordField{{Name: "Machine", Value: discordValue(host), Inline: true}}, message.Fields...)
+	message.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	return postWebhook(cfg, webhook, discordMessage{Username: "Slippi Dolphin", Embeds: []discordEmbed{message}})
+}
+
+// redactWebhook only keeps the host, the path of webhooks like Discord's is the secret
+func redactWebhook(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return raw
+	}
+
+	return parsed.Scheme + "://" + parsed.Host + "/REDACTED"
+}
+
+func discordValue(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	if len(value) > discordFieldLimit {
+		return value[:discordFieldLimit-3] + "..."
+	}
+	return value
+}
+
+// notifyUpdateWebhook tells the update webhook how an update ended, such that whoever looks after
+// many setups hears about the ones that failed. Failing to reach it only warns
+func notifyUpdateWebhook(cfg toolsConfig, entry historyEntry) {
+	if cfg.UpdateWebhook == "" {
+		return
+	}
+
+	host, _ := os.Hostname()
+	event := updateResultEvent{Type: "update-result", Host: host, InstallDir: cfg.InstallDir, historyEntry: entry}
+
+	message := discordEmbed{Fields: []discordField{
+		{Name: "Install", Value: discordValue(cfg.InstallDir)},
+		{Name: "From", Value: discordValue(entry.FromVersion), Inline: true},
+		{Name: "To", Value: discordValue(entry.ToVersion), Inline: true},
+		{Name: "Channel", Value: discordValue(entry.Channel), Inline: true},
+		{Name: "Duration", Value: (time.Duration(entry.Duration * float64(time.Second))).Round(time.Second).String(), Inline: true},
+	}}
+	switch entry.Outcome {
+	case "success":
+		message.Title = fmt.Sprintf("Dolphin %s installed (%s)", entry.ToVersion, entry.Command)
+		message.Color = discordGreen
+	case "cancelled":
+		message.Title = fmt.Sprintf("Dolphin %s cancelled", entry.Command)
+		message.Color = discordGray
+	default:
+		message.Title = fmt.Sprintf("Dolphin %s failed with exit code %d", entry.Command, entry.ExitCode)
+		message.Color = discordRed
+		message.Fields = append(message.Fields, discordField{Name: "Error", Value: discordValue(entry.Error)})
+	}
+
+	err := sendWebhook(cfg, cfg.UpdateWebhook, event, message)
+	if err != nil {
+		log.Printf("Warning: failed to call the update webhook. %s\n", err.Error())
+	}
+}